@@ -0,0 +1,426 @@
+package aiService
+
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AI features whose calls are cached, budgeted and metered
+const (
+	FeaturePricing = "pricing"
+	FeatureRecipes = "recipes"
+)
+
+// ErrBudgetExceeded is returned when a call would take a restaurant over its daily AI budget
+var ErrBudgetExceeded = errors.New("daily AI budget exceeded")
+
+// AICostConfig controls how much AI work runs at once and what it may cost
+type AICostConfig struct {
+	MaxConcurrency int           // bulk evaluations in flight at once
+	CacheTTL       time.Duration // how long cached results are reused
+	CacheSize      int           // most cached results kept
+	// DailyBudget is what a restaurant may spend per UTC day in USD, unless
+	// restaurants.ai_daily_budget says otherwise; 0 means unlimited
+	DailyBudget float64
+	// PriceEvaluationCost is charged for each price recommendation that isn't cached
+	PriceEvaluationCost float64
+	// Token prices in USD per 1,000 tokens, for LLM calls
+	PromptTokenCost     float64
+	CompletionTokenCost float64
+}
+
+// DefaultAICostConfig is used unless SetCostConfig is called
+var DefaultAICostConfig = AICostConfig{
+	MaxConcurrency:      4,
+	CacheTTL:            15 * time.Minute,
+	CacheSize:           5000,
+	DailyBudget:         5,
+	PriceEvaluationCost: 0.001,
+	PromptTokenCost:     0.00015,
+	CompletionTokenCost: 0.0006,
+}
+
+// AICostConfigFromEnv reads AI_MAX_CONCURRENCY, AI_CACHE_TTL_SECONDS, AI_CACHE_SIZE,
+// AI_DAILY_BUDGET, AI_PRICE_EVALUATION_COST, LLM_PROMPT_COST_PER_1K and
+// LLM_COMPLETION_COST_PER_1K over DefaultAICostConfig
+func AICostConfigFromEnv() (AICostConfig, error) {
+	config := DefaultAICostConfig
+
+	ints := []struct {
+		name   string
+		target *int
+	}{
+		{"AI_MAX_CONCURRENCY", &config.MaxConcurrency},
+		{"AI_CACHE_SIZE", &config.CacheSize},
+	}
+	for _, v := range ints {
+		if value := os.Getenv(v.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return config, fmt.Errorf("%s must be a positive number", v.name)
+			}
+			*v.target = n
+		}
+	}
+
+	if value := os.Getenv("AI_CACHE_TTL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return config, errors.New("AI_CACHE_TTL_SECONDS must be zero or a positive number")
+		}
+		config.CacheTTL = time.Duration(seconds) * time.Second
+	}
+
+	floats := []struct {
+		name   string
+		target *float64
+	}{
+		{"AI_DAILY_BUDGET", &config.DailyBudget},
+		{"AI_PRICE_EVALUATION_COST", &config.PriceEvaluationCost},
+		{"LLM_PROMPT_COST_PER_1K", &config.PromptTokenCost},
+		{"LLM_COMPLETION_COST_PER_1K", &config.CompletionTokenCost},
+	}
+	for _, v := range floats {
+		if value := os.Getenv(v.name); value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f < 0 {
+				return config, fmt.Errorf("%s must be zero or a positive number", v.name)
+			}
+			*v.target = f
+		}
+	}
+
+	return config, nil
+}
+
+// FeatureMetrics counts one feature's calls since the server started
+type FeatureMetrics struct {
+	Requests         int     `json:"requests"`
+	CacheHits        int     `json:"cache_hits"`
+	CacheMisses      int     `json:"cache_misses"`
+	HitRate          float64 `json:"hit_rate"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Spend            float64 `json:"spend"`
+	BudgetRejections int     `json:"budget_rejections"`
+}
+
+// AIMetrics are the AI service's cache and spend metrics since it started
+type AIMetrics struct {
+	Since    time.Time                 `json:"since"`
+	Features map[string]FeatureMetrics `json:"features"`
+	Total    FeatureMetrics            `json:"total"`
+}
+
+// AIUsageDay is a restaurant's AI usage for one feature on one UTC day
+type AIUsageDay struct {
+	Day              string  `json:"day"`
+	Feature          string  `json:"feature"`
+	Requests         int     `json:"requests"`
+	CacheHits        int     `json:"cache_hits"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// AIUsage is a restaurant's recent AI usage and today's budget
+type AIUsage struct {
+	RestaurantID int          `json:"restaurant_id"`
+	DailyBudget  float64      `json:"daily_budget"` // 0 means unlimited
+	SpentToday   float64      `json:"spent_today"`
+	Days         []AIUsageDay `json:"days"`
+}
+
+// usage is one call to charge to a restaurant
+type usage struct {
+	cacheHit         bool
+	promptTokens     int
+	completionTokens int
+	cost             float64
+}
+
+// resultCache is a size-bounded LRU cache whose entries expire
+type resultCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	mutex   sync.Mutex
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{size: size, ttl: ttl, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns the cached value for key, if any and not expired
+func (c *resultCache) get(key string, now time.Time) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// put caches value for key, evicting the least recently used entry when full
+func (c *resultCache) put(key string, value interface{}, now time.Time) {
+	if c.ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, value: value, expires: now.Add(c.ttl)}
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expires: now.Add(c.ttl)})
+}
+
+// costController caches AI results, enforces daily budgets and keeps metrics
+type costController struct {
+	config   AICostConfig
+	cache    *resultCache
+	since    time.Time
+	metrics  map[string]*FeatureMetrics
+	reserved map[int]float64 // cost of calls in flight, by restaurant
+	mutex    sync.Mutex
+}
+
+func newCostController(config AICostConfig) *costController {
+	return &costController{
+		config:   config,
+		cache:    newResultCache(config.CacheSize, config.CacheTTL),
+		since:    time.Now(),
+		metrics:  map[string]*FeatureMetrics{},
+		reserved: map[int]float64{},
+	}
+}
+
+// SetCostConfig replaces the AI service's cost configuration, clearing its cache and metrics
+func (s *AIService) SetCostConfig(config AICostConfig) {
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = 1
+	}
+	s.costs = newCostController(config)
+}
+
+// featureMetrics returns a feature's counters; the caller holds the mutex
+func (c *costController) featureMetrics(feature string) *FeatureMetrics {
+	metrics, ok := c.metrics[feature]
+	if !ok {
+		metrics = &FeatureMetrics{}
+		c.metrics[feature] = metrics
+	}
+	return metrics
+}
+
+// tokenCost is what an LLM call with these token counts costs
+func (c *costController) tokenCost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)/1000*c.config.PromptTokenCost + float64(completionTokens)/1000*c.config.CompletionTokenCost
+}
+
+// reserveBudget holds estimate against a restaurant's budget for today until
+// chargeUsage or releaseBudget is called. Reservations keep concurrent calls
+// from overshooting the budget together. Restaurant 0 is never limited.
+func (s *AIService) reserveBudget(restaurantID int, feature string, estimate float64, now time.Time) error {
+	if restaurantID == 0 {
+		return nil
+	}
+
+	// Spending is read under the lock too, so a charge can't land between the read
+	// and the reservation
+	s.costs.mutex.Lock()
+	defer s.costs.mutex.Unlock()
+
+	budget, spent, err := s.getBudget(restaurantID, now)
+	if err != nil {
+		return err
+	}
+
+	if budget > 0 && spent+s.costs.reserved[restaurantID]+estimate > budget {
+		s.costs.featureMetrics(feature).BudgetRejections++
+		return fmt.Errorf("%w: restaurant %d has spent $%.2f of $%.2f today", ErrBudgetExceeded, restaurantID, spent, budget)
+	}
+	s.costs.reserved[restaurantID] += estimate
+	return nil
+}
+
+// releaseBudget drops a reservation made by reserveBudget
+func (s *AIService) releaseBudget(restaurantID int, estimate float64) {
+	if restaurantID == 0 {
+		return
+	}
+
+	s.costs.mutex.Lock()
+	defer s.costs.mutex.Unlock()
+
+	s.costs.reserved[restaurantID] -= estimate
+	if s.costs.reserved[restaurantID] <= 1e-9 {
+		delete(s.costs.reserved, restaurantID)
+	}
+}
+
+// chargeUsage counts a call in the metrics and adds it to the restaurant's usage for today
+func (s *AIService) chargeUsage(restaurantID int, feature string, u usage, now time.Time) {
+	s.costs.mutex.Lock()
+	metrics := s.costs.featureMetrics(feature)
+	metrics.Requests++
+	if u.cacheHit {
+		metrics.CacheHits++
+	} else {
+		metrics.CacheMisses++
+	}
+	metrics.PromptTokens += u.promptTokens
+	metrics.CompletionTokens += u.completionTokens
+	metrics.Spend += u.cost
+	s.costs.mutex.Unlock()
+
+	if restaurantID == 0 || s.db == nil {
+		return
+	}
+
+	cacheHits := 0
+	if u.cacheHit {
+		cacheHits = 1
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO ai_usage (restaurant_id, day, feature, requests, cache_hits, prompt_tokens, completion_tokens, cost)
+		VALUES ($1, $2, $3, 1, $4, $5, $6, $7)
+		ON CONFLICT (restaurant_id, day, feature) DO UPDATE SET
+			requests = ai_usage.requests + 1,
+			cache_hits = ai_usage.cache_hits + EXCLUDED.cache_hits,
+			prompt_tokens = ai_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = ai_usage.completion_tokens + EXCLUDED.completion_tokens,
+			cost = ai_usage.cost + EXCLUDED.cost
+	`, restaurantID, usageDay(now), feature, cacheHits, u.promptTokens, u.completionTokens, u.cost)
+	if err != nil {
+		log.Printf("Failed to record AI usage for restaurant %d: %v", restaurantID, err)
+	}
+}
+
+// getBudget returns a restaurant's daily budget (0 = unlimited) and what it has spent today
+func (s *AIService) getBudget(restaurantID int, now time.Time) (float64, float64, error) {
+	var budget sql.NullFloat64
+	var spent float64
+	err := s.db.QueryRow(`
+		SELECT r.ai_daily_budget,
+			COALESCE((SELECT SUM(cost) FROM ai_usage WHERE restaurant_id = r.id AND day = $2), 0)
+		FROM restaurants r WHERE r.id = $1
+	`, restaurantID, usageDay(now)).Scan(&budget, &spent)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, 0, errors.New("restaurant not found")
+		}
+		return 0, 0, fmt.Errorf("failed to get AI budget: %w", err)
+	}
+
+	if budget.Valid {
+		return budget.Float64, spent, nil
+	}
+	return s.costs.config.DailyBudget, spent, nil
+}
+
+// Metrics returns cache hit rates and spend per feature since the service started
+func (s *AIService) Metrics() AIMetrics {
+	s.costs.mutex.Lock()
+	defer s.costs.mutex.Unlock()
+
+	metrics := AIMetrics{Since: s.costs.since, Features: map[string]FeatureMetrics{}}
+	for feature, counters := range s.costs.metrics {
+		m := *counters
+		m.HitRate = hitRate(m.CacheHits, m.Requests)
+		m.Spend = math.Round(m.Spend*1e6) / 1e6
+		metrics.Features[feature] = m
+
+		metrics.Total.Requests += m.Requests
+		metrics.Total.CacheHits += m.CacheHits
+		metrics.Total.CacheMisses += m.CacheMisses
+		metrics.Total.PromptTokens += m.PromptTokens
+		metrics.Total.CompletionTokens += m.CompletionTokens
+		metrics.Total.Spend += m.Spend
+		metrics.Total.BudgetRejections += m.BudgetRejections
+	}
+	metrics.Total.HitRate = hitRate(metrics.Total.CacheHits, metrics.Total.Requests)
+	metrics.Total.Spend = math.Round(metrics.Total.Spend*1e6) / 1e6
+
+	return metrics
+}
+
+// GetAIUsage returns a restaurant's AI usage over the last days UTC days, newest first
+func (s *AIService) GetAIUsage(restaurantID, days int) (*AIUsage, error) {
+	if days <= 0 {
+		days = 30
+	}
+	now := time.Now()
+
+	budget, spent, err := s.getBudget(restaurantID, now)
+	if err != nil {
+		return nil, err
+	}
+	report := &AIUsage{RestaurantID: restaurantID, DailyBudget: budget, SpentToday: spent, Days: []AIUsageDay{}}
+
+	rows, err := s.db.Query(`
+		SELECT to_char(day, 'YYYY-MM-DD'), feature, requests, cache_hits, prompt_tokens, completion_tokens, cost
+		FROM ai_usage
+		WHERE restaurant_id = $1 AND day > $2
+		ORDER BY day DESC, feature
+	`, restaurantID, usageDay(now.AddDate(0, 0, -days)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day AIUsageDay
+		err := rows.Scan(&day.Day, &day.Feature, &day.Requests, &day.CacheHits, &day.PromptTokens, &day.CompletionTokens, &day.Cost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan AI usage: %w", err)
+		}
+		report.Days = append(report.Days, day)
+	}
+
+	return report, nil
+}
+
+// usageDay is the UTC day usage is counted against
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func hitRate(hits, requests int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return math.Round(float64(hits)/float64(requests)*1000) / 1000
+}
@@ -0,0 +1,367 @@
+package aiService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Demand forecasting tuning. Demand for a weekday and hour is the recency-weighted
+// average of the same slot over the last weeks, shrunk towards the average for that
+// hour across all weekdays while there are few weeks of history.
+const (
+	forecastHistoryWeeks  = 8
+	forecastWeekDecay     = 0.8 // weight of each older week relative to the next
+	forecastSlotShrinkage = 2.0 // weeks of history at which slot and hour averages count equally
+	minForecastData       = 10  // units sold before a history is trusted
+	defaultForecastWindow = 3 * time.Hour
+	maxForecastWindow     = 7 * 24 * time.Hour
+)
+
+// Where a forecast's demand comes from
+const (
+	ForecastBasisCategory        = "category"         // sales of the category
+	ForecastBasisRestaurant      = "restaurant"       // all of the restaurant's sales
+	ForecastBasisRestaurantShare = "restaurant_share" // the category's share of all sales
+	ForecastBasisNone            = "none"             // too little history to go on
+)
+
+const week = 7 * 24 * time.Hour
+
+// HourlySales is the number of units sold in one hour
+type HourlySales struct {
+	Hour  time.Time
+	Units int
+}
+
+// DemandHistory is the sales history a forecast is made from
+type DemandHistory struct {
+	Sales    []HourlySales
+	Since    time.Time // when the history starts, e.g. the restaurant's first order
+	Scale    float64   // applied to the predicted demand, e.g. a category's share of sales
+	Basis    string
+	Timezone string // the restaurant's timezone, which weekdays and hours are taken in
+}
+
+// ForecastInput describes a proposed batch of surplus
+type ForecastInput struct {
+	RestaurantID int       `json:"restaurant_id"`
+	Category     string    `json:"category"`
+	Quantity     int       `json:"quantity"`
+	From         time.Time `json:"from"`  // when the batch goes on sale, default now
+	Until        time.Time `json:"until"` // when it stops selling, default From + 3h
+}
+
+// ForecastSlot is the expected demand for one hour of the forecast window
+type ForecastSlot struct {
+	Start          time.Time `json:"start"`
+	ExpectedDemand float64   `json:"expected_demand"`
+}
+
+// DemandForecast predicts how much of a batch will sell
+type DemandForecast struct {
+	RestaurantID   int            `json:"restaurant_id"`
+	Category       string         `json:"category"`
+	Quantity       int            `json:"quantity"`
+	From           time.Time      `json:"from"`
+	Until          time.Time      `json:"until"`
+	ExpectedDemand float64        `json:"expected_demand"` // units customers would buy if supply were unlimited
+	ExpectedSold   float64        `json:"expected_sold"`   // units of this batch expected to sell
+	LikelySold     int            `json:"likely_sold"`
+	LowSold        int            `json:"low_sold"`  // 10th percentile
+	HighSold       int            `json:"high_sold"` // 90th percentile
+	SellThrough    float64        `json:"sell_through"`
+	Confidence     float64        `json:"confidence"`
+	Basis          string         `json:"basis"`
+	Message        string         `json:"message"`
+	Slots          []ForecastSlot `json:"slots"`
+}
+
+// PredictDemand forecasts sell-through for a batch from a sales history. It is a
+// pure function of its inputs so forecasts are reproducible. Weekdays and hours are
+// taken in the restaurant's local time, so a lunch rush stays in its slot whatever
+// the UTC offset or daylight saving.
+func PredictDemand(history *DemandHistory, input ForecastInput, now time.Time) *DemandForecast {
+	forecast := &DemandForecast{
+		RestaurantID: input.RestaurantID,
+		Category:     input.Category,
+		Quantity:     input.Quantity,
+		From:         input.From,
+		Until:        input.Until,
+		Basis:        history.Basis,
+		Slots:        []ForecastSlot{},
+	}
+	location := restaurantLocation(history.Timezone)
+
+	// Recency-weighted units per weekday and hour, and the weight of the weeks covered
+	var slotUnits [7][24]float64
+	totalUnits := 0
+	for _, sale := range history.Sales {
+		age := now.Sub(sale.Hour)
+		if age < 0 || age >= forecastHistoryWeeks*week {
+			continue
+		}
+		hour := sale.Hour.In(location)
+		slotUnits[hour.Weekday()][hour.Hour()] += math.Pow(forecastWeekDecay, math.Floor(float64(age/week))) * float64(sale.Units)
+		totalUnits += sale.Units
+	}
+
+	weeksCovered := 0
+	weekWeight := 0.0
+	for i := 0; i < forecastHistoryWeeks; i++ {
+		if history.Since.Before(now.Add(-time.Duration(i) * week)) {
+			weeksCovered++
+			weekWeight += math.Pow(forecastWeekDecay, float64(i))
+		}
+	}
+
+	scale := history.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	slotWeight := float64(weeksCovered) / (float64(weeksCovered) + forecastSlotShrinkage)
+
+	rate := func(t time.Time) float64 {
+		if weekWeight == 0 {
+			return 0
+		}
+		t = t.In(location)
+		hourTotal := 0.0
+		for day := 0; day < 7; day++ {
+			hourTotal += slotUnits[day][t.Hour()]
+		}
+		slotRate := slotUnits[t.Weekday()][t.Hour()] / weekWeight
+		hourRate := hourTotal / 7 / weekWeight
+		return (slotWeight*slotRate + (1-slotWeight)*hourRate) * scale
+	}
+
+	// Sum the hourly rates over the window, counting partial hours pro rata
+	for start := input.From; start.Before(input.Until); {
+		end := start.Truncate(time.Hour).Add(time.Hour)
+		if end.After(input.Until) {
+			end = input.Until
+		}
+		demand := rate(start) * end.Sub(start).Hours()
+		forecast.Slots = append(forecast.Slots, ForecastSlot{Start: start, ExpectedDemand: math.Round(demand*100) / 100})
+		forecast.ExpectedDemand += demand
+		start = end
+	}
+
+	// Demand in the window is taken as Poisson, and sales are capped by the batch
+	forecast.ExpectedSold = expectedCappedPoisson(forecast.ExpectedDemand, input.Quantity)
+	forecast.LikelySold = int(math.Round(forecast.ExpectedSold))
+	forecast.LowSold = cappedPoissonQuantile(forecast.ExpectedDemand, input.Quantity, 0.1)
+	forecast.HighSold = cappedPoissonQuantile(forecast.ExpectedDemand, input.Quantity, 0.9)
+	if input.Quantity > 0 {
+		forecast.SellThrough = math.Round(forecast.ExpectedSold/float64(input.Quantity)*100) / 100
+	}
+	forecast.ExpectedDemand = math.Round(forecast.ExpectedDemand*100) / 100
+	forecast.ExpectedSold = math.Round(forecast.ExpectedSold*100) / 100
+
+	if totalUnits < minForecastData {
+		forecast.Basis = ForecastBasisNone
+	}
+	forecast.Confidence = forecastConfidence(forecast.Basis, weeksCovered)
+
+	switch {
+	case forecast.Basis == ForecastBasisNone:
+		forecast.Message = "Not enough order history to forecast yet"
+	case forecast.SellThrough < 0.5:
+		forecast.Message = fmt.Sprintf("You'll likely sell %d of these %d; consider a smaller batch or a deeper discount", forecast.LikelySold, input.Quantity)
+	default:
+		forecast.Message = fmt.Sprintf("You'll likely sell %d of these %d", forecast.LikelySold, input.Quantity)
+	}
+
+	return forecast
+}
+
+// forecastConfidence grows with the weeks of history and how specific the history is
+func forecastConfidence(basis string, weeksCovered int) float64 {
+	if basis == ForecastBasisNone {
+		return 0.1
+	}
+	confidence := 0.3 + 0.05*float64(weeksCovered)
+	switch basis {
+	case ForecastBasisCategory:
+		confidence += 0.15
+	case ForecastBasisRestaurant:
+		confidence += 0.1
+	}
+	return math.Min(math.Round(confidence*100)/100, 0.9)
+}
+
+// poissonPMF returns P(X = k) for X ~ Poisson(lambda)
+func poissonPMF(lambda float64, k int) float64 {
+	if lambda <= 0 {
+		if k == 0 {
+			return 1
+		}
+		return 0
+	}
+	logGamma, _ := math.Lgamma(float64(k) + 1)
+	return math.Exp(-lambda + float64(k)*math.Log(lambda) - logGamma)
+}
+
+// expectedCappedPoisson returns E[min(X, capacity)] for X ~ Poisson(lambda)
+func expectedCappedPoisson(lambda float64, capacity int) float64 {
+	expected, cdf := 0.0, 0.0
+	for k := 0; k < capacity; k++ {
+		cdf += poissonPMF(lambda, k)
+		expected += math.Max(0, 1-cdf)
+	}
+	return expected
+}
+
+// cappedPoissonQuantile returns the p-quantile of min(X, capacity) for X ~ Poisson(lambda)
+func cappedPoissonQuantile(lambda float64, capacity int, p float64) int {
+	cdf := 0.0
+	for k := 0; k < capacity; k++ {
+		cdf += poissonPMF(lambda, k)
+		if cdf >= p {
+			return k
+		}
+	}
+	return capacity
+}
+
+// ForecastDemand forecasts sell-through for a proposed batch of surplus
+func (s *AIService) ForecastDemand(input ForecastInput) (*DemandForecast, error) {
+	now := time.Now()
+	if input.Quantity <= 0 {
+		return nil, errors.New("quantity must be positive")
+	}
+	if input.From.IsZero() {
+		input.From = now
+	}
+	if input.Until.IsZero() {
+		input.Until = input.From.Add(defaultForecastWindow)
+	}
+	if !input.Until.After(input.From) {
+		return nil, errors.New("until must be after from")
+	}
+	if input.Until.Sub(input.From) > maxForecastWindow {
+		return nil, errors.New("forecast window must be at most 7 days")
+	}
+
+	history, err := s.getDemandHistory(input.RestaurantID, input.Category, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return PredictDemand(history, input, now), nil
+}
+
+// ForecastItemSellThrough forecasts how much of an inventory item's remaining
+// quantity will sell before it expires
+func (s *AIService) ForecastItemSellThrough(itemID int) (*DemandForecast, error) {
+	input := ForecastInput{From: time.Now()}
+	var category sql.NullString
+	var expiry sql.NullTime
+
+	err := s.db.QueryRow("SELECT restaurant_id, quantity, category, expiry_time FROM inventory_items WHERE id = $1", itemID).Scan(
+		&input.RestaurantID, &input.Quantity, &category, &expiry,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("inventory item not found")
+		}
+		return nil, fmt.Errorf("failed to get inventory item: %w", err)
+	}
+	input.Category = category.String
+	input.Until = input.From.Add(defaultForecastWindow)
+	if expiry.Valid {
+		if !expiry.Time.After(input.From) {
+			return nil, errors.New("inventory item has already expired")
+		}
+		input.Until = expiry.Time
+		if input.Until.Sub(input.From) > maxForecastWindow {
+			input.Until = input.From.Add(maxForecastWindow)
+		}
+	}
+
+	return s.ForecastDemand(input)
+}
+
+// getDemandHistory loads a restaurant's hourly sales and picks the history to forecast
+// a category from: its own sales when there are enough, otherwise its share of all sales
+func (s *AIService) getDemandHistory(restaurantID int, category string, now time.Time) (*DemandHistory, error) {
+	var since sql.NullTime
+	var timezone string
+	err := s.db.QueryRow(`
+		SELECT MIN(created_at), COALESCE((SELECT timezone FROM restaurants WHERE id = $1), '')
+		FROM orders WHERE restaurant_id = $1
+	`, restaurantID).Scan(&since, &timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	if !since.Valid {
+		return &DemandHistory{Since: now, Scale: 1, Basis: ForecastBasisNone, Timezone: timezone}, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT date_trunc('hour', o.created_at), COALESCE(ii.category, ''), SUM(oi.quantity)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		LEFT JOIN inventory_items ii ON ii.id = oi.inventory_item_id
+		WHERE o.restaurant_id = $1 AND o.status NOT IN ('cancelled', 'refunded') AND o.created_at >= $2
+		GROUP BY 1, 2
+	`, restaurantID, now.Add(-forecastHistoryWeeks*week))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales history: %w", err)
+	}
+	defer rows.Close()
+
+	var all, matching []HourlySales
+	allUnits, matchingUnits := 0, 0
+	categories := map[string]bool{}
+	for rows.Next() {
+		var sale HourlySales
+		var saleCategory string
+		if err := rows.Scan(&sale.Hour, &saleCategory, &sale.Units); err != nil {
+			return nil, fmt.Errorf("failed to scan sales history: %w", err)
+		}
+		all = append(all, sale)
+		allUnits += sale.Units
+		if saleCategory != "" {
+			categories[strings.ToLower(saleCategory)] = true
+		}
+		if category != "" && strings.EqualFold(saleCategory, category) {
+			matching = append(matching, sale)
+			matchingUnits += sale.Units
+		}
+	}
+
+	history := &DemandHistory{Sales: all, Since: since.Time, Scale: 1, Basis: ForecastBasisRestaurant, Timezone: timezone}
+	switch {
+	case category == "":
+	case matchingUnits >= minForecastData:
+		history.Sales = matching
+		history.Basis = ForecastBasisCategory
+	case matchingUnits > 0:
+		history.Scale = float64(matchingUnits) / float64(allUnits)
+		history.Basis = ForecastBasisRestaurantShare
+	default:
+		// A category that never sold gets an even share of the restaurant's sales
+		history.Scale = 1 / math.Max(1, float64(len(categories)))
+		history.Basis = ForecastBasisRestaurantShare
+	}
+
+	return history, nil
+}
+
+// PredictWaste returns the fraction of an inventory item's remaining quantity expected
+// to go unsold before it expires. known is false when there is too little order
+// history to say. It lets restaurantService flag items through WastePredictor.
+func (s *AIService) PredictWaste(itemID int) (risk float64, known bool, err error) {
+	forecast, err := s.ForecastItemSellThrough(itemID)
+	if err != nil {
+		return 0, false, err
+	}
+	if forecast.Basis == ForecastBasisNone {
+		return 0, false, nil
+	}
+	return math.Round((1-forecast.SellThrough)*1000) / 1000, true, nil
+}
@@ -0,0 +1,146 @@
+package aiService
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests' timezones, whatever the machine has installed
+)
+
+func TestPredictDemand(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Friday in New York, the week after clocks went forward on 2026-03-08
+	now := time.Date(2026, 3, 13, 12, 0, 0, 0, newYork)
+	dinner := time.Date(2026, 3, 13, 18, 0, 0, 0, newYork)
+
+	// Five units at 18:00 local on each of the four Fridays before, all in EST
+	var fridays []HourlySales
+	for weeks := 4; weeks >= 1; weeks-- {
+		fridays = append(fridays, HourlySales{Hour: time.Date(2026, 3, 13-7*weeks, 18, 0, 0, 0, newYork), Units: 5})
+	}
+	regular := func(timezone string) *DemandHistory {
+		return &DemandHistory{Sales: fridays, Since: fridays[0].Hour, Scale: 1, Basis: ForecastBasisRestaurant, Timezone: timezone}
+	}
+	lastFriday := time.Date(2026, 3, 6, 18, 0, 0, 0, newYork)
+
+	tests := []struct {
+		name       string
+		history    *DemandHistory
+		from       time.Time
+		until      time.Time
+		demand     float64
+		basis      string
+		confidence float64
+		slots      int
+	}{
+		{
+			name:       "empty history",
+			history:    &DemandHistory{Since: now, Scale: 1, Basis: ForecastBasisNone, Timezone: "America/New_York"},
+			from:       dinner,
+			until:      dinner.Add(3 * time.Hour),
+			demand:     0,
+			basis:      ForecastBasisNone,
+			confidence: 0.1,
+			slots:      3,
+		},
+		{
+			// One week of history: a third slot rate (3), two thirds hour average (3/7)
+			name:       "single observation",
+			history:    &DemandHistory{Sales: []HourlySales{{Hour: lastFriday, Units: 3}}, Since: lastFriday, Scale: 1, Basis: ForecastBasisRestaurant, Timezone: "America/New_York"},
+			from:       dinner,
+			until:      dinner.Add(time.Hour),
+			demand:     1.29,
+			basis:      ForecastBasisNone,
+			confidence: 0.1,
+			slots:      1,
+		},
+		{
+			// Four weeks of history: two thirds slot rate (5), a third hour average (5/7)
+			name:       "weekly pattern across the DST change",
+			history:    regular("America/New_York"),
+			from:       dinner,
+			until:      dinner.Add(2 * time.Hour),
+			demand:     3.57,
+			basis:      ForecastBasisRestaurant,
+			confidence: 0.6,
+			slots:      2,
+		},
+		{
+			name:       "partial hour",
+			history:    regular("America/New_York"),
+			from:       dinner.Add(30 * time.Minute),
+			until:      dinner.Add(time.Hour),
+			demand:     1.79,
+			basis:      ForecastBasisRestaurant,
+			confidence: 0.6,
+			slots:      1,
+		},
+		{
+			name:       "category share",
+			history:    &DemandHistory{Sales: fridays, Since: fridays[0].Hour, Scale: 0.5, Basis: ForecastBasisRestaurantShare, Timezone: "America/New_York"},
+			from:       dinner,
+			until:      dinner.Add(time.Hour),
+			demand:     1.79,
+			basis:      ForecastBasisRestaurantShare,
+			confidence: 0.5,
+			slots:      1,
+		},
+		{
+			// In UTC the sales were at 23:00 and dinner is now at 22:00
+			name:       "UTC buckets miss the slot after the DST change",
+			history:    regular(""),
+			from:       dinner,
+			until:      dinner.Add(time.Hour),
+			demand:     0,
+			basis:      ForecastBasisRestaurant,
+			confidence: 0.6,
+			slots:      1,
+		},
+	}
+
+	for _, test := range tests {
+		input := ForecastInput{RestaurantID: 1, Quantity: 4, From: test.from, Until: test.until}
+		forecast := PredictDemand(test.history, input, now)
+		if forecast.ExpectedDemand != test.demand {
+			t.Errorf("%s: expected demand %v, want %v", test.name, forecast.ExpectedDemand, test.demand)
+		}
+		if forecast.Basis != test.basis {
+			t.Errorf("%s: basis %q, want %q", test.name, forecast.Basis, test.basis)
+		}
+		if forecast.Confidence != test.confidence {
+			t.Errorf("%s: confidence %v, want %v", test.name, forecast.Confidence, test.confidence)
+		}
+		if len(forecast.Slots) != test.slots {
+			t.Errorf("%s: %d slots, want %d", test.name, len(forecast.Slots), test.slots)
+		}
+		if forecast.ExpectedSold > float64(input.Quantity) || forecast.LowSold > forecast.LikelySold || forecast.LikelySold > forecast.HighSold {
+			t.Errorf("%s: inconsistent sales %+v", test.name, forecast)
+		}
+		if again := PredictDemand(test.history, input, now); !reflect.DeepEqual(again, forecast) {
+			t.Errorf("%s: forecast changed between runs: %+v then %+v", test.name, forecast, again)
+		}
+	}
+}
+
+func TestPredictDemandIgnoresSalesOutsideTheHistory(t *testing.T) {
+	now := time.Date(2026, 6, 5, 12, 0, 0, 0, time.UTC)
+	since := now.Add(-forecastHistoryWeeks * week)
+	input := ForecastInput{Quantity: 4, From: now, Until: now.Add(time.Hour)}
+
+	history := &DemandHistory{
+		Sales: []HourlySales{
+			{Hour: since.Add(-week), Units: 50}, // older than the history window
+			{Hour: now.Add(week), Units: 50},    // in the future
+		},
+		Since: since,
+		Scale: 1,
+		Basis: ForecastBasisRestaurant,
+	}
+	forecast := PredictDemand(history, input, now)
+	if forecast.ExpectedDemand != 0 || forecast.Basis != ForecastBasisNone {
+		t.Errorf("got demand %v with basis %q, want 0 with basis %q", forecast.ExpectedDemand, forecast.Basis, ForecastBasisNone)
+	}
+}
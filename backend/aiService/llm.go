@@ -0,0 +1,357 @@
+package aiService
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LLM client defaults
+const (
+	defaultLLMURL     = "https://api.openai.com/v1/chat/completions"
+	defaultLLMModel   = "gpt-4o-mini"
+	defaultLLMTimeout = 30 * time.Second
+	defaultLLMRetries = 2
+	llmRetryBackoff   = 500 * time.Millisecond
+)
+
+// LLMRequest is a single prompt sent to a language model
+type LLMRequest struct {
+	System      string
+	Prompt      string
+	MaxTokens   int
+	Temperature float64
+}
+
+// LLMResponse is a language model's reply and what it cost
+type LLMResponse struct {
+	Text             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LLMClient sends prompts to a language model
+type LLMClient interface {
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+}
+
+// TokenUsage is the running total of what an LLM client has used
+type TokenUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// tokenCounter keeps TokenUsage for a client, safe for concurrent use
+type tokenCounter struct {
+	usage TokenUsage
+	mutex sync.Mutex
+}
+
+func (c *tokenCounter) record(resp *LLMResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.usage.Requests++
+	c.usage.PromptTokens += resp.PromptTokens
+	c.usage.CompletionTokens += resp.CompletionTokens
+}
+
+// Usage returns the tokens used so far
+func (c *tokenCounter) Usage() TokenUsage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.usage
+}
+
+// NewLLMClientFromEnv returns an HTTP client when LLM_API_KEY is set and a fake
+// replaying the recordings in LLM_RECORDINGS otherwise
+func NewLLMClientFromEnv() (LLMClient, error) {
+	if apiKey := os.Getenv("LLM_API_KEY"); apiKey != "" {
+		client := NewHTTPLLMClient(os.Getenv("LLM_API_URL"), apiKey, os.Getenv("LLM_MODEL"))
+		if timeout := os.Getenv("LLM_TIMEOUT_SECONDS"); timeout != "" {
+			seconds, err := strconv.Atoi(timeout)
+			if err != nil || seconds <= 0 {
+				return nil, errors.New("LLM_TIMEOUT_SECONDS must be a positive number")
+			}
+			client.Timeout = time.Duration(seconds) * time.Second
+		}
+		return client, nil
+	}
+
+	if dir := os.Getenv("LLM_RECORDINGS"); dir != "" {
+		return LoadFakeLLMClient(dir)
+	}
+
+	return nil, errors.New("no LLM configured: set LLM_API_KEY or LLM_RECORDINGS")
+}
+
+// HTTPLLMClient talks to an OpenAI-compatible chat completions API
+type HTTPLLMClient struct {
+	tokenCounter
+	URL        string
+	APIKey     string
+	Model      string
+	Timeout    time.Duration // per attempt
+	MaxRetries int
+	HTTPClient *http.Client
+}
+
+// NewHTTPLLMClient creates a client for an OpenAI-compatible API, using defaults for empty url and model
+func NewHTTPLLMClient(url, apiKey, model string) *HTTPLLMClient {
+	if url == "" {
+		url = defaultLLMURL
+	}
+	if model == "" {
+		model = defaultLLMModel
+	}
+	return &HTTPLLMClient{
+		URL:        url,
+		APIKey:     apiKey,
+		Model:      model,
+		Timeout:    defaultLLMTimeout,
+		MaxRetries: defaultLLMRetries,
+		HTTPClient: &http.Client{},
+	}
+}
+
+// chatRequest and chatResponse are the parts of the chat completions API we use
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// retryableError marks failures worth another attempt (rate limits, server errors, timeouts)
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Complete sends a prompt, retrying rate-limited and failed attempts with exponential backoff
+func (c *HTTPLLMClient) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	messages := []chatMessage{}
+	if req.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: req.System})
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: req.Prompt})
+
+	body, err := json.Marshal(chatRequest{
+		Model:       c.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode LLM request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			wait := llmRetryBackoff << (attempt - 1)
+			var retryable *retryableError
+			if errors.As(lastErr, &retryable) && retryable.retryAfter > wait {
+				wait = retryable.retryAfter
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("LLM request cancelled: %w", ctx.Err())
+			}
+		}
+
+		resp, err := c.attempt(ctx, body)
+		if err == nil {
+			c.record(resp)
+			return resp, nil
+		}
+		lastErr = err
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("LLM request failed: %w", lastErr)
+}
+
+// attempt makes one HTTP call, bounded by the client's per-attempt timeout
+func (c *HTTPLLMClient) attempt(ctx context.Context, body []byte) (*LLMResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+
+	if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode >= 500 {
+		retryAfter, _ := strconv.Atoi(httpResp.Header.Get("Retry-After"))
+		return nil, &retryableError{
+			err:        fmt.Errorf("LLM API returned %d: %s", httpResp.StatusCode, strings.TrimSpace(string(respBody))),
+			retryAfter: time.Duration(retryAfter) * time.Second,
+		}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LLM API returned %d: %s", httpResp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var chat chatResponse
+	if err := json.Unmarshal(respBody, &chat); err != nil {
+		return nil, fmt.Errorf("failed to decode LLM response: %w", err)
+	}
+	if len(chat.Choices) == 0 {
+		return nil, errors.New("LLM response has no choices")
+	}
+
+	return &LLMResponse{
+		Text:             chat.Choices[0].Message.Content,
+		Model:            chat.Model,
+		PromptTokens:     chat.Usage.PromptTokens,
+		CompletionTokens: chat.Usage.CompletionTokens,
+	}, nil
+}
+
+// LLMRecording is a recorded LLM reply. It is replayed for prompts containing
+// Match, or for any prompt when Match is empty.
+type LLMRecording struct {
+	Match            string `json:"match"`
+	Response         string `json:"response"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// FakeLLMClient replays recorded responses instead of calling a model. Recordings
+// are tried in order; each one is used once unless it is the last match left.
+type FakeLLMClient struct {
+	tokenCounter
+	recordings []LLMRecording
+	used       []bool
+	requests   []LLMRequest
+	mutex      sync.Mutex
+}
+
+// NewFakeLLMClient creates a fake that replays the given recordings
+func NewFakeLLMClient(recordings ...LLMRecording) *FakeLLMClient {
+	return &FakeLLMClient{recordings: recordings, used: make([]bool, len(recordings))}
+}
+
+// LoadFakeLLMClient creates a fake from every *.json file in dir, each holding an
+// array of LLMRecording, in file name order
+func LoadFakeLLMClient(dir string) (*FakeLLMClient, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LLM recordings: %w", err)
+	}
+
+	var recordings []LLMRecording
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LLM recordings: %w", err)
+		}
+		var fileRecordings []LLMRecording
+		if err := json.Unmarshal(data, &fileRecordings); err != nil {
+			return nil, fmt.Errorf("failed to parse LLM recordings in %s: %w", file, err)
+		}
+		recordings = append(recordings, fileRecordings...)
+	}
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("no LLM recordings found in %s", dir)
+	}
+
+	return NewFakeLLMClient(recordings...), nil
+}
+
+// Complete replays the first unused recording that matches the prompt
+func (f *FakeLLMClient) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	f.requests = append(f.requests, req)
+
+	match := -1
+	for i, recording := range f.recordings {
+		if recording.Match != "" && !strings.Contains(req.Prompt, recording.Match) {
+			continue
+		}
+		if !f.used[i] {
+			match = i
+			break
+		}
+		match = i // reuse the last match once all are used
+	}
+	if match >= 0 {
+		f.used[match] = true
+	}
+	f.mutex.Unlock()
+
+	if match < 0 {
+		return nil, errors.New("no recorded LLM response matches the prompt")
+	}
+
+	recording := f.recordings[match]
+	resp := &LLMResponse{
+		Text:             recording.Response,
+		Model:            "fake",
+		PromptTokens:     recording.PromptTokens,
+		CompletionTokens: recording.CompletionTokens,
+	}
+	f.record(resp)
+
+	return resp, nil
+}
+
+// Requests returns every request the fake has received
+func (f *FakeLLMClient) Requests() []LLMRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]LLMRequest{}, f.requests...)
+}
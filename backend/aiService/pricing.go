@@ -0,0 +1,505 @@
+package aiService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pricing engine tuning. Discounts are fractions of the original price, so a
+// base discount of 0.5 means the engine starts from half price and each factor
+// moves it up or down from there.
+const (
+	baseDiscount       = 0.50
+	sellThroughWindow  = 30 * 24 * time.Hour
+	minSellThroughData = 5 // units sold before sell-through is trusted
+)
+
+// categoryImpacts adjusts the discount by how perishable a category is.
+// Categories are matched by substring so "Fresh Produce" counts as produce.
+var categoryImpacts = []struct {
+	keyword string
+	impact  float64
+}{
+	{"bakery", 0.05},
+	{"bread", 0.05},
+	{"prepared", 0.05},
+	{"meal", 0.05},
+	{"sushi", 0.05},
+	{"seafood", 0.04},
+	{"dairy", 0.03},
+	{"produce", 0.02},
+	{"dessert", 0.00},
+	{"beverage", -0.05},
+	{"drink", -0.05},
+	{"packaged", -0.05},
+	{"pantry", -0.05},
+}
+
+// PricingFactor is one signal that moved a price recommendation
+type PricingFactor struct {
+	Name        string  `json:"name"`
+	Impact      float64 `json:"impact"` // change in discount, e.g. 0.05 = 5 points more off
+	Description string  `json:"description"`
+}
+
+// PricingInput is everything the pricing engine looks at for one item
+type PricingInput struct {
+	ItemID        int
+	RestaurantID  int
+	OriginalPrice float64
+	CurrentPrice  float64
+	Quantity      int
+	Category      string
+	ExpiryTime    *time.Time
+	SoldUnits     int // units of the category sold during the sell-through window
+	ListedUnits   int // SoldUnits plus units of the category currently listed
+	MinPriceRatio float64
+	MaxPriceRatio float64
+	Timezone      string // the restaurant's, for the time of day; UTC when empty or unknown
+}
+
+// PricingLimits are a restaurant's floor and ceiling for surplus prices, as fractions of the original price
+type PricingLimits struct {
+	MinPriceRatio float64 `json:"min_price_ratio"`
+	MaxPriceRatio float64 `json:"max_price_ratio"`
+}
+
+// RecommendPrice works out a surplus price for an item. It is deterministic:
+// the same input and time always give the same recommendation.
+func RecommendPrice(input PricingInput, now time.Time) *PriceRecommendation {
+	var factors []PricingFactor
+	discount := baseDiscount
+
+	add := func(name string, impact float64, description string) {
+		factors = append(factors, PricingFactor{Name: name, Impact: impact, Description: description})
+		discount += impact
+	}
+
+	// Time to expiry matters most: unsold food at expiry is worth nothing
+	if input.ExpiryTime != nil {
+		hours := input.ExpiryTime.Sub(now).Hours()
+		switch expiryBucket(hours) {
+		case expiryPast:
+			add("expiry", 0.15, "Already past its expiry time")
+		case expiryWithinHour:
+			add("expiry", 0.15, "Expires within the hour")
+		case expiryWithinTwoHours:
+			add("expiry", 0.10, fmt.Sprintf("Expires in %.1f hours", hours))
+		case expiryWithinFourHours:
+			add("expiry", 0.05, fmt.Sprintf("Expires in %.1f hours", hours))
+		case expiryWithinDay:
+			add("expiry", 0.00, fmt.Sprintf("Expires in %.0f hours", hours))
+		default:
+			add("expiry", -0.05, "More than a day until expiry")
+		}
+	}
+
+	switch {
+	case input.Quantity >= 10:
+		add("quantity", 0.05, fmt.Sprintf("%d units left to clear", input.Quantity))
+	case input.Quantity >= 5:
+		add("quantity", 0.02, fmt.Sprintf("%d units left", input.Quantity))
+	case input.Quantity == 1:
+		add("quantity", -0.03, "Last unit")
+	}
+
+	if category := strings.ToLower(input.Category); category != "" {
+		for _, c := range categoryImpacts {
+			if strings.Contains(category, c.keyword) {
+				add("category", c.impact, fmt.Sprintf("%s is a %s category", input.Category, perishability(c.impact)))
+				break
+			}
+		}
+	}
+
+	// Sell-through: share of recently listed units in this category that sold
+	if input.SoldUnits >= minSellThroughData && input.ListedUnits > 0 {
+		rate := float64(input.SoldUnits) / float64(input.ListedUnits)
+		description := fmt.Sprintf("%.0f%% sell-through for this category over the last 30 days", rate*100)
+		switch {
+		case rate >= 0.8:
+			add("sell_through", -0.05, description)
+		case rate >= 0.5:
+			add("sell_through", 0.00, description)
+		case rate >= 0.2:
+			add("sell_through", 0.03, description)
+		default:
+			add("sell_through", 0.06, description)
+		}
+	}
+
+	switch timeOfDayBucket(input, now) {
+	case timeOfDayClosing:
+		add("time_of_day", 0.05, "Close to closing time")
+	case timeOfDayPeak:
+		add("time_of_day", -0.03, "Peak meal time")
+	}
+
+	price := input.OriginalPrice * (1 - discount)
+
+	// Keep within the restaurant's floor and ceiling
+	floor := input.OriginalPrice * input.MinPriceRatio
+	ceiling := input.OriginalPrice * input.MaxPriceRatio
+	if price < floor {
+		factors = append(factors, PricingFactor{Name: "price_floor", Impact: (price - floor) / input.OriginalPrice, Description: fmt.Sprintf("Raised to the restaurant's floor of %.0f%% of the original price", input.MinPriceRatio*100)})
+		price = floor
+	}
+	if price > ceiling {
+		factors = append(factors, PricingFactor{Name: "price_ceiling", Impact: (price - ceiling) / input.OriginalPrice, Description: fmt.Sprintf("Lowered to the restaurant's ceiling of %.0f%% of the original price", input.MaxPriceRatio*100)})
+		price = ceiling
+	}
+	price = math.Round(price*100) / 100
+
+	descriptions := make([]string, len(factors))
+	for i, factor := range factors {
+		descriptions[i] = factor.Description
+	}
+	reasoning := fmt.Sprintf("%.0f%% off the original price.", (1-price/input.OriginalPrice)*100)
+	if len(descriptions) > 0 {
+		reasoning += " " + strings.Join(descriptions, "; ") + "."
+	}
+
+	return &PriceRecommendation{
+		ItemID:           strconv.Itoa(input.ItemID),
+		OriginalPrice:    input.OriginalPrice,
+		CurrentPrice:     input.CurrentPrice,
+		RecommendedPrice: price,
+		ConfidenceScore:  pricingConfidence(input),
+		Reasoning:        reasoning,
+		Factors:          factors,
+	}
+}
+
+// Expiry buckets, by hours left until expiry
+const (
+	expiryPast = iota
+	expiryWithinHour
+	expiryWithinTwoHours
+	expiryWithinFourHours
+	expiryWithinDay
+	expiryLater
+)
+
+// expiryBucket returns the expiry bucket RecommendPrice prices hours to expiry in
+func expiryBucket(hours float64) int {
+	switch {
+	case hours <= 0:
+		return expiryPast
+	case hours <= 1:
+		return expiryWithinHour
+	case hours <= 2:
+		return expiryWithinTwoHours
+	case hours <= 4:
+		return expiryWithinFourHours
+	case hours <= 24:
+		return expiryWithinDay
+	default:
+		return expiryLater
+	}
+}
+
+// Time-of-day buckets, in the restaurant's local time
+const (
+	timeOfDayOther = iota
+	timeOfDayPeak
+	timeOfDayClosing
+)
+
+// timeOfDayBucket returns the time-of-day bucket RecommendPrice prices an item in
+func timeOfDayBucket(input PricingInput, now time.Time) int {
+	switch hour := now.In(restaurantLocation(input.Timezone)).Hour(); {
+	case hour >= 20:
+		return timeOfDayClosing
+	case (hour >= 11 && hour < 13) || (hour >= 17 && hour < 19):
+		return timeOfDayPeak
+	default:
+		return timeOfDayOther
+	}
+}
+
+// restaurantLocation loads a restaurant's timezone, falling back to UTC
+func restaurantLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// pricingConfidence grows with the number of real signals behind a recommendation
+func pricingConfidence(input PricingInput) float64 {
+	confidence := 0.5
+	if input.ExpiryTime != nil {
+		confidence += 0.15
+	}
+	if input.Category != "" {
+		confidence += 0.1
+	}
+	if input.SoldUnits >= minSellThroughData {
+		confidence += 0.15
+	}
+	if input.Quantity > 0 {
+		confidence += 0.05
+	}
+	return math.Min(confidence, 0.95)
+}
+
+// perishability describes a category impact in words
+func perishability(impact float64) string {
+	switch {
+	case impact > 0:
+		return "highly perishable"
+	case impact < 0:
+		return "long-life"
+	default:
+		return "moderately perishable"
+	}
+}
+
+// pricingCacheKey identifies the inputs a price recommendation depends on, so items
+// that look the same to the engine share a cached result. Time to expiry and the
+// time of day are keyed by the buckets RecommendPrice prices them in, so a cached
+// price is always the one the engine would give now; only the hours quoted in
+// the reasoning can be those of an earlier item in the same bucket.
+func pricingCacheKey(input PricingInput, now time.Time) string {
+	expiry := -1
+	if input.ExpiryTime != nil {
+		expiry = expiryBucket(input.ExpiryTime.Sub(now).Hours())
+	}
+	return fmt.Sprintf("%s|%.2f|%.2f|%d|%s|%d|%d|%d|%.3f|%.3f|%d",
+		FeaturePricing, input.OriginalPrice, input.CurrentPrice, input.Quantity, input.Category, expiry,
+		input.SoldUnits, input.ListedUnits, input.MinPriceRatio, input.MaxPriceRatio, timeOfDayBucket(input, now))
+}
+
+// GetPriceRecommendation prices a real inventory item and records the recommendation in
+// ai_recommendations. Results are cached by pricingCacheKey; evaluations that miss the
+// cache count against the restaurant's daily AI budget.
+func (s *AIService) GetPriceRecommendation(itemID string) (*PriceRecommendation, error) {
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		return nil, errors.New("invalid item ID")
+	}
+
+	now := time.Now()
+	input, err := s.getPricingInput(id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendation *PriceRecommendation
+	key := pricingCacheKey(*input, now)
+	if cached, ok := s.costs.cache.get(key, now); ok {
+		recommendation = cached.(*PriceRecommendation).clone()
+		recommendation.ItemID = itemID
+		s.chargeUsage(input.RestaurantID, FeaturePricing, usage{cacheHit: true}, now)
+	} else {
+		recommendation, err = s.evaluatePrice(input, now)
+		if err != nil {
+			return nil, err
+		}
+		s.costs.cache.put(key, recommendation.clone(), now)
+	}
+
+	factors, err := json.Marshal(recommendation.Factors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pricing factors: %w", err)
+	}
+
+	err = s.db.QueryRow(`
+		INSERT INTO ai_recommendations (restaurant_id, inventory_item_id, recommended_price, current_price, confidence_score, reasoning, factors)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, input.RestaurantID, input.ItemID, recommendation.RecommendedPrice, input.CurrentPrice, recommendation.ConfidenceScore, recommendation.Reasoning, string(factors)).Scan(
+		&recommendation.ID, &recommendation.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save price recommendation: %w", err)
+	}
+
+	return recommendation, nil
+}
+
+// evaluatePrice makes one budgeted price evaluation. The reservation is only
+// dropped once the restaurant has been charged, so concurrent calls can't slip
+// past the budget in between.
+func (s *AIService) evaluatePrice(input *PricingInput, now time.Time) (*PriceRecommendation, error) {
+	cost := s.costs.config.PriceEvaluationCost
+	if err := s.reserveBudget(input.RestaurantID, FeaturePricing, cost, now); err != nil {
+		return nil, err
+	}
+	defer s.releaseBudget(input.RestaurantID, cost)
+
+	recommendation := RecommendPrice(*input, now)
+	s.chargeUsage(input.RestaurantID, FeaturePricing, usage{cost: cost}, now)
+
+	return recommendation, nil
+}
+
+// getPricingInput loads an inventory item, its restaurant's limits and category sell-through
+func (s *AIService) getPricingInput(itemID int, now time.Time) (*PricingInput, error) {
+	input := PricingInput{ItemID: itemID}
+	var category sql.NullString
+	var expiry sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT i.restaurant_id, i.original_price, i.surplus_price, i.quantity, i.category, i.expiry_time,
+		       r.min_price_ratio, r.max_price_ratio, r.timezone
+		FROM inventory_items i JOIN restaurants r ON r.id = i.restaurant_id
+		WHERE i.id = $1
+	`, itemID).Scan(
+		&input.RestaurantID, &input.OriginalPrice, &input.CurrentPrice, &input.Quantity, &category, &expiry,
+		&input.MinPriceRatio, &input.MaxPriceRatio, &input.Timezone,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("inventory item not found")
+		}
+		return nil, fmt.Errorf("failed to get inventory item: %w", err)
+	}
+	if input.OriginalPrice <= 0 {
+		return nil, errors.New("inventory item has no original price")
+	}
+	input.Category = category.String
+	if expiry.Valid {
+		input.ExpiryTime = &expiry.Time
+	}
+
+	err = s.db.QueryRow(`
+		SELECT
+			COALESCE((
+				SELECT SUM(oi.quantity)
+				FROM order_items oi
+				JOIN orders o ON o.id = oi.order_id
+				JOIN inventory_items ii ON ii.id = oi.inventory_item_id
+				WHERE o.restaurant_id = $1 AND o.status NOT IN ('cancelled', 'refunded')
+				AND o.created_at >= $3 AND COALESCE(ii.category, '') = $2
+			), 0),
+			COALESCE((
+				SELECT SUM(quantity) FROM inventory_items
+				WHERE restaurant_id = $1 AND is_available = true AND COALESCE(category, '') = $2
+			), 0)
+	`, input.RestaurantID, input.Category, now.Add(-sellThroughWindow)).Scan(&input.SoldUnits, &input.ListedUnits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sell-through: %w", err)
+	}
+	input.ListedUnits += input.SoldUnits
+
+	return &input, nil
+}
+
+// clone returns a copy that shares nothing with r
+func (r *PriceRecommendation) clone() *PriceRecommendation {
+	copied := *r
+	copied.Factors = append([]PricingFactor(nil), r.Factors...)
+	return &copied
+}
+
+// GetBulkPriceRecommendations prices several items, at most MaxConcurrency at a time,
+// in the order given. Items that fail, e.g. over budget, are skipped.
+func (s *AIService) GetBulkPriceRecommendations(itemIDs []string) ([]*PriceRecommendation, error) {
+	results := make([]*PriceRecommendation, len(itemIDs))
+	slots := make(chan struct{}, s.costs.config.MaxConcurrency)
+	var wg sync.WaitGroup
+
+	for i, itemID := range itemIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, itemID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			recommendation, err := s.GetPriceRecommendation(itemID)
+			if err != nil {
+				log.Printf("Failed to get recommendation for item %s: %v", itemID, err)
+				return
+			}
+			results[i] = recommendation
+		}(i, itemID)
+	}
+	wg.Wait()
+
+	var recommendations []*PriceRecommendation
+	for _, recommendation := range results {
+		if recommendation != nil {
+			recommendations = append(recommendations, recommendation)
+		}
+	}
+
+	return recommendations, nil
+}
+
+// GetPricingLimits returns a restaurant's price floor and ceiling
+func (s *AIService) GetPricingLimits(restaurantID int) (*PricingLimits, error) {
+	var limits PricingLimits
+	err := s.db.QueryRow("SELECT min_price_ratio, max_price_ratio FROM restaurants WHERE id = $1", restaurantID).Scan(
+		&limits.MinPriceRatio, &limits.MaxPriceRatio,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("restaurant not found")
+		}
+		return nil, fmt.Errorf("failed to get pricing limits: %w", err)
+	}
+
+	return &limits, nil
+}
+
+// UpdateAIBudget sets a restaurant's daily AI budget in USD; nil restores the server default
+func (s *AIService) UpdateAIBudget(restaurantID int, budget *float64) error {
+	if budget != nil && *budget < 0 {
+		return errors.New("ai_daily_budget must not be negative")
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE restaurants SET ai_daily_budget = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, restaurantID, budget)
+	if err != nil {
+		return fmt.Errorf("failed to update AI budget: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New("restaurant not found")
+	}
+
+	return nil
+}
+
+// UpdatePricingLimits sets a restaurant's price floor and ceiling
+func (s *AIService) UpdatePricingLimits(restaurantID int, limits PricingLimits) (*PricingLimits, error) {
+	if limits.MinPriceRatio <= 0 || limits.MaxPriceRatio > 1 || limits.MinPriceRatio > limits.MaxPriceRatio {
+		return nil, errors.New("price ratios must satisfy 0 < min_price_ratio <= max_price_ratio <= 1")
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE restaurants SET min_price_ratio = $2, max_price_ratio = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, restaurantID, limits.MinPriceRatio, limits.MaxPriceRatio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pricing limits: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, errors.New("restaurant not found")
+	}
+
+	return &limits, nil
+}
@@ -0,0 +1,132 @@
+package aiService
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests' timezones, whatever the machine has installed
+)
+
+// factorImpact returns the impact of a named factor and whether it was applied
+func factorImpact(recommendation *PriceRecommendation, name string) (float64, bool) {
+	for _, factor := range recommendation.Factors {
+		if factor.Name == name {
+			return factor.Impact, true
+		}
+	}
+	return 0, false
+}
+
+func TestRecommendPriceTimeOfDay(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		now      time.Time
+		impact   float64
+		applied  bool
+	}{
+		{"morning", "", time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC), 0, false},
+		{"lunch", "", time.Date(2026, 6, 1, 12, 30, 0, 0, time.UTC), -0.03, true},
+		{"afternoon", "", time.Date(2026, 6, 1, 15, 0, 0, 0, time.UTC), 0, false},
+		{"dinner", "", time.Date(2026, 6, 1, 18, 0, 0, 0, time.UTC), -0.03, true},
+		{"after dinner", "", time.Date(2026, 6, 1, 19, 0, 0, 0, time.UTC), 0, false},
+		{"closing time", "", time.Date(2026, 6, 1, 21, 0, 0, 0, time.UTC), 0.05, true},
+		{"unknown timezone is UTC", "Mars/Olympus_Mons", time.Date(2026, 6, 1, 21, 0, 0, 0, time.UTC), 0.05, true},
+		// 01:00 UTC is 21:00 the evening before in New York
+		{"restaurant's evening on a UTC server", "America/New_York", time.Date(2026, 6, 2, 1, 0, 0, 0, time.UTC), 0.05, true},
+		// 21:00 UTC is 06:00 the next morning in Tokyo
+		{"restaurant's morning on a UTC server", "Asia/Tokyo", time.Date(2026, 6, 1, 21, 0, 0, 0, time.UTC), 0, false},
+		{"restaurant's lunch", "Europe/Madrid", time.Date(2026, 6, 1, 10, 30, 0, 0, time.UTC), -0.03, true},
+	}
+
+	for _, test := range tests {
+		input := PricingInput{OriginalPrice: 10, Quantity: 2, MinPriceRatio: 0, MaxPriceRatio: 1, Timezone: test.timezone}
+		recommendation := RecommendPrice(input, test.now)
+		impact, applied := factorImpact(recommendation, "time_of_day")
+		if applied != test.applied || impact != test.impact {
+			t.Errorf("%s: time_of_day impact %v (applied %v), want %v (applied %v)", test.name, impact, applied, test.impact, test.applied)
+		}
+	}
+}
+
+func TestRecommendPriceExpiry(t *testing.T) {
+	now := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC) // no time-of-day factor
+
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		impact float64
+		price  float64
+	}{
+		{"expired", -time.Hour, 0.15, 3.50},
+		{"expiring now", 0, 0.15, 3.50},
+		{"within the hour", 45 * time.Minute, 0.15, 3.50},
+		{"exactly an hour", time.Hour, 0.15, 3.50},
+		{"within two hours", 90 * time.Minute, 0.10, 4.00},
+		{"within four hours", 3 * time.Hour, 0.05, 4.50},
+		{"later today", 10 * time.Hour, 0, 5.00},
+		{"exactly a day", 24 * time.Hour, 0, 5.00},
+		{"more than a day", 30 * time.Hour, -0.05, 5.50},
+	}
+
+	for _, test := range tests {
+		expiry := now.Add(test.expiry)
+		input := PricingInput{OriginalPrice: 10, Quantity: 2, ExpiryTime: &expiry, MinPriceRatio: 0, MaxPriceRatio: 1}
+		recommendation := RecommendPrice(input, now)
+		if impact, applied := factorImpact(recommendation, "expiry"); !applied || impact != test.impact {
+			t.Errorf("%s: expiry impact %v (applied %v), want %v", test.name, impact, applied, test.impact)
+		}
+		if recommendation.RecommendedPrice != test.price {
+			t.Errorf("%s: price %.2f, want %.2f", test.name, recommendation.RecommendedPrice, test.price)
+		}
+	}
+}
+
+func TestRecommendPriceLimitsAndDeterminism(t *testing.T) {
+	now := time.Date(2026, 6, 1, 21, 0, 0, 0, time.UTC)
+	expiry := now.Add(30 * time.Minute)
+	input := PricingInput{OriginalPrice: 10, Quantity: 12, Category: "Bakery", ExpiryTime: &expiry, SoldUnits: 1, ListedUnits: 50, MinPriceRatio: 0.3, MaxPriceRatio: 0.9}
+
+	recommendation := RecommendPrice(input, now)
+	// 0.5 + 0.15 expiry + 0.05 quantity + 0.05 bakery + 0.05 closing = 80% off, raised to the 30% floor
+	if recommendation.RecommendedPrice != 3 {
+		t.Errorf("price %.2f, want the 3.00 floor", recommendation.RecommendedPrice)
+	}
+	if _, applied := factorImpact(recommendation, "price_floor"); !applied {
+		t.Error("price_floor factor missing")
+	}
+	if _, applied := factorImpact(recommendation, "sell_through"); applied {
+		t.Error("sell-through used with too few sales")
+	}
+
+	again := RecommendPrice(input, now)
+	if again.RecommendedPrice != recommendation.RecommendedPrice || again.Reasoning != recommendation.Reasoning {
+		t.Errorf("same input gave %q then %q", recommendation.Reasoning, again.Reasoning)
+	}
+}
+
+func TestPricingCacheKeyFollowsBuckets(t *testing.T) {
+	now := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	key := func(expiresIn time.Duration, at time.Time, timezone string) string {
+		expiry := now.Add(expiresIn)
+		return pricingCacheKey(PricingInput{OriginalPrice: 10, Quantity: 2, ExpiryTime: &expiry, MaxPriceRatio: 1, Timezone: timezone}, at)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		// Both round to 1.0 hours, but price in different buckets
+		{"either side of the one hour threshold", key(57*time.Minute, now, ""), key(63*time.Minute, now, ""), false},
+		{"same expiry bucket", key(5*time.Hour, now, ""), key(20*time.Hour, now, ""), true},
+		{"same time-of-day bucket", key(10*time.Hour, now, ""), key(10*time.Hour, now.Add(time.Hour), ""), true},
+		{"into peak time", key(10*time.Hour, now, ""), key(10*time.Hour, now.Add(3*time.Hour), ""), false},
+		{"restaurant's local time", key(5*time.Hour, now, ""), key(5*time.Hour, now, "Europe/Madrid"), false},
+	}
+
+	for _, test := range tests {
+		if (test.a == test.b) != test.same {
+			t.Errorf("%s: keys %q and %q, want same %v", test.name, test.a, test.b, test.same)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package aiService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Recipe generation settings
+const (
+	recipeTimeout     = 60 * time.Second
+	recipeMaxTokens   = 1200
+	recipeTemperature = 0.7
+
+	recipeRepairAttempts = 1
+)
+
+const recipeSystemPrompt = "You are Creative Kitchen, a chef who turns surplus restaurant food into simple home recipes. You always answer with a single JSON object and nothing else."
+
+// RecipeRequest describes the recipe a customer wants from their surplus ingredients
+type RecipeRequest struct {
+	Ingredients []string `json:"ingredients"`
+	Preference  string   `json:"preference"`
+	Difficulty  string   `json:"difficulty"`
+	Cuisine     string   `json:"cuisine"`
+	Allergens   []string `json:"allergens"` // allergens the recipe must not contain, see userService.Allergens
+
+	// Where the request came from, recorded with rejected recipes. Calls are
+	// charged to the restaurant's AI budget.
+	OfferID      int `json:"-"`
+	UserID       int `json:"-"`
+	RestaurantID int `json:"-"`
+}
+
+// SetLLMClient sets the language model used by Creative Kitchen
+func (s *AIService) SetLLMClient(client LLMClient) {
+	s.llm = client
+}
+
+// BuildRecipePrompt builds the Creative Kitchen prompt for a recipe request
+func BuildRecipePrompt(req RecipeRequest) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Generate a creative recipe using the following surplus ingredients: %s\n\n", strings.Join(req.Ingredients, ", "))
+	if req.Preference != "" {
+		fmt.Fprintf(&b, "User Preference: %s\n", req.Preference)
+	}
+	if req.Difficulty != "" {
+		fmt.Fprintf(&b, "Difficulty Level: %s\n", req.Difficulty)
+	}
+	if req.Cuisine != "" {
+		fmt.Fprintf(&b, "Cuisine Style: %s\n", req.Cuisine)
+	}
+	if len(req.Allergens) > 0 {
+		fmt.Fprintf(&b, "Allergies: %s\n", allergenList(req.Allergens))
+	}
+
+	b.WriteString(`
+Please provide the recipe in the following JSON format:
+{
+  "name": "Recipe Name",
+  "ingredients": ["ingredient1", "ingredient2", ...],
+  "instructions": ["step1", "step2", ...],
+  "prep_time": "X minutes",
+  "cook_time": "X minutes",
+  "difficulty": "easy/medium/hard",
+  "tags": ["tag1", "tag2", ...],
+  "nutritional_info": {
+    "calories": 0,
+    "protein": "0g",
+    "carbs": "0g",
+    "fat": "0g"
+  }
+}
+
+Requirements:
+`)
+	if len(req.Allergens) > 0 {
+		fmt.Fprintf(&b, "- Use all the provided ingredients except any containing %s\n", allergenList(req.Allergens))
+		fmt.Fprintf(&b, "- The recipe must not contain %s in any form, including in ingredients the bag doesn't list\n", allergenList(req.Allergens))
+	} else {
+		b.WriteString("- Use all the provided ingredients\n")
+	}
+	if req.Preference != "" {
+		fmt.Fprintf(&b, "- Consider the user preference: %s\n", req.Preference)
+	}
+	b.WriteString("- Only add pantry staples (salt, pepper, oil, herbs and spices) to the listed ingredients; never add nuts, dairy, eggs, fish, shellfish, soy, sesame or wheat the bag doesn't contain\n")
+	b.WriteString(`- Make it creative and appealing
+- Include clear, step-by-step instructions
+- Suggest appropriate cooking times and difficulty level
+- Add relevant tags for categorization
+- Include basic nutritional information per serving
+
+Please respond with only the JSON object, no additional text.`)
+
+	return b.String()
+}
+
+// allergenList formats allergens for a prompt
+func allergenList(allergens []string) string {
+	names := make([]string, len(allergens))
+	for i, allergen := range allergens {
+		names[i] = allergenName(allergen)
+	}
+	return strings.Join(names, ", ")
+}
+
+// GenerateRecipe asks the language model for a recipe and returns it parsed, validated
+// and checked by the allergen guardrails. Rejected answers are recorded with their reasons.
+func (s *AIService) GenerateRecipe(ctx context.Context, req RecipeRequest) (*Recipe, error) {
+	if s.llm == nil {
+		return nil, errors.New("no LLM client configured")
+	}
+	if len(req.Ingredients) == 0 {
+		return nil, errors.New("at least one ingredient is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, recipeTimeout)
+	defer cancel()
+
+	prompt := BuildRecipePrompt(req)
+	var lastErr error
+
+	// One bounded re-ask: show the model its answer and what was wrong with it
+	for attempt := 0; attempt <= recipeRepairAttempts; attempt++ {
+		resp, err := s.completeRecipe(ctx, req.RestaurantID, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recipe: %w", err)
+		}
+
+		log.Printf("Generated recipe for %d ingredients (%d prompt + %d completion tokens)",
+			len(req.Ingredients), resp.PromptTokens, resp.CompletionTokens)
+
+		recipe, err := checkRecipe(resp.Text, req)
+		if err == nil {
+			return recipe, nil
+		}
+		lastErr = err
+
+		var invalid *RecipeValidationError
+		var unsafe *RecipeSafetyError
+		switch {
+		case errors.As(err, &invalid):
+			s.recordRecipeRejection(req, RejectionInvalid, invalid.Problems, resp.Text)
+			prompt = buildRecipeRepairPrompt(req, resp.Text, invalid.Problems)
+		case errors.As(err, &unsafe):
+			s.recordRecipeRejection(req, RejectionUnsafe, unsafe.Problems, resp.Text)
+			prompt = buildRecipeRepairPrompt(req, resp.Text, unsafe.Problems)
+		default:
+			return nil, fmt.Errorf("failed to generate a valid recipe: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("failed to generate a valid recipe: %w", lastErr)
+}
+
+// completeRecipe makes one budgeted LLM call. The budget is reserved for the
+// worst case, roughly four characters per prompt token and a full completion,
+// and the restaurant is charged for the tokens actually used.
+func (s *AIService) completeRecipe(ctx context.Context, restaurantID int, prompt string) (*LLMResponse, error) {
+	now := time.Now()
+	estimate := s.costs.tokenCost((len(recipeSystemPrompt)+len(prompt))/4, recipeMaxTokens)
+	if err := s.reserveBudget(restaurantID, FeatureRecipes, estimate, now); err != nil {
+		return nil, err
+	}
+	defer s.releaseBudget(restaurantID, estimate)
+
+	resp, err := s.llm.Complete(ctx, LLMRequest{
+		System:      recipeSystemPrompt,
+		Prompt:      prompt,
+		MaxTokens:   recipeMaxTokens,
+		Temperature: recipeTemperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.chargeUsage(restaurantID, FeatureRecipes, usage{
+		promptTokens:     resp.PromptTokens,
+		completionTokens: resp.CompletionTokens,
+		cost:             s.costs.tokenCost(resp.PromptTokens, resp.CompletionTokens),
+	}, now)
+
+	return resp, nil
+}
+
+// buildRecipeRepairPrompt asks the model to correct a recipe that failed validation or the guardrails
+func buildRecipeRepairPrompt(req RecipeRequest, previous string, problems []string) string {
+	var b strings.Builder
+
+	b.WriteString(BuildRecipePrompt(req))
+	b.WriteString("\n\nYour previous answer was:\n")
+	b.WriteString(previous)
+	b.WriteString("\n\nIt could not be used because:\n")
+	for _, problem := range problems {
+		fmt.Fprintf(&b, "- %s\n", problem)
+	}
+	b.WriteString("\nReply with only the corrected JSON object.")
+
+	return b.String()
+}
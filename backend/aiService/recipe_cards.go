@@ -0,0 +1,265 @@
+package aiService
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OfferTypeChefSurprise is the offer type whose ingredients get a recipe card
+const OfferTypeChefSurprise = "chef_surprise"
+
+// RecipePreferences are the preferences a recipe card can be made for. They are a
+// fixed list so cards can be cached and shared; "" means no preference.
+var RecipePreferences = []string{"", "vegetarian", "vegan", "gluten-free", "dairy-free", "low-carb", "quick", "kid-friendly"}
+
+// Recipe card errors
+var (
+	ErrUnsupportedPreference = errors.New("unsupported recipe preference")
+	ErrNotChefSurprise       = errors.New("offer is not a Chef's Surprise")
+)
+
+// RecipeCard is a Creative Kitchen recipe for a Chef's Surprise offer, a customer
+// preference and the allergens the customer avoids
+type RecipeCard struct {
+	ID         int       `json:"id"`
+	OfferID    int       `json:"offer_id"`
+	Preference string    `json:"preference"`
+	Avoids     []string  `json:"avoids"`
+	Recipe     Recipe    `json:"recipe"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// recipeCardLocks serialise generation per card key, so concurrent buyers of the
+// same offer share one LLM call. Keys share a fixed set of locks, see recipeCardLock.
+var recipeCardLocks [64]sync.Mutex
+
+// recipeCardLock returns the lock for a card key
+func recipeCardLock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &recipeCardLocks[h.Sum32()%uint32(len(recipeCardLocks))]
+}
+
+// NormalizeRecipePreference lower-cases a preference and checks it is supported
+func NormalizeRecipePreference(preference string) (string, error) {
+	preference = strings.ToLower(strings.TrimSpace(preference))
+	for _, known := range RecipePreferences {
+		if preference == known {
+			return preference, nil
+		}
+	}
+	return "", ErrUnsupportedPreference
+}
+
+// ParseOfferIngredients reads an offer's ingredients column, a JSON array of
+// strings or, for offers entered by hand, a comma-separated list
+func ParseOfferIngredients(raw string) []string {
+	var values []string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		values = strings.Split(raw, ",")
+	}
+
+	ingredients := []string{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			ingredients = append(ingredients, value)
+		}
+	}
+	return ingredients
+}
+
+// avoidKey is the sorted, comma-separated form of allergens stored with a card
+func avoidKey(allergens []string) string {
+	sorted := append([]string{}, allergens...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// splitAvoidKey reverses avoidKey
+func splitAvoidKey(key string) []string {
+	if key == "" {
+		return []string{}
+	}
+	return strings.Split(key, ",")
+}
+
+// GetRecipeCard returns the recipe card for a Chef's Surprise offer that avoids the
+// given allergens, generating it when there is none for the preference, allergens
+// and current ingredients yet. Cards for earlier ingredients are kept unchanged for
+// the orders they are attached to.
+func (s *AIService) GetRecipeCard(ctx context.Context, offerID int, preference string, avoid []string) (*RecipeCard, error) {
+	return s.getRecipeCard(ctx, offerID, preference, avoid, 0)
+}
+
+// getRecipeCard is GetRecipeCard for a known user, whose id is recorded with rejected recipes
+func (s *AIService) getRecipeCard(ctx context.Context, offerID int, preference string, avoid []string, userID int) (*RecipeCard, error) {
+	preference, err := NormalizeRecipePreference(preference)
+	if err != nil {
+		return nil, err
+	}
+	avoids := avoidKey(avoid)
+
+	var offerType string
+	var rawIngredients sql.NullString
+	var restaurantID int
+	err = s.db.QueryRow("SELECT offer_type, ingredients, COALESCE(restaurant_id, 0) FROM offers WHERE id = $1", offerID).Scan(&offerType, &rawIngredients, &restaurantID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("offer not found")
+		}
+		return nil, fmt.Errorf("failed to get offer: %w", err)
+	}
+	if offerType != OfferTypeChefSurprise {
+		return nil, ErrNotChefSurprise
+	}
+	ingredients := ParseOfferIngredients(rawIngredients.String)
+	if len(ingredients) == 0 {
+		return nil, errors.New("offer has no ingredients")
+	}
+	ingredientKey := strings.Join(ingredients, "\n")
+
+	lock := recipeCardLock(fmt.Sprintf("%d/%s/%s", offerID, preference, avoids))
+	lock.Lock()
+	defer lock.Unlock()
+
+	card, err := s.getCachedRecipeCard(offerID, preference, avoids, ingredientKey)
+	if err != nil {
+		return nil, err
+	}
+	if card != nil {
+		s.chargeUsage(restaurantID, FeatureRecipes, usage{cacheHit: true}, time.Now())
+		return card, nil
+	}
+
+	recipe, err := s.GenerateRecipe(ctx, RecipeRequest{
+		Ingredients:  ingredients,
+		Preference:   preference,
+		Allergens:    splitAvoidKey(avoids),
+		OfferID:      offerID,
+		UserID:       userID,
+		RestaurantID: restaurantID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	recipeJSON, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode recipe: %w", err)
+	}
+
+	card = &RecipeCard{OfferID: offerID, Preference: preference, Avoids: splitAvoidKey(avoids), Recipe: *recipe}
+	err = s.db.QueryRow(`
+		INSERT INTO recipe_cards (offer_id, preference, allergens, ingredients, recipe)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (offer_id, preference, allergens, md5(ingredients)) DO NOTHING
+		RETURNING id, created_at
+	`, offerID, preference, avoids, ingredientKey, recipeJSON).Scan(&card.ID, &card.CreatedAt)
+	if err == sql.ErrNoRows {
+		// Another server saved this version first, use theirs
+		saved, err := s.getCachedRecipeCard(offerID, preference, avoids, ingredientKey)
+		if err == nil && saved == nil {
+			err = errors.New("recipe card vanished after a conflicting save")
+		}
+		return saved, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save recipe card: %w", err)
+	}
+
+	return card, nil
+}
+
+// getCachedRecipeCard returns the stored card for an offer, preference, avoided
+// allergens and ingredients, if any
+func (s *AIService) getCachedRecipeCard(offerID int, preference, avoids, ingredients string) (*RecipeCard, error) {
+	var card RecipeCard
+	var recipeJSON []byte
+	err := s.db.QueryRow(`
+		SELECT id, offer_id, preference, recipe, created_at
+		FROM recipe_cards
+		WHERE offer_id = $1 AND preference = $2 AND allergens = $3 AND md5(ingredients) = md5($4) AND ingredients = $4
+	`, offerID, preference, avoids, ingredients).Scan(&card.ID, &card.OfferID, &card.Preference, &recipeJSON, &card.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get recipe card: %w", err)
+	}
+	if err := json.Unmarshal(recipeJSON, &card.Recipe); err != nil {
+		return nil, fmt.Errorf("failed to decode recipe card: %w", err)
+	}
+	card.Avoids = splitAvoidKey(avoids)
+
+	return &card, nil
+}
+
+// GetRecipeCardByID retrieves a stored recipe card
+func (s *AIService) GetRecipeCardByID(id int) (*RecipeCard, error) {
+	var card RecipeCard
+	var avoids string
+	var recipeJSON []byte
+	err := s.db.QueryRow(`
+		SELECT id, offer_id, preference, allergens, recipe, created_at
+		FROM recipe_cards WHERE id = $1
+	`, id).Scan(&card.ID, &card.OfferID, &card.Preference, &avoids, &recipeJSON, &card.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("recipe card not found")
+		}
+		return nil, fmt.Errorf("failed to get recipe card: %w", err)
+	}
+	if err := json.Unmarshal(recipeJSON, &card.Recipe); err != nil {
+		return nil, fmt.Errorf("failed to decode recipe card: %w", err)
+	}
+	card.Avoids = splitAvoidKey(avoids)
+
+	return &card, nil
+}
+
+// RecipeCardID returns the id of an offer's recipe card for a customer, avoiding the
+// allergens in their profile and generating the card when needed. It lets orders
+// attach cards through orderService.RecipeCardGenerator.
+func (s *AIService) RecipeCardID(ctx context.Context, offerID int, preference string, userID int) (int, error) {
+	avoid, err := s.getUserAllergens(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	card, err := s.getRecipeCard(ctx, offerID, preference, avoid, userID)
+	if err != nil {
+		return 0, err
+	}
+	return card.ID, nil
+}
+
+// getUserAllergens reads a user's allergen profile, see userService.GetAllergens
+func (s *AIService) getUserAllergens(userID int) ([]string, error) {
+	if userID == 0 {
+		return nil, nil
+	}
+
+	rows, err := s.db.Query("SELECT allergen FROM user_allergens WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user allergens: %w", err)
+	}
+	defer rows.Close()
+
+	var allergens []string
+	for rows.Next() {
+		var allergen string
+		if err := rows.Scan(&allergen); err != nil {
+			return nil, fmt.Errorf("failed to scan user allergen: %w", err)
+		}
+		allergens = append(allergens, allergen)
+	}
+
+	return allergens, nil
+}
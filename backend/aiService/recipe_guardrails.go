@@ -0,0 +1,251 @@
+package aiService
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons a generated recipe was rejected, as stored in recipe_rejections
+const (
+	RejectionInvalid = "invalid"
+	RejectionUnsafe  = "unsafe"
+)
+
+// allergenTerms are the words that reveal an allergen in an ingredient, keyed by
+// the names in userService.Allergens. Exclusions are phrases that contain a term
+// without containing the allergen, e.g. "peanut butter" for milk.
+var allergenTerms = map[string]struct {
+	keywords   []string
+	exclusions []string
+}{
+	"milk": {
+		keywords:   []string{"milk", "cheese", "cheddar", "mozzarella", "parmesan", "feta", "ricotta", "brie", "butter", "buttermilk", "cream", "yogurt", "yoghurt", "ghee", "whey", "custard"},
+		exclusions: []string{"peanut butter", "almond butter", "cashew butter", "nut butter", "apple butter", "cocoa butter", "coconut milk", "coconut cream", "almond milk", "oat milk", "soy milk", "rice milk", "cream of tartar"},
+	},
+	"eggs": {
+		keywords: []string{"egg", "mayonnaise", "mayo", "meringue", "aioli"},
+	},
+	"fish": {
+		keywords: []string{"fish", "salmon", "tuna", "cod", "anchovy", "anchovies", "sardine", "trout", "haddock", "mackerel", "tilapia", "halibut", "worcestershire"},
+	},
+	"shellfish": {
+		keywords:   []string{"shrimp", "prawn", "crab", "lobster", "mussel", "clam", "oyster", "scallop", "crayfish", "langoustine"},
+		exclusions: []string{"oyster mushroom"},
+	},
+	"tree_nuts": {
+		keywords: []string{"almond", "walnut", "cashew", "pecan", "hazelnut", "pistachio", "macadamia", "brazil nut", "pine nut", "praline", "marzipan", "pesto"},
+	},
+	"peanuts": {
+		keywords: []string{"peanut", "groundnut", "satay"},
+	},
+	"gluten": {
+		keywords:   []string{"wheat", "flour", "bread", "breadcrumb", "focaccia", "ciabatta", "baguette", "bagel", "brioche", "croissant", "sourdough", "panko", "pasta", "spaghetti", "noodle", "couscous", "barley", "rye", "semolina", "bulgur", "seitan", "tortilla", "pita", "cracker", "crouton", "pastry", "dough", "soy sauce"},
+		exclusions: []string{"rice flour", "almond flour", "coconut flour", "chickpea flour", "corn flour", "corn tortilla", "rice noodle"},
+	},
+	"soy": {
+		keywords: []string{"soy", "soya", "tofu", "edamame", "miso", "tempeh", "tamari"},
+	},
+	"sesame": {
+		keywords: []string{"sesame", "tahini"},
+	},
+}
+
+// allergenPatterns match an allergen's keywords as whole words, plurals included
+var allergenPatterns = compileAllergenPatterns()
+
+func compileAllergenPatterns() map[string]*regexp.Regexp {
+	patterns := map[string]*regexp.Regexp{}
+	for allergen, terms := range allergenTerms {
+		quoted := make([]string, len(terms.keywords))
+		for i, keyword := range terms.keywords {
+			quoted[i] = regexp.QuoteMeta(keyword)
+		}
+		patterns[allergen] = regexp.MustCompile(`\b(?:` + strings.Join(quoted, "|") + `)(?:s|es)?\b`)
+	}
+	return patterns
+}
+
+// pantryStaples are ingredients a recipe may use without the bag listing them
+var pantryStaples = map[string]bool{
+	"salt": true, "pepper": true, "oil": true, "water": true, "vinegar": true, "sugar": true,
+	"spice": true, "herb": true, "seasoning": true, "garlic": true, "onion": true, "lemon": true,
+	"lime": true, "paprika": true, "cumin": true, "oregano": true, "basil": true, "parsley": true,
+	"thyme": true, "chili": true, "cinnamon": true,
+}
+
+// ingredientFillerWords are quantities, units and preparation words ignored when
+// matching a recipe ingredient against the bag
+var ingredientFillerWords = map[string]bool{
+	"cup": true, "tbsp": true, "tsp": true, "tablespoon": true, "teaspoon": true, "gram": true,
+	"pinch": true, "handful": true, "dash": true, "piece": true, "slice": true, "clove": true,
+	"can": true, "bunch": true, "and": true, "for": true, "the": true, "with": true, "taste": true,
+	"fresh": true, "chopped": true, "diced": true, "sliced": true, "minced": true, "grated": true,
+	"cooked": true, "leftover": true, "surplus": true, "large": true, "small": true, "medium": true,
+	"optional": true, "serving": true, "about": true, "into": true, "cut": true, "bag": true,
+}
+
+var wordPattern = regexp.MustCompile(`[a-z]+`)
+
+// DetectAllergens returns the allergens an ingredient or instruction mentions, sorted
+func DetectAllergens(text string) []string {
+	text = strings.ToLower(text)
+
+	found := []string{}
+	for allergen, pattern := range allergenPatterns {
+		candidate := text
+		for _, exclusion := range allergenTerms[allergen].exclusions {
+			candidate = strings.ReplaceAll(candidate, exclusion, " ")
+		}
+		if pattern.MatchString(candidate) {
+			found = append(found, allergen)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// ingredientStems returns the meaningful words of an ingredient in singular form
+func ingredientStems(ingredient string) []string {
+	stems := []string{}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(ingredient), -1) {
+		switch {
+		case strings.HasSuffix(word, "ies") && len(word) > 4:
+			word = strings.TrimSuffix(word, "ies") + "y"
+		case strings.HasSuffix(word, "oes"):
+			word = strings.TrimSuffix(word, "es")
+		case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && len(word) > 3:
+			word = strings.TrimSuffix(word, "s")
+		}
+		if len(word) < 3 || ingredientFillerWords[word] {
+			continue
+		}
+		stems = append(stems, word)
+	}
+	return stems
+}
+
+// RecipeSafetyReport is the outcome of checking a recipe against the bag and the customer's allergens
+type RecipeSafetyReport struct {
+	Allergens []string // allergens the recipe contains
+	Warnings  []string // shown with the recipe
+	Problems  []string // reasons to reject the recipe
+}
+
+// RecipeSafetyError lists why the allergen guardrails rejected a recipe
+type RecipeSafetyError struct {
+	Problems []string
+}
+
+func (e *RecipeSafetyError) Error() string {
+	return "unsafe recipe: " + strings.Join(e.Problems, "; ")
+}
+
+// CheckRecipeSafety cross-checks a recipe against the ingredients in the bag and
+// the allergens the customer must avoid. A recipe is rejected when it brings in an
+// allergen the bag doesn't contain or uses one of the customer's allergens.
+// Unlisted ingredients that aren't pantry staples only produce a warning.
+func CheckRecipeSafety(recipe *Recipe, bagIngredients []string, avoid []string) *RecipeSafetyReport {
+	report := &RecipeSafetyReport{Allergens: []string{}}
+
+	bagStems := map[string]bool{}
+	bagAllergens := map[string]string{} // allergen -> bag ingredient containing it
+	for _, ingredient := range bagIngredients {
+		for _, stem := range ingredientStems(ingredient) {
+			bagStems[stem] = true
+		}
+		for _, allergen := range DetectAllergens(ingredient) {
+			if _, ok := bagAllergens[allergen]; !ok {
+				bagAllergens[allergen] = ingredient
+			}
+		}
+	}
+
+	avoided := map[string]bool{}
+	for _, allergen := range avoid {
+		avoided[allergen] = true
+		if ingredient, ok := bagAllergens[allergen]; ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("The bag itself contains %s (%s), which is in your allergen profile", allergenName(allergen), ingredient))
+		}
+	}
+
+	contained := map[string]bool{}
+	checkAllergens := func(text, what string) {
+		for _, allergen := range DetectAllergens(text) {
+			if !contained[allergen] {
+				contained[allergen] = true
+				report.Allergens = append(report.Allergens, allergen)
+			}
+			if avoided[allergen] {
+				report.Problems = append(report.Problems, fmt.Sprintf("%s %q contains %s, which the customer is allergic to", what, text, allergenName(allergen)))
+			} else if _, inBag := bagAllergens[allergen]; !inBag {
+				report.Problems = append(report.Problems, fmt.Sprintf("%s %q adds %s, which is not in the bag", what, text, allergenName(allergen)))
+			}
+		}
+	}
+
+	for _, ingredient := range recipe.Ingredients {
+		checkAllergens(ingredient, "ingredient")
+
+		listed, staple := false, false
+		for _, stem := range ingredientStems(ingredient) {
+			listed = listed || bagStems[stem]
+			staple = staple || pantryStaples[stem]
+		}
+		if !listed && !staple {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Uses %s, which is not in the bag", ingredient))
+		}
+	}
+	for _, step := range recipe.Instructions {
+		checkAllergens(step, "instruction")
+	}
+
+	sort.Strings(report.Allergens)
+	return report
+}
+
+// allergenName is how an allergen is written in messages
+func allergenName(allergen string) string {
+	return strings.ReplaceAll(allergen, "_", " ")
+}
+
+// checkRecipe parses a model's answer and runs the allergen guardrails on it
+func checkRecipe(text string, req RecipeRequest) (*Recipe, error) {
+	recipe, err := ParseRecipe(text)
+	if err != nil {
+		return nil, err
+	}
+
+	report := CheckRecipeSafety(recipe, req.Ingredients, req.Allergens)
+	if len(report.Problems) > 0 {
+		return nil, &RecipeSafetyError{Problems: report.Problems}
+	}
+	recipe.Allergens = report.Allergens
+	recipe.Warnings = report.Warnings
+
+	return recipe, nil
+}
+
+// recordRecipeRejection stores why a model's answer was not used
+func (s *AIService) recordRecipeRejection(req RecipeRequest, reason string, problems []string, response string) {
+	if s.db == nil {
+		return
+	}
+
+	problemsJSON, err := json.Marshal(problems)
+	if err != nil {
+		log.Printf("Failed to encode recipe rejection: %v", err)
+		return
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO recipe_rejections (offer_id, user_id, preference, reason, problems, response)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5, $6)
+	`, req.OfferID, req.UserID, req.Preference, reason, problemsJSON, response)
+	if err != nil {
+		log.Printf("Failed to record recipe rejection: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package aiService
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// execRecorder is a database connection that records every Exec and supports nothing else
+type execRecorder struct {
+	mutex sync.Mutex
+	execs []recordedExec
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.NamedValue
+}
+
+func (r *execRecorder) Connect(ctx context.Context) (driver.Conn, error) { return r, nil }
+func (r *execRecorder) Driver() driver.Driver                            { return nil }
+func (r *execRecorder) Close() error                                     { return nil }
+
+func (r *execRecorder) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (r *execRecorder) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (r *execRecorder) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.execs = append(r.execs, recordedExec{query: query, args: args})
+	return driver.RowsAffected(1), nil
+}
+
+func (r *execRecorder) recorded(table string) []recordedExec {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var execs []recordedExec
+	for _, exec := range r.execs {
+		if strings.Contains(exec.query, "INSERT INTO "+table) {
+			execs = append(execs, exec)
+		}
+	}
+	return execs
+}
+
+func TestGenerateRecipeRejectsAllergens(t *testing.T) {
+	client, err := LoadFakeLLMClient("testdata/guardrails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &execRecorder{}
+	db := sql.OpenDB(recorder)
+	defer db.Close()
+	service := NewAIService(db)
+	service.SetLLMClient(client)
+
+	recipe, err := service.GenerateRecipe(context.Background(), RecipeRequest{
+		Ingredients: []string{"jasmine rice", "roasted broccoli"},
+		Preference:  "comfort",
+		Allergens:   []string{"peanuts"},
+		OfferID:     7,
+		UserID:      42,
+	})
+	if err != nil {
+		t.Fatalf("GenerateRecipe: %v", err)
+	}
+	if recipe.Name != "Garlic Broccoli Rice" {
+		t.Errorf("got recipe %q, want the repaired Garlic Broccoli Rice", recipe.Name)
+	}
+	if len(recipe.Allergens) != 0 {
+		t.Errorf("got allergens %q, want none", recipe.Allergens)
+	}
+
+	rejections := recorder.recorded("recipe_rejections")
+	if len(rejections) != 1 {
+		t.Fatalf("recorded %d rejections, want 1", len(rejections))
+	}
+	args := rejections[0].args
+	if args[0].Value != int64(7) || args[1].Value != int64(42) || args[2].Value != "comfort" {
+		t.Errorf("recorded rejection for offer %v, user %v, preference %v", args[0].Value, args[1].Value, args[2].Value)
+	}
+	if args[3].Value != RejectionUnsafe {
+		t.Errorf("recorded reason %v, want %q", args[3].Value, RejectionUnsafe)
+	}
+
+	var problems []string
+	if err := json.Unmarshal(args[4].Value.([]byte), &problems); err != nil {
+		t.Fatalf("recorded problems aren't JSON: %v", err)
+	}
+	want := []string{
+		`ingredient "cheddar cheese" adds milk, which is not in the bag`,
+		`ingredient "crushed peanuts" contains peanuts, which the customer is allergic to`,
+		`instruction "Sprinkle with peanuts." contains peanuts, which the customer is allergic to`,
+	}
+	for _, problem := range want {
+		found := false
+		for _, got := range problems {
+			found = found || got == problem
+		}
+		if !found {
+			t.Errorf("recorded problems %q don't include %q", problems, problem)
+		}
+	}
+	if !strings.Contains(args[5].Value.(string), "Cheesy Peanut Rice") {
+		t.Errorf("recorded response %q, want the rejected answer", args[5].Value)
+	}
+}
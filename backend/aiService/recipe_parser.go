@@ -0,0 +1,280 @@
+package aiService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RecipeDifficulties are the difficulty values a recipe may have
+var RecipeDifficulties = []string{"easy", "medium", "hard"}
+
+// RecipeValidationError lists everything wrong with a recipe, so the model can be asked to fix it
+type RecipeValidationError struct {
+	Problems []string
+}
+
+func (e *RecipeValidationError) Error() string {
+	return "invalid recipe: " + strings.Join(e.Problems, "; ")
+}
+
+// ExtractJSONObject returns the first complete JSON object in an LLM reply, skipping
+// markdown fences and any prose around it, including prose with braces of its own.
+// Trailing commas inside the object are removed.
+func ExtractJSONObject(text string) (string, error) {
+	err := errors.New("no JSON object found in response")
+	for start := strings.IndexByte(text, '{'); start >= 0; {
+		object, complete := balancedObject(text[start:])
+		if !complete {
+			err = errors.New("JSON object in response is incomplete")
+			break
+		}
+		object = removeTrailingCommas(object)
+		if json.Valid([]byte(object)) {
+			return object, nil
+		}
+		err = errors.New("response does not contain a valid JSON object")
+
+		next := strings.IndexByte(text[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return "", err
+}
+
+// balancedObject returns the text up to the brace closing the one text starts with
+func balancedObject(text string) (string, bool) {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return text[:i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// removeTrailingCommas drops commas directly before a closing brace or bracket, outside strings
+func removeTrailingCommas(object string) string {
+	var b strings.Builder
+	inString := false
+	escaped := false
+	for i := 0; i < len(object); i++ {
+		c := object[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			next := strings.TrimLeft(object[i+1:], " \t\r\n")
+			if strings.HasPrefix(next, "}") || strings.HasPrefix(next, "]") {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// flexibleStrings accepts a JSON array of strings, or one string with an item per line
+type flexibleStrings []string
+
+func (f *flexibleStrings) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*f = list
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return errors.New("expected a list of strings")
+	}
+	*f = nil
+	for _, line := range strings.Split(single, "\n") {
+		*f = append(*f, line)
+	}
+	return nil
+}
+
+// flexibleInt accepts a JSON number or a string starting with one, e.g. "420 kcal"
+type flexibleInt int
+
+func (f *flexibleInt) UnmarshalJSON(data []byte) error {
+	var number float64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*f = flexibleInt(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.New("expected a number")
+	}
+	digits := strings.TrimSpace(text)
+	end := 0
+	for end < len(digits) && digits[end] >= '0' && digits[end] <= '9' {
+		end++
+	}
+	value, err := strconv.Atoi(digits[:end])
+	if err != nil {
+		return fmt.Errorf("expected a number, got %q", text)
+	}
+	*f = flexibleInt(value)
+	return nil
+}
+
+// rawRecipe is the shape models actually return, before it is cleaned into a Recipe
+type rawRecipe struct {
+	Name            string          `json:"name"`
+	Ingredients     flexibleStrings `json:"ingredients"`
+	Instructions    flexibleStrings `json:"instructions"`
+	PrepTime        string          `json:"prep_time"`
+	CookTime        string          `json:"cook_time"`
+	Difficulty      string          `json:"difficulty"`
+	Tags            flexibleStrings `json:"tags"`
+	NutritionalInfo struct {
+		Calories flexibleInt `json:"calories"`
+		Protein  string      `json:"protein"`
+		Carbs    string      `json:"carbs"`
+		Fat      string      `json:"fat"`
+	} `json:"nutritional_info"`
+}
+
+// ParseRecipe extracts, decodes and validates a recipe from an LLM reply. Validation
+// failures are returned as a *RecipeValidationError.
+func ParseRecipe(llmResponse string) (*Recipe, error) {
+	object, err := ExtractJSONObject(llmResponse)
+	if err != nil {
+		return nil, &RecipeValidationError{Problems: []string{err.Error()}}
+	}
+
+	var raw rawRecipe
+	if err := json.Unmarshal([]byte(object), &raw); err != nil {
+		return nil, &RecipeValidationError{Problems: []string{fmt.Sprintf("response is not valid recipe JSON: %v", err)}}
+	}
+
+	recipe := &Recipe{
+		Name:         strings.TrimSpace(raw.Name),
+		Ingredients:  cleanStrings(raw.Ingredients),
+		Instructions: cleanStrings(raw.Instructions),
+		PrepTime:     strings.TrimSpace(raw.PrepTime),
+		CookTime:     strings.TrimSpace(raw.CookTime),
+		Difficulty:   strings.ToLower(strings.TrimSpace(raw.Difficulty)),
+		Tags:         cleanStrings(raw.Tags),
+		NutritionalInfo: NutritionalInfo{
+			Calories: int(raw.NutritionalInfo.Calories),
+			Protein:  strings.TrimSpace(raw.NutritionalInfo.Protein),
+			Carbs:    strings.TrimSpace(raw.NutritionalInfo.Carbs),
+			Fat:      strings.TrimSpace(raw.NutritionalInfo.Fat),
+		},
+	}
+
+	if err := recipe.Validate(); err != nil {
+		return nil, err
+	}
+
+	return recipe, nil
+}
+
+// cleanStrings trims entries, drops blank ones and strips list markers like "1.",
+// "2)" or "-". A number is only a marker when whitespace follows, so quantities
+// like "1.5 cups" are kept.
+func cleanStrings(values []string) []string {
+	cleaned := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		value = strings.TrimLeft(value, "-*• ")
+		if i := strings.IndexAny(value, ".)"); i > 0 && i <= 3 && i+1 < len(value) && (value[i+1] == ' ' || value[i+1] == '\t') {
+			if _, err := strconv.Atoi(value[:i]); err == nil {
+				value = strings.TrimSpace(value[i+1:])
+			}
+		}
+		if value != "" {
+			cleaned = append(cleaned, value)
+		}
+	}
+	return cleaned
+}
+
+// Validate checks a recipe against the Creative Kitchen schema
+func (r *Recipe) Validate() error {
+	var problems []string
+
+	if strings.TrimSpace(r.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if len(r.Ingredients) == 0 {
+		problems = append(problems, "ingredients must be a non-empty list")
+	}
+	for i, ingredient := range r.Ingredients {
+		if strings.TrimSpace(ingredient) == "" {
+			problems = append(problems, fmt.Sprintf("ingredients[%d] is empty", i))
+		}
+	}
+	if len(r.Instructions) == 0 {
+		problems = append(problems, "instructions must be a non-empty list")
+	}
+	for i, step := range r.Instructions {
+		if strings.TrimSpace(step) == "" {
+			problems = append(problems, fmt.Sprintf("instructions[%d] is empty", i))
+		}
+	}
+
+	knownDifficulty := false
+	for _, difficulty := range RecipeDifficulties {
+		if r.Difficulty == difficulty {
+			knownDifficulty = true
+		}
+	}
+	if !knownDifficulty {
+		problems = append(problems, fmt.Sprintf("difficulty must be one of %s, got %q", strings.Join(RecipeDifficulties, ", "), r.Difficulty))
+	}
+
+	if r.NutritionalInfo.Calories < 0 {
+		problems = append(problems, "nutritional_info.calories must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return &RecipeValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package aiService
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func herbRiceBowl(difficulty string) *Recipe {
+	return &Recipe{
+		Name:            "Herb Rice Bowl",
+		Ingredients:     []string{"rice", "parsley", "lemon"},
+		Instructions:    []string{"Cook the rice.", "Stir in chopped parsley and lemon juice."},
+		PrepTime:        "5 minutes",
+		CookTime:        "15 minutes",
+		Difficulty:      difficulty,
+		Tags:            []string{"vegan"},
+		NutritionalInfo: NutritionalInfo{Calories: 350, Protein: "7g", Carbs: "70g", Fat: "3g"},
+	}
+}
+
+func TestParseRecipeFixtures(t *testing.T) {
+	tests := map[string]struct {
+		want    *Recipe
+		problem string // prefix of the single expected validation problem
+	}{
+		"valid_markdown_fence":    {want: herbRiceBowl("easy")},
+		"valid_surrounding_prose": {want: herbRiceBowl("easy")},
+		"valid_string_lists":      {want: herbRiceBowl("medium")},
+		"valid_trailing_commas":   {want: herbRiceBowl("easy")},
+		"valid_braces_in_strings": {want: &Recipe{
+			Name:            "Curly {Brace} Pasta",
+			Ingredients:     []string{"pasta", `tomato "passata"`},
+			Instructions:    []string{"Boil the pasta.", "Toss with passata } and serve."},
+			PrepTime:        "5 minutes",
+			CookTime:        "10 minutes",
+			Difficulty:      "easy",
+			Tags:            []string{},
+			NutritionalInfo: NutritionalInfo{Calories: 500, Protein: "15g", Carbs: "90g", Fat: "8g"},
+		}},
+		"invalid_empty_ingredients":    {problem: "ingredients must be a non-empty list"},
+		"invalid_missing_instructions": {problem: "instructions must be a non-empty list"},
+		"invalid_no_json":              {problem: "no JSON object found in response"},
+		"invalid_truncated":            {problem: "JSON object in response is incomplete"},
+		"invalid_unknown_difficulty":   {problem: `difficulty must be one of easy, medium, hard, got "expert"`},
+		"invalid_wrong_types":          {problem: "response is not valid recipe JSON"},
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "malformed", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(tests) {
+		t.Errorf("found %d fixtures, want %d", len(files), len(tests))
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		test, ok := tests[name]
+		if !ok {
+			t.Errorf("%s: no expectation for fixture", name)
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipe, err := ParseRecipe(string(data))
+		if test.want != nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			} else if !reflect.DeepEqual(recipe, test.want) {
+				t.Errorf("%s: got %+v, want %+v", name, recipe, test.want)
+			}
+			continue
+		}
+
+		var validationErr *RecipeValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("%s: got error %v, want a RecipeValidationError", name, err)
+			continue
+		}
+		if len(validationErr.Problems) != 1 || !strings.HasPrefix(validationErr.Problems[0], test.problem) {
+			t.Errorf("%s: got problems %q, want %q", name, validationErr.Problems, test.problem)
+		}
+	}
+}
+
+func TestCleanStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"decimal quantity", []string{"1.5 cups rice"}, []string{"1.5 cups rice"}},
+		{"leading zero decimal", []string{"0.5 tsp salt"}, []string{"0.5 tsp salt"}},
+		{"decimal after list marker", []string{"2. 1.5 cups rice"}, []string{"1.5 cups rice"}},
+		{"numbered with dot", []string{"1. Cook the rice.", "2. Serve."}, []string{"Cook the rice.", "Serve."}},
+		{"numbered with parenthesis", []string{"1) Cook the rice.", "10)\tServe."}, []string{"Cook the rice.", "Serve."}},
+		{"bullets", []string{"- rice", "* parsley", "• lemon"}, []string{"rice", "parsley", "lemon"}},
+		{"plain numbers", []string{"2 eggs", "250g flour"}, []string{"2 eggs", "250g flour"}},
+		{"marker without space", []string{"3.Chop"}, []string{"3.Chop"}},
+		{"blank entries", []string{"", "  ", "-", "rice"}, []string{"rice"}},
+	}
+
+	for _, test := range tests {
+		if got := cleanStrings(test.values); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: cleanStrings(%q) = %q, want %q", test.name, test.values, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package aiService
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newFakeRecipeService(t *testing.T, dir string) (*AIService, *FakeLLMClient) {
+	t.Helper()
+	client, err := LoadFakeLLMClient(filepath.Join("testdata", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewAIService(nil)
+	service.SetLLMClient(client)
+	return service, client
+}
+
+func TestGenerateRecipeReplaysRecording(t *testing.T) {
+	service, client := newFakeRecipeService(t, "recordings")
+
+	recipe, err := service.GenerateRecipe(context.Background(), RecipeRequest{
+		Ingredients: []string{"day-old focaccia", "roasted peppers", "cherry tomatoes", "basil"},
+		Preference:  "vegetarian",
+	})
+	if err != nil {
+		t.Fatalf("GenerateRecipe: %v", err)
+	}
+
+	want := &Recipe{
+		Name:        "Roasted Vegetable Focaccia Panzanella",
+		Ingredients: []string{"day-old focaccia", "roasted peppers", "cherry tomatoes", "basil", "olive oil", "red wine vinegar"},
+		Instructions: []string{
+			"Tear the focaccia into bite-sized pieces and toast in a hot oven for 8 minutes.",
+			"Halve the cherry tomatoes and slice the roasted peppers.",
+			"Whisk olive oil and vinegar with a pinch of salt.",
+			"Toss everything together with torn basil and rest for 10 minutes before serving.",
+		},
+		PrepTime:        "10 minutes",
+		CookTime:        "8 minutes",
+		Difficulty:      "easy",
+		Tags:            []string{"vegetarian", "salad", "no-waste"},
+		NutritionalInfo: NutritionalInfo{Calories: 420, Protein: "9g", Carbs: "48g", Fat: "21g"},
+		Allergens:       []string{"gluten"},
+	}
+	if !reflect.DeepEqual(recipe, want) {
+		t.Errorf("got %+v, want %+v", recipe, want)
+	}
+
+	if requests := client.Requests(); len(requests) != 1 {
+		t.Errorf("made %d LLM requests, want 1", len(requests))
+	}
+	if metrics := service.Metrics(); metrics.Features[FeatureRecipes].PromptTokens != 310 {
+		t.Errorf("counted %d prompt tokens, want 310", metrics.Features[FeatureRecipes].PromptTokens)
+	}
+}
+
+func TestGenerateRecipeRepairsInvalidAnswer(t *testing.T) {
+	service, client := newFakeRecipeService(t, "repair")
+
+	recipe, err := service.GenerateRecipe(context.Background(), RecipeRequest{
+		Ingredients: []string{"rice", "parsley"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateRecipe: %v", err)
+	}
+	if want := []string{"Cook the rice.", "Stir in chopped parsley."}; !reflect.DeepEqual(recipe.Instructions, want) {
+		t.Errorf("got instructions %q, want %q", recipe.Instructions, want)
+	}
+
+	requests := client.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("made %d LLM requests, want 2", len(requests))
+	}
+	for _, problem := range []string{"instructions must be a non-empty list", `got "simple"`} {
+		if !strings.Contains(requests[1].Prompt, problem) {
+			t.Errorf("re-ask prompt doesn't mention %q", problem)
+		}
+	}
+}
+
+func TestGenerateRecipeReasksOnce(t *testing.T) {
+	client := NewFakeLLMClient(LLMRecording{Response: "Sorry, I can't help with that."})
+	service := NewAIService(nil)
+	service.SetLLMClient(client)
+
+	_, err := service.GenerateRecipe(context.Background(), RecipeRequest{Ingredients: []string{"rice"}})
+	if err == nil || !strings.Contains(err.Error(), "no JSON object found in response") {
+		t.Errorf("got error %v, want the validation problem", err)
+	}
+	if requests := client.Requests(); len(requests) != 1+recipeRepairAttempts {
+		t.Errorf("made %d LLM requests, want %d", len(requests), 1+recipeRepairAttempts)
+	}
+}
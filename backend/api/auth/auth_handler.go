@@ -1,19 +1,29 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"surplus-supper/backend/emailService"
+	"surplus-supper/backend/geo"
 	"surplus-supper/backend/middleware"
 	"surplus-supper/backend/userService"
+
+	"github.com/gorilla/mux"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
-	userService *userService.UserService
-	authService *userService.AuthService
+	userService  *userService.UserService
+	authService  *userService.AuthService
+	emailService *emailService.EmailService
+	geocoder     geo.Geocoder
 }
 
 // NewAuthHandler creates a new auth handler
@@ -24,6 +34,42 @@ func NewAuthHandler(db *sql.DB) *AuthHandler {
 	}
 }
 
+// SetEmailService sets the service used to send the welcome email on registration
+func (h *AuthHandler) SetEmailService(service *emailService.EmailService) {
+	h.emailService = service
+}
+
+// SetGeocoder sets the geocoder that fills in coordinates for addresses on
+// registration and profile updates, and addresses for coordinates
+func (h *AuthHandler) SetGeocoder(geocoder geo.Geocoder) {
+	h.geocoder = geocoder
+}
+
+// locate fills in coordinates for an address given without them, treating 0, 0 as
+// unset, or the address for coordinates given without one. Only an address the
+// geocoder can't find is an error; if the geocoder is down the input is kept as is.
+func (h *AuthHandler) locate(ctx context.Context, address string, lat, lon float64) (string, float64, float64, error) {
+	if h.geocoder == nil {
+		return address, lat, lon, nil
+	}
+	var latPtr, lonPtr *float64
+	if lat != 0 || lon != 0 {
+		latPtr, lonPtr = &lat, &lon
+	}
+	located, newLat, newLon, err := geo.Locate(ctx, h.geocoder, address, latPtr, lonPtr)
+	if err != nil {
+		if errors.Is(err, geo.ErrAddressNotFound) && strings.TrimSpace(address) != "" {
+			return address, lat, lon, err
+		}
+		log.Printf("Warning: failed to locate %q: %v", address, err)
+		return address, lat, lon, nil
+	}
+	if newLat != nil && newLon != nil {
+		lat, lon = *newLat, *newLon
+	}
+	return located, lat, lon, nil
+}
+
 // RegisterRequest represents the request body for user registration
 type RegisterRequest struct {
 	Email     string  `json:"email"`
@@ -34,6 +80,7 @@ type RegisterRequest struct {
 	Address   string  `json:"address"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	Locale    string  `json:"locale"`
 }
 
 // LoginRequest represents the request body for user login
@@ -67,6 +114,13 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	address, latitude, longitude, err := h.locate(r.Context(), req.Address, req.Latitude, req.Longitude)
+	if err != nil {
+		http.Error(w, "We couldn't find that address", http.StatusBadRequest)
+		return
+	}
+	req.Address, req.Latitude, req.Longitude = address, latitude, longitude
+
 	// Create user
 	input := userService.CreateUserInput{
 		Email:     req.Email,
@@ -77,6 +131,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Address:   req.Address,
 		Latitude:  req.Latitude,
 		Longitude: req.Longitude,
+		Locale:    req.Locale,
 	}
 
 	user, err := h.userService.CreateUser(input)
@@ -85,6 +140,15 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Send welcome email in the background; registration succeeds either way
+	if h.emailService != nil {
+		go func(userID int) {
+			if err := h.emailService.SendWelcome(userID); err != nil {
+				log.Printf("Failed to send welcome email to user %d: %v", userID, err)
+			}
+		}(user.ID)
+	}
+
 	// Generate token
 	token, err := h.authService.GenerateToken(user)
 	if err != nil {
@@ -196,6 +260,13 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	address, latitude, longitude, err := h.locate(r.Context(), req.Address, req.Latitude, req.Longitude)
+	if err != nil {
+		http.Error(w, "We couldn't find that address", http.StatusBadRequest)
+		return
+	}
+	req.Address, req.Latitude, req.Longitude = address, latitude, longitude
+
 	// Update user
 	user, err := h.userService.UpdateUser(userID, req)
 	if err != nil {
@@ -207,6 +278,208 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// AllergensRequest represents the request body for updating the allergen profile
+type AllergensRequest struct {
+	Allergens []string `json:"allergens"`
+}
+
+// Allergens handles getting the authenticated user's allergen profile
+func (h *AuthHandler) Allergens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	allergens, err := h.userService.GetAllergens(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"allergens": allergens,
+		"available": userService.Allergens,
+	})
+}
+
+// UpdateAllergens handles replacing the authenticated user's allergen profile
+func (h *AuthHandler) UpdateAllergens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req AllergensRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	allergens, err := h.userService.UpdateAllergens(userID, req.Allergens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"allergens": allergens,
+		"available": userService.Allergens,
+	})
+}
+
+// FavoriteRestaurantRequest represents the request body for following a restaurant
+type FavoriteRestaurantRequest struct {
+	RestaurantID int `json:"restaurant_id"`
+}
+
+// FavoriteCategoryRequest represents the request body for adding a favorite category
+type FavoriteCategoryRequest struct {
+	Category string `json:"category"`
+}
+
+// FavoriteRestaurants handles listing the restaurants the authenticated user follows
+func (h *AuthHandler) FavoriteRestaurants(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	h.writeFavoriteRestaurants(w, userID)
+}
+
+// AddFavoriteRestaurant handles the authenticated user following a restaurant,
+// which signs them up for its new offers and price drops
+func (h *AuthHandler) AddFavoriteRestaurant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req FavoriteRestaurantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RestaurantID <= 0 {
+		http.Error(w, "restaurant_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.AddFavoriteRestaurant(userID, req.RestaurantID); err != nil {
+		if err.Error() == "restaurant not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFavoriteRestaurants(w, userID)
+}
+
+// RemoveFavoriteRestaurant handles the authenticated user unfollowing a restaurant
+func (h *AuthHandler) RemoveFavoriteRestaurant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	restaurantID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.RemoveFavoriteRestaurant(userID, restaurantID); err != nil {
+		if err.Error() == "favorite restaurant not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFavoriteRestaurants(w, userID)
+}
+
+func (h *AuthHandler) writeFavoriteRestaurants(w http.ResponseWriter, userID int) {
+	favorites, err := h.userService.GetFavoriteRestaurants(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"restaurants": favorites})
+}
+
+// FavoriteCategories handles listing the authenticated user's favorite item categories
+func (h *AuthHandler) FavoriteCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	h.writeFavoriteCategories(w, userID)
+}
+
+// AddFavoriteCategory handles adding an item category to the authenticated user's favorites
+func (h *AuthHandler) AddFavoriteCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req FavoriteCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.AddFavoriteCategory(userID, req.Category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeFavoriteCategories(w, userID)
+}
+
+// RemoveFavoriteCategory handles removing an item category from the authenticated
+// user's favorites
+func (h *AuthHandler) RemoveFavoriteCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.userService.RemoveFavoriteCategory(userID, mux.Vars(r)["category"]); err != nil {
+		if err.Error() == "favorite category not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeFavoriteCategories(w, userID)
+}
+
+func (h *AuthHandler) writeFavoriteCategories(w http.ResponseWriter, userID int) {
+	categories, err := h.userService.GetFavoriteCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"categories": categories})
+}
+
 // RefreshToken handles token refresh
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
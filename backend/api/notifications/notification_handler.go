@@ -0,0 +1,440 @@
+package notifications
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/notificationService"
+	"surplus-supper/backend/userService"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationHandler handles notification-related HTTP requests
+type NotificationHandler struct {
+	notificationService *notificationService.NotificationService
+	authService         *userService.AuthService
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(service *notificationService.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: service,
+		authService:         userService.NewAuthService(),
+	}
+}
+
+// BulkDeleteRequest represents the request body for deleting several notifications
+type BulkDeleteRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// ListNotifications handles listing the authenticated user's notifications, newest first.
+// Query parameters: cursor (next_cursor of the previous page), limit, unread=true.
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	input := notificationService.ListNotificationsInput{
+		UnreadOnly: query.Get("unread") == "true",
+		Cursor:     query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		input.Limit, err = strconv.Atoi(limit)
+		if err != nil || input.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.notificationService.ListNotifications(userID, input)
+	if err != nil {
+		if errors.Is(err, notificationService.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// UnreadCount handles getting the number of unread notifications of the authenticated user
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := h.notificationService.GetUnreadCount(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread_count": count})
+}
+
+// MarkRead handles marking one of the authenticated user's notifications as read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	notification, err := h.notificationService.MarkNotificationAsRead(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notification)
+}
+
+// MarkAllRead handles marking all of the authenticated user's notifications as read
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	updated, err := h.notificationService.MarkAllAsRead(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"updated": updated})
+}
+
+// DeleteNotification handles deleting one of the authenticated user's notifications
+func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.notificationService.DeleteNotification(userID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BulkDelete handles deleting several of the authenticated user's notifications
+func (h *NotificationHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.notificationService.DeleteNotifications(userID, req.IDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// WebSocket handles the real-time notification socket. Browsers can't set an
+// Authorization header on WebSocket requests, so the JWT comes in the token query parameter.
+func (h *NotificationHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token parameter is required", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.authService.ValidateToken(token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	h.notificationService.ServeWebSocket(w, r, claims.UserID)
+}
+
+// ListAlerts handles listing the authenticated user's alert areas
+func (h *NotificationHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := h.notificationService.GetUserAlertSubscriptions(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subscriptions == nil {
+		subscriptions = []*notificationService.AlertSubscription{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// CreateAlert handles saving a new alert area for the authenticated user
+func (h *NotificationHandler) CreateAlert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req notificationService.CreateAlertSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.notificationService.CreateAlertSubscription(userID, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteAlert handles removing one of the authenticated user's alert areas
+func (h *NotificationHandler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.notificationService.DeleteAlertSubscription(userID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPreferences handles getting the authenticated user's notification preferences
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := h.notificationService.GetPreferences(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdatePreferences handles updating the authenticated user's notification preferences
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req notificationService.UpdatePreferencesInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.notificationService.UpdatePreferences(userID, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+var unsubscribeTemplate = template.Must(template.New("unsubscribe").Parse(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Unsubscribe - Surplus Supper</title>
+	<script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="bg-gray-50">
+	<div class="min-h-screen flex items-center justify-center">
+		<div class="max-w-md w-full bg-white rounded-lg shadow-lg p-8 text-center">
+			{{if .Done}}
+			<h2 class="text-2xl font-bold text-gray-900 mb-4">You're unsubscribed</h2>
+			<p class="text-gray-600">We won't email you about this again. You can change this any time in your notification settings.</p>
+			{{else if .Error}}
+			<h2 class="text-2xl font-bold text-gray-900 mb-4">Something went wrong</h2>
+			<p class="text-gray-600">{{.Error}}</p>
+			{{else}}
+			<h2 class="text-2xl font-bold text-gray-900 mb-4">Unsubscribe from emails?</h2>
+			<form method="POST" class="space-y-4">
+				<input type="hidden" name="token" value="{{.Token}}">
+				<input type="hidden" name="type" value="{{.Type}}">
+				<button type="submit" class="w-full bg-green-600 hover:bg-green-700 text-white py-2 px-4 rounded-md font-medium transition-colors">
+					Unsubscribe
+				</button>
+			</form>
+			{{end}}
+		</div>
+	</div>
+</body>
+</html>
+`))
+
+// Unsubscribe handles the unsubscribe link placed in emails. GET shows a confirmation
+// page so link scanners can't unsubscribe anyone; POST (including one-click
+// List-Unsubscribe-Post requests from mail clients) turns email off.
+func (h *NotificationHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Token string
+		Type  string
+		Done  bool
+		Error string
+	}{
+		Token: r.FormValue("token"),
+		Type:  r.FormValue("type"),
+	}
+
+	if data.Token == "" {
+		http.Error(w, "token parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if r.Method == "POST" {
+		if err := h.notificationService.Unsubscribe(data.Token, data.Type); err != nil {
+			data.Error = err.Error()
+			status = http.StatusBadRequest
+		} else {
+			data.Done = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	unsubscribeTemplate.Execute(w, data)
+}
+
+// VAPIDPublicKey handles returning the key browsers pass to PushManager.subscribe
+func (h *NotificationHandler) VAPIDPublicKey(w http.ResponseWriter, r *http.Request) {
+	publicKey := h.notificationService.VAPIDPublicKey()
+	if publicKey == "" {
+		http.Error(w, "Web Push is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"public_key": publicKey,
+	})
+}
+
+// SavePushSubscription handles registering a browser push subscription for the authenticated user
+func (h *NotificationHandler) SavePushSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req notificationService.PushSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.notificationService.SavePushSubscription(userID, req, r.UserAgent())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeletePushSubscription handles removing a browser push subscription of the authenticated user
+func (h *NotificationHandler) DeletePushSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		http.Error(w, "endpoint is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.notificationService.DeletePushSubscription(userID, req.Endpoint); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,210 @@
+package orders
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"surplus-supper/backend/aiService"
+	"surplus-supper/backend/geo"
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/orderService"
+
+	"github.com/gorilla/mux"
+)
+
+// OrderHandler handles order-related HTTP requests
+type OrderHandler struct {
+	orderService *orderService.OrderService
+	aiService    *aiService.AIService
+	geocoder     geo.Geocoder
+}
+
+// NewOrderHandler creates a new order handler
+func NewOrderHandler(orders *orderService.OrderService, ai *aiService.AIService) *OrderHandler {
+	return &OrderHandler{
+		orderService: orders,
+		aiService:    ai,
+	}
+}
+
+// SetGeocoder sets the geocoder used for delivery addresses sent without coordinates
+func (h *OrderHandler) SetGeocoder(geocoder geo.Geocoder) {
+	h.geocoder = geocoder
+}
+
+// CreateOrderRequest represents the request body for placing an order
+type CreateOrderRequest struct {
+	RestaurantID        int                           `json:"restaurant_id"`
+	OrderItems          []orderService.OrderItemInput `json:"order_items"`
+	SpecialInstructions string                        `json:"special_instructions"`
+	RecipePreference    string                        `json:"recipe_preference"`
+	PickupTime          *time.Time                    `json:"pickup_time"`
+	FulfilmentType      string                        `json:"fulfilment_type"`
+	DeliveryAddress     string                        `json:"delivery_address"`
+	DeliveryLatitude    *float64                      `json:"delivery_latitude"`
+	DeliveryLongitude   *float64                      `json:"delivery_longitude"`
+}
+
+// OrderItemDetail is an order item with its Chef's Surprise recipe card, if any
+type OrderItemDetail struct {
+	*orderService.OrderItem
+	RecipeCard *aiService.RecipeCard `json:"recipe_card,omitempty"`
+}
+
+// OrderDetail is an order with its items
+type OrderDetail struct {
+	*orderService.Order
+	Items []OrderItemDetail `json:"items"`
+}
+
+// CreateOrder handles placing an order for the authenticated user
+func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RestaurantID <= 0 || len(req.OrderItems) == 0 {
+		http.Error(w, "restaurant_id and order_items are required", http.StatusBadRequest)
+		return
+	}
+	for _, item := range req.OrderItems {
+		if item.Quantity <= 0 || (item.InventoryItemID > 0) == (item.OfferID > 0) {
+			http.Error(w, "Each order item needs a positive quantity and either inventory_item_id or offer_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	preference, err := aiService.NormalizeRecipePreference(req.RecipePreference)
+	if err != nil {
+		http.Error(w, "Unsupported recipe_preference", http.StatusBadRequest)
+		return
+	}
+
+	if req.FulfilmentType == orderService.FulfilmentDelivery && h.geocoder != nil && req.DeliveryAddress != "" {
+		req.DeliveryAddress, req.DeliveryLatitude, req.DeliveryLongitude, err = geo.Locate(r.Context(), h.geocoder, req.DeliveryAddress, req.DeliveryLatitude, req.DeliveryLongitude)
+		if errors.Is(err, geo.ErrAddressNotFound) {
+			http.Error(w, "We couldn't find that delivery address", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Address lookup is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	order, err := h.orderService.CreateOrder(orderService.CreateOrderInput{
+		UserID:              userID,
+		RestaurantID:        req.RestaurantID,
+		OrderItems:          req.OrderItems,
+		SpecialInstructions: req.SpecialInstructions,
+		RecipePreference:    preference,
+		PickupTime:          req.PickupTime,
+		FulfilmentType:      req.FulfilmentType,
+		DeliveryAddress:     req.DeliveryAddress,
+		DeliveryLatitude:    req.DeliveryLatitude,
+		DeliveryLongitude:   req.DeliveryLongitude,
+	})
+	if errors.Is(err, orderService.ErrSoldOut) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// ListOrders handles listing the authenticated user's orders, newest first
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	orders, err := h.orderService.GetUserOrders(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []*orderService.Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetOrder handles getting one of the authenticated user's orders with its items
+// and their recipe cards. Cards that failed to generate when the order was placed
+// are generated again here.
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderService.GetOrderByID(id)
+	if err != nil || order.UserID != userID {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+
+	items, err := h.orderService.GetOrderItems(order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detail := OrderDetail{Order: order, Items: []OrderItemDetail{}}
+	for _, item := range items {
+		itemDetail := OrderItemDetail{OrderItem: item}
+		if item.OfferType == orderService.OfferTypeChefSurprise {
+			itemDetail.RecipeCard = h.recipeCard(r, order, item)
+		}
+		detail.Items = append(detail.Items, itemDetail)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// recipeCard returns the card attached to a Chef's Surprise item, attaching one
+// first if it is missing. Failures leave the item without a card.
+func (h *OrderHandler) recipeCard(r *http.Request, order *orderService.Order, item *orderService.OrderItem) *aiService.RecipeCard {
+	if item.RecipeCardID == nil {
+		if _, err := h.orderService.AttachRecipeCard(r.Context(), order, item); err != nil {
+			log.Printf("Failed to attach recipe card to order %d: %v", order.ID, err)
+			return nil
+		}
+	}
+
+	card, err := h.aiService.GetRecipeCardByID(*item.RecipeCardID)
+	if err != nil {
+		log.Printf("Failed to get recipe card %d: %v", *item.RecipeCardID, err)
+		return nil
+	}
+	return card
+}
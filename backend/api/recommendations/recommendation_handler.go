@@ -0,0 +1,72 @@
+package recommendations
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/recommendationService"
+)
+
+// RecommendationHandler handles recommendation-related HTTP requests
+type RecommendationHandler struct {
+	recommendationService *recommendationService.RecommendationService
+}
+
+// NewRecommendationHandler creates a new recommendation handler
+func NewRecommendationHandler(service *recommendationService.RecommendationService) *RecommendationHandler {
+	return &RecommendationHandler{recommendationService: service}
+}
+
+// Recommendations handles ranking available surplus for the authenticated user.
+// Query parameters: limit, lat and lng (instead of the profile location), radius_km.
+func (h *RecommendationHandler) Recommendations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	var input recommendationService.RecommendInput
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		input.Limit, err = strconv.Atoi(limit)
+		if err != nil || input.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if radius := query.Get("radius_km"); radius != "" {
+		var err error
+		input.RadiusKm, err = strconv.ParseFloat(radius, 64)
+		if err != nil || input.RadiusKm <= 0 {
+			http.Error(w, "Invalid radius_km", http.StatusBadRequest)
+			return
+		}
+	}
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+		if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			http.Error(w, "lat and lng must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+		input.Latitude, input.Longitude = &lat, &lng
+	}
+
+	recommendations, err := h.recommendationService.Recommend(userID, input)
+	if errors.Is(err, recommendationService.ErrInvalidInput) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendations)
+}
@@ -2,40 +2,72 @@ package rest
 
 import (
 	"database/sql"
+	"errors"
 	"html/template"
 	"log"
-	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"surplus-supper/backend/aiService"
+	"surplus-supper/backend/geo"
+	"surplus-supper/backend/restaurantService"
+	"surplus-supper/backend/userService"
+
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // HTMXHandler handles HTMX requests for server-side rendering
 type HTMXHandler struct {
-	db *sql.DB
+	db          *sql.DB
+	aiService   *aiService.AIService
+	restaurants *restaurantService.RestaurantService
+	geocoder    geo.Geocoder
 }
 
-// NewHTMXHandler creates a new HTMX handler
+// NewHTMXHandler creates a new HTMX handler. Addresses are geocoded offline with the
+// bundled gazetteer until SetGeocoder is called.
 func NewHTMXHandler(db *sql.DB) *HTMXHandler {
-	return &HTMXHandler{db: db}
+	h := &HTMXHandler{db: db, restaurants: restaurantService.NewRestaurantService(db)}
+	if gazetteer, err := geo.DefaultGazetteer(); err != nil {
+		log.Printf("Warning: address lookup disabled: %v", err)
+	} else {
+		h.geocoder = geo.NewCachedGeocoder(gazetteer, geo.DefaultGeocodeCacheTTL, geo.DefaultGeocodeCacheSize)
+	}
+	return h
+}
+
+// SetGeocoder sets the geocoder for restaurant addresses and location searches
+func (h *HTMXHandler) SetGeocoder(geocoder geo.Geocoder) {
+	h.geocoder = geocoder
+}
+
+// SetAIService sets the AI service used for Chef's Surprise recipe cards
+func (h *HTMXHandler) SetAIService(service *aiService.AIService) {
+	h.aiService = service
 }
 
 // Restaurant represents a restaurant for the frontend
 type Restaurant struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Address     string  `json:"address"`
-	Latitude    float64 `json:"latitude"`
-	Longitude   float64 `json:"longitude"`
-	Phone       string  `json:"phone"`
-	Email       string  `json:"email"`
-	CuisineType string  `json:"cuisine_type"`
-	Rating      float64 `json:"rating"`
-	Distance    float64 `json:"distance"`
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	Address       string  `json:"address"`
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	Phone         string  `json:"phone"`
+	Email         string  `json:"email"`
+	CuisineType   string  `json:"cuisine_type"`
+	Rating        float64 `json:"rating"`
+	ReviewCount   int     `json:"review_count"`
+	Distance      float64 `json:"distance"`
+	BestDiscount  float64 `json:"best_discount_percent,omitempty"`
+	CheapestPrice float64 `json:"cheapest_price,omitempty"`
+	IsOpenNow     bool    `json:"is_open_now"`
+	NextOpen      string  `json:"next_open,omitempty"` // e.g. "Mon 17:00", restaurant local time
 }
 
 // InventoryItem represents an inventory item for the frontend
@@ -49,17 +81,19 @@ type InventoryItem struct {
 	Category      string    `json:"category"`
 	ExpiryTime    time.Time `json:"expiry_time"`
 	Discount      float64   `json:"discount"`
+	AtRisk        bool      `json:"at_risk"`
 }
 
 // Offer represents an offer for the frontend
 type Offer struct {
-	ID            int     `json:"id"`
-	Name          string  `json:"name"`
-	Description   string  `json:"description"`
-	OriginalPrice float64 `json:"original_price"`
-	SurplusPrice  float64 `json:"surplus_price"`
-	OfferType     string  `json:"offer_type"`
-	Discount      float64 `json:"discount"`
+	ID            int      `json:"id"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	OriginalPrice float64  `json:"original_price"`
+	SurplusPrice  float64  `json:"surplus_price"`
+	OfferType     string   `json:"offer_type"`
+	Discount      float64  `json:"discount"`
+	Ingredients   []string `json:"ingredients"`
 }
 
 // Order represents an order for the frontend
@@ -86,13 +120,68 @@ type RestaurantListData struct {
 	SearchQuery string
 	Latitude    float64
 	Longitude   float64
+	Cursor      string // cursor this page was loaded from, empty for the first page
+	NextCursor  string
+	Sort        string
+	Sorts       []SortOption
+	Cuisine     string
+	Price       string
+	OfferType   string
+	Facets      restaurantService.ListingFacets
 }
 
+// listURL is the restaurant list URL for this page's location, sort and filters
+// with one parameter changed, or removed when value is empty. Changing anything
+// but the cursor starts again from the first page.
+func (d RestaurantListData) listURL(key, value string) string {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(d.Latitude, 'f', -1, 64))
+	params.Set("lng", strconv.FormatFloat(d.Longitude, 'f', -1, 64))
+	for name, current := range map[string]string{"sort": d.Sort, "cuisine": d.Cuisine, "price": d.Price, "offer_type": d.OfferType} {
+		if current != "" {
+			params.Set(name, current)
+		}
+	}
+	if value == "" {
+		params.Del(key)
+	} else {
+		params.Set(key, value)
+	}
+	return "/restaurants?" + params.Encode()
+}
+
+// SortOption is a restaurant list sort order
+type SortOption struct {
+	Value string
+	Label string
+}
+
+// restaurantListSorts are the sort orders offered on the restaurant list
+var restaurantListSorts = []SortOption{
+	{Value: restaurantService.SortDistance, Label: "Nearest"},
+	{Value: restaurantService.SortRating, Label: "Top rated"},
+	{Value: restaurantService.SortDiscount, Label: "Biggest discount"},
+	{Value: restaurantService.SortExpiry, Label: "Ending soonest"},
+	{Value: restaurantService.SortPrice, Label: "Cheapest"},
+}
+
+// restaurantListRadiusKm and restaurantListPageSize bound the restaurant list search
+const (
+	restaurantListRadiusKm = 10
+	restaurantListPageSize = 10
+)
+
+// restaurantDetailReviews is how many of the latest reviews the restaurant page shows
+const restaurantDetailReviews = 10
+
 // RestaurantDetailData represents data for the restaurant detail page
 type RestaurantDetailData struct {
-	Restaurant     Restaurant
-	InventoryItems []InventoryItem
-	Offers         []Offer
+	Restaurant        Restaurant
+	InventoryItems    []InventoryItem
+	Offers            []Offer
+	RecipePreferences []string
+	Allergens         []string
+	Reviews           []*restaurantService.Review
 }
 
 // DashboardData represents data for the restaurant dashboard
@@ -373,24 +462,61 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 			longitude = lng
 		}
 		log.Printf("Using coordinates: %f, %f (Location: %s)", latitude, longitude, location)
+	} else if location != "" && h.geocoder != nil {
+		place, err := h.geocoder.Geocode(r.Context(), location)
+		if errors.Is(err, geo.ErrAddressNotFound) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<div class="text-center text-gray-600 p-4">We couldn't find "` + template.HTMLEscapeString(location) + `". Try a street address or city.</div>`))
+			return
+		}
+		if err != nil {
+			log.Printf("Geocoding error: %v", err)
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<div class="text-center text-red-600 p-4">Location search is unavailable right now. Please try again or use your current location.</div>`))
+			return
+		}
+		latitude, longitude = place.Latitude, place.Longitude
+		log.Printf("Geocoded %q to %f, %f", location, latitude, longitude)
 	} else if location != "" {
 		log.Printf("Location provided: %s, using default coordinates", location)
 	}
 
-	// Get nearby restaurants with distance calculation
-	query := `
-		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating,
-		       (6371 * acos(
-		           cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) + 
-		           sin(radians($1)) * sin(radians(latitude))
-		       )) as distance
-		FROM restaurants 
-		WHERE is_active = true 
-		ORDER BY distance
-		LIMIT 10
-	`
-
-	rows, err := h.db.Query(query, latitude, longitude)
+	// Get nearby restaurants in the chosen order, with facets for the area
+	params := r.URL.Query()
+	cursor := params.Get("cursor")
+	data := RestaurantListData{
+		SearchQuery: location,
+		Latitude:    latitude,
+		Longitude:   longitude,
+		Cursor:      cursor,
+		Sort:        params.Get("sort"),
+		Sorts:       restaurantListSorts,
+		Cuisine:     params.Get("cuisine"),
+		Price:       params.Get("price"),
+		OfferType:   params.Get("offer_type"),
+	}
+	query := restaurantService.ListingQuery{
+		Latitude:  &latitude,
+		Longitude: &longitude,
+		RadiusKm:  restaurantListRadiusKm,
+		Sort:      data.Sort,
+		Cursor:    cursor,
+		Limit:     restaurantListPageSize,
+	}
+	if data.Cuisine != "" {
+		query.Cuisines = []string{data.Cuisine}
+	}
+	if data.Price != "" {
+		query.PriceBuckets = []string{data.Price}
+	}
+	if data.OfferType != "" {
+		query.OfferTypes = []string{data.OfferType}
+	}
+	page, err := h.restaurants.ListRestaurants(query)
+	if errors.Is(err, restaurantService.ErrInvalidCursor) || errors.Is(err, restaurantService.ErrInvalidLocation) || errors.Is(err, restaurantService.ErrInvalidSort) {
+		http.Error(w, "Invalid search", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("Database error: %v", err)
 		if r.Header.Get("HX-Request") == "true" {
@@ -401,32 +527,78 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	defer rows.Close()
-
-	var restaurants []Restaurant
-	for rows.Next() {
-		var restaurant Restaurant
-		var distance float64
-		err := rows.Scan(
-			&restaurant.ID, &restaurant.Name, &restaurant.Description, &restaurant.Address,
-			&restaurant.Latitude, &restaurant.Longitude, &restaurant.Phone, &restaurant.Email,
-			&restaurant.CuisineType, &restaurant.Rating, &distance,
-		)
-		if err != nil {
-			log.Printf("Row scan error: %v", err)
-			continue
+	data.Sort, data.NextCursor, data.Facets = page.Sort, page.NextCursor, page.Facets
+
+	for _, found := range page.Restaurants {
+		restaurant := Restaurant{
+			ID:          found.ID,
+			Name:        found.Name,
+			Description: found.Description,
+			Address:     found.Address,
+			Latitude:    found.Latitude,
+			Longitude:   found.Longitude,
+			Phone:       found.Phone,
+			Email:       found.Email,
+			CuisineType: found.CuisineType,
+			Rating:      found.Rating,
 		}
-
-		restaurant.Distance = distance
-		restaurants = append(restaurants, restaurant)
+		if found.DistanceKm != nil {
+			restaurant.Distance = *found.DistanceKm
+		}
+		restaurant.IsOpenNow = found.IsOpenNow == nil || *found.IsOpenNow
+		if found.NextOpen != nil {
+			restaurant.NextOpen = found.NextOpen.Format("Mon 15:04")
+		}
+		if found.BestDiscount != nil {
+			restaurant.BestDiscount = *found.BestDiscount
+		}
+		if found.CheapestPrice != nil {
+			restaurant.CheapestPrice = *found.CheapestPrice
+		}
+		data.Restaurants = append(data.Restaurants, restaurant)
 	}
+	restaurants := data.Restaurants
 
 	log.Printf("Found %d restaurants near coordinates %f, %f", len(restaurants), latitude, longitude)
 
 	// Check if this is an HTMX request
 	if r.Header.Get("HX-Request") == "true" {
-		// Return just the restaurants list
+		// Return just the restaurants list, with sort and filter controls above the first page
 		tmpl := `
+		{{if not .Cursor}}
+			<div class="bg-white rounded-lg shadow-md p-4 mb-4 space-y-3">
+				<div class="flex items-center space-x-2">
+					<label for="restaurant-sort" class="text-sm text-gray-600">Sort by</label>
+					<select id="restaurant-sort" name="sort" hx-get="{{listURL "sort" ""}}" hx-target="#restaurants-list" class="border rounded-lg px-3 py-1 text-sm">
+						{{range .Sorts}}<option value="{{.Value}}" {{if eq .Value $.Sort}}selected{{end}}>{{.Label}}</option>{{end}}
+					</select>
+				</div>
+				{{if .Facets.Cuisines}}
+				<div class="flex flex-wrap gap-2 text-sm">
+					{{range .Facets.Cuisines}}
+					<button hx-get="{{listURL "cuisine" (toggle $.Cuisine .Value)}}" hx-target="#restaurants-list"
+						class="px-3 py-1 rounded-full border {{if eq $.Cuisine .Value}}bg-green-600 text-white{{else}}text-gray-700{{end}}">
+						{{.Label}} ({{.Count}})
+					</button>
+					{{end}}
+				</div>
+				{{end}}
+				<div class="flex flex-wrap gap-2 text-sm">
+					{{range .Facets.PriceBuckets}}
+					<button hx-get="{{listURL "price" (toggle $.Price .Value)}}" hx-target="#restaurants-list"
+						class="px-3 py-1 rounded-full border {{if eq $.Price .Value}}bg-green-600 text-white{{else}}text-gray-700{{end}}">
+						{{.Label}} ({{.Count}})
+					</button>
+					{{end}}
+					{{range .Facets.OfferTypes}}
+					<button hx-get="{{listURL "offer_type" (toggle $.OfferType .Value)}}" hx-target="#restaurants-list"
+						class="px-3 py-1 rounded-full border {{if eq $.OfferType .Value}}bg-green-600 text-white{{else}}text-gray-700{{end}}">
+						{{.Label}} ({{.Count}})
+					</button>
+					{{end}}
+				</div>
+			</div>
+		{{end}}
 		{{if .Restaurants}}
 			{{range .Restaurants}}
 			<div class="bg-white rounded-lg shadow-md p-6 mb-4 hover:shadow-lg transition-shadow">
@@ -439,6 +611,9 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 							<span>🍽️ {{.CuisineType}}</span>
 							<span>⭐ {{.Rating}}</span>
 							<span>📏 {{printf "%.1f" .Distance}} km</span>
+							{{if not .IsOpenNow}}<span class="text-red-600">Closed{{with .NextOpen}} · opens {{.}}{{end}}</span>{{end}}
+							{{if .BestDiscount}}<span class="text-green-700 font-semibold">up to {{printf "%.0f" .BestDiscount}}% off</span>{{end}}
+							{{if .CheapestPrice}}<span>from ${{printf "%.2f" .CheapestPrice}}</span>{{end}}
 						</div>
 					</div>
 					<div class="ml-4">
@@ -452,7 +627,19 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 				</div>
 			</div>
 			{{end}}
-		{{else}}
+			{{if .NextCursor}}
+			<div class="text-center mt-4">
+				<button
+					hx-get="{{listURL "cursor" .NextCursor}}"
+					hx-target="closest div"
+					hx-swap="outerHTML"
+					class="bg-gray-600 hover:bg-gray-700 text-white px-6 py-2 rounded-lg font-semibold transition-colors"
+				>
+					Show more restaurants
+				</button>
+			</div>
+			{{end}}
+		{{else if not .Cursor}}
 			<div class="text-center p-8">
 				<div class="bg-gray-100 rounded-full w-16 h-16 flex items-center justify-center mx-auto mb-4">
 					<span class="text-2xl"></span>
@@ -461,7 +648,7 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 				<p class="text-gray-600 mb-4">Sorry, there are no restaurants with surplus food in your area yet.</p>
 				<div class="space-y-2 text-sm text-gray-500">
 					<p>📍 Location: {{if .SearchQuery}}{{.SearchQuery}}{{else}}Your current location{{end}}</p>
-					<p>📏 Search radius: 10 km</p>
+					<p>📏 Search radius: {{radius}} km</p>
 				</div>
 				<div class="mt-6">
 					<button onclick="getCurrentLocation()" class="bg-green-600 hover:bg-green-700 text-white px-6 py-2 rounded-lg font-semibold transition-colors mr-2">
@@ -475,19 +662,23 @@ func (h *HTMXHandler) HandleRestaurantList(w http.ResponseWriter, r *http.Reques
 		{{end}}
 		`
 
-		tmplParsed, err := template.New("restaurants").Parse(tmpl)
+		tmplParsed, err := template.New("restaurants").Funcs(template.FuncMap{
+			"radius":  func() int { return restaurantListRadiusKm },
+			"listURL": data.listURL,
+			"toggle": func(current, value string) string {
+				if current == value {
+					return ""
+				}
+				return value
+			},
+		}).Parse(tmpl)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "text/html")
-		tmplParsed.Execute(w, RestaurantListData{
-			Restaurants: restaurants,
-			SearchQuery: location,
-			Latitude:    latitude,
-			Longitude:   longitude,
-		})
+		tmplParsed.Execute(w, data)
 		return
 	}
 
@@ -508,12 +699,12 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 	// Get restaurant details
 	var restaurant Restaurant
 	err = h.db.QueryRow(`
-		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating
+		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating, review_count
 		FROM restaurants WHERE id = $1 AND is_active = true
 	`, restaurantID).Scan(
 		&restaurant.ID, &restaurant.Name, &restaurant.Description, &restaurant.Address,
 		&restaurant.Latitude, &restaurant.Longitude, &restaurant.Phone, &restaurant.Email,
-		&restaurant.CuisineType, &restaurant.Rating,
+		&restaurant.CuisineType, &restaurant.Rating, &restaurant.ReviewCount,
 	)
 	if err != nil {
 		http.Error(w, "Restaurant not found", http.StatusNotFound)
@@ -522,10 +713,10 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 
 	// Get inventory items
 	rows, err := h.db.Query(`
-		SELECT id, name, description, original_price, surplus_price, quantity, category, expiry_time
+		SELECT id, name, description, original_price, surplus_price, quantity, category, expiry_time, at_risk
 		FROM inventory_items 
 		WHERE restaurant_id = $1 AND is_available = true AND expiry_time > NOW()
-		ORDER BY created_at DESC
+		ORDER BY at_risk DESC, created_at DESC
 	`, restaurantID)
 	if err != nil {
 		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
@@ -538,7 +729,7 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 		var item InventoryItem
 		err := rows.Scan(
 			&item.ID, &item.Name, &item.Description, &item.OriginalPrice, &item.SurplusPrice,
-			&item.Quantity, &item.Category, &item.ExpiryTime,
+			&item.Quantity, &item.Category, &item.ExpiryTime, &item.AtRisk,
 		)
 		if err != nil {
 			continue
@@ -549,9 +740,9 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 
 	// Get offers
 	offerRows, err := h.db.Query(`
-		SELECT id, name, description, original_price, surplus_price, offer_type
+		SELECT id, name, description, original_price, surplus_price, offer_type, COALESCE(ingredients, '')
 		FROM offers 
-		WHERE restaurant_id = $1 AND is_available = true
+		WHERE restaurant_id = $1 AND is_available = true AND (quantity IS NULL OR quantity > 0)
 		ORDER BY created_at DESC
 	`, restaurantID)
 	if err != nil {
@@ -563,20 +754,33 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 	var offers []Offer
 	for offerRows.Next() {
 		var offer Offer
+		var ingredients string
 		err := offerRows.Scan(
-			&offer.ID, &offer.Name, &offer.Description, &offer.OriginalPrice, &offer.SurplusPrice, &offer.OfferType,
+			&offer.ID, &offer.Name, &offer.Description, &offer.OriginalPrice, &offer.SurplusPrice, &offer.OfferType, &ingredients,
 		)
 		if err != nil {
 			continue
 		}
+		if offer.OfferType == aiService.OfferTypeChefSurprise {
+			offer.Ingredients = aiService.ParseOfferIngredients(ingredients)
+		}
 		offer.Discount = ((offer.OriginalPrice - offer.SurplusPrice) / offer.OriginalPrice) * 100
 		offers = append(offers, offer)
 	}
 
+	// Latest reviews; a failure here shouldn't take the page down
+	reviews, err := h.restaurants.GetRestaurantReviews(restaurantID, restaurantDetailReviews, 0)
+	if err != nil {
+		log.Printf("Failed to fetch reviews for restaurant %d: %v", restaurantID, err)
+	}
+
 	data := RestaurantDetailData{
-		Restaurant:     restaurant,
-		InventoryItems: inventoryItems,
-		Offers:         offers,
+		Restaurant:        restaurant,
+		InventoryItems:    inventoryItems,
+		Offers:            offers,
+		RecipePreferences: aiService.RecipePreferences,
+		Allergens:         userService.Allergens,
+		Reviews:           reviews,
 	}
 
 	tmpl := `
@@ -614,7 +818,7 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 						<div class="flex items-center space-x-6 text-sm text-gray-500">
 							<span>📍 {{.Restaurant.Address}}</span>
 							<span>🍽️ {{.Restaurant.CuisineType}}</span>
-							<span>⭐ {{.Restaurant.Rating}}</span>
+							<span>⭐ {{printf "%.1f" .Restaurant.Rating}}{{if .Restaurant.ReviewCount}} ({{.Restaurant.ReviewCount}} review{{if ne .Restaurant.ReviewCount 1}}s{{end}}){{end}}</span>
 							<span>📞 {{.Restaurant.Phone}}</span>
 						</div>
 					</div>
@@ -634,6 +838,11 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 									-{{printf "%.0f" .Discount}}%
 								</span>
 							</div>
+							{{if .AtRisk}}
+							<p class="inline-block bg-orange-100 text-orange-800 px-2 py-1 rounded-full text-xs font-semibold mb-2">
+								🌱 Last chance - help save it from the bin
+							</p>
+							{{end}}
 							<p class="text-gray-600 mb-4">{{.Description}}</p>
 							<div class="flex justify-between items-center mb-4">
 								<div>
@@ -681,6 +890,29 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 									-{{printf "%.0f" .Discount}}%
 								</span>
 							</div>
+							{{if .Ingredients}}
+							<div class="mb-4">
+								<p class="text-sm text-gray-500 mb-2">Inside: {{range $i, $ingredient := .Ingredients}}{{if $i}}, {{end}}{{$ingredient}}{{end}}</p>
+								<form class="flex space-x-2" hx-get="/offers/{{.ID}}/recipe-card" hx-target="#recipe-card-{{.ID}}" hx-indicator="#recipe-card-loading-{{.ID}}">
+									<select name="preference" class="flex-1 border rounded-lg px-2 py-1 text-sm">
+										{{range $.RecipePreferences}}
+										<option value="{{.}}">{{if .}}{{.}}{{else}}No preference{{end}}</option>
+										{{end}}
+									</select>
+									<button type="submit" class="bg-yellow-500 hover:bg-yellow-600 text-white px-3 py-1 rounded-lg text-sm font-semibold">
+										Recipe idea
+									</button>
+									<details class="w-full text-sm text-gray-600 mt-2">
+										<summary class="cursor-pointer">Allergies</summary>
+										{{range $.Allergens}}
+										<label class="inline-flex items-center mr-3"><input type="checkbox" name="avoid" value="{{.}}" class="mr-1">{{.}}</label>
+										{{end}}
+									</details>
+								</form>
+								<p id="recipe-card-loading-{{.ID}}" class="htmx-indicator text-sm text-gray-500 mt-2">Our chef is thinking...</p>
+								<div id="recipe-card-{{.ID}}" class="mt-2"></div>
+							</div>
+							{{end}}
 							<button 
 								class="w-full bg-purple-600 hover:bg-purple-700 text-white py-2 px-4 rounded-lg font-semibold transition-colors"
 								onclick="addToCart({{.ID}}, 'offer', {{.SurplusPrice}})"
@@ -693,6 +925,34 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 				</div>
 			</section>
 
+			<!-- Reviews -->
+			<section class="py-8">
+				<div class="container mx-auto px-4">
+					<h3 class="text-2xl font-bold text-gray-800 mb-6">Reviews</h3>
+					{{if .Reviews}}
+					<div class="space-y-4">
+						{{range .Reviews}}
+						<div class="bg-white rounded-lg shadow-md p-6">
+							<div class="flex justify-between items-center mb-2">
+								<span class="text-yellow-500" title="{{.Rating}} out of 5">{{stars .Rating}}</span>
+								<span class="text-sm text-gray-500">{{.AuthorName}} · {{.CreatedAt.Format "Jan 2, 2006"}}</span>
+							</div>
+							{{if .Text}}<p class="text-gray-700">{{.Text}}</p>{{end}}
+							{{if .OwnerReply}}
+							<div class="mt-4 ml-4 pl-4 border-l-4 border-green-200">
+								<p class="text-sm font-semibold text-gray-800">Reply from {{$.Restaurant.Name}}</p>
+								<p class="text-sm text-gray-600">{{.OwnerReply}}</p>
+							</div>
+							{{end}}
+						</div>
+						{{end}}
+					</div>
+					{{else}}
+					<p class="text-gray-500">No reviews yet. Reviews come from customers who collected an order here.</p>
+					{{end}}
+				</div>
+			</section>
+
 			<!-- Shopping Cart -->
 			<div id="cart" class="fixed bottom-4 right-4 bg-white rounded-lg shadow-lg p-4 hidden">
 				<h4 class="font-semibold mb-2">Shopping Cart</h4>
@@ -760,7 +1020,9 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 	</html>
 	`
 
-	tmplParsed, err := template.New("restaurant-detail").Parse(tmpl)
+	tmplParsed, err := template.New("restaurant-detail").Funcs(template.FuncMap{
+		"stars": func(rating int) string { return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating) },
+	}).Parse(tmpl)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -770,6 +1032,72 @@ func (h *HTMXHandler) HandleRestaurantDetail(w http.ResponseWriter, r *http.Requ
 	tmplParsed.Execute(w, data)
 }
 
+// HandleRecipeCard renders the Chef's Surprise recipe card for an offer, the
+// preference query parameter and the allergens in avoid parameters, as a fragment
+// for the restaurant detail page
+func (h *HTMXHandler) HandleRecipeCard(w http.ResponseWriter, r *http.Request) {
+	offerID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return
+	}
+	if h.aiService == nil {
+		http.Error(w, "Recipe cards are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	avoid, err := userService.NormalizeAllergens(r.URL.Query()["avoid"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	card, err := h.aiService.GetRecipeCard(r.Context(), offerID, r.URL.Query().Get("preference"), avoid)
+	if err != nil {
+		switch {
+		case errors.Is(err, aiService.ErrUnsupportedPreference):
+			http.Error(w, "Unsupported preference", http.StatusBadRequest)
+		case errors.Is(err, aiService.ErrNotChefSurprise):
+			http.Error(w, "Offer not found", http.StatusNotFound)
+		default:
+			log.Printf("Failed to get recipe card for offer %d: %v", offerID, err)
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<p class="text-sm text-red-600">Our chef couldn't come up with a recipe right now. Please try again.</p>`))
+		}
+		return
+	}
+
+	tmpl := `
+	<div class="border border-yellow-200 bg-yellow-50 rounded-lg p-4 text-sm">
+		<h5 class="font-semibold text-gray-800 mb-1">{{.Recipe.Name}}</h5>
+		<p class="text-gray-500 mb-3">
+			⏱️ {{.Recipe.PrepTime}} prep · {{.Recipe.CookTime}} cook · {{.Recipe.Difficulty}}
+			{{if .Recipe.NutritionalInfo.Calories}} · {{.Recipe.NutritionalInfo.Calories}} kcal{{end}}
+		</p>
+		<ul class="list-disc list-inside text-gray-700 mb-3">
+			{{range .Recipe.Ingredients}}<li>{{.}}</li>{{end}}
+		</ul>
+		<ol class="list-decimal list-inside text-gray-700 space-y-1">
+			{{range .Recipe.Instructions}}<li>{{.}}</li>{{end}}
+		</ol>
+		{{if .Recipe.Tags}}
+		<div class="mt-3 space-x-1">
+			{{range .Recipe.Tags}}<span class="bg-yellow-100 text-yellow-800 px-2 py-0.5 rounded-full text-xs">{{.}}</span>{{end}}
+		</div>
+		{{end}}
+	</div>
+	`
+
+	tmplParsed, err := template.New("recipe-card").Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	tmplParsed.Execute(w, card)
+}
+
 // HandleRestaurantLogin handles restaurant login/registration
 func (h *HTMXHandler) HandleRestaurantLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
@@ -924,8 +1252,21 @@ func (h *HTMXHandler) handleRestaurantRegistration(w http.ResponseWriter, r *htt
 		RETURNING id
 	`
 
-	// For demo, use default coordinates (in real app, geocode the address)
-	latitude, longitude := 40.7128, -74.0060
+	if h.geocoder == nil {
+		http.Error(w, "Registration is unavailable - address lookup is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	place, err := h.geocoder.Geocode(r.Context(), address)
+	if errors.Is(err, geo.ErrAddressNotFound) {
+		http.Error(w, "We couldn't find that address - please check it and try again", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Geocoding error: %v", err)
+		http.Error(w, "Registration failed - address lookup is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	latitude, longitude := place.Latitude, place.Longitude
 
 	var restaurantID int
 	err = h.db.QueryRow(query, restaurantName, email, cuisineType, address, latitude, longitude).Scan(&restaurantID)
@@ -1068,6 +1409,45 @@ func (h *HTMXHandler) HandleRestaurantDashboard(w http.ResponseWriter, r *http.R
 					</div>
 				</div>
 
+				<!-- Batch Planner -->
+				{{if .Restaurant.ID}}
+				<div class="bg-white rounded-lg shadow-md p-6 mb-8">
+					<h2 class="text-2xl font-bold text-gray-800 mb-4">Batch Planner</h2>
+					<form class="grid md:grid-cols-4 gap-4 items-end" hx-get="/restaurant/forecast" hx-target="#forecast-result">
+						<input type="hidden" name="restaurant_id" value="{{.Restaurant.ID}}">
+						<label class="text-sm text-gray-600">Category
+							<input type="text" name="category" placeholder="e.g. Bakery" class="w-full border rounded-lg px-3 py-2">
+						</label>
+						<label class="text-sm text-gray-600">Quantity
+							<input type="number" name="quantity" min="1" value="10" class="w-full border rounded-lg px-3 py-2">
+						</label>
+						<label class="text-sm text-gray-600">Selling for (hours)
+							<input type="number" name="hours" min="1" max="168" value="3" class="w-full border rounded-lg px-3 py-2">
+						</label>
+						<button type="submit" class="bg-green-600 hover:bg-green-700 text-white px-4 py-2 rounded-lg font-semibold">
+							Forecast
+						</button>
+					</form>
+					<div id="forecast-result" class="mt-4"></div>
+				</div>
+				{{end}}
+
+				<!-- Waste Report -->
+				{{if .Restaurant.ID}}
+				<div class="bg-white rounded-lg shadow-md p-6 mb-8">
+					<div class="flex justify-between items-center mb-4">
+						<h2 class="text-2xl font-bold text-gray-800">Food Waste</h2>
+						<select name="period" class="border rounded-lg px-3 py-2"
+							hx-get="/restaurant/waste-report?restaurant_id={{.Restaurant.ID}}" hx-target="#waste-report" hx-trigger="load, change">
+							<option value="daily">Daily</option>
+							<option value="weekly">Weekly</option>
+							<option value="monthly">Monthly</option>
+						</select>
+					</div>
+					<div id="waste-report"></div>
+				</div>
+				{{end}}
+
 				<!-- Recent Activity -->
 				<div class="bg-white rounded-lg shadow-md p-6">
 					<h2 class="text-2xl font-bold text-gray-800 mb-4">Recent Activity</h2>
@@ -1106,24 +1486,139 @@ func (h *HTMXHandler) HandleRestaurantDashboard(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// Until sessions land, the batch planner takes the restaurant from ?restaurant_id=
+	restaurantID, _ := strconv.Atoi(r.URL.Query().Get("restaurant_id"))
+
 	w.Header().Set("Content-Type", "text/html")
-	tmplParsed.Execute(w, nil)
+	tmplParsed.Execute(w, DashboardData{Restaurant: Restaurant{ID: restaurantID}})
 }
 
-// calculateDistance calculates the distance between two points using Haversine formula
-func (h *HTMXHandler) calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
+// HandleWasteReport renders a restaurant's waste report as a fragment for the dashboard
+func (h *HTMXHandler) HandleWasteReport(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(r.URL.Query().Get("restaurant_id"))
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = restaurantService.WastePeriodDaily
+	}
 
-	lat1Rad := lat1 * 3.14159265359 / 180
-	lon1Rad := lon1 * 3.14159265359 / 180
-	lat2Rad := lat2 * 3.14159265359 / 180
-	lon2Rad := lon2 * 3.14159265359 / 180
+	report, err := h.restaurants.GetWasteReport(restaurantID, period, time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmpl := `
+	<div class="grid grid-cols-3 gap-4 mb-4">
+		<div class="bg-gray-50 rounded-lg p-4">
+			<p class="text-sm text-gray-500">Unsold</p>
+			<p class="text-2xl font-bold text-gray-800">{{.Totals.Quantity}} items</p>
+		</div>
+		<div class="bg-gray-50 rounded-lg p-4">
+			<p class="text-sm text-gray-500">Weight</p>
+			<p class="text-2xl font-bold text-gray-800">{{printf "%.1f" .Totals.WeightKg}} kg</p>
+		</div>
+		<div class="bg-gray-50 rounded-lg p-4">
+			<p class="text-sm text-gray-500">Value lost</p>
+			<p class="text-2xl font-bold text-red-600">${{printf "%.2f" .Totals.ValueLost}}</p>
+		</div>
+	</div>
+	<table class="w-full text-sm mb-4">
+		<thead>
+			<tr class="text-left text-gray-500"><th>{{if eq .Period "monthly"}}Month{{else if eq .Period "weekly"}}Week of{{else}}Day{{end}}</th><th>Items</th><th>kg</th><th>Value lost</th></tr>
+		</thead>
+		<tbody>
+			{{range .Buckets}}
+			<tr class="border-t"><td>{{.Start.Format "Jan 2"}}</td><td>{{.Quantity}}</td><td>{{printf "%.1f" .WeightKg}}</td><td>${{printf "%.2f" .ValueLost}}</td></tr>
+			{{end}}
+		</tbody>
+	</table>
+	{{if .TopItems}}
+	<p class="text-sm text-gray-600 mb-2">Most wasted:
+		{{range $i, $item := .TopItems}}{{if $i}}, {{end}}{{$item.ItemName}} ({{$item.Quantity}}){{end}}
+	</p>
+	{{end}}
+	{{if .AtRisk}}
+	<p class="text-sm text-orange-700">⚠️ Likely to go to waste, now promoted:
+		{{range $i, $item := .AtRisk}}{{if $i}}, {{end}}{{$item.Name}} ({{$item.Quantity}} left){{end}}
+	</p>
+	{{end}}
+	`
+
+	tmplParsed, err := template.New("waste-report").Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	tmplParsed.Execute(w, report)
+}
+
+// HandleDemandForecast renders the expected sell-through of a proposed batch as a
+// fragment for the dashboard's batch planner
+func (h *HTMXHandler) HandleDemandForecast(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	restaurantID, err := strconv.Atoi(query.Get("restaurant_id"))
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+	quantity, err := strconv.Atoi(query.Get("quantity"))
+	if err != nil || quantity <= 0 {
+		http.Error(w, "Quantity must be a positive number", http.StatusBadRequest)
+		return
+	}
+	hours, err := strconv.Atoi(query.Get("hours"))
+	if err != nil || hours <= 0 {
+		hours = 3
+	}
+	if h.aiService == nil {
+		http.Error(w, "Forecasts are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	now := time.Now()
+	forecast, err := h.aiService.ForecastDemand(aiService.ForecastInput{
+		RestaurantID: restaurantID,
+		Category:     query.Get("category"),
+		Quantity:     quantity,
+		From:         now,
+		Until:        now.Add(time.Duration(hours) * time.Hour),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmpl := `
+	<div class="rounded-lg p-4 {{if eq .Basis "none"}}bg-gray-50 text-gray-600{{else if lt .SellThrough 0.5}}bg-yellow-50 text-yellow-800{{else}}bg-green-50 text-green-800{{end}}">
+		<p class="font-semibold">{{if and (ne .Basis "none") (lt .SellThrough 0.5)}}⚠️ {{end}}{{.Message}}</p>
+		{{if ne .Basis "none"}}
+		<p class="text-sm mt-1">
+			Probably between {{.LowSold}} and {{.HighSold}} · expected demand {{printf "%.1f" .ExpectedDemand}} ·
+			{{printf "%.0f" (percent .Confidence)}}% confidence
+		</p>
+		{{end}}
+	</div>
+	`
 
-	dlat := lat2Rad - lat1Rad
-	dlon := lon2Rad - lon1Rad
+	tmplParsed, err := template.New("forecast").Funcs(template.FuncMap{
+		"percent": func(v float64) float64 { return v * 100 },
+	}).Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	a := (dlat/2)*(dlat/2) + (dlon/2)*(dlon/2)*math.Cos(lat1Rad)*math.Cos(lat2Rad)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	w.Header().Set("Content-Type", "text/html")
+	tmplParsed.Execute(w, forecast)
+}
 
-	return R * c
+// calculateDistance calculates the distance between two points using Haversine formula
+func (h *HTMXHandler) calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	return geo.Distance(lat1, lon1, lat2, lon2)
 }
@@ -0,0 +1,303 @@
+package restaurants
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"surplus-supper/backend/geo"
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/restaurantService"
+
+	"github.com/gorilla/mux"
+)
+
+// RestaurantHandler handles restaurant listing HTTP requests
+type RestaurantHandler struct {
+	restaurantService *restaurantService.RestaurantService
+	geocoder          geo.Geocoder
+}
+
+// NewRestaurantHandler creates a new restaurant handler
+func NewRestaurantHandler(service *restaurantService.RestaurantService) *RestaurantHandler {
+	return &RestaurantHandler{restaurantService: service}
+}
+
+// SetGeocoder sets the geocoder used for the location parameter
+func (h *RestaurantHandler) SetGeocoder(geocoder geo.Geocoder) {
+	h.geocoder = geocoder
+}
+
+// ListRestaurants handles listing restaurants with sorts, filters and facets.
+// Query parameters: lat and lng, or location (an address); radius_km; sort
+// (distance, rating, discount, expiry, price); cuisine, price (price bucket keys)
+// and offer_type, each comma-separated; cursor and limit.
+func (h *RestaurantHandler) ListRestaurants(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := restaurantService.ListingQuery{
+		Sort:         params.Get("sort"),
+		Cuisines:     splitList(params.Get("cuisine")),
+		PriceBuckets: splitList(params.Get("price")),
+		OfferTypes:   splitList(params.Get("offer_type")),
+		Cursor:       params.Get("cursor"),
+	}
+
+	if params.Get("lat") != "" || params.Get("lng") != "" {
+		lat, latErr := strconv.ParseFloat(params.Get("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(params.Get("lng"), 64)
+		if latErr != nil || lngErr != nil {
+			http.Error(w, "lat and lng must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+		query.Latitude, query.Longitude = &lat, &lng
+	} else if location := strings.TrimSpace(params.Get("location")); location != "" {
+		if h.geocoder == nil {
+			http.Error(w, "Location search is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		place, err := h.geocoder.Geocode(r.Context(), location)
+		if errors.Is(err, geo.ErrAddressNotFound) {
+			http.Error(w, "Location not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Location search is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		query.Latitude, query.Longitude = &place.Latitude, &place.Longitude
+	}
+	if radius := params.Get("radius_km"); radius != "" {
+		var err error
+		query.RadiusKm, err = strconv.ParseFloat(radius, 64)
+		if err != nil || query.RadiusKm <= 0 {
+			http.Error(w, "Invalid radius_km", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.restaurantService.ListRestaurants(query)
+	switch {
+	case errors.Is(err, restaurantService.ErrInvalidCursor):
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	case errors.Is(err, restaurantService.ErrInvalidSort):
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	case errors.Is(err, restaurantService.ErrInvalidLocation):
+		http.Error(w, "Invalid location or radius", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// RestaurantDetail is a restaurant with its opening hours and delivery zones
+type RestaurantDetail struct {
+	*restaurantService.Restaurant
+	OpeningHours  *restaurantService.OpeningHours   `json:"opening_hours"`
+	DeliveryZones []*restaurantService.DeliveryZone `json:"delivery_zones"`
+}
+
+// GetRestaurant handles getting a restaurant with its opening hours, whether it's
+// open now and where it delivers
+func (h *RestaurantHandler) GetRestaurant(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+
+	restaurant, err := h.restaurantService.GetRestaurantByID(id)
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	hours, err := h.restaurantService.GetOpeningHours(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	zones, err := h.restaurantService.GetDeliveryZones(id, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if zones == nil {
+		zones = []*restaurantService.DeliveryZone{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestaurantDetail{Restaurant: restaurant, OpeningHours: hours, DeliveryZones: zones})
+}
+
+// QuoteDelivery handles quoting delivery from a restaurant to lat and lng, or to an
+// address. It answers 422 when the restaurant doesn't deliver there.
+func (h *RestaurantHandler) QuoteDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	var lat, lng float64
+	if params.Get("lat") != "" || params.Get("lng") != "" {
+		var latErr, lngErr error
+		lat, latErr = strconv.ParseFloat(params.Get("lat"), 64)
+		lng, lngErr = strconv.ParseFloat(params.Get("lng"), 64)
+		if latErr != nil || lngErr != nil {
+			http.Error(w, "lat and lng must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+	} else if address := strings.TrimSpace(params.Get("address")); address != "" && h.geocoder != nil {
+		place, err := h.geocoder.Geocode(r.Context(), address)
+		if errors.Is(err, geo.ErrAddressNotFound) {
+			http.Error(w, "We couldn't find that address", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Address lookup is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		lat, lng = place.Latitude, place.Longitude
+	} else {
+		http.Error(w, "lat and lng, or address, are required", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.restaurantService.QuoteDelivery(id, lat, lng)
+	switch {
+	case errors.Is(err, restaurantService.ErrOutsideDeliveryArea):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, restaurantService.ErrInvalidLocation):
+		http.Error(w, "lat and lng must be valid coordinates", http.StatusBadRequest)
+		return
+	case errors.Is(err, restaurantService.ErrRestaurantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// MapFeatures handles the restaurant map: a GeoJSON FeatureCollection of the
+// restaurants in bbox (west,south,east,north; west above east crosses the
+// antimeridian), clustered below restaurantService.ClusterMaxZoom. Query parameters:
+// bbox, zoom and available_only.
+func (h *RestaurantHandler) MapFeatures(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	corners := splitList(params.Get("bbox"))
+	if len(corners) != 4 {
+		http.Error(w, "bbox must be west,south,east,north", http.StatusBadRequest)
+		return
+	}
+	var bounds [4]float64
+	for i, corner := range corners {
+		var err error
+		bounds[i], err = strconv.ParseFloat(strings.TrimSpace(corner), 64)
+		if err != nil {
+			http.Error(w, "bbox must be west,south,east,north", http.StatusBadRequest)
+			return
+		}
+	}
+	zoom, err := strconv.Atoi(params.Get("zoom"))
+	if err != nil {
+		http.Error(w, "Invalid zoom", http.StatusBadRequest)
+		return
+	}
+	query := restaurantService.MapQuery{
+		Box:  geo.BoundingBox{MinLon: bounds[0], MinLat: bounds[1], MaxLon: bounds[2], MaxLat: bounds[3]},
+		Zoom: zoom,
+	}
+	if availableOnly := params.Get("available_only"); availableOnly != "" {
+		query.AvailableOnly, err = strconv.ParseBool(availableOnly)
+		if err != nil {
+			http.Error(w, "Invalid available_only", http.StatusBadRequest)
+			return
+		}
+	}
+
+	features, err := h.restaurantService.GetMapFeatures(query)
+	if errors.Is(err, restaurantService.ErrInvalidMapArea) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Surplus counts change as orders come in, so only cache briefly
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(features)
+}
+
+// splitList splits a comma-separated parameter
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// LinkStaffAccountRequest represents the request body for linking a staff login
+type LinkStaffAccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LinkStaffAccount handles the authenticated user linking their restaurant staff
+// login, which lets owners reply to their restaurant's reviews
+func (h *RestaurantHandler) LinkStaffAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req LinkStaffAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.restaurantService.LinkStaffAccount(userID, req.Email, req.Password)
+	switch {
+	case errors.Is(err, restaurantService.ErrInvalidStaffCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, restaurantService.ErrStaffAccountLinked):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
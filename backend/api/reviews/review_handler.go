@@ -0,0 +1,247 @@
+package reviews
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/restaurantService"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultReviewPageSize and maxReviewPageSize bound the reviews listed at once
+const (
+	defaultReviewPageSize = 20
+	maxReviewPageSize     = 100
+)
+
+// ReviewHandler handles review-related HTTP requests
+type ReviewHandler struct {
+	restaurantService *restaurantService.RestaurantService
+	moderators        map[int]bool
+}
+
+// NewReviewHandler creates a new review handler
+func NewReviewHandler(service *restaurantService.RestaurantService) *ReviewHandler {
+	return &ReviewHandler{restaurantService: service, moderators: map[int]bool{}}
+}
+
+// SetModerators sets the IDs of the users allowed to hide and restore reviews
+func (h *ReviewHandler) SetModerators(userIDs []int) {
+	h.moderators = map[int]bool{}
+	for _, userID := range userIDs {
+		h.moderators[userID] = true
+	}
+}
+
+// RestaurantReviews is a page of a restaurant's reviews with its rating
+type RestaurantReviews struct {
+	Summary *restaurantService.ReviewSummary `json:"summary"`
+	Reviews []*restaurantService.Review      `json:"reviews"`
+}
+
+// ListRestaurantReviews handles listing a restaurant's visible reviews, newest
+// first. Query parameters: limit and offset.
+func (h *ReviewHandler) ListRestaurantReviews(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid restaurant ID", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	limit, offset := defaultReviewPageSize, 0
+	if value := params.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxReviewPageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	summary, err := h.restaurantService.GetReviewSummary(restaurantID)
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	reviews, err := h.restaurantService.GetRestaurantReviews(restaurantID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reviews == nil {
+		reviews = []*restaurantService.Review{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestaurantReviews{Summary: summary, Reviews: reviews})
+}
+
+// CreateReview handles the authenticated user reviewing one of their collected
+// orders
+func (h *ReviewHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var input restaurantService.CreateReviewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if input.OrderID <= 0 {
+		http.Error(w, "order_id is required", http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.restaurantService.CreateReview(userID, input)
+	switch {
+	case errors.Is(err, restaurantService.ErrAlreadyReviewed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil && err.Error() == "order not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// ReportReviewRequest represents the request body for reporting a review
+type ReportReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReportReview handles the authenticated user reporting someone else's review
+func (h *ReviewHandler) ReportReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReportReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.restaurantService.ReportReview(userID, reviewID, req.Reason)
+	switch {
+	case err != nil && err.Error() == "review not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReplyRequest represents the request body for replying to a review
+type ReplyRequest struct {
+	Reply string `json:"reply"`
+}
+
+// ReplyToReview handles the restaurant's owner replying to a review. The
+// authenticated user must have linked an owner's staff login of the restaurant.
+func (h *ReviewHandler) ReplyToReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.restaurantService.ReplyToReview(reviewID, userID, req.Reply)
+	switch {
+	case errors.Is(err, restaurantService.ErrNotRestaurantOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil && err.Error() == "review not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// ModerateReviewRequest represents the request body for hiding or restoring a review
+type ModerateReviewRequest struct {
+	Hidden bool   `json:"hidden"`
+	Reason string `json:"reason"`
+}
+
+// ModerateReview handles a moderator hiding or restoring a review
+func (h *ReviewHandler) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if !h.moderators[userID] {
+		http.Error(w, "Only moderators can hide or restore reviews", http.StatusForbidden)
+		return
+	}
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ModerateReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.restaurantService.SetReviewHidden(reviewID, req.Hidden, req.Reason)
+	switch {
+	case err != nil && err.Error() == "review not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
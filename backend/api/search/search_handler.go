@@ -0,0 +1,114 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"surplus-supper/backend/searchService"
+)
+
+// SearchHandler handles search HTTP requests
+type SearchHandler struct {
+	searchService *searchService.SearchService
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(service *searchService.SearchService) *SearchHandler {
+	return &SearchHandler{searchService: service}
+}
+
+// Search handles searching restaurants, inventory items and offers.
+// Query parameters: q (filters like "under $8", "within 2km", "30% off" and
+// "open now" are read from it), lat and lng, radius_km, min_price, max_price,
+// min_discount (percent), cuisine (comma-separated), expires_within_minutes,
+// open_now, type (comma-separated restaurant, inventory_item, offer) and limit.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := searchService.SearchQuery{Text: params.Get("q")}
+
+	floats := []struct {
+		name   string
+		target **float64
+	}{
+		{"min_price", &query.MinPrice},
+		{"max_price", &query.MaxPrice},
+		{"min_discount", &query.MinDiscount},
+	}
+	for _, f := range floats {
+		if value := params.Get(f.name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+f.name, http.StatusBadRequest)
+				return
+			}
+			*f.target = &parsed
+		}
+	}
+
+	if radius := params.Get("radius_km"); radius != "" {
+		var err error
+		query.RadiusKm, err = strconv.ParseFloat(radius, 64)
+		if err != nil || query.RadiusKm <= 0 {
+			http.Error(w, "Invalid radius_km", http.StatusBadRequest)
+			return
+		}
+	}
+	if params.Get("lat") != "" || params.Get("lng") != "" {
+		lat, latErr := strconv.ParseFloat(params.Get("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(params.Get("lng"), 64)
+		if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			http.Error(w, "lat and lng must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+		query.Latitude, query.Longitude = &lat, &lng
+	}
+	if minutes := params.Get("expires_within_minutes"); minutes != "" {
+		parsed, err := strconv.Atoi(minutes)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid expires_within_minutes", http.StatusBadRequest)
+			return
+		}
+		query.ExpiresWithin = time.Duration(parsed) * time.Minute
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if openNow := params.Get("open_now"); openNow != "" {
+		var err error
+		query.OpenNow, err = strconv.ParseBool(openNow)
+		if err != nil {
+			http.Error(w, "Invalid open_now", http.StatusBadRequest)
+			return
+		}
+	}
+	if cuisine := params.Get("cuisine"); cuisine != "" {
+		query.Cuisines = strings.Split(cuisine, ",")
+	}
+	if kinds := params.Get("type"); kinds != "" {
+		for _, kind := range strings.Split(kinds, ",") {
+			query.Kinds = append(query.Kinds, strings.TrimSpace(kind))
+		}
+	}
+
+	response, err := h.searchService.Search(query)
+	if errors.Is(err, searchService.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
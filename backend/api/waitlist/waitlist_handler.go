@@ -0,0 +1,101 @@
+package waitlist
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/restaurantService"
+
+	"github.com/gorilla/mux"
+)
+
+// WaitlistHandler handles waitlist-related HTTP requests
+type WaitlistHandler struct {
+	restaurantService *restaurantService.RestaurantService
+}
+
+// NewWaitlistHandler creates a new waitlist handler
+func NewWaitlistHandler(service *restaurantService.RestaurantService) *WaitlistHandler {
+	return &WaitlistHandler{restaurantService: service}
+}
+
+// ListWaitlists handles listing the authenticated user's waitlist entries and holds
+func (h *WaitlistHandler) ListWaitlists(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := h.restaurantService.GetUserWaitlists(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// JoinWaitlist handles the authenticated user joining the waitlist of a sold-out
+// inventory item or offer
+func (h *WaitlistHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var input restaurantService.JoinWaitlistInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.restaurantService.JoinWaitlist(userID, input)
+	switch {
+	case errors.Is(err, restaurantService.ErrNotSoldOut), errors.Is(err, restaurantService.ErrAlreadyWaitlisted):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil && (err.Error() == "inventory item not found" || err.Error() == "offer not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// LeaveWaitlist handles the authenticated user leaving a waitlist, passing on any
+// stock held for them
+func (h *WaitlistHandler) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid waitlist entry ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.restaurantService.LeaveWaitlist(userID, id)
+	switch {
+	case err != nil && err.Error() == "waitlist entry not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,350 @@
+// Command nearby-bench compares the bounding-box nearby search with the old full
+// scan on synthetic restaurants. By default it runs in memory, checking that both
+// return the same restaurants and counting how often the old acos formula gives NaN:
+//
+//	go run ./cmd/nearby-bench -restaurants 100000 -queries 1000
+//
+// The in-memory timing is also BenchmarkNearby in the geo package:
+//
+//	go test -run '^$' -bench Nearby ./geo
+//
+// With -database-url it loads the restaurants into a temporary table that shadows
+// restaurants for its session, times RestaurantService.GetNearbyRestaurantsPage
+// against the old query and prints both plans:
+//
+//	go run ./cmd/nearby-bench -database-url "$DATABASE_URL"
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"surplus-supper/backend/geo"
+	"surplus-supper/backend/restaurantService"
+
+	"github.com/lib/pq"
+)
+
+// point is a synthetic restaurant
+type point struct {
+	id       int
+	lat, lon float64
+}
+
+// cities are the centres synthetic restaurants cluster around
+var cities = []struct{ lat, lon float64 }{
+	{40.7128, -74.0060}, {34.0522, -118.2437}, {41.8781, -87.6298}, {29.7604, -95.3698},
+	{33.4484, -112.0740}, {39.9526, -75.1652}, {32.7157, -117.1611}, {37.7749, -122.4194},
+	{47.6062, -122.3321}, {25.7617, -80.1918}, {42.3601, -71.0589}, {39.7392, -104.9903},
+}
+
+// legacyQuery is the nearby search this tool replaced, with its parentheses balanced
+const legacyQuery = `
+	SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating, is_active, created_at, updated_at
+	FROM restaurants
+	WHERE is_active = true
+	AND (
+		6371 * acos(
+			cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) +
+			sin(radians($1)) * sin(radians(latitude))
+		)
+	) <= $3
+	ORDER BY (
+		6371 * acos(
+			cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) +
+			sin(radians($1)) * sin(radians(latitude))
+		)
+	)
+	LIMIT $4
+`
+
+func main() {
+	seed := flag.Int64("seed", 42, "random seed for the synthetic restaurants")
+	count := flag.Int("restaurants", 100000, "number of synthetic restaurants")
+	queries := flag.Int("queries", 1000, "number of searches to time")
+	radius := flag.Float64("radius", 10, "search radius in km")
+	limit := flag.Int("limit", 20, "results per search")
+	databaseURL := flag.String("database-url", "", "Postgres to benchmark against instead of memory")
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	points := syntheticRestaurants(rng, *count)
+
+	// Searches start at restaurants' own locations, as "near this restaurant" does,
+	// and at random points around the cities
+	centres := make([]point, *queries)
+	for i := range centres {
+		if i%2 == 0 {
+			centres[i] = points[rng.Intn(len(points))]
+		} else {
+			centres[i] = syntheticPoint(rng, 0)
+		}
+	}
+
+	fmt.Printf("%d restaurants, %d searches, radius %.1f km, limit %d, seed %d\n", len(points), len(centres), *radius, *limit, *seed)
+	if *databaseURL != "" {
+		benchmarkDatabase(*databaseURL, points, centres, *radius, *limit)
+		return
+	}
+	benchmarkMemory(points, centres, *radius, *limit)
+}
+
+// syntheticRestaurants returns restaurants clustered around cities, with a quarter
+// spread across the continent
+func syntheticRestaurants(rng *rand.Rand, count int) []point {
+	points := make([]point, count)
+	for i := range points {
+		points[i] = syntheticPoint(rng, i+1)
+	}
+	return points
+}
+
+func syntheticPoint(rng *rand.Rand, id int) point {
+	if rng.Float64() < 0.25 {
+		return point{id: id, lat: 25 + rng.Float64()*24, lon: -124 + rng.Float64()*57}
+	}
+	city := cities[rng.Intn(len(cities))]
+	return point{id: id, lat: city.lat + rng.NormFloat64()*0.08, lon: city.lon + rng.NormFloat64()*0.1}
+}
+
+// legacyDistance is the acos formula the old query used
+func legacyDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	return 6371 * math.Acos(
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Cos(lon2*rad-lon1*rad)+
+			math.Sin(lat1*rad)*math.Sin(lat2*rad),
+	)
+}
+
+// result is a restaurant found by a search
+type result struct {
+	id       int
+	distance float64
+}
+
+// nearest sorts results by distance then id and keeps the first limit
+func nearest(results []result, limit int) []result {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].distance != results[j].distance {
+			return results[i].distance < results[j].distance
+		}
+		return results[i].id < results[j].id
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// benchmarkMemory runs every search as a full scan with the old formula and as a
+// bounding-box range over restaurants sorted by latitude, the way the index is read
+func benchmarkMemory(points []point, centres []point, radius float64, limit int) {
+	byLatitude := append([]point(nil), points...)
+	sort.Slice(byLatitude, func(i, j int) bool { return byLatitude[i].lat < byLatitude[j].lat })
+
+	var scanned, nans, missed, mismatched int
+	var scanTime, boxTime time.Duration
+
+	for _, centre := range centres {
+		start := time.Now()
+		var legacy []result
+		for _, p := range points {
+			distance := legacyDistance(centre.lat, centre.lon, p.lat, p.lon)
+			if math.IsNaN(distance) {
+				nans++
+			}
+			// NaN compares false, so the old query dropped those rows
+			if distance <= radius {
+				legacy = append(legacy, result{p.id, distance})
+			}
+		}
+		legacy = nearest(legacy, limit)
+		scanTime += time.Since(start)
+
+		start = time.Now()
+		box := geo.BoundingBoxAround(centre.lat, centre.lon, radius)
+		var found []result
+		for i := sort.Search(len(byLatitude), func(i int) bool { return byLatitude[i].lat >= box.MinLat }); i < len(byLatitude) && byLatitude[i].lat <= box.MaxLat; i++ {
+			p := byLatitude[i]
+			scanned++
+			if !box.Contains(p.lat, p.lon) {
+				continue
+			}
+			if distance := geo.Distance(centre.lat, centre.lon, p.lat, p.lon); distance <= radius {
+				found = append(found, result{p.id, distance})
+			}
+		}
+		found = nearest(found, limit)
+		boxTime += time.Since(start)
+
+		// The box must find exactly what a full scan with the same formula finds
+		var exact []result
+		for _, p := range points {
+			if distance := geo.Distance(centre.lat, centre.lon, p.lat, p.lon); distance <= radius {
+				exact = append(exact, result{p.id, distance})
+			}
+		}
+		exact = nearest(exact, limit)
+		if !sameRestaurants(found, exact) {
+			mismatched++
+		}
+		if !sameRestaurants(legacy, exact) {
+			missed++
+		}
+	}
+
+	n := time.Duration(len(centres))
+	fmt.Printf("full scan (acos):    %10v per search, %d rows per search\n", scanTime/n, len(points))
+	fmt.Printf("bounding box (asin): %10v per search, %d rows per search (%.2f%% of the table)\n",
+		boxTime/n, scanned/len(centres), float64(scanned)/float64(len(centres)*len(points))*100)
+	fmt.Printf("speed-up: %.1fx\n", float64(scanTime)/float64(boxTime))
+	fmt.Printf("acos NaN distances: %d, searches where the full scan lost restaurants to NaN: %d\n", nans, missed)
+	fmt.Printf("searches where the bounding box differs from an exact full scan: %d\n", mismatched)
+}
+
+// sameRestaurants reports whether two searches found the same restaurants in order
+func sameRestaurants(a, b []result) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].id != b[i].id {
+			return false
+		}
+	}
+	return true
+}
+
+// benchmarkDatabase times both queries against a temporary copy of the points
+func benchmarkDatabase(databaseURL string, points []point, centres []point, radius float64, limit int) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	// The temporary table only exists on the connection that created it
+	db.SetMaxOpenConns(1)
+
+	if err := loadRestaurants(db, points); err != nil {
+		log.Fatalf("Failed to load restaurants: %v", err)
+	}
+
+	service := restaurantService.NewRestaurantService(db)
+	var boxTime, scanTime time.Duration
+	var failed int
+	for _, centre := range centres {
+		start := time.Now()
+		if _, err := service.GetNearbyRestaurantsPage(restaurantService.NearbyQuery{
+			Latitude: centre.lat, Longitude: centre.lon, RadiusKm: radius, Limit: limit,
+		}); err != nil {
+			log.Fatalf("Nearby search failed: %v", err)
+		}
+		boxTime += time.Since(start)
+
+		start = time.Now()
+		rows, err := db.Query(legacyQuery, centre.lat, centre.lon, radius, limit)
+		if err != nil {
+			// Postgres raises an error where Go returns NaN
+			failed++
+			continue
+		}
+		rows.Close()
+		scanTime += time.Since(start)
+	}
+
+	fmt.Printf("bounding box (asin): %10v per search\n", boxTime/time.Duration(len(centres)))
+	if failed < len(centres) {
+		fmt.Printf("full scan (acos):    %10v per search", scanTime/time.Duration(len(centres)-failed))
+	}
+	fmt.Printf(", %d searches failed with acos out of range\n", failed)
+
+	centre := centres[0]
+	box, boxArgs := geo.BoundingBoxAround(centre.lat, centre.lon, radius).SQL("latitude", "longitude", 3)
+	fmt.Println("\nbounding box plan:")
+	explain(db, `SELECT id FROM restaurants WHERE is_active = true AND `+box+`
+		ORDER BY `+geo.DistanceSQL("latitude", "longitude", "$1", "$2")+` LIMIT 20`,
+		append([]interface{}{centre.lat, centre.lon}, boxArgs...)...)
+	fmt.Println("\nfull scan plan:")
+	explain(db, legacyQuery, centre.lat, centre.lon, radius, limit)
+}
+
+// loadRestaurants copies the points into a temporary restaurants table
+func loadRestaurants(db *sql.DB, points []point) error {
+	_, err := db.Exec(`
+		CREATE TEMP TABLE restaurants (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			address TEXT NOT NULL DEFAULT '',
+			latitude DECIMAL(10, 8) NOT NULL,
+			longitude DECIMAL(11, 8) NOT NULL,
+			phone TEXT NOT NULL DEFAULT '',
+			email TEXT NOT NULL DEFAULT '',
+			cuisine_type TEXT NOT NULL DEFAULT '',
+			rating DECIMAL(3, 2) NOT NULL DEFAULT 0,
+			is_active BOOLEAN NOT NULL DEFAULT true,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin copy: %w", err)
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("restaurants", "id", "name", "latitude", "longitude"))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare copy: %w", err)
+	}
+	for _, p := range points {
+		if _, err := stmt.Exec(p.id, fmt.Sprintf("Restaurant %d", p.id), p.lat, p.lon); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to copy restaurant: %w", err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to close copy: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit copy: %w", err)
+	}
+
+	// Same index as migration 012
+	if _, err := db.Exec(`CREATE INDEX ON restaurants(latitude, longitude, id) WHERE is_active = true`); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	if _, err := db.Exec(`ANALYZE restaurants`); err != nil {
+		return fmt.Errorf("failed to analyze table: %w", err)
+	}
+	return nil
+}
+
+func explain(db *sql.DB, query string, args ...interface{}) {
+	rows, err := db.Query("EXPLAIN ANALYZE "+query, args...)
+	if err != nil {
+		log.Printf("Failed to explain query: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err == nil {
+			fmt.Println("  " + line)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+-- Location-based "new surplus near me" alerts
+
+-- CreateNotification already writes restaurant_id, so make sure the column exists
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE CASCADE;
+
+-- Alert areas saved by users. When latitude/longitude are NULL the user's
+-- profile coordinates are used instead.
+CREATE TABLE IF NOT EXISTS alert_subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    latitude DECIMAL(10, 8),
+    longitude DECIMAL(11, 8),
+    radius_km DECIMAL(6, 2) NOT NULL DEFAULT 2.0,
+    cuisine_type VARCHAR(100), -- NULL matches every cuisine
+    max_price DECIMAL(10, 2), -- NULL matches every price
+    is_active BOOLEAN DEFAULT true,
+    last_notified_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_subscriptions_user ON alert_subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_alert_subscriptions_active ON alert_subscriptions(is_active);
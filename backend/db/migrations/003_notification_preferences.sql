@@ -0,0 +1,22 @@
+-- Notification preferences, delivery channels and quiet hours
+
+-- Per-user settings shared by every notification type
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    quiet_hours_start TIME, -- local time, NULL disables quiet hours
+    quiet_hours_end TIME,
+    unsubscribe_token VARCHAR(64) UNIQUE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-type channel choices: order_update, new_offer, marketing
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    notification_type VARCHAR(50) NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT true,
+    email BOOLEAN NOT NULL DEFAULT false,
+    push BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, notification_type)
+);
@@ -0,0 +1,13 @@
+-- Web Push subscriptions registered by browsers (one row per browser/device)
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    endpoint TEXT UNIQUE NOT NULL,
+    p256dh VARCHAR(255) NOT NULL, -- base64url client public key
+    auth VARCHAR(255) NOT NULL, -- base64url client auth secret
+    user_agent TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions(user_id);
@@ -0,0 +1,2 @@
+-- Preferred language for transactional emails (en, es, ...)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(10) NOT NULL DEFAULT 'en';
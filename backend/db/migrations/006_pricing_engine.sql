@@ -0,0 +1,11 @@
+-- Pricing engine: restaurant price bounds and explainable recommendations
+
+-- Surplus prices are kept between these fractions of the original price
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS min_price_ratio DECIMAL(4, 3) NOT NULL DEFAULT 0.300;
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS max_price_ratio DECIMAL(4, 3) NOT NULL DEFAULT 0.700;
+
+-- Price the recommendation was made against and the factors behind it (JSON array)
+ALTER TABLE ai_recommendations ADD COLUMN IF NOT EXISTS current_price DECIMAL(10, 2);
+ALTER TABLE ai_recommendations ADD COLUMN IF NOT EXISTS factors JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_ai_recommendations_item ON ai_recommendations(inventory_item_id, created_at DESC);
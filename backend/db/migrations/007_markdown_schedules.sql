@@ -0,0 +1,35 @@
+-- Opt-in time-decay markdowns for expiring inventory
+
+-- A schedule applies to one item, or to every item of a category when
+-- inventory_item_id is NULL. Item schedules win over category schedules.
+CREATE TABLE IF NOT EXISTS markdown_schedules (
+    id SERIAL PRIMARY KEY,
+    restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE CASCADE,
+    inventory_item_id INTEGER REFERENCES inventory_items(id) ON DELETE CASCADE,
+    category VARCHAR(100),
+    start_minutes_before_expiry INTEGER NOT NULL DEFAULT 120,
+    step_minutes INTEGER NOT NULL DEFAULT 30,
+    step_percent DECIMAL(5, 2) NOT NULL DEFAULT 10.00, -- percent of the pre-markdown price
+    floor_ratio DECIMAL(4, 3), -- fraction of original price, NULL = restaurant's min_price_ratio
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (inventory_item_id IS NOT NULL OR category IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_markdown_schedules_restaurant ON markdown_schedules(restaurant_id) WHERE is_active;
+
+-- Price the first markdown started from, so later steps don't compound
+ALTER TABLE inventory_items ADD COLUMN IF NOT EXISTS markdown_base_price DECIMAL(10, 2);
+
+-- Every surplus price change, whether manual or automatic
+CREATE TABLE IF NOT EXISTS price_history (
+    id SERIAL PRIMARY KEY,
+    inventory_item_id INTEGER REFERENCES inventory_items(id) ON DELETE CASCADE,
+    old_price DECIMAL(10, 2) NOT NULL,
+    new_price DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(20) NOT NULL, -- manual, markdown
+    markdown_schedule_id INTEGER REFERENCES markdown_schedules(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_item ON price_history(inventory_item_id, created_at);
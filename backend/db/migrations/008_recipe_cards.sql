@@ -0,0 +1,18 @@
+-- Chef's Surprise recipe cards
+
+-- One generated recipe per offer and customer preference. ingredients is the
+-- offer's ingredient list the recipe was made from, so edits to the offer
+-- cause the card to be regenerated.
+CREATE TABLE IF NOT EXISTS recipe_cards (
+    id SERIAL PRIMARY KEY,
+    offer_id INTEGER NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+    preference VARCHAR(50) NOT NULL DEFAULT '',
+    ingredients TEXT NOT NULL,
+    recipe JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (offer_id, preference)
+);
+
+-- Preference the customer stated at checkout, and the card for each Chef's Surprise bought
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS recipe_preference VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS recipe_card_id INTEGER REFERENCES recipe_cards(id) ON DELETE SET NULL;
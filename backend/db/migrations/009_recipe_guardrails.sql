@@ -0,0 +1,27 @@
+-- Allergen guardrails for Creative Kitchen recipes
+
+-- Allergens a user must not be served (milk, eggs, peanuts, ...)
+CREATE TABLE IF NOT EXISTS user_allergens (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    allergen VARCHAR(20) NOT NULL,
+    PRIMARY KEY (user_id, allergen)
+);
+
+-- Recipe cards are also keyed by the allergens they avoid (sorted, comma-separated)
+ALTER TABLE recipe_cards ADD COLUMN IF NOT EXISTS allergens VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE recipe_cards DROP CONSTRAINT IF EXISTS recipe_cards_offer_id_preference_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recipe_cards_key ON recipe_cards(offer_id, preference, allergens);
+
+-- Every model answer that was not used, and why
+CREATE TABLE IF NOT EXISTS recipe_rejections (
+    id SERIAL PRIMARY KEY,
+    offer_id INTEGER REFERENCES offers(id) ON DELETE SET NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    preference VARCHAR(50) NOT NULL DEFAULT '',
+    reason VARCHAR(20) NOT NULL, -- invalid, unsafe
+    problems JSONB NOT NULL, -- JSON array of strings
+    response TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recipe_rejections_created ON recipe_rejections(created_at);
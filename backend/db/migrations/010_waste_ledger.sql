@@ -0,0 +1,31 @@
+-- Waste ledger: what was left of each item when it expired
+
+-- Weight of one unit, when the restaurant knows it; otherwise reports estimate by category
+ALTER TABLE inventory_items ADD COLUMN IF NOT EXISTS weight_kg DECIMAL(8, 3);
+
+-- Predicted fraction of the remaining quantity that will go unsold, and whether that
+-- is high enough to promote the item
+ALTER TABLE inventory_items ADD COLUMN IF NOT EXISTS waste_risk DECIMAL(4, 3);
+ALTER TABLE inventory_items ADD COLUMN IF NOT EXISTS at_risk BOOLEAN NOT NULL DEFAULT false;
+
+-- One row per item and expiry. Name, category and prices are copied so the ledger
+-- survives edits and deletion of the item.
+CREATE TABLE IF NOT EXISTS waste_ledger (
+    id SERIAL PRIMARY KEY,
+    inventory_item_id INTEGER REFERENCES inventory_items(id) ON DELETE SET NULL,
+    restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE CASCADE,
+    item_name VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    quantity INTEGER NOT NULL,
+    weight_kg DECIMAL(10, 3) NOT NULL,
+    weight_estimated BOOLEAN NOT NULL, -- true when weight_kg comes from the category estimate
+    value_lost DECIMAL(10, 2) NOT NULL, -- quantity at the original price
+    revenue_lost DECIMAL(10, 2) NOT NULL, -- quantity at the last surplus price
+    predicted_risk DECIMAL(4, 3), -- waste_risk when the item expired
+    expired_at TIMESTAMP NOT NULL,
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (inventory_item_id, expired_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_waste_ledger_restaurant ON waste_ledger(restaurant_id, expired_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_items_expiry ON inventory_items(expiry_time) WHERE quantity > 0;
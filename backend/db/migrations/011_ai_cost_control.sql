@@ -0,0 +1,17 @@
+-- AI cost control: per-restaurant daily budgets and usage
+
+-- Most a restaurant may spend on AI calls per day (USD); NULL uses the server default
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS ai_daily_budget DECIMAL(10, 2);
+
+-- AI usage per restaurant, UTC day and feature (pricing, recipes)
+CREATE TABLE IF NOT EXISTS ai_usage (
+    restaurant_id INTEGER REFERENCES restaurants(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    feature VARCHAR(50) NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    cache_hits INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost DECIMAL(12, 6) NOT NULL DEFAULT 0,
+    PRIMARY KEY (restaurant_id, day, feature)
+);
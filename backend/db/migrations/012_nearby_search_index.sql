@@ -0,0 +1,7 @@
+-- Nearby search: bounding-box prefilter on active restaurants
+
+-- Serves the latitude range of the box, with longitude and id read from the index
+-- so inactive restaurants and rows outside the box never touch the table
+CREATE INDEX IF NOT EXISTS idx_restaurants_active_location
+    ON restaurants(latitude, longitude, id)
+    WHERE is_active = true;
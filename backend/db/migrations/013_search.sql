@@ -0,0 +1,32 @@
+-- Full-text search over restaurants, inventory items and offers
+
+-- Names weigh most, then cuisine or category, then descriptions and ingredients
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(cuisine_type, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')
+    ) STORED;
+
+ALTER TABLE inventory_items ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')
+    ) STORED;
+
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', replace(coalesce(offer_type, ''), '_', ' ')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce(ingredients, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_restaurants_search ON restaurants USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_inventory_items_search ON inventory_items USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_offers_search ON offers USING GIN(search_vector);
+
+-- Price filters on what's still for sale
+CREATE INDEX IF NOT EXISTS idx_inventory_items_available_price ON inventory_items(surplus_price)
+    WHERE is_available = true;
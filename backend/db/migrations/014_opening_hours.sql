@@ -0,0 +1,87 @@
+-- Restaurant opening hours: weekly periods, dated exceptions and a timezone
+
+-- Local timezone the opening hours are given in
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- Weekly opening periods. A period closing at or before it opens runs past midnight;
+-- a restaurant without any periods is open around the clock.
+CREATE TABLE IF NOT EXISTS restaurant_hours (
+    id SERIAL PRIMARY KEY,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    day_of_week SMALLINT NOT NULL CHECK (day_of_week BETWEEN 0 AND 6), -- 0 is Sunday
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL,
+    CHECK (opens_at <> closes_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_restaurant_hours_restaurant ON restaurant_hours(restaurant_id, day_of_week);
+
+-- Holidays, temporary closures and special hours. They replace the weekly hours on
+-- every day from starts_on to ends_on; NULL hours mean closed all day.
+CREATE TABLE IF NOT EXISTS restaurant_hours_exceptions (
+    id SERIAL PRIMARY KEY,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    opens_at TIME,
+    closes_at TIME,
+    reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on >= starts_on),
+    CHECK ((opens_at IS NULL) = (closes_at IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_restaurant_hours_exceptions_restaurant ON restaurant_hours_exceptions(restaurant_id, ends_on);
+
+-- Whether an opening period on a local day covers a local time
+CREATE OR REPLACE FUNCTION hours_period_contains(p_day DATE, p_opens TIME, p_closes TIME, p_local TIMESTAMP)
+RETURNS BOOLEAN AS $$
+    SELECT p_local >= p_day + p_opens
+       AND p_local < p_day + p_closes + CASE WHEN p_closes <= p_opens THEN interval '1 day' ELSE interval '0' END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Whether a restaurant is open at a moment, for filtering searches. Keep in step
+-- with OpeningHours.IsOpen in restaurantService.
+CREATE OR REPLACE FUNCTION restaurant_is_open(p_restaurant_id INTEGER, p_at TIMESTAMPTZ)
+RETURNS BOOLEAN AS $$
+DECLARE
+    v_timezone VARCHAR(64);
+    v_local TIMESTAMP;
+    v_day DATE;
+    v_exception restaurant_hours_exceptions%ROWTYPE;
+BEGIN
+    SELECT timezone INTO v_timezone FROM restaurants WHERE id = p_restaurant_id;
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+    v_local := p_at AT TIME ZONE v_timezone;
+
+    -- Yesterday's periods can run past midnight into today
+    FOREACH v_day IN ARRAY ARRAY[v_local::date - 1, v_local::date] LOOP
+        SELECT * INTO v_exception FROM restaurant_hours_exceptions
+        WHERE restaurant_id = p_restaurant_id AND v_day BETWEEN starts_on AND ends_on
+        ORDER BY starts_on DESC, id DESC
+        LIMIT 1;
+
+        IF FOUND THEN
+            IF v_exception.opens_at IS NOT NULL
+               AND hours_period_contains(v_day, v_exception.opens_at, v_exception.closes_at, v_local) THEN
+                RETURN true;
+            END IF;
+        ELSIF NOT EXISTS (SELECT 1 FROM restaurant_hours WHERE restaurant_id = p_restaurant_id) THEN
+            IF v_day = v_local::date THEN
+                RETURN true;
+            END IF;
+        ELSIF EXISTS (
+            SELECT 1 FROM restaurant_hours
+            WHERE restaurant_id = p_restaurant_id
+              AND day_of_week = EXTRACT(DOW FROM v_day)
+              AND hours_period_contains(v_day, opens_at, closes_at, v_local)
+        ) THEN
+            RETURN true;
+        END IF;
+    END LOOP;
+
+    RETURN false;
+END;
+$$ LANGUAGE plpgsql STABLE;
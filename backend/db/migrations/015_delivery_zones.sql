@@ -0,0 +1,30 @@
+-- Delivery zones and order fulfilment type
+
+-- Areas a restaurant delivers to: a radius around the restaurant, or a polygon
+-- stored as a JSON array of {"latitude", "longitude"} points
+CREATE TABLE IF NOT EXISTS delivery_zones (
+    id SERIAL PRIMARY KEY,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    radius_km DECIMAL(6, 2),
+    polygon JSONB,
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    min_order_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((radius_km IS NULL) <> (polygon IS NULL)),
+    CHECK (radius_km IS NULL OR radius_km > 0),
+    CHECK (fee >= 0 AND min_order_amount >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_zones_restaurant ON delivery_zones(restaurant_id) WHERE is_active = true;
+
+-- How an order reaches the customer, and where it's delivered to
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fulfilment_type VARCHAR(20) NOT NULL DEFAULT 'pickup'
+    CHECK (fulfilment_type IN ('pickup', 'delivery'));
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_address TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_latitude DECIMAL(10, 8);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_longitude DECIMAL(11, 8);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_zone_id INTEGER REFERENCES delivery_zones(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_fee DECIMAL(10, 2) NOT NULL DEFAULT 0;
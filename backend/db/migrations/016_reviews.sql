@@ -0,0 +1,35 @@
+-- Customer reviews, moderation and owner replies
+
+-- One review per collected order. Hidden reviews don't show and don't count
+-- towards the restaurant's rating.
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    text TEXT NOT NULL DEFAULT '',
+    is_hidden BOOLEAN NOT NULL DEFAULT false,
+    hidden_reason VARCHAR(255),
+    report_count INTEGER NOT NULL DEFAULT 0,
+    owner_reply TEXT,
+    replied_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_restaurant ON reviews(restaurant_id, created_at DESC) WHERE is_hidden = false;
+CREATE INDEX IF NOT EXISTS idx_reviews_user ON reviews(user_id);
+
+-- Reports of a review by other users, at most one per user
+CREATE TABLE IF NOT EXISTS review_reports (
+    review_id INTEGER NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id)
+);
+
+-- Number of visible reviews behind restaurants.rating. Seeded ratings stand until
+-- a restaurant's first review.
+ALTER TABLE restaurants ADD COLUMN IF NOT EXISTS review_count INTEGER NOT NULL DEFAULT 0;
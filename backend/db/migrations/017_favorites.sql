@@ -0,0 +1,20 @@
+-- Favorite restaurants and item categories
+
+-- Restaurants a user follows. Followers hear about the restaurant's new offers
+-- and price drops.
+CREATE TABLE IF NOT EXISTS favorite_restaurants (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, restaurant_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_favorite_restaurants_restaurant ON favorite_restaurants(restaurant_id);
+
+-- Inventory item categories a user likes, lower-cased
+CREATE TABLE IF NOT EXISTS favorite_categories (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category)
+);
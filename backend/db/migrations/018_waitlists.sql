@@ -0,0 +1,33 @@
+-- Waitlists for sold-out offers and inventory items
+
+-- Units left of an offer. NULL for offers whose units aren't counted.
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS quantity INTEGER CHECK (quantity >= 0);
+
+-- People waiting for a sold-out item or offer, first come first served. When stock
+-- comes back the next in line gets it held for them until hold_expires_at, after
+-- which the hold passes on, and once nobody is waiting it goes back on sale.
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    inventory_item_id INTEGER REFERENCES inventory_items(id) ON DELETE CASCADE,
+    offer_id INTEGER REFERENCES offers(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'held', 'fulfilled', 'expired', 'cancelled')),
+    hold_expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((inventory_item_id IS NULL) <> (offer_id IS NULL))
+);
+
+-- At most one waiting or held entry per user and item
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_entries_user_item ON waitlist_entries(user_id, inventory_item_id)
+    WHERE inventory_item_id IS NOT NULL AND status IN ('waiting', 'held');
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_entries_user_offer ON waitlist_entries(user_id, offer_id)
+    WHERE offer_id IS NOT NULL AND status IN ('waiting', 'held');
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_item_queue ON waitlist_entries(inventory_item_id, created_at)
+    WHERE inventory_item_id IS NOT NULL AND status IN ('waiting', 'held');
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_offer_queue ON waitlist_entries(offer_id, created_at)
+    WHERE offer_id IS NOT NULL AND status IN ('waiting', 'held');
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_hold_expiry ON waitlist_entries(hold_expires_at) WHERE status = 'held';
@@ -0,0 +1,5 @@
+-- Customer accounts linked to restaurant staff logins. Owner replies to reviews
+-- go through the linked account, which proved it knows the staff password.
+ALTER TABLE restaurant_staff ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_restaurant_staff_user ON restaurant_staff(user_id) WHERE user_id IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Running total refunded on an order, so refunds can't add up to more than it cost
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Recipe cards never change once made, as orders keep pointing at them. A change
+-- to an offer's ingredients gets a card of its own; md5 keeps long ingredient
+-- lists within the index row size.
+DROP INDEX IF EXISTS idx_recipe_cards_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recipe_cards_version ON recipe_cards(offer_id, preference, allergens, md5(ingredients));
@@ -0,0 +1,203 @@
+package emailService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"surplus-supper/backend/orderService"
+)
+
+// OrderItemLine is an order item as shown in emails
+type OrderItemLine struct {
+	Name       string
+	Quantity   int
+	TotalPrice float64
+}
+
+// OrderData is the template data for order emails
+type OrderData struct {
+	BaseData
+	OrderID           int
+	RestaurantName    string
+	RestaurantAddress string
+	PickupTime        string
+	DeliveryAddress   string // empty for pickup orders
+	DeliveryFee       float64
+	Items             []OrderItemLine
+	TotalAmount       float64
+	RefundAmount      float64
+}
+
+// NotificationData is the template data for notification emails
+type NotificationData struct {
+	BaseData
+	Title   string
+	Message string
+}
+
+// recipient is the user an email is addressed to
+type recipient struct {
+	Email     string
+	FirstName string
+	Locale    string
+}
+
+// EmailService renders and sends transactional emails
+type EmailService struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+// NewEmailService creates a new email service
+func NewEmailService(db *sql.DB, mailer Mailer) *EmailService {
+	return &EmailService{db: db, mailer: mailer}
+}
+
+// SendWelcome sends the registration email
+func (s *EmailService) SendWelcome(userID int) error {
+	to, err := s.getRecipient(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.send(to, TemplateWelcome, &struct{ BaseData }{s.baseData(to)}, nil)
+}
+
+// SendOrderPlaced sends the order confirmation email
+func (s *EmailService) SendOrderPlaced(orderID int) error {
+	return s.sendOrderEmail(TemplateOrderPlaced, orderID, 0)
+}
+
+// SendOrderReady tells the customer their order can be picked up
+func (s *EmailService) SendOrderReady(orderID int) error {
+	return s.sendOrderEmail(TemplateOrderReady, orderID, 0)
+}
+
+// SendOrderCancelled tells the customer their order was cancelled
+func (s *EmailService) SendOrderCancelled(orderID int) error {
+	return s.sendOrderEmail(TemplateOrderCancelled, orderID, 0)
+}
+
+// SendRefundIssued tells the customer a refund is on its way
+func (s *EmailService) SendRefundIssued(orderID int, amount float64) error {
+	return s.sendOrderEmail(TemplateRefundIssued, orderID, amount)
+}
+
+// HandleOrderEvent sends the email for an order lifecycle event (implements orderService.OrderNotifier)
+func (s *EmailService) HandleOrderEvent(event orderService.OrderEvent) error {
+	switch event.Type {
+	case orderService.EventOrderPlaced:
+		return s.SendOrderPlaced(event.Order.ID)
+	case orderService.EventOrderStatusChanged:
+		if event.Order.Status == "ready" {
+			return s.SendOrderReady(event.Order.ID)
+		}
+	case orderService.EventOrderCancelled:
+		return s.SendOrderCancelled(event.Order.ID)
+	case orderService.EventRefundIssued:
+		return s.SendRefundIssued(event.Order.ID, event.RefundAmount)
+	}
+	return nil
+}
+
+// sendOrderEmail renders an order template for the customer who placed the order
+func (s *EmailService) sendOrderEmail(name string, orderID int, refundAmount float64) error {
+	var userID sql.NullInt64
+	var pickupTime sql.NullTime
+	data := OrderData{OrderID: orderID, RefundAmount: refundAmount}
+
+	err := s.db.QueryRow(`
+		SELECT o.user_id, o.total_amount, o.pickup_time, r.name, r.address,
+		       CASE WHEN o.fulfilment_type = 'delivery' THEN COALESCE(o.delivery_address, '') ELSE '' END, o.delivery_fee
+		FROM orders o JOIN restaurants r ON r.id = o.restaurant_id
+		WHERE o.id = $1
+	`, orderID).Scan(&userID, &data.TotalAmount, &pickupTime, &data.RestaurantName, &data.RestaurantAddress, &data.DeliveryAddress, &data.DeliveryFee)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("order not found")
+		}
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+
+	// Guest orders have nobody to email
+	if !userID.Valid {
+		return nil
+	}
+	if pickupTime.Valid {
+		data.PickupTime = pickupTime.Time.Format("15:04")
+	}
+
+	rows, err := s.db.Query(`
+		SELECT COALESCE(ii.name, ofr.name, 'Item'), oi.quantity, oi.total_price
+		FROM order_items oi
+		LEFT JOIN inventory_items ii ON ii.id = oi.inventory_item_id
+		LEFT JOIN offers ofr ON ofr.id = oi.offer_id
+		WHERE oi.order_id = $1 ORDER BY oi.id
+	`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItemLine
+		if err := rows.Scan(&item.Name, &item.Quantity, &item.TotalPrice); err != nil {
+			return fmt.Errorf("failed to scan order item: %w", err)
+		}
+		data.Items = append(data.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get order items: %w", err)
+	}
+
+	to, err := s.getRecipient(int(userID.Int64))
+	if err != nil {
+		return err
+	}
+	data.BaseData = s.baseData(to)
+
+	return s.send(to, name, &data, nil)
+}
+
+// send renders a template in the recipient's locale and hands it to the mailer
+func (s *EmailService) send(to *recipient, name string, data interface{}, headers map[string]string) error {
+	msg, err := Render(name, to.Locale, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to.Email
+	msg.Headers = headers
+
+	return s.mailer.Send(msg)
+}
+
+// getRecipient loads the address, name and locale of a user
+func (s *EmailService) getRecipient(userID int) (*recipient, error) {
+	var to recipient
+	err := s.db.QueryRow("SELECT email, first_name, locale FROM users WHERE id = $1", userID).Scan(&to.Email, &to.FirstName, &to.Locale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &to, nil
+}
+
+// baseData fills in the fields shared by every template
+func (s *EmailService) baseData(to *recipient) BaseData {
+	return BaseData{FirstName: to.FirstName, AppURL: appURL()}
+}
+
+// appURL is where email links point, matching the unsubscribe links' PUBLIC_BASE_URL
+func appURL() string {
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return strings.TrimRight(baseURL, "/") + "/"
+}
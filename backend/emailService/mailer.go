@@ -0,0 +1,188 @@
+package emailService
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Message represents an email with HTML and plain-text bodies
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+	Headers map[string]string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// NewMailerFromEnv returns an SMTP mailer when SMTP_HOST is set and a maildir
+// file mailer (MAILDIR, default ./maildir) otherwise
+func NewMailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Surplus Supper <no-reply@surplussupper.com>"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	dir := os.Getenv("MAILDIR")
+	if dir == "" {
+		dir = "maildir"
+	}
+	return &FileMailer{Dir: dir, From: from}
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send sends a message over SMTP, using STARTTLS when the server offers it
+func (m *SMTPMailer) Send(msg *Message) error {
+	body, err := buildMIME(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	envelopeFrom := m.From
+	if address, err := mail.ParseAddress(m.From); err == nil {
+		envelopeFrom = address.Address
+	}
+
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, envelopeFrom, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
+
+// FileMailer writes each message into a maildir so emails can be inspected locally
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to Dir/new, going through Dir/tmp as maildir readers expect
+func (m *FileMailer) Send(msg *Message) error {
+	body, err := buildMIME(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to name message file: %w", err)
+	}
+	name := fmt.Sprintf("%d.%s.surplus-supper.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(m.Dir, "new", name)); err != nil {
+		return fmt.Errorf("failed to deliver message: %w", err)
+	}
+
+	return nil
+}
+
+// buildMIME renders a multipart/alternative message with text and HTML parts
+func buildMIME(from string, msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + writer.Boundary(),
+	}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var head bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&head, "%s: %s\r\n", key, headers[key])
+	}
+	head.WriteString("\r\n")
+
+	// Plain text first: clients show the last alternative they understand
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MIME part: %w", err)
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		if _, err := encoder.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("failed to encode MIME part: %w", err)
+		}
+		encoder.Close()
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish MIME message: %w", err)
+	}
+
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
@@ -0,0 +1,91 @@
+package emailService
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir, From: "Surplus Supper <no-reply@surplussupper.com>"}
+
+	sent := &Message{
+		To:      "ana@example.com",
+		Subject: "Pedido #42 está listo",
+		Text:    "Hola Ana,\n\nTu pedido está listo. Total: $9.00 — ¡gracias!\n",
+		HTML:    `<p style="margin:0">Hola Ana, tu pedido está listo. ` + strings.Repeat("Una línea larga. ", 10) + `</p>`,
+		Headers: map[string]string{"List-Unsubscribe": "<https://surplus.example/unsubscribe>"},
+	}
+	if err := mailer.Send(sent); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(pending) != 0 {
+		t.Errorf("%d messages left in tmp", len(pending))
+	}
+	delivered, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	if err != nil || len(delivered) != 1 {
+		t.Fatalf("found %d messages in new, want 1 (%v)", len(delivered), err)
+	}
+
+	file, err := os.Open(delivered[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatalf("message doesn't parse: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != sent.Subject {
+		t.Errorf("got subject %q (%v), want %q", subject, err, sent.Subject)
+	}
+	headers := map[string]string{
+		"To":               sent.To,
+		"From":             mailer.From,
+		"List-Unsubscribe": sent.Headers["List-Unsubscribe"],
+		"Mime-Version":     "1.0",
+	}
+	for key, want := range headers {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("got %s header %q, want %q", key, got, want)
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q (%v), want multipart/alternative", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", sent.Text},
+		{"text/html; charset=utf-8", sent.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("missing %s part: %v", want.contentType, err)
+		}
+		body, err := io.ReadAll(part) // quoted-printable is decoded by the reader
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("got part %q, want %q", got, want.contentType)
+		}
+		// Text lines go out with CRLF endings, as SMTP requires
+		if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != want.body {
+			t.Errorf("%s part round-tripped to %q, want %q", want.contentType, got, want.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("got more than two parts (%v)", err)
+	}
+}
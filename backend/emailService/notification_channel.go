@@ -0,0 +1,49 @@
+package emailService
+
+import (
+	"surplus-supper/backend/notificationService"
+)
+
+// NotificationChannel delivers notifications by email (implements notificationService.DeliveryChannel)
+type NotificationChannel struct {
+	emails   *EmailService
+	notifier *notificationService.NotificationService
+}
+
+// NewNotificationChannel creates the email delivery channel for notifications
+func NewNotificationChannel(emails *EmailService, notifier *notificationService.NotificationService) *NotificationChannel {
+	return &NotificationChannel{emails: emails, notifier: notifier}
+}
+
+// Name returns the channel name
+func (c *NotificationChannel) Name() string {
+	return notificationService.ChannelEmail
+}
+
+// Deliver emails a notification with a one-click unsubscribe link for its type
+func (c *NotificationChannel) Deliver(notification *notificationService.Notification) error {
+	to, err := c.emails.getRecipient(notification.UserID)
+	if err != nil {
+		return err
+	}
+
+	unsubscribeURL, err := c.notifier.UnsubscribeURL(notification.UserID, notification.Type)
+	if err != nil {
+		return err
+	}
+
+	data := NotificationData{
+		BaseData: c.emails.baseData(to),
+		Title:    notification.Title,
+		Message:  notification.Message,
+	}
+	data.UnsubscribeURL = unsubscribeURL
+
+	// RFC 8058 one-click unsubscribe, handled by the POST side of the unsubscribe endpoint
+	headers := map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	return c.emails.send(to, TemplateNotification, &data, headers)
+}
@@ -0,0 +1,94 @@
+package emailService
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Email templates, one directory per locale. Each email has a .html file defining
+// "content" (wrapped in layout.html) and a .txt file defining "subject" and "body".
+//
+//go:embed templates
+var templateFS embed.FS
+
+// BaseData holds the fields every email template can use
+type BaseData struct {
+	FirstName      string
+	AppURL         string
+	UnsubscribeURL string
+}
+
+// Template names
+const (
+	TemplateWelcome        = "welcome"
+	TemplateOrderPlaced    = "order_placed"
+	TemplateOrderReady     = "order_ready"
+	TemplateOrderCancelled = "order_cancelled"
+	TemplateRefundIssued   = "refund_issued"
+	TemplateNotification   = "notification"
+)
+
+// DefaultLocale is used when a user's locale has no templates
+const DefaultLocale = "en"
+
+// SupportedLocales lists the locales emails are translated into
+var SupportedLocales = []string{"en", "es"}
+
+// ResolveLocale maps a user's locale (e.g. "es-MX") onto a supported template locale
+func ResolveLocale(locale string) string {
+	language := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	for _, supported := range SupportedLocales {
+		if language == supported {
+			return supported
+		}
+	}
+	return DefaultLocale
+}
+
+// Render renders the subject, HTML and plain-text bodies of a template in the given locale.
+// data must embed BaseData, which the shared layout reads.
+func Render(name, locale string, data interface{}) (*Message, error) {
+	dir := "templates/" + ResolveLocale(locale)
+
+	textTemplate, err := texttemplate.ParseFS(templateFS, dir+"/"+name+".txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s text template: %w", name, err)
+	}
+
+	var subject, text bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := textTemplate.ExecuteTemplate(&text, "body", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s text body: %w", name, err)
+	}
+
+	htmlTemplate, err := htmltemplate.ParseFS(templateFS, dir+"/layout.html", dir+"/items.html", dir+"/"+name+".html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s HTML template: %w", name, err)
+	}
+
+	// The layout needs the subject for <title> alongside the template's own data
+	layoutData := struct {
+		Subject string
+		Data    interface{}
+	}{Subject: strings.TrimSpace(subject.String()), Data: data}
+
+	var html bytes.Buffer
+	if err := htmlTemplate.ExecuteTemplate(&html, "layout", layoutData); err != nil {
+		return nil, fmt.Errorf("failed to render %s HTML body: %w", name, err)
+	}
+
+	return &Message{
+		Subject: layoutData.Subject,
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,94 @@
+package emailService
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveLocale(t *testing.T) {
+	tests := map[string]string{
+		"en":     "en",
+		"es":     "es",
+		"es-MX":  "es",
+		" ES_ar": "es",
+		"en-GB":  "en",
+		"fr":     DefaultLocale,
+		"":       DefaultLocale,
+	}
+	for locale, want := range tests {
+		if got := ResolveLocale(locale); got != want {
+			t.Errorf("ResolveLocale(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	base := BaseData{FirstName: "Ana", AppURL: "https://surplus.example", UnsubscribeURL: "https://surplus.example/unsubscribe"}
+	order := &OrderData{
+		BaseData:          base,
+		OrderID:           42,
+		RestaurantName:    "Casa Verde",
+		RestaurantAddress: "1 Main St",
+		Items:             []OrderItemLine{{Name: "Veggie Box", Quantity: 2, TotalPrice: 9}},
+		TotalAmount:       9,
+		RefundAmount:      4.5,
+	}
+	delivery := *order
+	delivery.DeliveryAddress, delivery.DeliveryFee, delivery.TotalAmount = "9 Side St", 2.5, 11.5
+	notification := &NotificationData{BaseData: base, Title: "Fresh surplus nearby", Message: "Casa Verde has new bags"}
+
+	tests := []struct {
+		name     string
+		locale   string
+		data     interface{}
+		subject  string
+		contains []string // in both bodies
+	}{
+		{TemplateWelcome, "en", &struct{ BaseData }{base}, "Welcome to Surplus Supper", []string{"Ana"}},
+		{TemplateWelcome, "es", &struct{ BaseData }{base}, "Bienvenido a Surplus Supper", []string{"Ana"}},
+		{TemplateOrderPlaced, "en", order, "Order #42 placed at Casa Verde", []string{"Veggie Box", "9.00", "1 Main St"}},
+		{TemplateOrderPlaced, "es", order, "Pedido #42 realizado en Casa Verde", []string{"Veggie Box", "9.00", "1 Main St"}},
+		{TemplateOrderPlaced, "en", &delivery, "Order #42 placed at Casa Verde", []string{"9 Side St", "2.50", "11.50"}},
+		{TemplateOrderPlaced, "es", &delivery, "Pedido #42 realizado en Casa Verde", []string{"9 Side St", "2.50", "11.50"}},
+		{TemplateOrderReady, "en", order, "Order #42 is ready for pickup", []string{"Casa Verde"}},
+		{TemplateOrderReady, "es", order, "El pedido #42 está listo para recoger", []string{"Casa Verde"}},
+		{TemplateOrderReady, "en", &delivery, "Order #42 is on its way", []string{"Casa Verde"}},
+		{TemplateOrderReady, "es", &delivery, "El pedido #42 está en camino", []string{"Casa Verde"}},
+		{TemplateOrderCancelled, "en", order, "Order #42 cancelled", []string{"Casa Verde"}},
+		{TemplateOrderCancelled, "es", order, "Pedido #42 cancelado", []string{"Casa Verde"}},
+		{TemplateRefundIssued, "en", order, "Refund of $4.50 for order #42", []string{"4.50"}},
+		{TemplateRefundIssued, "es", order, "Reembolso de $4.50 del pedido #42", []string{"4.50"}},
+		{TemplateNotification, "en", notification, "Fresh surplus nearby", []string{"Casa Verde has new bags"}},
+		{TemplateNotification, "es", notification, "Fresh surplus nearby", []string{"Casa Verde has new bags"}},
+		// Locales without templates fall back to English, regional ones to their language
+		{TemplateOrderCancelled, "fr-FR", order, "Order #42 cancelled", []string{"Casa Verde"}},
+		{TemplateOrderCancelled, "", order, "Order #42 cancelled", []string{"Casa Verde"}},
+		{TemplateOrderCancelled, "es-MX", order, "Pedido #42 cancelado", []string{"Casa Verde"}},
+	}
+
+	for _, test := range tests {
+		msg, err := Render(test.name, test.locale, test.data)
+		if err != nil {
+			t.Errorf("%s/%s: %v", test.name, test.locale, err)
+			continue
+		}
+		if msg.Subject != test.subject {
+			t.Errorf("%s/%s: got subject %q, want %q", test.name, test.locale, msg.Subject, test.subject)
+		}
+		if !strings.Contains(msg.HTML, "<title>"+test.subject+"</title>") {
+			t.Errorf("%s/%s: HTML title isn't the subject", test.name, test.locale)
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(msg.Text, want) {
+				t.Errorf("%s/%s: text body doesn't contain %q:\n%s", test.name, test.locale, want, msg.Text)
+			}
+			if !strings.Contains(msg.HTML, want) {
+				t.Errorf("%s/%s: HTML body doesn't contain %q", test.name, test.locale, want)
+			}
+		}
+	}
+
+	if _, err := Render("no_such_template", "en", &base); err == nil {
+		t.Error("rendering an unknown template succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+package geo
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Geocode cache defaults
+const (
+	DefaultGeocodeCacheTTL  = 24 * time.Hour
+	DefaultGeocodeCacheSize = 10000
+)
+
+// CachedGeocoder remembers another geocoder's answers, including addresses it
+// couldn't find, for a while. Other errors aren't cached so outages can recover.
+type CachedGeocoder struct {
+	geocoder Geocoder
+	size     int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+	mutex    sync.Mutex
+}
+
+// geocodeEntry is a cached answer; place is nil for ErrAddressNotFound
+type geocodeEntry struct {
+	key     string
+	place   *Place
+	expires time.Time
+}
+
+// NewCachedGeocoder caches up to size answers from geocoder for ttl
+func NewCachedGeocoder(geocoder Geocoder, ttl time.Duration, size int) *CachedGeocoder {
+	return &CachedGeocoder{geocoder: geocoder, size: size, ttl: ttl, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Geocode returns a cached answer for the address, or asks the wrapped geocoder
+func (c *CachedGeocoder) Geocode(ctx context.Context, address string) (*Place, error) {
+	return c.lookup("address:"+normalizeAddress(address), func() (*Place, error) {
+		return c.geocoder.Geocode(ctx, address)
+	})
+}
+
+// ReverseGeocode returns a cached answer for points within about a metre of the
+// given one, or asks the wrapped geocoder
+func (c *CachedGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (*Place, error) {
+	return c.lookup(fmt.Sprintf("point:%.5f,%.5f", lat, lon), func() (*Place, error) {
+		return c.geocoder.ReverseGeocode(ctx, lat, lon)
+	})
+}
+
+func (c *CachedGeocoder) lookup(key string, fetch func() (*Place, error)) (*Place, error) {
+	if entry, ok := c.get(key, time.Now()); ok {
+		if entry.place == nil {
+			return nil, ErrAddressNotFound
+		}
+		place := *entry.place
+		return &place, nil
+	}
+
+	place, err := fetch()
+	if err != nil {
+		if errors.Is(err, ErrAddressNotFound) {
+			c.put(key, nil, time.Now())
+		}
+		return nil, err
+	}
+	cached := *place
+	c.put(key, &cached, time.Now())
+	return place, nil
+}
+
+func (c *CachedGeocoder) get(key string, now time.Time) (*geocodeEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*geocodeEntry)
+	if !now.Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+func (c *CachedGeocoder) put(key string, place *Place, now time.Time) {
+	if c.ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &geocodeEntry{key: key, place: place, expires: now.Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*geocodeEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+}
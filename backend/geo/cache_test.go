@@ -0,0 +1,103 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingGeocoder answers from a map of normalized addresses and counts its calls
+type countingGeocoder struct {
+	places map[string]Place
+	err    error
+	calls  int
+}
+
+func (g *countingGeocoder) Geocode(ctx context.Context, address string) (*Place, error) {
+	g.calls++
+	if g.err != nil {
+		return nil, g.err
+	}
+	place, ok := g.places[normalizeAddress(address)]
+	if !ok {
+		return nil, ErrAddressNotFound
+	}
+	return &place, nil
+}
+
+func (g *countingGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (*Place, error) {
+	g.calls++
+	return &Place{Address: "somewhere", Latitude: lat, Longitude: lon}, nil
+}
+
+func TestCachedGeocoder(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		lookups   []string
+		wantCalls int
+	}{
+		{"repeated address", []string{"Boston", "Boston", "Boston"}, 1},
+		{"same address typed differently", []string{"Boston, MA", "  boston ma.", "BOSTON; MA"}, 1},
+		{"different addresses", []string{"Boston", "Philadelphia", "Boston"}, 2},
+		{"unknown address is remembered", []string{"Atlantis", "Atlantis"}, 1},
+		{"least recently used is evicted", []string{"Boston", "Philadelphia", "Chicago", "Boston"}, 4},
+		{"use keeps an entry", []string{"Boston", "Philadelphia", "Boston", "Chicago", "Boston"}, 3},
+	}
+
+	for _, test := range tests {
+		inner := &countingGeocoder{places: map[string]Place{
+			"boston":       {Address: "Boston", Latitude: 42.36, Longitude: -71.06},
+			"boston ma":    {Address: "Boston", Latitude: 42.36, Longitude: -71.06},
+			"philadelphia": {Address: "Philadelphia", Latitude: 39.95, Longitude: -75.17},
+			"chicago":      {Address: "Chicago", Latitude: 41.88, Longitude: -87.63},
+		}}
+		cache := NewCachedGeocoder(inner, time.Hour, 2)
+		for _, address := range test.lookups {
+			cache.Geocode(ctx, address)
+		}
+		if inner.calls != test.wantCalls {
+			t.Errorf("%s: made %d lookups, want %d", test.name, inner.calls, test.wantCalls)
+		}
+	}
+}
+
+func TestCachedGeocoderErrorsAndExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	outage := &countingGeocoder{err: errors.New("geocoder unavailable")}
+	cache := NewCachedGeocoder(outage, time.Hour, 10)
+	cache.Geocode(ctx, "Boston")
+	cache.Geocode(ctx, "Boston")
+	if outage.calls != 2 {
+		t.Errorf("outage errors were cached: made %d lookups, want 2", outage.calls)
+	}
+
+	inner := &countingGeocoder{}
+	cache = NewCachedGeocoder(inner, time.Hour, 10)
+	now := time.Now()
+	cache.put("point:1,2", &Place{Address: "cached"}, now)
+	if _, ok := cache.get("point:1,2", now.Add(59*time.Minute)); !ok {
+		t.Error("entry expired before its TTL")
+	}
+	if _, ok := cache.get("point:1,2", now.Add(time.Hour)); ok {
+		t.Error("entry outlived its TTL")
+	}
+
+	place, err := cache.ReverseGeocode(ctx, 40.000001, -74.000001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	place.Address = "changed by the caller"
+	if again, _ := cache.ReverseGeocode(ctx, 40.000002, -74.000002); again.Address != "somewhere" || inner.calls != 1 {
+		t.Errorf("nearby point got %q after %d lookups, want the cached copy after 1", again.Address, inner.calls)
+	}
+
+	disabled := NewCachedGeocoder(inner, 0, 10)
+	disabled.Geocode(ctx, "Boston")
+	disabled.Geocode(ctx, "Boston")
+	if inner.calls != 3 {
+		t.Errorf("a zero TTL still cached: made %d lookups, want 3", inner.calls)
+	}
+}
@@ -0,0 +1,120 @@
+package geo
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//go:embed gazetteer.csv
+var defaultGazetteerCSV string
+
+// gazetteerReverseMaxKm is how far from a point the nearest place may be
+const gazetteerReverseMaxKm = 50
+
+// Gazetteer geocodes offline against a list of named places, for development and
+// tests. An address matches the place whose name or alias appears in it, preferring
+// the longest match, so "12 Main St, Brooklyn, NY" finds Brooklyn before New York.
+type Gazetteer struct {
+	places []gazetteerPlace
+}
+
+type gazetteerPlace struct {
+	Place
+	// names are the normalized name and aliases
+	names []string
+}
+
+// DefaultGazetteer returns the bundled gazetteer of major cities
+func DefaultGazetteer() (*Gazetteer, error) {
+	return ReadGazetteer(strings.NewReader(defaultGazetteerCSV))
+}
+
+// LoadGazetteer reads a gazetteer CSV file, see ReadGazetteer
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gazetteer: %w", err)
+	}
+	defer file.Close()
+	return ReadGazetteer(file)
+}
+
+// ReadGazetteer reads CSV with a header row and the columns name, latitude,
+// longitude and optionally aliases, separated by "|"
+func ReadGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gazetteer: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("gazetteer is empty")
+	}
+
+	gazetteer := &Gazetteer{}
+	for i, record := range records[1:] {
+		if len(record) < 3 {
+			return nil, fmt.Errorf("gazetteer line %d: expected name, latitude and longitude", i+2)
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if latErr != nil || lonErr != nil || !ValidCoordinates(lat, lon) {
+			return nil, fmt.Errorf("gazetteer line %d: invalid coordinates", i+2)
+		}
+
+		place := gazetteerPlace{Place: Place{Address: strings.TrimSpace(record[0]), Latitude: lat, Longitude: lon}}
+		place.names = append(place.names, normalizeAddress(record[0]))
+		if len(record) > 3 {
+			for _, alias := range strings.Split(record[3], "|") {
+				if alias = normalizeAddress(alias); alias != "" {
+					place.names = append(place.names, alias)
+				}
+			}
+		}
+		gazetteer.places = append(gazetteer.places, place)
+	}
+	return gazetteer, nil
+}
+
+// Geocode returns the place whose name appears in the address as whole words
+func (g *Gazetteer) Geocode(ctx context.Context, address string) (*Place, error) {
+	normalized := " " + normalizeAddress(address) + " "
+	var best *gazetteerPlace
+	bestLength := 0
+	for i := range g.places {
+		for _, name := range g.places[i].names {
+			if len(name) > bestLength && strings.Contains(normalized, " "+name+" ") {
+				best, bestLength = &g.places[i], len(name)
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrAddressNotFound
+	}
+	place := best.Place
+	return &place, nil
+}
+
+// ReverseGeocode returns the nearest place within 50 km
+func (g *Gazetteer) ReverseGeocode(ctx context.Context, lat, lon float64) (*Place, error) {
+	var best *gazetteerPlace
+	bestDistance := float64(gazetteerReverseMaxKm)
+	for i := range g.places {
+		if distance := Distance(lat, lon, g.places[i].Latitude, g.places[i].Longitude); distance <= bestDistance {
+			best, bestDistance = &g.places[i], distance
+		}
+	}
+	if best == nil {
+		return nil, ErrAddressNotFound
+	}
+	place := best.Place
+	return &place, nil
+}
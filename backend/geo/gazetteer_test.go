@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGazetteerGeocode(t *testing.T) {
+	gazetteer, err := DefaultGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		want    string // "" for ErrAddressNotFound
+	}{
+		{"New York", "New York, NY, USA"},
+		{"12 Main St, Brooklyn, NY", "Brooklyn, New York, NY, USA"},
+		{"350 5th Ave, NYC", "New York, NY, USA"},
+		{"  BOSTON,   ma ", "Boston, MA, USA"},
+		{"Philly", "Philadelphia, PA, USA"},
+		{"Newarkville", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		place, err := gazetteer.Geocode(context.Background(), test.address)
+		if test.want == "" {
+			if !errors.Is(err, ErrAddressNotFound) {
+				t.Errorf("Geocode(%q) = %v, %v, want ErrAddressNotFound", test.address, place, err)
+			}
+			continue
+		}
+		if err != nil || place.Address != test.want {
+			t.Errorf("Geocode(%q) = %v, %v, want %q", test.address, place, err, test.want)
+		}
+	}
+}
+
+func TestGazetteerReverseGeocode(t *testing.T) {
+	gazetteer, err := DefaultGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lat, lon float64
+		want     string // "" for ErrAddressNotFound
+	}{
+		{40.6782, -73.9442, "Brooklyn, New York, NY, USA"},
+		{42.36, -71.06, "Boston, MA, USA"},
+		{0, 0, ""},
+	}
+
+	for _, test := range tests {
+		place, err := gazetteer.ReverseGeocode(context.Background(), test.lat, test.lon)
+		if test.want == "" {
+			if !errors.Is(err, ErrAddressNotFound) {
+				t.Errorf("ReverseGeocode(%v, %v) = %v, %v, want ErrAddressNotFound", test.lat, test.lon, place, err)
+			}
+			continue
+		}
+		if err != nil || place.Address != test.want {
+			t.Errorf("ReverseGeocode(%v, %v) = %v, %v, want %q", test.lat, test.lon, place, err, test.want)
+		}
+	}
+}
+
+func TestReadGazetteer(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+	}{
+		{"aliases", "name,latitude,longitude,aliases\nSpringfield,39.78,-89.65,springfield il|capital city\n", false},
+		{"comments", "name,latitude,longitude\n# a comment\nSpringfield,39.78,-89.65\n", false},
+		{"empty", "", true},
+		{"missing column", "name,latitude,longitude\nSpringfield,39.78\n", true},
+		{"bad latitude", "name,latitude,longitude\nSpringfield,north,-89.65\n", true},
+		{"out of range", "name,latitude,longitude\nSpringfield,91,-89.65\n", true},
+	}
+
+	for _, test := range tests {
+		gazetteer, err := ReadGazetteer(strings.NewReader(test.csv))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if place, err := gazetteer.Geocode(context.Background(), "Springfield"); err != nil || place.Latitude != 39.78 {
+			t.Errorf("%s: Geocode(Springfield) = %v, %v", test.name, place, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package geo has the distance maths and SQL used for nearby searches, and geocoding
+// of addresses. Searches prefilter rows with a latitude/longitude bounding box, which
+// a plain B-tree index can serve, and only compute exact distances for rows inside it.
+package geo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadiusKm is the mean radius of the Earth
+const EarthRadiusKm = 6371.0
+
+// kmPerDegreeLat is the length of one degree of latitude
+const kmPerDegreeLat = math.Pi * EarthRadiusKm / 180
+
+// ErrInvalidCursor is returned when a nearby search cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Distance returns the great-circle distance in km between two points. It uses the
+// asin form of the Haversine formula, clamped so rounding can't produce NaN the way
+// acos does for points very close together.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// DistanceSQL is the SQL for Distance from the point in the given parameters, or
+// any SQL expressions, to a row's latitude and longitude columns
+func DistanceSQL(latColumn, lonColumn, latParam, lonParam string) string {
+	return fmt.Sprintf(`(%[5]g * 2 * asin(sqrt(LEAST(1,
+		power(sin(radians(%[1]s - %[3]s) / 2), 2) +
+		cos(radians(%[3]s)) * cos(radians(%[1]s)) * power(sin(radians(%[2]s - %[4]s) / 2), 2)
+	))))`, latColumn, lonColumn, latParam, lonParam, EarthRadiusKm)
+}
+
+// BoundingBox is the latitude/longitude rectangle around a circle. When it crosses
+// the antimeridian MinLon is greater than MaxLon and the box wraps around.
+type BoundingBox struct {
+	MinLat float64
+	MaxLat float64
+	MinLon float64
+	MaxLon float64
+}
+
+// BoundingBoxAround returns the smallest box holding every point within radiusKm
+// of a centre. Near the poles it spans all longitudes.
+func BoundingBoxAround(lat, lon, radiusKm float64) BoundingBox {
+	delta := radiusKm / kmPerDegreeLat
+	box := BoundingBox{MinLat: lat - delta, MaxLat: lat + delta, MinLon: -180, MaxLon: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	// Widest longitude span of the circle, reached north or south of the centre
+	// (Bounding Coordinates, J. P. Matuschek)
+	angular := radiusKm / EarthRadiusKm
+	sinRatio := math.Sin(angular) / math.Cos(radians(lat))
+	if sinRatio >= 1 {
+		return box
+	}
+	deltaLon := degrees(math.Asin(sinRatio))
+	box.MinLon = normalizeLongitude(lon - deltaLon)
+	box.MaxLon = normalizeLongitude(lon + deltaLon)
+	return box
+}
+
+// Contains reports whether a point is inside the box
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
+
+// SQL returns a condition matching rows inside the box and its arguments, numbered
+// from firstArg. It only compares the columns, so an index on them can be used.
+func (b BoundingBox) SQL(latColumn, lonColumn string, firstArg int) (string, []interface{}) {
+	args := []interface{}{b.MinLat, b.MaxLat}
+	condition := fmt.Sprintf("%s BETWEEN $%d AND $%d", latColumn, firstArg, firstArg+1)
+
+	switch {
+	case b.MinLon == -180 && b.MaxLon == 180:
+		// every longitude
+	case b.MinLon <= b.MaxLon:
+		condition += fmt.Sprintf(" AND %s BETWEEN $%d AND $%d", lonColumn, firstArg+2, firstArg+3)
+		args = append(args, b.MinLon, b.MaxLon)
+	default:
+		condition += fmt.Sprintf(" AND (%s >= $%d OR %s <= $%d)", lonColumn, firstArg+2, lonColumn, firstArg+3)
+		args = append(args, b.MinLon, b.MaxLon)
+	}
+
+	return condition, args
+}
+
+// Cursor is a position in a list ordered by distance, then id
+type Cursor struct {
+	Distance float64
+	ID       int
+}
+
+// Encode returns the cursor as an opaque string
+func (c Cursor) Encode() string {
+	raw := strconv.FormatFloat(c.Distance, 'g', -1, 64) + ":" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reverses Cursor.Encode
+func DecodeCursor(value string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	distance, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	cursor.Distance, err = strconv.ParseFloat(distance, 64)
+	if err != nil || cursor.Distance < 0 || math.IsNaN(cursor.Distance) || math.IsInf(cursor.Distance, 0) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	cursor.ID, err = strconv.Atoi(id)
+	if err != nil || cursor.ID <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// ValidCoordinates reports whether lat and lon are a point on Earth
+func ValidCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// normalizeLongitude wraps a longitude into [-180, 180]
+func normalizeLongitude(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
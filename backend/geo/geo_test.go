@@ -0,0 +1,300 @@
+package geo
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// destination returns the point distanceKm from a start along a bearing in degrees
+func destination(lat, lon, bearing, distanceKm float64) (float64, float64) {
+	angular := distanceKm / EarthRadiusKm
+	lat1, lon1, theta := radians(lat), radians(lon), radians(bearing)
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angular) + math.Cos(lat1)*math.Sin(angular)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(angular)*math.Cos(lat1), math.Cos(angular)-math.Sin(lat1)*math.Sin(lat2))
+	return degrees(lat2), normalizeLongitude(degrees(lon2))
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 40.7128, -74.0060, 40.7128, -74.0060, 0},
+		{"one degree of latitude", 10, 20, 11, 20, kmPerDegreeLat},
+		{"one degree of longitude at the equator", 0, 20, 0, 21, kmPerDegreeLat},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, kmPerDegreeLat},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * EarthRadiusKm},
+		{"antipodes", 0, 0, 0, 180, math.Pi * EarthRadiusKm},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.56},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.75},
+	}
+
+	for _, test := range tests {
+		got := Distance(test.lat1, test.lon1, test.lat2, test.lon2)
+		if math.Abs(got-test.want) > 0.01 {
+			t.Errorf("%s: got %.4f km, want %.4f km", test.name, got, test.want)
+		}
+		if back := Distance(test.lat2, test.lon2, test.lat1, test.lon1); back != got {
+			t.Errorf("%s: distance back is %.6f km, there %.6f km", test.name, back, got)
+		}
+	}
+}
+
+func TestDistanceOfNearbyPoints(t *testing.T) {
+	// Points this close make the acos formula's argument round above 1
+	lat, lon := 40.7128, -74.0060
+	for _, offset := range []float64{0, 1e-12, 1e-9, 1e-6} {
+		got := Distance(lat, lon, lat+offset, lon+offset)
+		if math.IsNaN(got) || got < 0 || got > 1 {
+			t.Errorf("offset %g: got %v km", offset, got)
+		}
+	}
+}
+
+func TestBoundingBoxAround(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		radiusKm float64
+		want     BoundingBox // compared to a hundredth of a degree
+		wraps    bool
+	}{
+		{"equator", 0, 0, 111.19, BoundingBox{MinLat: -1, MaxLat: 1, MinLon: -1, MaxLon: 1}, false},
+		{"mid latitude", 60, 10, 10, BoundingBox{MinLat: 59.91, MaxLat: 60.09, MinLon: 9.82, MaxLon: 10.18}, false},
+		{"east of the antimeridian", 0, 179.95, 11.12, BoundingBox{MinLat: -0.1, MaxLat: 0.1, MinLon: 179.85, MaxLon: -179.95}, true},
+		{"west of the antimeridian", -20, -179.95, 11.12, BoundingBox{MinLat: -20.1, MaxLat: -19.9, MinLon: 179.94, MaxLon: -179.84}, true},
+		{"on the antimeridian", 0, 180, 11.12, BoundingBox{MinLat: -0.1, MaxLat: 0.1, MinLon: 179.9, MaxLon: -179.9}, true},
+		{"circle over the north pole", 89.95, 45, 10, BoundingBox{MinLat: 89.86, MaxLat: 90, MinLon: -180, MaxLon: 180}, false},
+		{"circle over the south pole", -89.95, -45, 10, BoundingBox{MinLat: -90, MaxLat: -89.86, MinLon: -180, MaxLon: 180}, false},
+		{"at the north pole", 90, 0, 1, BoundingBox{MinLat: 89.99, MaxLat: 90, MinLon: -180, MaxLon: 180}, false},
+		{"near but short of the pole", 89, 0, 50, BoundingBox{MinLat: 88.55, MaxLat: 89.45, MinLon: -26.72, MaxLon: 26.72}, false},
+	}
+
+	for _, test := range tests {
+		box := BoundingBoxAround(test.lat, test.lon, test.radiusKm)
+		for _, pair := range [][2]float64{
+			{box.MinLat, test.want.MinLat}, {box.MaxLat, test.want.MaxLat},
+			{box.MinLon, test.want.MinLon}, {box.MaxLon, test.want.MaxLon},
+		} {
+			if math.Abs(pair[0]-pair[1]) > 0.01 {
+				t.Errorf("%s: got %+v, want %+v", test.name, box, test.want)
+				break
+			}
+		}
+		if wraps := box.MinLon > box.MaxLon; wraps != test.wraps {
+			t.Errorf("%s: box %+v wraps %v, want %v", test.name, box, wraps, test.wraps)
+		}
+
+		// Every point within the radius must be inside the box
+		for bearing := 0.0; bearing < 360; bearing += 7.5 {
+			for _, fraction := range []float64{0.5, 0.999} {
+				lat, lon := destination(test.lat, test.lon, bearing, test.radiusKm*fraction)
+				if !box.Contains(lat, lon) {
+					t.Errorf("%s: box %+v misses %.5f,%.5f at bearing %v", test.name, box, lat, lon, bearing)
+				}
+			}
+		}
+	}
+}
+
+func TestBoundingBoxContainsAcrossTheAntimeridian(t *testing.T) {
+	box := BoundingBox{MinLat: -1, MaxLat: 1, MinLon: 179, MaxLon: -179}
+	tests := []struct {
+		lat, lon float64
+		want     bool
+	}{
+		{0, 179.5, true},
+		{0, 180, true},
+		{0, -180, true},
+		{0, -179.5, true},
+		{0, 0, false},
+		{0, 178.9, false},
+		{0, -178.9, false},
+		{1.1, 179.5, false},
+	}
+	for _, test := range tests {
+		if got := box.Contains(test.lat, test.lon); got != test.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", test.lat, test.lon, got, test.want)
+		}
+	}
+}
+
+func TestBoundingBoxSQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		box       BoundingBox
+		condition string
+		args      int
+	}{
+		{"plain", BoundingBox{MinLat: 1, MaxLat: 2, MinLon: 3, MaxLon: 4}, "lat BETWEEN $3 AND $4 AND lon BETWEEN $5 AND $6", 4},
+		{"wrapping", BoundingBox{MinLat: 1, MaxLat: 2, MinLon: 179, MaxLon: -179}, "lat BETWEEN $3 AND $4 AND (lon >= $5 OR lon <= $6)", 4},
+		{"all longitudes", BoundingBox{MinLat: 89, MaxLat: 90, MinLon: -180, MaxLon: 180}, "lat BETWEEN $3 AND $4", 2},
+	}
+	for _, test := range tests {
+		condition, args := test.box.SQL("lat", "lon", 3)
+		if condition != test.condition || len(args) != test.args {
+			t.Errorf("%s: got %q with %d args, want %q with %d", test.name, condition, len(args), test.condition, test.args)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cursor := range []Cursor{
+		{Distance: 0, ID: 1},
+		{Distance: 1.5, ID: 42},
+		{Distance: 1e-9, ID: 7},
+		{Distance: 12345.678901234567, ID: math.MaxInt32},
+		{Distance: math.Pi * EarthRadiusKm, ID: 3},
+	} {
+		encoded := cursor.Encode()
+		if strings.ContainsAny(encoded, "+/=") {
+			t.Errorf("%+v: encoded as %q, which isn't URL safe", cursor, encoded)
+		}
+		decoded, err := DecodeCursor(encoded)
+		if err != nil || decoded != cursor {
+			t.Errorf("%+v: decoded as %+v, %v", cursor, decoded, err)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsMalformedInput(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("1.5:4"))},
+		{"no separator", encode("1.5")},
+		{"no id", encode("1.5:")},
+		{"no distance", encode(":42")},
+		{"distance not a number", encode("near:42")},
+		{"negative distance", encode("-1:42")},
+		{"NaN distance", encode("NaN:42")},
+		{"infinite distance", encode("+Inf:42")},
+		{"id not a number", encode("1.5:x")},
+		{"zero id", encode("1.5:0")},
+		{"negative id", encode("1.5:-3")},
+		{"extra field", encode("1.5:42:7")},
+	}
+	for _, test := range tests {
+		if cursor, err := DecodeCursor(test.value); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got %+v, %v, want ErrInvalidCursor", test.name, cursor, err)
+		}
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	square := []Point{{0, 0}, {0, 1}, {1, 1}, {1, 0}}
+	notch := []Point{{0, 0}, {0, 2}, {2, 2}, {2, 0}, {1, 1}} // concave, dented from the west
+	tests := []struct {
+		name     string
+		polygon  []Point
+		lat, lon float64
+		want     bool
+	}{
+		{"centre", square, 0.5, 0.5, true},
+		{"outside", square, 1.5, 0.5, false},
+		{"level with a vertex, outside", square, 1, 2, false},
+		// Points on the south and west edges are inside and on the north and east
+		// edges outside, so a point on an edge two zones share is in exactly one
+		{"west edge", square, 0.5, 0, true},
+		{"south edge", square, 0, 0.5, true},
+		{"east edge", square, 0.5, 1, false},
+		{"north edge", square, 1, 0.5, false},
+		{"south-west vertex", square, 0, 0, true},
+		{"south-east vertex", square, 0, 1, false},
+		{"north-west vertex", square, 1, 0, false},
+		{"north-east vertex", square, 1, 1, false},
+		{"in the concave polygon", notch, 1, 1.5, true},
+		{"in its notch", notch, 1, 0.5, false},
+		{"beside the notch", notch, 0.25, 0.5, true},
+		{"too few points", square[:2], 0.5, 0.5, false},
+	}
+	for _, test := range tests {
+		if got := PolygonContains(test.polygon, test.lat, test.lon); got != test.want {
+			t.Errorf("%s: PolygonContains(%v, %v) = %v, want %v", test.name, test.lat, test.lon, got, test.want)
+		}
+	}
+}
+
+func TestPolygonContainsSharedEdges(t *testing.T) {
+	west := []Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	east := []Point{{0, 1}, {1, 1}, {1, 2}, {0, 2}}
+	for _, lat := range []float64{0, 0.25, 0.5, 0.75} {
+		if PolygonContains(west, lat, 1) == PolygonContains(east, lat, 1) {
+			t.Errorf("point %v,1 on the shared edge is in both zones or neither", lat)
+		}
+	}
+}
+
+// BenchmarkNearby compares a nearby search over restaurants sorted by latitude,
+// read only inside the bounding box as the index does, with a full scan. The
+// cmd/nearby-bench command runs the same comparison against Postgres.
+func BenchmarkNearby(b *testing.B) {
+	const restaurants, radiusKm, limit = 100000, 10.0, 20
+
+	// Restaurants clustered around a few cities, with a quarter spread out
+	rng := rand.New(rand.NewSource(42))
+	cities := []Point{{40.7128, -74.0060}, {34.0522, -118.2437}, {41.8781, -87.6298}, {47.6062, -122.3321}}
+	points := make([]Point, restaurants)
+	for i := range points {
+		if rng.Float64() < 0.25 {
+			points[i] = Point{25 + rng.Float64()*24, -124 + rng.Float64()*57}
+			continue
+		}
+		city := cities[rng.Intn(len(cities))]
+		points[i] = Point{city.Latitude + rng.NormFloat64()*0.08, city.Longitude + rng.NormFloat64()*0.1}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Latitude < points[j].Latitude })
+	centres := make([]Point, 1000)
+	for i := range centres {
+		centres[i] = points[rng.Intn(len(points))]
+	}
+
+	nearest := func(distances []float64) []float64 {
+		sort.Float64s(distances)
+		if len(distances) > limit {
+			distances = distances[:limit]
+		}
+		return distances
+	}
+
+	b.Run("bounding box", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			centre := centres[i%len(centres)]
+			box := BoundingBoxAround(centre.Latitude, centre.Longitude, radiusKm)
+			var distances []float64
+			for j := sort.Search(len(points), func(j int) bool { return points[j].Latitude >= box.MinLat }); j < len(points) && points[j].Latitude <= box.MaxLat; j++ {
+				p := points[j]
+				if !box.Contains(p.Latitude, p.Longitude) {
+					continue
+				}
+				if distance := Distance(centre.Latitude, centre.Longitude, p.Latitude, p.Longitude); distance <= radiusKm {
+					distances = append(distances, distance)
+				}
+			}
+			nearest(distances)
+		}
+	})
+
+	b.Run("full scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			centre := centres[i%len(centres)]
+			var distances []float64
+			for _, p := range points {
+				if distance := Distance(centre.Latitude, centre.Longitude, p.Latitude, p.Longitude); distance <= radiusKm {
+					distances = append(distances, distance)
+				}
+			}
+			nearest(distances)
+		}
+	})
+}
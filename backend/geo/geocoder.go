@@ -0,0 +1,111 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAddressNotFound is returned when a geocoder has no match for an address or point
+var ErrAddressNotFound = errors.New("address not found")
+
+// Place is an address and its coordinates
+type Place struct {
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder turns addresses into coordinates and back
+type Geocoder interface {
+	// Geocode returns the best match for an address, or ErrAddressNotFound
+	Geocode(ctx context.Context, address string) (*Place, error)
+	// ReverseGeocode returns the address at or nearest to a point, or ErrAddressNotFound
+	ReverseGeocode(ctx context.Context, lat, lon float64) (*Place, error)
+}
+
+// NewGeocoderFromEnv creates a cached geocoder from the environment. NOMINATIM_URL
+// selects a Nominatim-compatible server, with GEOCODER_USER_AGENT and GEOCODER_EMAIL
+// identifying this app as its usage policy asks. Otherwise GAZETTEER_PATH names a
+// CSV gazetteer, and without either the bundled gazetteer of major cities is used.
+// GEOCODER_CACHE_TTL_SECONDS and GEOCODER_CACHE_SIZE tune the cache.
+func NewGeocoderFromEnv() (Geocoder, error) {
+	var geocoder Geocoder
+	if url := os.Getenv("NOMINATIM_URL"); url != "" {
+		nominatim := NewNominatimGeocoder(url, os.Getenv("GEOCODER_USER_AGENT"))
+		nominatim.Email = os.Getenv("GEOCODER_EMAIL")
+		geocoder = nominatim
+	} else if path := os.Getenv("GAZETTEER_PATH"); path != "" {
+		gazetteer, err := LoadGazetteer(path)
+		if err != nil {
+			return nil, err
+		}
+		geocoder = gazetteer
+	} else {
+		gazetteer, err := DefaultGazetteer()
+		if err != nil {
+			return nil, err
+		}
+		geocoder = gazetteer
+	}
+
+	ttl := DefaultGeocodeCacheTTL
+	if value := os.Getenv("GEOCODER_CACHE_TTL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("GEOCODER_CACHE_TTL_SECONDS must be a positive number")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	size := DefaultGeocodeCacheSize
+	if value := os.Getenv("GEOCODER_CACHE_SIZE"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return nil, errors.New("GEOCODER_CACHE_SIZE must be a positive number")
+		}
+	}
+
+	return NewCachedGeocoder(geocoder, ttl, size), nil
+}
+
+// Locate fills in whichever of an address and its coordinates is missing: it geocodes
+// an address given without coordinates and reverse geocodes coordinates given without
+// an address. It returns the address and coordinates to store, unchanged when both or
+// neither were given.
+func Locate(ctx context.Context, geocoder Geocoder, address string, lat, lon *float64) (string, *float64, *float64, error) {
+	address = strings.TrimSpace(address)
+	hasPoint := lat != nil && lon != nil
+	switch {
+	case address != "" && !hasPoint:
+		place, err := geocoder.Geocode(ctx, address)
+		if err != nil {
+			return address, nil, nil, fmt.Errorf("failed to geocode address: %w", err)
+		}
+		return address, &place.Latitude, &place.Longitude, nil
+	case address == "" && hasPoint:
+		if !ValidCoordinates(*lat, *lon) {
+			return address, lat, lon, fmt.Errorf("failed to reverse geocode: %w", ErrAddressNotFound)
+		}
+		place, err := geocoder.ReverseGeocode(ctx, *lat, *lon)
+		if err != nil {
+			return address, lat, lon, fmt.Errorf("failed to reverse geocode: %w", err)
+		}
+		return place.Address, lat, lon, nil
+	default:
+		return address, lat, lon, nil
+	}
+}
+
+// normalizeAddress lower-cases an address and reduces punctuation and spacing, so
+// the same address typed differently shares a cache entry and gazetteer lookup
+func normalizeAddress(address string) string {
+	fields := strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.' || r == ';' || r == '\t' || r == '\n'
+	})
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,46 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	gazetteer, err := DefaultGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	float := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name        string
+		address     string
+		lat, lon    *float64
+		wantAddress string
+		wantLat     *float64
+		wantErr     error
+	}{
+		{"address only", " Brooklyn, NY ", nil, nil, "Brooklyn, NY", float(40.6782), nil},
+		{"point only", "", float(42.3601), float(-71.0589), "Boston, MA, USA", float(42.3601), nil},
+		{"both kept", "My kitchen", float(1), float(2), "My kitchen", float(1), nil},
+		{"neither", "", nil, nil, "", nil, nil},
+		{"latitude without longitude", "", float(1), nil, "", float(1), nil},
+		{"unknown address", "Atlantis", nil, nil, "Atlantis", nil, ErrAddressNotFound},
+		{"invalid point", "", float(91), float(0), "", float(91), ErrAddressNotFound},
+	}
+
+	for _, test := range tests {
+		address, lat, _, err := Locate(context.Background(), gazetteer, test.address, test.lat, test.lon)
+		if !errors.Is(err, test.wantErr) || (err != nil) != (test.wantErr != nil) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if address != test.wantAddress {
+			t.Errorf("%s: got address %q, want %q", test.name, address, test.wantAddress)
+		}
+		if (lat == nil) != (test.wantLat == nil) || (lat != nil && *lat != *test.wantLat) {
+			t.Errorf("%s: got latitude %v, want %v", test.name, lat, test.wantLat)
+		}
+	}
+}
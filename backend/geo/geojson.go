@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// tileSize is the width in pixels of a web map tile
+const tileSize = 256
+
+// maxMercatorLat is where Web Mercator maps are cut off
+const maxMercatorLat = 85.05112878
+
+// FeatureCollection is a GeoJSON feature collection (RFC 7946)
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// Feature is a GeoJSON point feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   PointGeometry          `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// PointGeometry is a GeoJSON point. Coordinates are longitude first.
+type PointGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// NewFeatureCollection returns an empty feature collection
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+}
+
+// NewPointFeature returns a point feature at lat and lon
+func NewPointFeature(id interface{}, lat, lon float64, properties map[string]interface{}) *Feature {
+	return &Feature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   PointGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}},
+		Properties: properties,
+	}
+}
+
+// WorldPixel returns a point's position in pixels on a Web Mercator map of the
+// whole world at a zoom level, from the top left corner
+func WorldPixel(lat, lon float64, zoom int) (float64, float64) {
+	lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+	size := float64(tileSize) * math.Exp2(float64(zoom))
+	x := (lon + 180) / 360 * size
+	sinLat := math.Sin(radians(lat))
+	y := (0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)) * size
+	return x, y
+}
+
+// WorldPixelSQL is the SQL for WorldPixel at zoom 0 of a row's latitude and
+// longitude columns. Positions at other zooms are these times 2^zoom.
+func WorldPixelSQL(latColumn, lonColumn string) (string, string) {
+	x := fmt.Sprintf("((%s + 180) / 360 * %d)::float8", lonColumn, tileSize)
+	sinLat := fmt.Sprintf("sin(radians(GREATEST(%[1]g, LEAST(%[2]g, %[3]s))))", -maxMercatorLat, maxMercatorLat, latColumn)
+	y := fmt.Sprintf("((0.5 - ln((1 + %[1]s) / (1 - %[1]s)) / (4 * pi())) * %[2]d)::float8", sinLat, tileSize)
+	return x, y
+}
@@ -0,0 +1,144 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNominatimUserAgent = "SurplusSupper/1.0"
+	// nominatimMinInterval spaces requests as the public Nominatim usage policy asks
+	nominatimMinInterval = time.Second
+)
+
+// NominatimGeocoder geocodes with a Nominatim-compatible HTTP API
+type NominatimGeocoder struct {
+	URL       string
+	UserAgent string
+	// Email is sent with each request so the server's operators can get in touch
+	Email       string
+	MinInterval time.Duration
+	HTTPClient  *http.Client
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewNominatimGeocoder creates a geocoder for the Nominatim server at baseURL
+func NewNominatimGeocoder(baseURL, userAgent string) *NominatimGeocoder {
+	if userAgent == "" {
+		userAgent = defaultNominatimUserAgent
+	}
+	return &NominatimGeocoder{
+		URL:         strings.TrimRight(baseURL, "/"),
+		UserAgent:   userAgent,
+		MinInterval: nominatimMinInterval,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// nominatimPlace is a place in a Nominatim response
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	Error       string `json:"error"`
+}
+
+// Geocode looks an address up with /search
+func (g *NominatimGeocoder) Geocode(ctx context.Context, address string) (*Place, error) {
+	var places []nominatimPlace
+	if err := g.get(ctx, "/search", url.Values{"q": {address}, "limit": {"1"}}, &places); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, ErrAddressNotFound
+	}
+	return places[0].place()
+}
+
+// ReverseGeocode looks a point up with /reverse
+func (g *NominatimGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (*Place, error) {
+	var place nominatimPlace
+	params := url.Values{
+		"lat": {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon": {strconv.FormatFloat(lon, 'f', -1, 64)},
+	}
+	if err := g.get(ctx, "/reverse", params, &place); err != nil {
+		return nil, err
+	}
+	// Nominatim answers 200 with an error field when nothing is there
+	if place.Error != "" {
+		return nil, ErrAddressNotFound
+	}
+	return place.place()
+}
+
+// get calls an endpoint and decodes its JSON response, waiting out MinInterval
+// since the previous request
+func (g *NominatimGeocoder) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	if err := g.wait(ctx); err != nil {
+		return err
+	}
+
+	params.Set("format", "jsonv2")
+	if g.Email != "" {
+		params.Set("email", g.Email)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.URL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create geocoding request: %w", err)
+	}
+	req.Header.Set("User-Agent", g.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("geocoding request failed with status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	return nil
+}
+
+// wait blocks until MinInterval has passed since the last request
+func (g *NominatimGeocoder) wait(ctx context.Context) error {
+	g.mu.Lock()
+	next := g.last.Add(g.MinInterval)
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	g.last = next
+	g.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p nominatimPlace) place() (*Place, error) {
+	lat, latErr := strconv.ParseFloat(p.Lat, 64)
+	lon, lonErr := strconv.ParseFloat(p.Lon, 64)
+	if latErr != nil || lonErr != nil || !ValidCoordinates(lat, lon) {
+		return nil, fmt.Errorf("geocoding response has invalid coordinates %q, %q", p.Lat, p.Lon)
+	}
+	return &Place{Address: p.DisplayName, Latitude: lat, Longitude: lon}, nil
+}
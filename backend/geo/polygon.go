@@ -0,0 +1,47 @@
+package geo
+
+// Point is a latitude and longitude
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// ValidPolygon reports whether points outline an area: at least three valid
+// coordinates, not crossing the antimeridian
+func ValidPolygon(points []Point) bool {
+	if len(points) < 3 {
+		return false
+	}
+	minLon, maxLon := 180.0, -180.0
+	for _, point := range points {
+		if !ValidCoordinates(point.Latitude, point.Longitude) {
+			return false
+		}
+		if point.Longitude < minLon {
+			minLon = point.Longitude
+		}
+		if point.Longitude > maxLon {
+			maxLon = point.Longitude
+		}
+	}
+	return maxLon-minLon < 180
+}
+
+// PolygonContains reports whether a point is inside a polygon, treating latitude
+// and longitude as plane coordinates. That's close enough for delivery zones a few
+// kilometres across. The polygon is closed implicitly; its first point needn't be
+// repeated at the end. A point on an edge that two zones share is in exactly one.
+func PolygonContains(polygon []Point, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		// Ray casting: count edges crossed by a ray running east from the point
+		if (a.Latitude > lat) != (b.Latitude > lat) {
+			crossing := a.Longitude + (lat-a.Latitude)*(b.Longitude-a.Longitude)/(b.Latitude-a.Latitude)
+			if lon < crossing {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
@@ -3,14 +3,32 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+	_ "time/tzdata" // notification quiet hours need timezones even on slim images
 
+	"surplus-supper/backend/aiService"
 	"surplus-supper/backend/api/auth"
+	"surplus-supper/backend/api/notifications"
+	"surplus-supper/backend/api/orders"
+	"surplus-supper/backend/api/recommendations"
+	"surplus-supper/backend/api/restaurants"
+	"surplus-supper/backend/api/reviews"
+	"surplus-supper/backend/api/search"
+	"surplus-supper/backend/api/waitlist"
+	"surplus-supper/backend/emailService"
+	"surplus-supper/backend/geo"
 	"surplus-supper/backend/middleware"
+	"surplus-supper/backend/notificationService"
+	"surplus-supper/backend/orderService"
+	"surplus-supper/backend/recommendationService"
+	"surplus-supper/backend/restaurantService"
+	"surplus-supper/backend/searchService"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
@@ -73,10 +91,95 @@ func main() {
 	// Initialize auth handler and middleware
 	var authHandler *auth.AuthHandler
 	var authMiddleware *middleware.AuthMiddleware
+	var notificationHandler *notifications.NotificationHandler
+	var orderHandler *orders.OrderHandler
+	var recommendationHandler *recommendations.RecommendationHandler
+	var searchHandler *search.SearchHandler
+	var restaurantHandler *restaurants.RestaurantHandler
+	var reviewHandler *reviews.ReviewHandler
+	var waitlistHandler *waitlist.WaitlistHandler
 
 	if db != nil {
 		authHandler = auth.NewAuthHandler(db)
 		authMiddleware = middleware.NewAuthMiddleware()
+		notifier := notificationService.NewNotificationService(db)
+		vapidKeys, err := notificationService.LoadVAPIDKeys()
+		if err != nil {
+			log.Fatal("Failed to load VAPID keys:", err)
+		}
+		notifier.EnableWebPush(vapidKeys)
+
+		// Transactional email over SMTP, or into a local maildir when SMTP_HOST is unset
+		emails := emailService.NewEmailService(db, emailService.NewMailerFromEnv())
+		notifier.RegisterChannel(emailService.NewNotificationChannel(emails, notifier))
+		authHandler.SetEmailService(emails)
+
+		// Coordinates for profile, restaurant search and delivery addresses, see geo.NewGeocoderFromEnv
+		geocoder, err := geo.NewGeocoderFromEnv()
+		if err != nil {
+			log.Fatal("Invalid geocoder configuration:", err)
+		}
+		authHandler.SetGeocoder(geocoder)
+
+		// New surplus alerts and scheduled markdowns for expiring inventory
+		restaurantManager := restaurantService.NewRestaurantService(db)
+		restaurantManager.SetOfferNotifier(notifier)
+		restaurantManager.SetPriceDropNotifier(notifier)
+		stopMarkdowns := restaurantManager.StartMarkdownScheduler(time.Minute)
+		defer stopMarkdowns()
+		notificationHandler = notifications.NewNotificationHandler(notifier)
+
+		// Creative Kitchen recipe cards for Chef's Surprise orders, see aiService.NewLLMClientFromEnv
+		ai := aiService.NewAIService(db)
+		costConfig, err := aiService.AICostConfigFromEnv()
+		if err != nil {
+			log.Fatal("Invalid AI cost configuration:", err)
+		}
+		ai.SetCostConfig(costConfig)
+		if llm, err := aiService.NewLLMClientFromEnv(); err != nil {
+			log.Printf("Warning: Creative Kitchen disabled: %v", err)
+		} else {
+			ai.SetLLMClient(llm)
+		}
+		// Waste ledger at expiry, and promotion of items the demand forecast expects to go to waste
+		restaurantManager.SetWastePredictor(ai)
+		stopWaste := restaurantManager.StartWasteScheduler(time.Minute)
+		defer stopWaste()
+
+		orderManager := orderService.NewOrderService(db)
+		orderManager.SetOrderNotifier(emails)
+		orderManager.SetRecipeCardGenerator(ai)
+		orderManager.SetPickupChecker(restaurantManager)
+		orderManager.SetDeliveryQuoter(restaurantManager)
+
+		// Waitlists for sold-out items, with holds passed on when they run out
+		restaurantManager.SetWaitlistNotifier(notifier)
+		orderManager.SetStockReleaser(restaurantManager)
+		stopWaitlists := restaurantManager.StartWaitlistScheduler(time.Minute)
+		defer stopWaitlists()
+		waitlistHandler = waitlist.NewWaitlistHandler(restaurantManager)
+
+		orderHandler = orders.NewOrderHandler(orderManager, ai)
+		orderHandler.SetGeocoder(geocoder)
+		recommendationHandler = recommendations.NewRecommendationHandler(recommendationService.NewRecommendationService(db))
+		searchHandler = search.NewSearchHandler(searchService.NewSearchService(db))
+		restaurantHandler = restaurants.NewRestaurantHandler(restaurantManager)
+		restaurantHandler.SetGeocoder(geocoder)
+		// Reviews, hidden and restored by the comma-separated user IDs in REVIEW_MODERATORS
+		reviewHandler = reviews.NewReviewHandler(restaurantManager)
+		moderators, err := parseUserIDs(os.Getenv("REVIEW_MODERATORS"))
+		if err != nil {
+			log.Fatal("Invalid REVIEW_MODERATORS:", err)
+		}
+		reviewHandler.SetModerators(moderators)
+
+		// Local stand-in for browser push services, see notificationService.FakePushService
+		if os.Getenv("WEBPUSH_FAKE") == "true" {
+			fakePush := notificationService.NewFakePushService("http://localhost:" + getPort() + "/dev/push")
+			r.PathPrefix("/dev/push/").Handler(fakePush)
+			notifier.AllowInsecurePushEndpoints()
+			log.Printf("Fake push service enabled at /dev/push/")
+		}
 	} else {
 		log.Printf("Warning: Authentication disabled - no database connection")
 	}
@@ -85,25 +188,13 @@ func main() {
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Public endpoints (no authentication required)
-	api.HandleFunc("/restaurants", func(w http.ResponseWriter, r *http.Request) {
-		restaurants, err := getRestaurants(db, r.URL.Query().Get("location"))
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		json.NewEncoder(w).Encode(restaurants)
-	}).Methods("GET", "OPTIONS")
-
-	api.HandleFunc("/restaurant/{id}", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		id, _ := strconv.Atoi(vars["id"])
-		restaurant, err := getRestaurantById(db, id)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		json.NewEncoder(w).Encode(restaurant)
-	}).Methods("GET", "OPTIONS")
+	if restaurantHandler != nil {
+		api.HandleFunc("/restaurants", restaurantHandler.ListRestaurants).Methods("GET", "OPTIONS")
+		api.HandleFunc("/restaurants/map", restaurantHandler.MapFeatures).Methods("GET", "OPTIONS")
+		api.HandleFunc("/restaurant/{id:[0-9]+}", restaurantHandler.GetRestaurant).Methods("GET", "OPTIONS")
+		api.HandleFunc("/restaurant/{id:[0-9]+}/delivery-quote", restaurantHandler.QuoteDelivery).Methods("GET", "OPTIONS")
+		api.HandleFunc("/restaurant/{id:[0-9]+}/reviews", reviewHandler.ListRestaurantReviews).Methods("GET", "OPTIONS")
+	}
 
 	// Authentication endpoints
 	if authHandler != nil {
@@ -116,6 +207,64 @@ func main() {
 		protected.Use(authMiddleware.Authenticate)
 		protected.HandleFunc("/profile", authHandler.Profile).Methods("GET", "OPTIONS")
 		protected.HandleFunc("/profile", authHandler.UpdateProfile).Methods("PUT", "OPTIONS")
+		protected.HandleFunc("/profile/allergens", authHandler.Allergens).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/profile/allergens", authHandler.UpdateAllergens).Methods("PUT", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/restaurants", authHandler.FavoriteRestaurants).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/restaurants", authHandler.AddFavoriteRestaurant).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/restaurants/{id:[0-9]+}", authHandler.RemoveFavoriteRestaurant).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/categories", authHandler.FavoriteCategories).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/categories", authHandler.AddFavoriteCategory).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/profile/favorites/categories/{category}", authHandler.RemoveFavoriteCategory).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/profile/staff", restaurantHandler.LinkStaffAccount).Methods("POST", "OPTIONS")
+
+		// Notification endpoints
+		api.HandleFunc("/notifications/unsubscribe", notificationHandler.Unsubscribe).Methods("GET", "POST", "OPTIONS")
+		api.HandleFunc("/notifications/push/vapid-public-key", notificationHandler.VAPIDPublicKey).Methods("GET", "OPTIONS")
+		notificationAPI := api.PathPrefix("/notifications").Subrouter()
+		notificationAPI.Use(authMiddleware.Authenticate)
+		notificationAPI.HandleFunc("", notificationHandler.ListNotifications).Methods("GET", "OPTIONS")
+		notificationAPI.HandleFunc("/unread-count", notificationHandler.UnreadCount).Methods("GET", "OPTIONS")
+		notificationAPI.HandleFunc("/read-all", notificationHandler.MarkAllRead).Methods("POST", "OPTIONS")
+		notificationAPI.HandleFunc("/bulk-delete", notificationHandler.BulkDelete).Methods("POST", "OPTIONS")
+		notificationAPI.HandleFunc("/{id:[0-9]+}/read", notificationHandler.MarkRead).Methods("POST", "OPTIONS")
+		notificationAPI.HandleFunc("/{id:[0-9]+}", notificationHandler.DeleteNotification).Methods("DELETE", "OPTIONS")
+		notificationAPI.HandleFunc("/alerts", notificationHandler.ListAlerts).Methods("GET", "OPTIONS")
+		notificationAPI.HandleFunc("/alerts", notificationHandler.CreateAlert).Methods("POST", "OPTIONS")
+		notificationAPI.HandleFunc("/alerts/{id}", notificationHandler.DeleteAlert).Methods("DELETE", "OPTIONS")
+		notificationAPI.HandleFunc("/preferences", notificationHandler.GetPreferences).Methods("GET", "OPTIONS")
+		notificationAPI.HandleFunc("/preferences", notificationHandler.UpdatePreferences).Methods("PUT", "OPTIONS")
+		notificationAPI.HandleFunc("/push/subscriptions", notificationHandler.SavePushSubscription).Methods("POST", "OPTIONS")
+		notificationAPI.HandleFunc("/push/subscriptions", notificationHandler.DeletePushSubscription).Methods("DELETE", "OPTIONS")
+
+		// Order endpoints
+		orderAPI := api.PathPrefix("/orders").Subrouter()
+		orderAPI.Use(authMiddleware.Authenticate)
+		orderAPI.HandleFunc("", orderHandler.ListOrders).Methods("GET", "OPTIONS")
+		orderAPI.HandleFunc("", orderHandler.CreateOrder).Methods("POST", "OPTIONS")
+		orderAPI.HandleFunc("/{id:[0-9]+}", orderHandler.GetOrder).Methods("GET", "OPTIONS")
+
+		// Reviews of collected orders, reports, owner replies and moderation
+		reviewAPI := api.PathPrefix("/reviews").Subrouter()
+		reviewAPI.Use(authMiddleware.Authenticate)
+		reviewAPI.HandleFunc("", reviewHandler.CreateReview).Methods("POST", "OPTIONS")
+		reviewAPI.HandleFunc("/{id:[0-9]+}/report", reviewHandler.ReportReview).Methods("POST", "OPTIONS")
+		reviewAPI.HandleFunc("/{id:[0-9]+}/reply", reviewHandler.ReplyToReview).Methods("PUT", "OPTIONS")
+		reviewAPI.HandleFunc("/{id:[0-9]+}/moderation", reviewHandler.ModerateReview).Methods("PUT", "OPTIONS")
+
+		// Waitlists for sold-out inventory items and offers
+		waitlistAPI := api.PathPrefix("/waitlist").Subrouter()
+		waitlistAPI.Use(authMiddleware.Authenticate)
+		waitlistAPI.HandleFunc("", waitlistHandler.ListWaitlists).Methods("GET", "OPTIONS")
+		waitlistAPI.HandleFunc("", waitlistHandler.JoinWaitlist).Methods("POST", "OPTIONS")
+		waitlistAPI.HandleFunc("/{id:[0-9]+}", waitlistHandler.LeaveWaitlist).Methods("DELETE", "OPTIONS")
+
+		// Personalized recommendations
+		recommendationAPI := api.PathPrefix("/recommendations").Subrouter()
+		recommendationAPI.Use(authMiddleware.Authenticate)
+		recommendationAPI.HandleFunc("", recommendationHandler.Recommendations).Methods("GET", "OPTIONS")
+
+		// Full-text search across restaurants, inventory items and offers
+		api.HandleFunc("/search", searchHandler.Search).Methods("GET", "OPTIONS")
 	} else {
 		// Mock auth endpoints for development
 		api.HandleFunc("/auth/register", mockAuthHandler).Methods("POST", "OPTIONS")
@@ -127,14 +276,15 @@ func main() {
 	// Health check endpoint
 	r.HandleFunc("/health", healthCheckHandler(db)).Methods("GET")
 
-	// WebSocket endpoint for real-time notifications
-	r.HandleFunc("/ws", websocketHandler(db))
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// WebSocket endpoint for real-time notifications, authenticated with ?token=<JWT>
+	if notificationHandler != nil {
+		r.HandleFunc("/ws", notificationHandler.WebSocket)
+	} else {
+		r.HandleFunc("/ws", websocketHandler(db))
 	}
 
+	port := getPort()
+
 	// Add CORS middleware
 	handler := corsMiddleware(r)
 
@@ -142,68 +292,28 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
 
-type Restaurant struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Address     string  `json:"address"`
-	Latitude    float64 `json:"latitude"`
-	Longitude   float64 `json:"longitude"`
-	Phone       string  `json:"phone"`
-	Email       string  `json:"email"`
-	CuisineType string  `json:"cuisine_type"`
-	Rating      float64 `json:"rating"`
-	Distance    float64 `json:"distance"`
-}
-
-func getRestaurants(db *sql.DB, location string) ([]Restaurant, error) {
-	query := `SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating 
-			 FROM restaurants`
-
-	if location != "" {
-		query += ` WHERE LOWER(address) LIKE LOWER($1)`
-		rows, err := db.Query(query, "%"+location+"%")
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		return scanRestaurants(rows)
-	}
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	return scanRestaurants(rows)
-}
-
-func getRestaurantById(db *sql.DB, id int) (*Restaurant, error) {
-	var r Restaurant
-	err := db.QueryRow(`
-		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating 
-		FROM restaurants WHERE id = $1`, id).Scan(
-		&r.ID, &r.Name, &r.Description, &r.Address, &r.Latitude, &r.Longitude,
-		&r.Phone, &r.Email, &r.CuisineType, &r.Rating)
-	if err != nil {
-		return nil, err
+func getPort() string {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
 	}
-	return &r, nil
+	return port
 }
 
-func scanRestaurants(rows *sql.Rows) ([]Restaurant, error) {
-	var restaurants []Restaurant
-	for rows.Next() {
-		var r Restaurant
-		err := rows.Scan(
-			&r.ID, &r.Name, &r.Description, &r.Address, &r.Latitude, &r.Longitude,
-			&r.Phone, &r.Email, &r.CuisineType, &r.Rating)
-		if err != nil {
-			return nil, err
+// parseUserIDs parses a comma-separated list of user IDs, ignoring blanks
+func parseUserIDs(value string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid user ID %q", field)
 		}
-		restaurants = append(restaurants, r)
+		ids = append(ids, id)
 	}
-	return restaurants, nil
+	return ids, nil
 }
 
 func initDB() (*sql.DB, error) {
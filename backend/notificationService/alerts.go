@@ -0,0 +1,229 @@
+package notificationService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"surplus-supper/backend/geo"
+)
+
+// alertCooldown is the minimum time between two "near me" alerts for the same user
+const alertCooldown = 30 * time.Minute
+
+// AlertSubscription represents an area a user wants to hear about new surplus in
+type AlertSubscription struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"user_id"`
+	Latitude       *float64   `json:"latitude"`
+	Longitude      *float64   `json:"longitude"`
+	RadiusKm       float64    `json:"radius_km"`
+	CuisineType    string     `json:"cuisine_type"`
+	MaxPrice       *float64   `json:"max_price"`
+	IsActive       bool       `json:"is_active"`
+	LastNotifiedAt *time.Time `json:"last_notified_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CreateAlertSubscriptionInput represents the input for saving an alert area.
+// Leaving Latitude/Longitude empty falls back to the user's profile location.
+type CreateAlertSubscriptionInput struct {
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	RadiusKm    float64  `json:"radius_km"`
+	CuisineType string   `json:"cuisine_type"`
+	MaxPrice    *float64 `json:"max_price"`
+}
+
+// CreateAlertSubscription saves a new alert area for a user
+func (s *NotificationService) CreateAlertSubscription(userID int, input CreateAlertSubscriptionInput) (*AlertSubscription, error) {
+	if (input.Latitude == nil) != (input.Longitude == nil) {
+		return nil, errors.New("latitude and longitude must be provided together")
+	}
+	if input.RadiusKm <= 0 {
+		input.RadiusKm = 2.0
+	}
+	if input.RadiusKm > 50 {
+		return nil, errors.New("radius_km must be at most 50")
+	}
+
+	var cuisineType sql.NullString
+	if input.CuisineType != "" {
+		cuisineType = sql.NullString{String: input.CuisineType, Valid: true}
+	}
+
+	row := s.db.QueryRow(`
+		INSERT INTO alert_subscriptions (user_id, latitude, longitude, radius_km, cuisine_type, max_price)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, user_id, latitude, longitude, radius_km, cuisine_type, max_price, is_active, last_notified_at, created_at
+	`, userID, input.Latitude, input.Longitude, input.RadiusKm, cuisineType, input.MaxPrice)
+
+	subscription, err := scanAlertSubscription(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert subscription: %w", err)
+	}
+
+	return subscription, nil
+}
+
+// GetUserAlertSubscriptions retrieves the alert areas saved by a user
+func (s *NotificationService) GetUserAlertSubscriptions(userID int) ([]*AlertSubscription, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, latitude, longitude, radius_km, cuisine_type, max_price, is_active, last_notified_at, created_at
+		FROM alert_subscriptions WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []*AlertSubscription
+	for rows.Next() {
+		subscription, err := scanAlertSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteAlertSubscription deletes one of the user's alert areas
+func (s *NotificationService) DeleteAlertSubscription(userID, id int) error {
+	result, err := s.db.Exec("DELETE FROM alert_subscriptions WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("alert subscription not found")
+	}
+
+	return nil
+}
+
+// NotifyAlertSubscribers notifies every user whose alert area covers the restaurant
+// and whose filters match the new item. Users alerted within alertCooldown are skipped,
+// as are the restaurant's followers, who hear about it from BroadcastToRestaurant.
+func (s *NotificationService) NotifyAlertSubscribers(restaurantID int, itemName string, price float64) error {
+	distance := geo.DistanceSQL("r.latitude", "r.longitude", "COALESCE(s.latitude, u.latitude)", "COALESCE(s.longitude, u.longitude)")
+	rows, err := s.db.Query(`
+		SELECT s.id, s.user_id, r.name
+		FROM alert_subscriptions s
+		JOIN users u ON u.id = s.user_id
+		JOIN restaurants r ON r.id = $1
+		WHERE s.is_active = true
+		AND r.is_active = true
+		AND (s.cuisine_type IS NULL OR LOWER(s.cuisine_type) = LOWER(r.cuisine_type))
+		AND (s.max_price IS NULL OR s.max_price >= $2)
+		AND COALESCE(s.latitude, u.latitude) IS NOT NULL
+		AND COALESCE(s.longitude, u.longitude) IS NOT NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM favorite_restaurants f WHERE f.user_id = s.user_id AND f.restaurant_id = r.id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM alert_subscriptions recent
+			WHERE recent.user_id = s.user_id AND recent.last_notified_at > NOW() - make_interval(secs => $3)
+		)
+		AND `+distance+` <= s.radius_km
+		ORDER BY s.user_id, s.id
+	`, restaurantID, price, int(alertCooldown.Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to get alert subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptionIDs []int
+	var userIDs []int
+	var restaurantName string
+	seen := make(map[int]bool)
+	for rows.Next() {
+		var subscriptionID, userID int
+		if err := rows.Scan(&subscriptionID, &userID, &restaurantName); err != nil {
+			return fmt.Errorf("failed to scan alert subscriber: %w", err)
+		}
+		subscriptionIDs = append(subscriptionIDs, subscriptionID)
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read alert subscribers: %w", err)
+	}
+
+	title := "New Surplus Near You"
+	message := fmt.Sprintf("%s just listed '%s' for $%.2f", restaurantName, itemName, price)
+
+	for _, userID := range userIDs {
+		// Claim the user's cooldown first so concurrent publishes don't double-send
+		result, err := s.db.Exec(`
+			UPDATE alert_subscriptions SET last_notified_at = NOW()
+			WHERE user_id = $1 AND NOT EXISTS (
+				SELECT 1 FROM alert_subscriptions recent
+				WHERE recent.user_id = $1 AND recent.last_notified_at > NOW() - make_interval(secs => $2)
+			)
+		`, userID, int(alertCooldown.Seconds()))
+		if err != nil {
+			log.Printf("Failed to update alert cooldown for user %d: %v", userID, err)
+			continue
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		_, err = s.CreateNotification(userID, restaurantID, title, message, TypeNewOffer)
+		if err != nil && !errors.Is(err, ErrNotificationSuppressed) {
+			log.Printf("Failed to create alert notification for user %d: %v", userID, err)
+		}
+	}
+
+	log.Printf("Matched %d alert subscriptions (%d users) for restaurant %d", len(subscriptionIDs), len(userIDs), restaurantID)
+
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAlertSubscription scans an alert_subscriptions row
+func scanAlertSubscription(row rowScanner) (*AlertSubscription, error) {
+	var subscription AlertSubscription
+	var latitude, longitude, maxPrice sql.NullFloat64
+	var cuisineType sql.NullString
+	var lastNotifiedAt sql.NullTime
+
+	err := row.Scan(
+		&subscription.ID, &subscription.UserID, &latitude, &longitude, &subscription.RadiusKm, &cuisineType, &maxPrice, &subscription.IsActive, &lastNotifiedAt, &subscription.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if latitude.Valid {
+		subscription.Latitude = &latitude.Float64
+	}
+	if longitude.Valid {
+		subscription.Longitude = &longitude.Float64
+	}
+	if maxPrice.Valid {
+		subscription.MaxPrice = &maxPrice.Float64
+	}
+	if lastNotifiedAt.Valid {
+		subscription.LastNotifiedAt = &lastNotifiedAt.Time
+	}
+	subscription.CuisineType = cuisineType.String
+
+	return &subscription, nil
+}
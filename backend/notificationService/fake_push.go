@@ -0,0 +1,161 @@
+package notificationService
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakePushMessage is a message received and decrypted by the fake push service
+type FakePushMessage struct {
+	SubscriptionID string          `json:"subscription_id"`
+	Authorization  string          `json:"authorization"`
+	TTL            string          `json:"ttl"`
+	Urgency        string          `json:"urgency"`
+	Payload        json.RawMessage `json:"payload"`
+	ReceivedAt     time.Time       `json:"received_at"`
+}
+
+// fakeSubscriber holds the browser-side keys of a fake subscription
+type fakeSubscriber struct {
+	privateKey *ecdh.PrivateKey
+	auth       []byte
+}
+
+// FakePushService stands in for a browser vendor's push service during local
+// development. It hands out subscriptions whose keys it keeps, so it can decrypt
+// and record everything PushChannel sends to them.
+//
+// Routes, relative to where it is mounted:
+//
+//	POST /subscriptions  create a subscription to register via the normal API
+//	POST /{id}           receive a push message (what PushChannel calls)
+//	GET  /messages       list decrypted messages
+type FakePushService struct {
+	baseURL     string
+	subscribers map[string]*fakeSubscriber
+	messages    []FakePushMessage
+	mutex       sync.Mutex
+}
+
+// NewFakePushService creates a fake push service reachable at baseURL
+func NewFakePushService(baseURL string) *FakePushService {
+	return &FakePushService{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		subscribers: make(map[string]*fakeSubscriber),
+	}
+}
+
+// NewSubscription creates a subscription as a browser would after PushManager.subscribe
+func (f *FakePushService) NewSubscription() (*PushSubscriptionInput, error) {
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate subscriber key: %w", err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		return nil, fmt.Errorf("failed to generate auth secret: %w", err)
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate subscription ID: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(idBytes)
+
+	f.mutex.Lock()
+	f.subscribers[id] = &fakeSubscriber{privateKey: privateKey, auth: auth}
+	f.mutex.Unlock()
+
+	input := &PushSubscriptionInput{Endpoint: f.baseURL + "/" + id}
+	input.Keys.P256dh = base64.RawURLEncoding.EncodeToString(privateKey.PublicKey().Bytes())
+	input.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+
+	return input, nil
+}
+
+// Messages returns every message received so far
+func (f *FakePushService) Messages() []FakePushMessage {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]FakePushMessage{}, f.messages...)
+}
+
+// ServeHTTP implements the fake push service endpoints
+func (f *FakePushService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path[strings.LastIndex(r.URL.Path, "/"):], "/")
+
+	switch {
+	case r.Method == "GET" && path == "messages":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(f.Messages())
+	case r.Method == "POST" && path == "subscriptions":
+		subscription, err := f.NewSubscription()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(subscription)
+	case r.Method == "POST":
+		f.receive(w, r, path)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// receive validates and decrypts a push message the way a real push service and browser would
+func (f *FakePushService) receive(w http.ResponseWriter, r *http.Request, id string) {
+	f.mutex.Lock()
+	subscriber, ok := f.subscribers[id]
+	f.mutex.Unlock()
+	if !ok {
+		http.Error(w, "subscription not found", http.StatusGone)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") {
+		http.Error(w, "missing VAPID authorization", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" {
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, pushRecordSize+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > pushRecordSize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	payload, err := decryptPushPayload(body, subscriber.privateKey, subscriber.auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	f.messages = append(f.messages, FakePushMessage{
+		SubscriptionID: id,
+		Authorization:  r.Header.Get("Authorization"),
+		TTL:            r.Header.Get("TTL"),
+		Urgency:        r.Header.Get("Urgency"),
+		Payload:        json.RawMessage(payload),
+		ReceivedAt:     time.Now(),
+	})
+	f.mutex.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+}
@@ -3,10 +3,14 @@ package notificationService
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Notification represents a notification in the system
@@ -25,6 +29,9 @@ type Notification struct {
 type NotificationService struct {
 	db *sql.DB
 	clients map[int]*Client
+	channels map[string]DeliveryChannel
+	vapidKeys *VAPIDKeys
+	insecurePush bool
 	mutex   sync.RWMutex
 }
 
@@ -41,29 +48,157 @@ func NewNotificationService(db *sql.DB) *NotificationService {
 	return &NotificationService{
 		db:      db,
 		clients: make(map[int]*Client),
+		channels: make(map[string]DeliveryChannel),
 	}
 }
 
-// CreateNotification creates a new notification
+// CreateNotification creates a new notification and delivers it on the channels the user has enabled.
+// It returns ErrNotificationSuppressed when the user's preferences turn off every channel.
 func (s *NotificationService) CreateNotification(userID, restaurantID int, title, message, notificationType string) (*Notification, error) {
-	var notification Notification
-	err := s.db.QueryRow(`
-		INSERT INTO notifications (user_id, restaurant_id, title, message, type)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, restaurant_id, title, message, type, is_read, created_at
-	`, userID, restaurantID, title, message, notificationType).Scan(
-		&notification.ID, &notification.UserID, &notification.RestaurantID, &notification.Title, &notification.Message, &notification.Type, &notification.IsRead, &notification.CreatedAt,
-	)
+	channels, err := s.deliveryChannels(userID, notificationType, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create notification: %w", err)
+		return nil, fmt.Errorf("failed to resolve notification preferences: %w", err)
+	}
+	if !channels.InApp && !channels.Email && !channels.Push {
+		return nil, ErrNotificationSuppressed
+	}
+
+	notification := Notification{
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		Title:        title,
+		Message:      message,
+		Type:         notificationType,
+		CreatedAt:    time.Now(),
+	}
+
+	// Only in-app notifications are kept in the user's inbox
+	if channels.InApp {
+		err := s.db.QueryRow(`
+			INSERT INTO notifications (user_id, restaurant_id, title, message, type)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, user_id, restaurant_id, title, message, type, is_read, created_at
+		`, userID, restaurantID, title, message, notificationType).Scan(
+			&notification.ID, &notification.UserID, &notification.RestaurantID, &notification.Title, &notification.Message, &notification.Type, &notification.IsRead, &notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notification: %w", err)
+		}
+
+		// Send real-time notification to connected clients
+		s.sendToUser(userID, notification)
 	}
 
-	// Send real-time notification to connected clients
-	s.sendToUser(userID, notification)
+	if channels.Email {
+		s.deliver(ChannelEmail, &notification)
+	}
+	if channels.Push {
+		s.deliver(ChannelPush, &notification)
+	}
 
 	return &notification, nil
 }
 
+// deliver hands a notification to a registered delivery channel, if there is one.
+// Channels talk to external services, so delivery runs in the background.
+func (s *NotificationService) deliver(name string, notification *Notification) {
+	s.mutex.RLock()
+	channel, ok := s.channels[name]
+	s.mutex.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	go func() {
+		if err := channel.Deliver(notification); err != nil {
+			log.Printf("Failed to deliver notification to user %d via %s: %v", notification.UserID, name, err)
+		}
+	}()
+}
+
+// ListNotificationsInput controls which page of a user's notifications is returned
+type ListNotificationsInput struct {
+	UnreadOnly bool
+	Cursor     string // NextCursor from the previous page, empty for the first page
+	Limit      int
+}
+
+// NotificationPage is one page of notifications, newest first
+type NotificationPage struct {
+	Notifications []*Notification `json:"notifications"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+	HasMore       bool            `json:"has_more"`
+}
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page size limits for notification listing and bulk actions
+const (
+	DefaultNotificationPageSize = 20
+	MaxNotificationPageSize     = 100
+	MaxBulkNotificationIDs      = 500
+)
+
+// ListNotifications returns a page of a user's notifications. Pages are keyed on the
+// notification ID so new notifications arriving between requests don't shift later pages.
+func (s *NotificationService) ListNotifications(userID int, input ListNotificationsInput) (*NotificationPage, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = DefaultNotificationPageSize
+	}
+	if limit > MaxNotificationPageSize {
+		limit = MaxNotificationPageSize
+	}
+
+	// IDs are positive, so 0 means "from the newest"
+	before := 0
+	if input.Cursor != "" {
+		var err error
+		before, err = strconv.Atoi(input.Cursor)
+		if err != nil || before <= 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// Fetch one extra row to learn whether there is another page
+	rows, err := s.db.Query(`
+		SELECT id, user_id, COALESCE(restaurant_id, 0), title, message, type, is_read, created_at
+		FROM notifications
+		WHERE user_id = $1 AND ($2 = 0 OR id < $2) AND (NOT $3 OR is_read = false)
+		ORDER BY id DESC
+		LIMIT $4
+	`, userID, before, input.UnreadOnly, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user notifications: %w", err)
+	}
+	defer rows.Close()
+
+	page := &NotificationPage{Notifications: []*Notification{}}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&notification.ID, &notification.UserID, &notification.RestaurantID, &notification.Title, &notification.Message, &notification.Type, &notification.IsRead, &notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		page.Notifications = append(page.Notifications, &notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user notifications: %w", err)
+	}
+
+	if len(page.Notifications) > limit {
+		page.Notifications = page.Notifications[:limit]
+		page.HasMore = true
+		page.NextCursor = strconv.Itoa(page.Notifications[limit-1].ID)
+	}
+
+	return page, nil
+}
+
 // GetUserNotifications retrieves notifications for a user
 func (s *NotificationService) GetUserNotifications(userID int, unreadOnly bool) ([]*Notification, error) {
 	var query string
@@ -106,13 +241,13 @@ func (s *NotificationService) GetUserNotifications(userID int, unreadOnly bool)
 	return notifications, nil
 }
 
-// MarkNotificationAsRead marks a notification as read
-func (s *NotificationService) MarkNotificationAsRead(id int) (*Notification, error) {
+// MarkNotificationAsRead marks one of a user's notifications as read
+func (s *NotificationService) MarkNotificationAsRead(userID, id int) (*Notification, error) {
 	var notification Notification
 	err := s.db.QueryRow(`
-		UPDATE notifications SET is_read = true WHERE id = $1
-		RETURNING id, user_id, restaurant_id, title, message, type, is_read, created_at
-	`, id).Scan(
+		UPDATE notifications SET is_read = true WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, COALESCE(restaurant_id, 0), title, message, type, is_read, created_at
+	`, id, userID).Scan(
 		&notification.ID, &notification.UserID, &notification.RestaurantID, &notification.Title, &notification.Message, &notification.Type, &notification.IsRead, &notification.CreatedAt,
 	)
 	if err != nil {
@@ -125,9 +260,24 @@ func (s *NotificationService) MarkNotificationAsRead(id int) (*Notification, err
 	return &notification, nil
 }
 
-// DeleteNotification deletes a notification
-func (s *NotificationService) DeleteNotification(id int) error {
-	result, err := s.db.Exec("DELETE FROM notifications WHERE id = $1", id)
+// MarkAllAsRead marks all of a user's notifications as read and returns how many changed
+func (s *NotificationService) MarkAllAsRead(userID int) (int, error) {
+	result, err := s.db.Exec("UPDATE notifications SET is_read = true WHERE user_id = $1 AND is_read = false", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// DeleteNotification deletes one of a user's notifications
+func (s *NotificationService) DeleteNotification(userID, id int) error {
+	result, err := s.db.Exec("DELETE FROM notifications WHERE id = $1 AND user_id = $2", id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete notification: %w", err)
 	}
@@ -144,6 +294,34 @@ func (s *NotificationService) DeleteNotification(id int) error {
 	return nil
 }
 
+// DeleteNotifications deletes the given notifications belonging to a user and returns how many were deleted.
+// IDs of other users' notifications are ignored.
+func (s *NotificationService) DeleteNotifications(userID int, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if len(ids) > MaxBulkNotificationIDs {
+		return 0, fmt.Errorf("cannot delete more than %d notifications at once", MaxBulkNotificationIDs)
+	}
+
+	ids64 := make([]int64, len(ids))
+	for i, id := range ids {
+		ids64[i] = int64(id)
+	}
+
+	result, err := s.db.Exec("DELETE FROM notifications WHERE user_id = $1 AND id = ANY($2)", userID, pq.Array(ids64))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete notifications: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
 // RegisterClient registers a new WebSocket client
 func (s *NotificationService) RegisterClient(client *Client) {
 	s.mutex.Lock()
@@ -187,14 +365,14 @@ func (s *NotificationService) sendToUser(userID int, notification Notification)
 	}
 }
 
-// BroadcastToRestaurant sends a notification to all users of a restaurant
+// BroadcastToRestaurant sends a notification to the users who follow a restaurant,
+// that is have it in their favorite restaurants
 func (s *NotificationService) BroadcastToRestaurant(restaurantID int, title, message, notificationType string) error {
-	// Get all users who have ordered from this restaurant
 	rows, err := s.db.Query(`
-		SELECT DISTINCT user_id FROM orders WHERE restaurant_id = $1 AND user_id IS NOT NULL
+		SELECT user_id FROM favorite_restaurants WHERE restaurant_id = $1 ORDER BY user_id
 	`, restaurantID)
 	if err != nil {
-		return fmt.Errorf("failed to get restaurant users: %w", err)
+		return fmt.Errorf("failed to get restaurant followers: %w", err)
 	}
 	defer rows.Close()
 
@@ -211,7 +389,7 @@ func (s *NotificationService) BroadcastToRestaurant(restaurantID int, title, mes
 	// Create notifications for all users
 	for _, userID := range userIDs {
 		_, err := s.CreateNotification(userID, restaurantID, title, message, notificationType)
-		if err != nil {
+		if err != nil && !errors.Is(err, ErrNotificationSuppressed) {
 			log.Printf("Failed to create notification for user %d: %v", userID, err)
 		}
 	}
@@ -230,14 +408,14 @@ func (s *NotificationService) SendOrderNotification(orderID int, message string)
 
 	// Send notification to user
 	if userID > 0 {
-		_, err = s.CreateNotification(userID, restaurantID, "Order Update", message, "order_update")
-		if err != nil {
+		_, err = s.CreateNotification(userID, restaurantID, "Order Update", message, TypeOrderUpdate)
+		if err != nil && !errors.Is(err, ErrNotificationSuppressed) {
 			log.Printf("Failed to send order notification to user: %v", err)
 		}
 	}
 
 	// Send notification to restaurant
-	_, err = s.CreateNotification(0, restaurantID, "New Order", fmt.Sprintf("New order #%d received", orderID), "order_update")
+	_, err = s.CreateNotification(0, restaurantID, "New Order", fmt.Sprintf("New order #%d received", orderID), TypeOrderUpdate)
 	if err != nil {
 		log.Printf("Failed to send order notification to restaurant: %v", err)
 	}
@@ -245,12 +423,38 @@ func (s *NotificationService) SendOrderNotification(orderID int, message string)
 	return nil
 }
 
-// SendOfferNotification sends a notification about a new offer
-func (s *NotificationService) SendOfferNotification(restaurantID int, offerName string) error {
+// SendOfferNotification sends a notification about a newly published offer or inventory item
+// to followers of the restaurant and to users whose alert areas cover it
+func (s *NotificationService) SendOfferNotification(restaurantID int, offerName string, price float64) error {
 	title := "New Surplus Offer Available"
-	message := fmt.Sprintf("A new offer '%s' is now available at a restaurant near you!", offerName)
+	message := fmt.Sprintf("A new offer '%s' is now available at a restaurant you follow!", offerName)
+
+	if err := s.BroadcastToRestaurant(restaurantID, title, message, TypeNewOffer); err != nil {
+		log.Printf("Failed to notify followers of restaurant %d: %v", restaurantID, err)
+	}
+
+	return s.NotifyAlertSubscribers(restaurantID, offerName, price)
+}
+
+// SendPriceDropNotification tells followers of a restaurant that an item got much cheaper
+func (s *NotificationService) SendPriceDropNotification(restaurantID int, itemName string, oldPrice, newPrice float64) error {
+	title := "Price Drop"
+	message := fmt.Sprintf("'%s' just dropped from $%.2f to $%.2f. Grab it before it's gone!", itemName, oldPrice, newPrice)
 
-	return s.BroadcastToRestaurant(restaurantID, title, message, "new_offer")
+	return s.BroadcastToRestaurant(restaurantID, title, message, TypeNewOffer)
+}
+
+// SendWaitlistHoldNotification tells the next person on a waitlist that stock is
+// held for them
+func (s *NotificationService) SendWaitlistHoldNotification(userID, restaurantID int, itemName string, quantity int, holdFor time.Duration) error {
+	title := "It's Your Turn"
+	message := fmt.Sprintf("'%s' is back and %d is held for you for the next %d minutes. Order before then or it goes back on sale.", itemName, quantity, int(holdFor.Minutes()))
+
+	_, err := s.CreateNotification(userID, restaurantID, title, message, TypeWaitlist)
+	if err != nil && !errors.Is(err, ErrNotificationSuppressed) {
+		return err
+	}
+	return nil
 }
 
 // GetUnreadCount gets the count of unread notifications for a user
@@ -0,0 +1,338 @@
+package notificationService
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notification types users can configure
+const (
+	TypeOrderUpdate = "order_update"
+	TypeNewOffer    = "new_offer"
+	TypeMarketing   = "marketing"
+	TypeWaitlist    = "waitlist"
+)
+
+// Delivery channels a notification can go out on
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// ErrNotificationSuppressed is returned when a user's preferences disable every channel for a notification
+var ErrNotificationSuppressed = errors.New("notification suppressed by user preferences")
+
+// ChannelPreferences holds the channels enabled for one notification type
+type ChannelPreferences struct {
+	InApp bool `json:"in_app"`
+	Email bool `json:"email"`
+	Push  bool `json:"push"`
+}
+
+// NotificationPreferences represents a user's notification settings
+type NotificationPreferences struct {
+	UserID          int                           `json:"user_id"`
+	Timezone        string                        `json:"timezone"`
+	QuietHoursStart string                        `json:"quiet_hours_start"`
+	QuietHoursEnd   string                        `json:"quiet_hours_end"`
+	Types           map[string]ChannelPreferences `json:"types"`
+}
+
+// UpdatePreferencesInput represents the input for updating notification settings.
+// Empty quiet hours disable them; types that are left out keep their current value.
+type UpdatePreferencesInput struct {
+	Timezone        string                        `json:"timezone"`
+	QuietHoursStart string                        `json:"quiet_hours_start"`
+	QuietHoursEnd   string                        `json:"quiet_hours_end"`
+	Types           map[string]ChannelPreferences `json:"types"`
+}
+
+// DeliveryChannel delivers a notification outside the in-app inbox and WebSocket hub
+type DeliveryChannel interface {
+	Name() string
+	Deliver(notification *Notification) error
+}
+
+// defaultPreferences are used for types a user has never configured
+var defaultPreferences = map[string]ChannelPreferences{
+	TypeOrderUpdate: {InApp: true, Email: true, Push: true},
+	TypeNewOffer:    {InApp: true, Email: false, Push: true},
+	TypeMarketing:   {InApp: false, Email: false, Push: false},
+	TypeWaitlist:    {InApp: true, Email: true, Push: true},
+}
+
+// RegisterChannel adds a delivery channel, replacing any channel with the same name
+func (s *NotificationService) RegisterChannel(channel DeliveryChannel) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[channel.Name()] = channel
+}
+
+// GetPreferences retrieves a user's notification settings, filled in with defaults
+func (s *NotificationService) GetPreferences(userID int) (*NotificationPreferences, error) {
+	prefs := &NotificationPreferences{
+		UserID:   userID,
+		Timezone: "UTC",
+		Types:    make(map[string]ChannelPreferences),
+	}
+	for notificationType, channels := range defaultPreferences {
+		prefs.Types[notificationType] = channels
+	}
+
+	var quietStart, quietEnd sql.NullString
+	err := s.db.QueryRow(`
+		SELECT timezone, quiet_hours_start, quiet_hours_end
+		FROM notification_settings WHERE user_id = $1
+	`, userID).Scan(&prefs.Timezone, &quietStart, &quietEnd)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+	prefs.QuietHoursStart = trimSeconds(quietStart.String)
+	prefs.QuietHoursEnd = trimSeconds(quietEnd.String)
+
+	rows, err := s.db.Query(`
+		SELECT notification_type, in_app, email, push
+		FROM notification_preferences WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationType string
+		var channels ChannelPreferences
+		if err := rows.Scan(&notificationType, &channels.InApp, &channels.Email, &channels.Push); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		prefs.Types[notificationType] = channels
+	}
+
+	return prefs, nil
+}
+
+// UpdatePreferences updates a user's notification settings
+func (s *NotificationService) UpdatePreferences(userID int, input UpdatePreferencesInput) (*NotificationPreferences, error) {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", input.Timezone)
+	}
+	if (input.QuietHoursStart == "") != (input.QuietHoursEnd == "") {
+		return nil, errors.New("quiet_hours_start and quiet_hours_end must be set together")
+	}
+	for _, value := range []string{input.QuietHoursStart, input.QuietHoursEnd} {
+		if _, err := parseClock(value); value != "" && err != nil {
+			return nil, err
+		}
+	}
+	for notificationType := range input.Types {
+		if _, ok := defaultPreferences[notificationType]; !ok {
+			return nil, fmt.Errorf("unknown notification type %q", notificationType)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_settings (user_id, timezone, quiet_hours_start, quiet_hours_end)
+		VALUES ($1, $2, NULLIF($3, '')::TIME, NULLIF($4, '')::TIME)
+		ON CONFLICT (user_id) DO UPDATE SET
+		timezone = EXCLUDED.timezone,
+		quiet_hours_start = EXCLUDED.quiet_hours_start,
+		quiet_hours_end = EXCLUDED.quiet_hours_end,
+		updated_at = CURRENT_TIMESTAMP
+	`, userID, input.Timezone, input.QuietHoursStart, input.QuietHoursEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update notification settings: %w", err)
+	}
+
+	for notificationType, channels := range input.Types {
+		_, err = tx.Exec(`
+			INSERT INTO notification_preferences (user_id, notification_type, in_app, email, push)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id, notification_type) DO UPDATE SET
+			in_app = EXCLUDED.in_app,
+			email = EXCLUDED.email,
+			push = EXCLUDED.push,
+			updated_at = CURRENT_TIMESTAMP
+		`, userID, notificationType, channels.InApp, channels.Email, channels.Push)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update notification preference: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetPreferences(userID)
+}
+
+// UnsubscribeURL returns the link placed in emails to turn off email for a notification type
+func (s *NotificationService) UnsubscribeURL(userID int, notificationType string) (string, error) {
+	token, err := s.unsubscribeToken(userID)
+	if err != nil {
+		return "", err
+	}
+
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	query := url.Values{"token": {token}}
+	if notificationType != "" {
+		query.Set("type", notificationType)
+	}
+
+	return strings.TrimRight(baseURL, "/") + "/api/notifications/unsubscribe?" + query.Encode(), nil
+}
+
+// Unsubscribe turns off email for one notification type, or for every type when notificationType is empty
+func (s *NotificationService) Unsubscribe(token, notificationType string) error {
+	var userID int
+	err := s.db.QueryRow("SELECT user_id FROM notification_settings WHERE unsubscribe_token = $1", token).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("invalid unsubscribe link")
+		}
+		return fmt.Errorf("failed to look up unsubscribe token: %w", err)
+	}
+
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return err
+	}
+
+	input := UpdatePreferencesInput{
+		Timezone:        prefs.Timezone,
+		QuietHoursStart: prefs.QuietHoursStart,
+		QuietHoursEnd:   prefs.QuietHoursEnd,
+		Types:           make(map[string]ChannelPreferences),
+	}
+	for currentType, channels := range prefs.Types {
+		if notificationType == "" || notificationType == currentType {
+			channels.Email = false
+			input.Types[currentType] = channels
+		}
+	}
+	if len(input.Types) == 0 {
+		return fmt.Errorf("unknown notification type %q", notificationType)
+	}
+
+	_, err = s.UpdatePreferences(userID, input)
+	return err
+}
+
+// unsubscribeToken returns the user's unsubscribe token, creating one if needed
+func (s *NotificationService) unsubscribeToken(userID int) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+
+	var token string
+	err := s.db.QueryRow(`
+		INSERT INTO notification_settings (user_id, unsubscribe_token)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+		unsubscribe_token = COALESCE(notification_settings.unsubscribe_token, EXCLUDED.unsubscribe_token)
+		RETURNING unsubscribe_token
+	`, userID, hex.EncodeToString(buf)).Scan(&token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get unsubscribe token: %w", err)
+	}
+
+	return token, nil
+}
+
+// deliveryChannels works out which channels a notification should go out on right now
+func (s *NotificationService) deliveryChannels(userID int, notificationType string, now time.Time) (ChannelPreferences, error) {
+	// Restaurant-wide notifications (user 0) have no preferences
+	if userID <= 0 {
+		return ChannelPreferences{InApp: true}, nil
+	}
+
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return ChannelPreferences{}, err
+	}
+
+	channels, ok := prefs.Types[notificationType]
+	if !ok {
+		// Types without preferences (info, warning, ...) stay in-app only
+		channels = ChannelPreferences{InApp: true}
+	}
+
+	// Quiet hours hold back interruptive channels, but never order updates
+	if notificationType != TypeOrderUpdate && inQuietHours(prefs, now) {
+		channels.Email = false
+		channels.Push = false
+	}
+
+	return channels, nil
+}
+
+// inQuietHours reports whether now falls inside the user's quiet hours in their timezone
+func inQuietHours(prefs *NotificationPreferences, now time.Time) bool {
+	if prefs.QuietHoursStart == "" || prefs.QuietHoursEnd == "" {
+		return false
+	}
+
+	location, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	start, err := parseClock(prefs.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(prefs.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start == end {
+		return false
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	// Quiet hours wrap past midnight, e.g. 22:00-07:00
+	return minute >= start || minute < end
+}
+
+// parseClock parses "HH:MM" (or "HH:MM:SS") into minutes after midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", trimSeconds(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// trimSeconds turns Postgres TIME output like "22:00:00" into "22:00"
+func trimSeconds(value string) string {
+	if len(value) > 5 && strings.Count(value, ":") == 2 {
+		return value[:5]
+	}
+	return value
+}
@@ -0,0 +1,555 @@
+package notificationService
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Web Push (RFC 8030) with VAPID (RFC 8292) and aes128gcm payload encryption (RFC 8291)
+
+const (
+	// pushRecordSize is the aes128gcm record size; payloads always fit in one record
+	pushRecordSize = 4096
+	// maxPushPayload is the largest plaintext push services are required to accept
+	maxPushPayload = 3993
+	// pushTTL is how long the push service keeps an undelivered message
+	pushTTL = 24 * time.Hour
+)
+
+// PushSubscription represents a browser's Web Push subscription
+type PushSubscription struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushSubscriptionInput mirrors the browser's PushSubscription.toJSON() output
+type PushSubscriptionInput struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// VAPIDKeys identifies this application server to push services
+type VAPIDKeys struct {
+	privateKey *ecdsa.PrivateKey
+	// PublicKey is the base64url uncompressed P-256 point handed to PushManager.subscribe
+	PublicKey string
+	// Subject is a mailto: or https: contact for push service operators
+	Subject string
+}
+
+// LoadVAPIDKeys reads VAPID_PRIVATE_KEY (base64url raw P-256 scalar) and VAPID_SUBJECT.
+// Without a configured key a throwaway key is generated, which invalidates every
+// browser subscription on restart, so this is only suitable for development.
+func LoadVAPIDKeys() (*VAPIDKeys, error) {
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "mailto:support@surplussupper.com"
+	}
+
+	encoded := os.Getenv("VAPID_PRIVATE_KEY")
+	if encoded == "" {
+		log.Printf("Warning: VAPID_PRIVATE_KEY not set, generating a temporary key")
+		key, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+		}
+		return newVAPIDKeys(key.Bytes(), subject)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+
+	return newVAPIDKeys(raw, subject)
+}
+
+// newVAPIDKeys builds signing keys from a raw 32-byte P-256 private scalar
+func newVAPIDKeys(raw []byte, subject string) (*VAPIDKeys, error) {
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	// Uncompressed point: 0x04 || X || Y
+	public := key.PublicKey().Bytes()
+	privateKey := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+
+	return &VAPIDKeys{
+		privateKey: privateKey,
+		PublicKey:  base64.RawURLEncoding.EncodeToString(public),
+		Subject:    subject,
+	}, nil
+}
+
+// authorization builds the VAPID Authorization header for a push endpoint
+func (k *VAPIDKeys) authorization(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	// Push services expect "aud" as a plain string, not a one-element array
+	claims := jwt.MapClaims{
+		"aud": parsed.Scheme + "://" + parsed.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": k.Subject,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(k.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	return fmt.Sprintf("vapid t=%s, k=%s", token, k.PublicKey), nil
+}
+
+// PushChannel delivers notifications to every browser a user has subscribed with
+type PushChannel struct {
+	service *NotificationService
+	keys    *VAPIDKeys
+	client  *http.Client
+}
+
+// NewPushChannel creates a Web Push delivery channel. It only connects to public
+// addresses, unless the service allows insecure push endpoints.
+func NewPushChannel(service *NotificationService, keys *VAPIDKeys) *PushChannel {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Checked on the resolved address, so a public host name can't point inside
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if service.allowsInsecurePush() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("push endpoint resolves to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+
+	// No proxy either, it would be dialed instead of the push service
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &PushChannel{
+		service: service,
+		keys:    keys,
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// Name returns the channel name used in notification preferences
+func (c *PushChannel) Name() string {
+	return ChannelPush
+}
+
+// Deliver encrypts the notification and sends it to each of the user's subscriptions
+func (c *PushChannel) Deliver(notification *Notification) error {
+	subscriptions, err := c.service.GetPushSubscriptions(notification.UserID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":            notification.ID,
+		"title":         notification.Title,
+		"body":          notification.Message,
+		"type":          notification.Type,
+		"restaurant_id": notification.RestaurantID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push payload: %w", err)
+	}
+	if len(payload) > maxPushPayload {
+		return fmt.Errorf("push payload too large (%d bytes)", len(payload))
+	}
+
+	urgency := "normal"
+	if notification.Type == TypeOrderUpdate {
+		urgency = "high"
+	}
+
+	var lastErr error
+	for _, subscription := range subscriptions {
+		if err := c.send(subscription, payload, urgency); err != nil {
+			log.Printf("Failed to push to subscription %d: %v", subscription.ID, err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// send delivers one encrypted message to a push service
+func (c *PushChannel) send(subscription *PushSubscription, payload []byte, urgency string) error {
+	body, err := encryptPushPayload(payload, subscription.P256dh, subscription.Auth)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := c.keys.authorization(subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build push request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprintf("%d", int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", urgency)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push message: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		// The browser unsubscribed or the subscription expired
+		return c.service.removePushSubscription(subscription.ID)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service responded with %s", resp.Status)
+	}
+
+	c.service.db.Exec("UPDATE push_subscriptions SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", subscription.ID)
+	return nil
+}
+
+// EnableWebPush registers the Web Push delivery channel signed with the given VAPID keys
+func (s *NotificationService) EnableWebPush(keys *VAPIDKeys) {
+	s.mutex.Lock()
+	s.vapidKeys = keys
+	s.mutex.Unlock()
+
+	s.RegisterChannel(NewPushChannel(s, keys))
+}
+
+// VAPIDPublicKey returns the application server key browsers subscribe with,
+// or an empty string when Web Push is not enabled
+func (s *NotificationService) VAPIDPublicKey() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.vapidKeys == nil {
+		return ""
+	}
+	return s.vapidKeys.PublicKey
+}
+
+// AllowInsecurePushEndpoints lets push subscriptions use http:// and local or
+// private hosts. Only for the fake push service, see FakePushService.
+func (s *NotificationService) AllowInsecurePushEndpoints() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.insecurePush = true
+}
+
+// allowsInsecurePush reports whether AllowInsecurePushEndpoints was called
+func (s *NotificationService) allowsInsecurePush() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.insecurePush
+}
+
+// ValidatePushEndpoint checks that a push endpoint is an https URL on a public
+// host name, so the server can't be made to POST to internal services.
+// allowInsecure accepts any http(s) URL, for the fake push service.
+func ValidatePushEndpoint(endpoint string, allowInsecure bool) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return errors.New("endpoint must be an absolute URL")
+	}
+	if allowInsecure {
+		return nil
+	}
+	if parsed.Scheme != "https" {
+		return errors.New("endpoint must be an https URL")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if net.ParseIP(host) != nil {
+		return errors.New("endpoint must use a host name, not an IP address")
+	}
+	if !strings.Contains(host, ".") || host == "localhost" ||
+		strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return errors.New("endpoint must be on a public host")
+	}
+	return nil
+}
+
+// cgnatRange is the shared address space of RFC 6598, not covered by net.IP.IsPrivate
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is routable on the internet
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnatRange.Contains(ip))
+}
+
+// SavePushSubscription registers (or re-assigns) a browser subscription for a user
+func (s *NotificationService) SavePushSubscription(userID int, input PushSubscriptionInput, userAgent string) (*PushSubscription, error) {
+	if err := ValidatePushEndpoint(input.Endpoint, s.allowsInsecurePush()); err != nil {
+		return nil, err
+	}
+	if key, err := base64.RawURLEncoding.DecodeString(input.Keys.P256dh); err != nil || len(key) != 65 {
+		return nil, errors.New("keys.p256dh must be a base64url P-256 public key")
+	}
+	if secret, err := base64.RawURLEncoding.DecodeString(input.Keys.Auth); err != nil || len(secret) != 16 {
+		return nil, errors.New("keys.auth must be a base64url 16-byte secret")
+	}
+
+	var subscription PushSubscription
+	err := s.db.QueryRow(`
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint) DO UPDATE SET
+		user_id = EXCLUDED.user_id,
+		p256dh = EXCLUDED.p256dh,
+		auth = EXCLUDED.auth,
+		user_agent = EXCLUDED.user_agent
+		RETURNING id, user_id, endpoint, p256dh, auth, COALESCE(user_agent, ''), created_at
+	`, userID, input.Endpoint, input.Keys.P256dh, input.Keys.Auth, userAgent).Scan(
+		&subscription.ID, &subscription.UserID, &subscription.Endpoint, &subscription.P256dh, &subscription.Auth, &subscription.UserAgent, &subscription.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save push subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
+// GetPushSubscriptions retrieves every push subscription of a user
+func (s *NotificationService) GetPushSubscriptions(userID int) ([]*PushSubscription, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, endpoint, p256dh, auth, COALESCE(user_agent, ''), created_at
+		FROM push_subscriptions WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []*PushSubscription
+	for rows.Next() {
+		var subscription PushSubscription
+		err := rows.Scan(
+			&subscription.ID, &subscription.UserID, &subscription.Endpoint, &subscription.P256dh, &subscription.Auth, &subscription.UserAgent, &subscription.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan push subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// DeletePushSubscription removes one of the user's subscriptions by endpoint
+func (s *NotificationService) DeletePushSubscription(userID int, endpoint string) error {
+	result, err := s.db.Exec("DELETE FROM push_subscriptions WHERE user_id = $1 AND endpoint = $2", userID, endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("push subscription not found")
+	}
+
+	return nil
+}
+
+// removePushSubscription drops a subscription the push service no longer knows about
+func (s *NotificationService) removePushSubscription(id int) error {
+	if _, err := s.db.Exec("DELETE FROM push_subscriptions WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to remove expired push subscription: %w", err)
+	}
+	return nil
+}
+
+// encryptPushPayload encrypts a message for a subscription using aes128gcm (RFC 8291)
+func encryptPushPayload(plaintext []byte, p256dh, authSecret string) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	// A fresh application server key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return sealPushPayload(plaintext, uaPublicBytes, auth, asPrivate, salt)
+}
+
+// sealPushPayload encrypts a message with a given application server key and salt.
+// Only encryptPushPayload's random ones keep messages unlinkable; tests pass the
+// RFC 8291 example's.
+func sealPushPayload(plaintext, uaPublicBytes, auth []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+	gcm, nonce, err := pushCipher(sharedSecret, auth, salt, uaPublicBytes, asPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Single record: plaintext followed by the 0x02 last-record delimiter
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// decryptPushPayload reverses encryptPushPayload given the subscriber's private key.
+// Only the fake push service needs this; real browsers decrypt messages themselves.
+func decryptPushPayload(body []byte, uaPrivate *ecdh.PrivateKey, auth []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("push message too short")
+	}
+
+	salt := body[:16]
+	keyIDLength := int(body[20])
+	if len(body) < 21+keyIDLength {
+		return nil, errors.New("push message header truncated")
+	}
+	asPublicBytes := body[21 : 21+keyIDLength]
+	ciphertext := body[21+keyIDLength:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender key: %w", err)
+	}
+	sharedSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	gcm, nonce, err := pushCipher(sharedSecret, auth, salt, uaPrivate.PublicKey().Bytes(), asPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt push message: %w", err)
+	}
+
+	// Strip padding and the record delimiter
+	end := bytes.LastIndexByte(record, 0x02)
+	if end < 0 {
+		return nil, errors.New("push message missing record delimiter")
+	}
+
+	return record[:end], nil
+}
+
+// pushCipher derives the content encryption key and nonce shared by both sides
+func pushCipher(sharedSecret, auth, salt, uaPublic, asPublic []byte) (cipher.AEAD, []byte, error) {
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public)
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, auth, keyInfo), ikm); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive push IKM: %w", err)
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive content encryption key: %w", err)
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive nonce: %w", err)
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nonce, nil
+}
@@ -0,0 +1,184 @@
+package notificationService
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"testing"
+)
+
+func TestValidatePushEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint      string
+		allowInsecure bool
+		valid         bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", false, true},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", false, true},
+		{"http://fcm.googleapis.com/fcm/send/abc", false, false},
+		{"https://169.254.169.254/latest/meta-data", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"https://127.0.0.1/push", false, false},
+		{"https://[::1]/push", false, false},
+		{"https://10.0.0.5/push", false, false},
+		{"https://localhost:5432/", false, false},
+		{"https://push.localhost/", false, false},
+		{"https://metadata.google.internal/", false, false},
+		{"https://db/", false, false},
+		{"not a url", false, false},
+		{"ftp://fcm.googleapis.com/", false, false},
+		{"http://localhost:8080/dev/push/abc", true, true},
+		{"ftp://localhost/", true, false},
+	}
+
+	for _, test := range tests {
+		err := ValidatePushEndpoint(test.endpoint, test.allowInsecure)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidatePushEndpoint(%q, %v) = %v, want valid %v", test.endpoint, test.allowInsecure, err, test.valid)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+	}
+
+	for address, public := range tests {
+		if got := isPublicIP(net.ParseIP(address)); got != public {
+			t.Errorf("isPublicIP(%s) = %v, want %v", address, got, public)
+		}
+	}
+}
+
+// The example in RFC 8291 section 5, base64url without padding
+const (
+	rfc8291Plaintext = "When I grow up, I want to be a watermelon"
+	rfc8291ASPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfc8291UAPrivate = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	rfc8291UAPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfc8291Auth      = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfc8291Salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfc8291Body      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func decodeBase64(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("invalid base64 %q: %v", value, err)
+	}
+	return decoded
+}
+
+func TestPushPayloadMatchesRFC8291Example(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(decodeBase64(t, rfc8291ASPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uaPrivate, err := ecdh.P256().NewPrivateKey(decodeBase64(t, rfc8291UAPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := decodeBase64(t, rfc8291Auth)
+
+	body, err := sealPushPayload([]byte(rfc8291Plaintext), decodeBase64(t, rfc8291UAPublic), auth, asPrivate, decodeBase64(t, rfc8291Salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(body); got != rfc8291Body {
+		t.Errorf("encrypted body\n%s\nwant\n%s", got, rfc8291Body)
+	}
+
+	plaintext, err := decryptPushPayload(decodeBase64(t, rfc8291Body), uaPrivate, auth)
+	if err != nil || string(plaintext) != rfc8291Plaintext {
+		t.Errorf("decrypted the example as %q, %v", plaintext, err)
+	}
+}
+
+func TestPushPayloadRoundTrip(t *testing.T) {
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		t.Fatal(err)
+	}
+	p256dh := base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes())
+	authSecret := base64.RawURLEncoding.EncodeToString(auth)
+
+	for _, plaintext := range [][]byte{
+		{},
+		[]byte(`{"title":"New Surplus Near You","body":"Luigi's just listed 'Lasagne' for $4.50"}`),
+		[]byte("ends in the delimiter \x02"),
+		bytes.Repeat([]byte("x"), pushRecordSize-200),
+	} {
+		body, err := encryptPushPayload(plaintext, p256dh, authSecret)
+		if err != nil {
+			t.Fatalf("encrypting %d bytes: %v", len(plaintext), err)
+		}
+		if len(body) > pushRecordSize {
+			t.Errorf("%d bytes encrypted to %d, more than one record", len(plaintext), len(body))
+		}
+		got, err := decryptPushPayload(body, uaPrivate, auth)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes decrypted as %d bytes, %v", len(plaintext), len(got), err)
+		}
+
+		// Every message has its own key and salt
+		again, err := encryptPushPayload(plaintext, p256dh, authSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(again[:16], body[:16]) || bytes.Equal(again, body) {
+			t.Errorf("%d bytes encrypted twice to the same salt or body", len(plaintext))
+		}
+	}
+}
+
+func TestDecryptPushPayloadRejectsTampering(t *testing.T) {
+	uaPrivate, err := ecdh.P256().NewPrivateKey(decodeBase64(t, rfc8291UAPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := decodeBase64(t, rfc8291Auth)
+	body := decodeBase64(t, rfc8291Body)
+	flipped := append([]byte{}, body...)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		body    []byte
+		private *ecdh.PrivateKey
+		auth    []byte
+	}{
+		{"truncated header", body[:20], uaPrivate, auth},
+		{"truncated key", body[:40], uaPrivate, auth},
+		{"flipped ciphertext bit", flipped, uaPrivate, auth},
+		{"wrong private key", body, other, auth},
+		{"wrong auth secret", body, uaPrivate, []byte("0123456789abcdef")},
+	}
+	for _, test := range tests {
+		if plaintext, err := decryptPushPayload(test.body, test.private, test.auth); err == nil {
+			t.Errorf("%s: decrypted as %q", test.name, plaintext)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,21 +17,8 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// WebSocketHandler handles WebSocket connections for real-time notifications
-func (s *NotificationService) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from query parameters
-	userIDStr := r.URL.Query().Get("user_id")
-	if userIDStr == "" {
-		http.Error(w, "user_id parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "invalid user_id parameter", http.StatusBadRequest)
-		return
-	}
-
+// ServeWebSocket upgrades an authenticated request to a WebSocket that receives the user's real-time notifications
+func (s *NotificationService) ServeWebSocket(w http.ResponseWriter, r *http.Request, userID int) {
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -91,7 +77,8 @@ func (c *Client) readPump(conn *websocket.Conn) {
 			switch msgType {
 			case "mark_read":
 				if notificationID, ok := msg["notification_id"].(float64); ok {
-					_, err := c.Hub.MarkNotificationAsRead(int(notificationID))
+					// Clients can only mark their own user's notifications
+					_, err := c.Hub.MarkNotificationAsRead(c.UserID, int(notificationID))
 					if err != nil {
 						log.Printf("Failed to mark notification as read: %v", err)
 					}
@@ -161,6 +148,15 @@ func (s *NotificationService) SendNotification(clientID int, notification Notifi
 		return
 	}
 
+	channels, err := s.deliveryChannels(client.UserID, notification.Type, time.Now())
+	if err != nil {
+		log.Printf("Failed to resolve notification preferences for user %d: %v", client.UserID, err)
+		return
+	}
+	if !channels.InApp {
+		return
+	}
+
 	notificationJSON, err := json.Marshal(notification)
 	if err != nil {
 		log.Printf("Failed to marshal notification: %v", err)
@@ -1,9 +1,11 @@
 package orderService
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 )
 
@@ -14,8 +16,13 @@ type Order struct {
 	RestaurantID      int       `json:"restaurant_id"`
 	TotalAmount       float64   `json:"total_amount"`
 	Status            string    `json:"status"`
-	PickupTime        time.Time `json:"pickup_time"`
+	PickupTime        *time.Time `json:"pickup_time"`
+	FulfilmentType    string    `json:"fulfilment_type"`
+	DeliveryAddress   string    `json:"delivery_address,omitempty"`
+	DeliveryFee       float64   `json:"delivery_fee"`
+	RefundedAmount    float64   `json:"refunded_amount"`
 	SpecialInstructions string  `json:"special_instructions"`
+	RecipePreference  string    `json:"recipe_preference"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
@@ -29,6 +36,8 @@ type OrderItem struct {
 	Quantity        int     `json:"quantity"`
 	UnitPrice       float64 `json:"unit_price"`
 	TotalPrice      float64 `json:"total_price"`
+	OfferType       string  `json:"offer_type,omitempty"`
+	RecipeCardID    *int    `json:"recipe_card_id"`
 	CreatedAt       time.Time `json:"created_at"`
 }
 
@@ -48,6 +57,12 @@ type CreateOrderInput struct {
 	RestaurantID        int           `json:"restaurant_id"`
 	OrderItems          []OrderItemInput `json:"order_items"`
 	SpecialInstructions string        `json:"special_instructions"`
+	RecipePreference    string        `json:"recipe_preference"` // for Chef's Surprise recipe cards
+	PickupTime          *time.Time    `json:"pickup_time"`       // as soon as possible when nil
+	FulfilmentType      string        `json:"fulfilment_type"`   // pickup (the default) or delivery
+	DeliveryAddress     string        `json:"delivery_address"`  // required for delivery
+	DeliveryLatitude    *float64      `json:"delivery_latitude"`
+	DeliveryLongitude   *float64      `json:"delivery_longitude"`
 }
 
 // OrderItemInput represents the input for an order item
@@ -65,9 +80,81 @@ type PaymentInput struct {
 	StripeToken string `json:"stripe_token"`
 }
 
+// Order lifecycle events
+const (
+	EventOrderPlaced        = "order_placed"
+	EventOrderStatusChanged = "status_changed"
+	EventOrderCancelled     = "order_cancelled"
+	EventRefundIssued       = "refund_issued"
+)
+
+// OrderEvent describes a change in an order's lifecycle
+type OrderEvent struct {
+	Type         string
+	Order        *Order
+	RefundAmount float64
+}
+
+// OrderNotifier is told about order lifecycle events, e.g. to send emails
+type OrderNotifier interface {
+	HandleOrderEvent(event OrderEvent) error
+}
+
+// RecipeCardGenerator provides the recipe card for a Chef's Surprise offer that is
+// safe for the customer, see aiService.RecipeCardID
+type RecipeCardGenerator interface {
+	RecipeCardID(ctx context.Context, offerID int, preference string, userID int) (int, error)
+}
+
+// Fulfilment types
+const (
+	FulfilmentPickup   = "pickup"
+	FulfilmentDelivery = "delivery"
+)
+
+// DeliveryQuoter finds the delivery zone covering an address and what delivery
+// there costs, see restaurantService.RestaurantService.DeliveryFee
+type DeliveryQuoter interface {
+	DeliveryFee(restaurantID int, latitude, longitude float64) (zoneID int, fee, minOrderAmount float64, err error)
+}
+
+// PickupChecker tells whether a restaurant can be picked up from at a time, see
+// restaurantService.RestaurantService.CheckPickup
+type PickupChecker interface {
+	CheckPickup(restaurantID int, pickup time.Time) error
+}
+
+// StockReleaser hands stock that came back to the people waiting for it, see
+// restaurantService.RestaurantService.ReleaseStock
+type StockReleaser interface {
+	ReleaseStock(inventoryItemID, offerID int) error
+}
+
+// ErrSoldOut is returned when an order asks for more than is left on general sale
+var ErrSoldOut = errors.New("not enough left, join the waitlist to get the next ones")
+
+// ErrOtherRestaurant is returned when an order has items from a restaurant other than its own
+var ErrOtherRestaurant = errors.New("all items in an order must come from the same restaurant")
+
+// OfferTypeChefSurprise is the offer type that comes with a recipe card
+const OfferTypeChefSurprise = "chef_surprise"
+
+// recipeCardTimeout bounds generating the recipe cards of a new order
+const recipeCardTimeout = 2 * time.Minute
+
+// orderColumns are the orders columns read by scanOrder
+const orderColumns = `id, COALESCE(user_id, 0), restaurant_id, total_amount, status, pickup_time,
+	fulfilment_type, COALESCE(delivery_address, ''), delivery_fee, refunded_amount,
+	COALESCE(special_instructions, ''), recipe_preference, created_at, updated_at`
+
 // OrderService handles order-related operations
 type OrderService struct {
-	db *sql.DB
+	db          *sql.DB
+	notifier    OrderNotifier
+	recipeCards RecipeCardGenerator
+	pickups     PickupChecker
+	deliveries  DeliveryQuoter
+	stock       StockReleaser
 }
 
 // NewOrderService creates a new order service
@@ -75,8 +162,184 @@ func NewOrderService(db *sql.DB) *OrderService {
 	return &OrderService{db: db}
 }
 
-// CreateOrder creates a new order
+// SetOrderNotifier sets the notifier used for order lifecycle events
+func (s *OrderService) SetOrderNotifier(notifier OrderNotifier) {
+	s.notifier = notifier
+}
+
+// SetRecipeCardGenerator sets the generator for Chef's Surprise recipe cards
+func (s *OrderService) SetRecipeCardGenerator(generator RecipeCardGenerator) {
+	s.recipeCards = generator
+}
+
+// SetPickupChecker sets the checker for pickup times against opening hours
+func (s *OrderService) SetPickupChecker(checker PickupChecker) {
+	s.pickups = checker
+}
+
+// SetDeliveryQuoter sets the quoter for delivery orders. Without one only pickup
+// orders can be placed.
+func (s *OrderService) SetDeliveryQuoter(quoter DeliveryQuoter) {
+	s.deliveries = quoter
+}
+
+// SetStockReleaser sets the releaser for stock freed up by cancelled orders and
+// partly used waitlist holds
+func (s *OrderService) SetStockReleaser(releaser StockReleaser) {
+	s.stock = releaser
+}
+
+// releaseStock passes stock that came back on to its waitlist
+func (s *OrderService) releaseStock(items []OrderItemInput) {
+	if s.stock == nil {
+		return
+	}
+
+	for _, item := range items {
+		if err := s.stock.ReleaseStock(item.InventoryItemID, item.OfferID); err != nil {
+			log.Printf("Failed to release stock of inventory item %d / offer %d: %v", item.InventoryItemID, item.OfferID, err)
+		}
+	}
+}
+
+// takeStock locks an order item's inventory item or offer, checks enough of it is
+// left once units held for other people's waitlist entries are set aside, and takes
+// the units. The customer's own hold is used up. It returns the unit price and
+// whether the customer had a hold. Items of other restaurants are refused.
+func takeStock(tx *sql.Tx, restaurantID, userID int, item OrderItemInput) (float64, bool, error) {
+	table, column, noun, id := "inventory_items", "inventory_item_id", "inventory item", item.InventoryItemID
+	if item.InventoryItemID <= 0 {
+		table, column, noun, id = "offers", "offer_id", "offer", item.OfferID
+	}
+
+	var price float64
+	var quantity sql.NullInt64
+	err := tx.QueryRow("SELECT surplus_price, quantity FROM "+table+" WHERE id = $1 AND restaurant_id = $2 AND is_available = true FOR UPDATE", id, restaurantID).Scan(&price, &quantity)
+	if err == sql.ErrNoRows {
+		var owner int
+		err = tx.QueryRow("SELECT restaurant_id FROM "+table+" WHERE id = $1", id).Scan(&owner)
+		switch {
+		case err == nil && owner != restaurantID:
+			return 0, false, ErrOtherRestaurant
+		case err == nil, err == sql.ErrNoRows:
+			return 0, false, fmt.Errorf("%s %d is not available", noun, id)
+		}
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get %s price: %w", noun, err)
+	}
+
+	// Offers whose units aren't counted have a NULL quantity
+	if quantity.Valid {
+		var heldForOthers int
+		err = tx.QueryRow(`
+			SELECT COALESCE(SUM(quantity), 0) FROM waitlist_entries
+			WHERE `+column+` = $1 AND status = 'held' AND hold_expires_at > NOW() AND user_id IS DISTINCT FROM $2
+		`, id, nullableID(userID)).Scan(&heldForOthers)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get waitlist holds: %w", err)
+		}
+		if int(quantity.Int64)-heldForOthers < item.Quantity {
+			return 0, false, ErrSoldOut
+		}
+
+		_, err = tx.Exec("UPDATE "+table+" SET quantity = quantity - $1 WHERE id = $2", item.Quantity, id)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to update %s quantity: %w", noun, err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE waitlist_entries SET status = 'fulfilled', updated_at = CURRENT_TIMESTAMP
+		WHERE `+column+` = $1 AND user_id = $2 AND status = 'held' AND hold_expires_at > NOW()
+	`, id, nullableID(userID))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to fulfil waitlist hold: %w", err)
+	}
+	held, _ := result.RowsAffected()
+
+	return price, held > 0, nil
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder scans a row of orderColumns into an Order
+func scanOrder(row rowScanner) (*Order, error) {
+	var order Order
+	err := row.Scan(
+		&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.FulfilmentType, &order.DeliveryAddress, &order.DeliveryFee, &order.RefundedAmount, &order.SpecialInstructions, &order.RecipePreference, &order.CreatedAt, &order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// nullableID stores ids of 0 as NULL, for optional foreign keys
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// publish hands an order event to the notifier without blocking the caller
+func (s *OrderService) publish(eventType string, order *Order, refundAmount float64) {
+	if s.notifier == nil {
+		return
+	}
+
+	event := OrderEvent{Type: eventType, Order: order, RefundAmount: refundAmount}
+	go func() {
+		if err := s.notifier.HandleOrderEvent(event); err != nil {
+			log.Printf("Failed to handle %s event for order %d: %v", eventType, order.ID, err)
+		}
+	}()
+}
+
+// CreateOrder creates a new order. The restaurant must be open at the pickup time,
+// or now when there isn't one. Delivery orders must be to an address inside one of
+// the restaurant's delivery zones and meet its minimum order, and the zone's fee
+// is added to the total. Chef's Surprise items get a recipe card for the order's
+// recipe preference, generated in the background.
 func (s *OrderService) CreateOrder(input CreateOrderInput) (*Order, error) {
+	if input.FulfilmentType == "" {
+		input.FulfilmentType = FulfilmentPickup
+	}
+	var deliveryZoneID int
+	var deliveryFee, deliveryMinimum float64
+	switch input.FulfilmentType {
+	case FulfilmentPickup:
+		input.DeliveryAddress, input.DeliveryLatitude, input.DeliveryLongitude = "", nil, nil
+	case FulfilmentDelivery:
+		if s.deliveries == nil {
+			return nil, errors.New("delivery is unavailable")
+		}
+		if input.DeliveryAddress == "" || input.DeliveryLatitude == nil || input.DeliveryLongitude == nil {
+			return nil, errors.New("delivery orders need a delivery address and its coordinates")
+		}
+		var err error
+		deliveryZoneID, deliveryFee, deliveryMinimum, err = s.deliveries.DeliveryFee(input.RestaurantID, *input.DeliveryLatitude, *input.DeliveryLongitude)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown fulfilment type %q", input.FulfilmentType)
+	}
+
+	if s.pickups != nil {
+		pickup := time.Now()
+		if input.PickupTime != nil {
+			pickup = *input.PickupTime
+		}
+		if err := s.pickups.CheckPickup(input.RestaurantID, pickup); err != nil {
+			return nil, err
+		}
+	}
+
 	// Start transaction
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -84,51 +347,54 @@ func (s *OrderService) CreateOrder(input CreateOrderInput) (*Order, error) {
 	}
 	defer tx.Rollback()
 
-	// Calculate total amount
+	// Calculate total amount, taking the stock as we go
 	var totalAmount float64
+	var heldItems []OrderItemInput
 	for _, item := range input.OrderItems {
-		if item.InventoryItemID > 0 {
-			// Get inventory item price
-			var price float64
-			err := tx.QueryRow("SELECT surplus_price FROM inventory_items WHERE id = $1 AND is_available = true", item.InventoryItemID).Scan(&price)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get inventory item price: %w", err)
-			}
-			totalAmount += price * float64(item.Quantity)
-		} else if item.OfferID > 0 {
-			// Get offer price
-			var price float64
-			err := tx.QueryRow("SELECT surplus_price FROM offers WHERE id = $1 AND is_available = true", item.OfferID).Scan(&price)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get offer price: %w", err)
-			}
-			totalAmount += price * float64(item.Quantity)
+		if item.InventoryItemID <= 0 && item.OfferID <= 0 {
+			continue
+		}
+		price, held, err := takeStock(tx, input.RestaurantID, input.UserID, item)
+		if err != nil {
+			return nil, err
+		}
+		totalAmount += price * float64(item.Quantity)
+		if held {
+			heldItems = append(heldItems, item)
 		}
 	}
+	if input.FulfilmentType == FulfilmentDelivery {
+		if totalAmount < deliveryMinimum {
+			return nil, fmt.Errorf("delivery to this address needs an order of at least %.2f", deliveryMinimum)
+		}
+		totalAmount += deliveryFee
+	}
 
 	// Create order
-	var order Order
-	err = tx.QueryRow(`
-		INSERT INTO orders (user_id, restaurant_id, total_amount, status, special_instructions)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
-	`, input.UserID, input.RestaurantID, totalAmount, "pending", input.SpecialInstructions).Scan(
-		&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-	)
+	order, err := scanOrder(tx.QueryRow(`
+		INSERT INTO orders (user_id, restaurant_id, total_amount, status, special_instructions, recipe_preference, pickup_time,
+			fulfilment_type, delivery_address, delivery_latitude, delivery_longitude, delivery_zone_id, delivery_fee)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13)
+		RETURNING ` + orderColumns,
+		nullableID(input.UserID), input.RestaurantID, totalAmount, "pending", input.SpecialInstructions, input.RecipePreference, input.PickupTime,
+		input.FulfilmentType, input.DeliveryAddress, input.DeliveryLatitude, input.DeliveryLongitude, nullableID(deliveryZoneID), deliveryFee,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
 	// Create order items
+	var chefSurprises []*OrderItem
 	for _, item := range input.OrderItems {
 		var unitPrice float64
+		var offerType string
 		if item.InventoryItemID > 0 {
 			err := tx.QueryRow("SELECT surplus_price FROM inventory_items WHERE id = $1", item.InventoryItemID).Scan(&unitPrice)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get inventory item price: %w", err)
 			}
 		} else if item.OfferID > 0 {
-			err := tx.QueryRow("SELECT surplus_price FROM offers WHERE id = $1", item.OfferID).Scan(&unitPrice)
+			err := tx.QueryRow("SELECT surplus_price, offer_type FROM offers WHERE id = $1", item.OfferID).Scan(&unitPrice, &offerType)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get offer price: %w", err)
 			}
@@ -136,20 +402,17 @@ func (s *OrderService) CreateOrder(input CreateOrderInput) (*Order, error) {
 
 		totalPrice := unitPrice * float64(item.Quantity)
 
-		_, err = tx.Exec(`
+		var orderItemID int
+		err = tx.QueryRow(`
 			INSERT INTO order_items (order_id, inventory_item_id, offer_id, quantity, unit_price, total_price)
 			VALUES ($1, $2, $3, $4, $5, $6)
-		`, order.ID, item.InventoryItemID, item.OfferID, item.Quantity, unitPrice, totalPrice)
+			RETURNING id
+		`, order.ID, nullableID(item.InventoryItemID), nullableID(item.OfferID), item.Quantity, unitPrice, totalPrice).Scan(&orderItemID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create order item: %w", err)
 		}
-
-		// Update inventory quantity
-		if item.InventoryItemID > 0 {
-			_, err = tx.Exec("UPDATE inventory_items SET quantity = quantity - $1 WHERE id = $2", item.Quantity, item.InventoryItemID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to update inventory quantity: %w", err)
-			}
+		if offerType == OfferTypeChefSurprise {
+			chefSurprises = append(chefSurprises, &OrderItem{ID: orderItemID, OrderID: order.ID, OfferID: item.OfferID, OfferType: offerType})
 		}
 	}
 
@@ -158,18 +421,56 @@ func (s *OrderService) CreateOrder(input CreateOrderInput) (*Order, error) {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return &order, nil
+	s.publish(EventOrderPlaced, order, 0)
+
+	// Units of a hold the customer didn't order go to the next in line
+	s.releaseStock(heldItems)
+
+	if s.recipeCards != nil && len(chefSurprises) > 0 {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), recipeCardTimeout)
+			defer cancel()
+			for _, item := range chefSurprises {
+				if _, err := s.AttachRecipeCard(ctx, order, item); err != nil {
+					log.Printf("Failed to attach recipe card to order %d: %v", order.ID, err)
+				}
+			}
+		}()
+	}
+
+	return order, nil
+}
+
+// AttachRecipeCard generates the recipe card for a Chef's Surprise order item and
+// attaches it. Order details call it again for items whose card is still missing.
+func (s *OrderService) AttachRecipeCard(ctx context.Context, order *Order, item *OrderItem) (int, error) {
+	if s.recipeCards == nil {
+		return 0, errors.New("no recipe card generator configured")
+	}
+	if item.OfferType != OfferTypeChefSurprise {
+		return 0, errors.New("order item is not a Chef's Surprise")
+	}
+
+	cardID, err := s.recipeCards.RecipeCardID(ctx, item.OfferID, order.RecipePreference, order.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate recipe card: %w", err)
+	}
+
+	_, err = s.db.Exec("UPDATE order_items SET recipe_card_id = $2 WHERE id = $1", item.ID, cardID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach recipe card: %w", err)
+	}
+	item.RecipeCardID = &cardID
+
+	return cardID, nil
 }
 
 // GetOrderByID retrieves an order by ID
 func (s *OrderService) GetOrderByID(id int) (*Order, error) {
-	var order Order
-	err := s.db.QueryRow(`
-		SELECT id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
+	order, err := scanOrder(s.db.QueryRow(`
+		SELECT ` + orderColumns + `
 		FROM orders WHERE id = $1
-	`, id).Scan(
-		&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-	)
+	`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("order not found")
@@ -177,14 +478,18 @@ func (s *OrderService) GetOrderByID(id int) (*Order, error) {
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	return &order, nil
+	return order, nil
 }
 
 // GetOrderItems retrieves items for an order
 func (s *OrderService) GetOrderItems(orderID int) ([]*OrderItem, error) {
 	rows, err := s.db.Query(`
-		SELECT id, order_id, inventory_item_id, offer_id, quantity, unit_price, total_price, created_at
-		FROM order_items WHERE order_id = $1
+		SELECT oi.id, oi.order_id, COALESCE(oi.inventory_item_id, 0), COALESCE(oi.offer_id, 0), oi.quantity, oi.unit_price, oi.total_price,
+			COALESCE(o.offer_type, ''), oi.recipe_card_id, oi.created_at
+		FROM order_items oi
+		LEFT JOIN offers o ON o.id = oi.offer_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id
 	`, orderID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order items: %w", err)
@@ -195,7 +500,7 @@ func (s *OrderService) GetOrderItems(orderID int) ([]*OrderItem, error) {
 	for rows.Next() {
 		var item OrderItem
 		err := rows.Scan(
-			&item.ID, &item.OrderID, &item.InventoryItemID, &item.OfferID, &item.Quantity, &item.UnitPrice, &item.TotalPrice, &item.CreatedAt,
+			&item.ID, &item.OrderID, &item.InventoryItemID, &item.OfferID, &item.Quantity, &item.UnitPrice, &item.TotalPrice, &item.OfferType, &item.RecipeCardID, &item.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order item: %w", err)
@@ -208,14 +513,11 @@ func (s *OrderService) GetOrderItems(orderID int) ([]*OrderItem, error) {
 
 // UpdateOrderStatus updates the status of an order
 func (s *OrderService) UpdateOrderStatus(id int, status string) (*Order, error) {
-	var order Order
-	err := s.db.QueryRow(`
+	order, err := scanOrder(s.db.QueryRow(`
 		UPDATE orders SET status = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
-		RETURNING id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
-	`, id, status).Scan(
-		&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-	)
+		RETURNING ` + orderColumns + `
+	`, id, status))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("order not found")
@@ -223,13 +525,15 @@ func (s *OrderService) UpdateOrderStatus(id int, status string) (*Order, error)
 		return nil, fmt.Errorf("failed to update order status: %w", err)
 	}
 
-	return &order, nil
+	s.publish(EventOrderStatusChanged, order, 0)
+
+	return order, nil
 }
 
 // GetUserOrders retrieves all orders for a user
 func (s *OrderService) GetUserOrders(userID int) ([]*Order, error) {
 	rows, err := s.db.Query(`
-		SELECT id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
+		SELECT ` + orderColumns + `
 		FROM orders WHERE user_id = $1 ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -239,14 +543,11 @@ func (s *OrderService) GetUserOrders(userID int) ([]*Order, error) {
 
 	var orders []*Order
 	for rows.Next() {
-		var order Order
-		err := rows.Scan(
-			&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-		)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		orders = append(orders, &order)
+		orders = append(orders, order)
 	}
 
 	return orders, nil
@@ -259,13 +560,13 @@ func (s *OrderService) GetRestaurantOrders(restaurantID int, status string) ([]*
 
 	if status != "" {
 		query = `
-			SELECT id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
+			SELECT ` + orderColumns + `
 			FROM orders WHERE restaurant_id = $1 AND status = $2 ORDER BY created_at DESC
 		`
 		args = []interface{}{restaurantID, status}
 	} else {
 		query = `
-			SELECT id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
+			SELECT ` + orderColumns + `
 			FROM orders WHERE restaurant_id = $1 ORDER BY created_at DESC
 		`
 		args = []interface{}{restaurantID}
@@ -279,14 +580,11 @@ func (s *OrderService) GetRestaurantOrders(restaurantID int, status string) ([]*
 
 	var orders []*Order
 	for rows.Next() {
-		var order Order
-		err := rows.Scan(
-			&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-		)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		orders = append(orders, &order)
+		orders = append(orders, order)
 	}
 
 	return orders, nil
@@ -306,7 +604,9 @@ func (s *OrderService) ProcessPayment(input PaymentInput) error {
 	return nil
 }
 
-// CancelOrder cancels an order
+// CancelOrder cancels a pending or confirmed order and puts its items back in
+// stock, where they go to the waitlist first. Orders further along have been
+// prepared or handed over, so there's nothing to put back.
 func (s *OrderService) CancelOrder(id int) (*Order, error) {
 	// Start transaction
 	tx, err := s.db.Begin()
@@ -315,48 +615,123 @@ func (s *OrderService) CancelOrder(id int) (*Order, error) {
 	}
 	defer tx.Rollback()
 
+	// Update order status first so a second cancellation can't restore the stock again
+	order, err := scanOrder(tx.QueryRow(`
+		UPDATE orders SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status IN ('pending', 'confirmed')
+		RETURNING ` + orderColumns + `
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			var status string
+			err := tx.QueryRow("SELECT status FROM orders WHERE id = $1", id).Scan(&status)
+			if err == sql.ErrNoRows {
+				return nil, errors.New("order not found")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get order: %w", err)
+			}
+			if status == "cancelled" {
+				return nil, errors.New("order is already cancelled")
+			}
+			return nil, fmt.Errorf("%s orders can't be cancelled", status)
+		}
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
+	}
+
 	// Get order items to restore inventory
-	rows, err := tx.Query("SELECT inventory_item_id, quantity FROM order_items WHERE order_id = $1", id)
+	rows, err := tx.Query("SELECT COALESCE(inventory_item_id, 0), COALESCE(offer_id, 0), quantity FROM order_items WHERE order_id = $1", id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order items: %w", err)
 	}
-	defer rows.Close()
 
-	// Restore inventory quantities
+	var items []OrderItemInput
 	for rows.Next() {
-		var inventoryItemID, quantity int
-		err := rows.Scan(&inventoryItemID, &quantity)
-		if err != nil {
+		var item OrderItemInput
+		if err := rows.Scan(&item.InventoryItemID, &item.OfferID, &item.Quantity); err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("failed to scan order item: %w", err)
 		}
-		if inventoryItemID > 0 {
-			_, err = tx.Exec("UPDATE inventory_items SET quantity = quantity + $1 WHERE id = $2", quantity, inventoryItemID)
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order items: %w", err)
+	}
+
+	// Restore inventory quantities, and those of offers whose units are counted
+	var released []OrderItemInput
+	for _, item := range items {
+		if item.InventoryItemID > 0 {
+			_, err = tx.Exec("UPDATE inventory_items SET quantity = quantity + $1 WHERE id = $2", item.Quantity, item.InventoryItemID)
 			if err != nil {
 				return nil, fmt.Errorf("failed to restore inventory quantity: %w", err)
 			}
+		} else if item.OfferID > 0 {
+			_, err = tx.Exec("UPDATE offers SET quantity = quantity + $1 WHERE id = $2 AND quantity IS NOT NULL", item.Quantity, item.OfferID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore offer quantity: %w", err)
+			}
+		} else {
+			continue
 		}
+		released = append(released, item)
 	}
 
-	// Update order status
-	var order Order
-	err = tx.QueryRow(`
-		UPDATE orders SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-		RETURNING id, user_id, restaurant_id, total_amount, status, pickup_time, special_instructions, created_at, updated_at
-	`, id).Scan(
-		&order.ID, &order.UserID, &order.RestaurantID, &order.TotalAmount, &order.Status, &order.PickupTime, &order.SpecialInstructions, &order.CreatedAt, &order.UpdatedAt,
-	)
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.publish(EventOrderCancelled, order, 0)
+
+	s.releaseStock(released)
+
+	return order, nil
+}
+
+// IssueRefund records a refund (placeholder for Stripe refunds). Refunds of an
+// order can add up to at most its total, and pending or cancelled orders, which
+// haven't been paid for, can't be refunded. The order is partially_refunded until
+// its refunds add up to the total, and refunded from then on.
+func (s *OrderService) IssueRefund(id int, amount float64) (*Order, error) {
+	if amount <= 0 {
+		return nil, errors.New("refund amount must be positive")
+	}
+
+	order, err := scanOrder(s.db.QueryRow(`
+		UPDATE orders SET
+			status = CASE WHEN refunded_amount + $2 >= total_amount THEN 'refunded' ELSE 'partially_refunded' END,
+			refunded_amount = refunded_amount + $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status NOT IN ('pending', 'cancelled') AND refunded_amount + $2 <= total_amount
+		RETURNING ` + orderColumns + `
+	`, id, amount))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("order not found")
+			return nil, s.refundRejection(id)
 		}
-		return nil, fmt.Errorf("failed to cancel order: %w", err)
+		return nil, fmt.Errorf("failed to issue refund: %w", err)
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	s.publish(EventRefundIssued, order, amount)
+
+	return order, nil
+}
+
+// refundRejection explains why IssueRefund didn't refund an order
+func (s *OrderService) refundRejection(id int) error {
+	var status string
+	var remaining float64
+	err := s.db.QueryRow("SELECT status, total_amount - refunded_amount FROM orders WHERE id = $1", id).Scan(&status, &remaining)
+	if err == sql.ErrNoRows {
+		return errors.New("order not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
 	}
 
-	return &order, nil
-} 
\ No newline at end of file
+	if status == "pending" || status == "cancelled" {
+		return fmt.Errorf("%s orders can't be refunded", status)
+	}
+	return fmt.Errorf("refund exceeds the %.2f left to refund", remaining)
+}
\ No newline at end of file
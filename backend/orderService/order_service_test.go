@@ -0,0 +1,112 @@
+package orderService
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeRow is an inventory item or offer in fakeStock
+type fakeRow struct {
+	restaurantID int
+	price        float64
+	quantity     interface{} // int64, or nil for offers whose units aren't counted
+}
+
+// fakeStock is a database connection that answers takeStock's queries from an
+// in-memory table of inventory items and offers; writes succeed without effect
+type fakeStock struct {
+	rows map[string]map[int64]fakeRow // table -> id -> row
+}
+
+func (f *fakeStock) Connect(ctx context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeStock) Driver() driver.Driver                            { return nil }
+func (f *fakeStock) Close() error                                     { return nil }
+func (f *fakeStock) Begin() (driver.Tx, error)                        { return f, nil }
+func (f *fakeStock) Commit() error                                    { return nil }
+func (f *fakeStock) Rollback() error                                  { return nil }
+
+func (f *fakeStock) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (f *fakeStock) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (f *fakeStock) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	table := "offers"
+	if strings.Contains(query, "FROM inventory_items") {
+		table = "inventory_items"
+	}
+	row, ok := f.rows[table][args[0].Value.(int64)]
+
+	switch {
+	case strings.HasPrefix(query, "SELECT surplus_price, quantity"):
+		if !ok || (strings.Contains(query, "restaurant_id = $2") && int64(row.restaurantID) != args[1].Value.(int64)) {
+			return &fakeRows{columns: []string{"surplus_price", "quantity"}}, nil
+		}
+		return &fakeRows{columns: []string{"surplus_price", "quantity"}, values: [][]driver.Value{{row.price, row.quantity}}}, nil
+	case strings.HasPrefix(query, "SELECT restaurant_id"):
+		if !ok {
+			return &fakeRows{columns: []string{"restaurant_id"}}, nil
+		}
+		return &fakeRows{columns: []string{"restaurant_id"}, values: [][]driver.Value{{int64(row.restaurantID)}}}, nil
+	case strings.Contains(query, "FROM waitlist_entries"):
+		return &fakeRows{columns: []string{"sum"}, values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestCreateOrderRejectsOtherRestaurantsItems(t *testing.T) {
+	stock := &fakeStock{rows: map[string]map[int64]fakeRow{
+		"inventory_items": {
+			1: {restaurantID: 1, price: 4.5, quantity: int64(10)},
+			2: {restaurantID: 2, price: 0.5, quantity: int64(10)},
+		},
+		"offers": {
+			3: {restaurantID: 2, price: 1, quantity: nil},
+		},
+	}}
+	db := sql.OpenDB(stock)
+	defer db.Close()
+	service := NewOrderService(db)
+
+	tests := []struct {
+		name  string
+		items []OrderItemInput
+	}{
+		{"inventory item of another restaurant", []OrderItemInput{{InventoryItemID: 2, Quantity: 1}}},
+		{"offer of another restaurant", []OrderItemInput{{OfferID: 3, Quantity: 1}}},
+		{"lines spanning restaurants", []OrderItemInput{{InventoryItemID: 1, Quantity: 1}, {InventoryItemID: 2, Quantity: 1}}},
+	}
+
+	for _, test := range tests {
+		_, err := service.CreateOrder(CreateOrderInput{UserID: 7, RestaurantID: 1, OrderItems: test.items})
+		if !errors.Is(err, ErrOtherRestaurant) {
+			t.Errorf("%s: got error %v, want ErrOtherRestaurant", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package recommendationService
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Offline evaluation on synthetic data. Synthetic users have hidden tastes for
+// cuisines, prices and distance; their order history and their held-out next orders
+// are drawn from those tastes with noise, and a ranker is scored on how high it puts
+// the orders it couldn't see. The same config always produces the same data and scores.
+
+// syntheticCuisines are the cuisines synthetic restaurants serve
+var syntheticCuisines = []string{"Italian", "Japanese", "Mexican", "Indian", "Bakery", "Vegan", "Thai", "American"}
+
+// syntheticCenter is the middle of the synthetic city
+var syntheticCenter = struct{ lat, lon float64 }{40.7128, -74.0060}
+
+// SyntheticConfig controls the size and randomness of a synthetic dataset
+type SyntheticConfig struct {
+	Seed        int64
+	Users       int
+	Restaurants int
+	// NextOrders is how many held-out orders each user makes
+	NextOrders int
+	// ColdStartShare is the fraction of users without any order history
+	ColdStartShare float64
+	// Now is the time the dataset is ranked at
+	Now time.Time
+}
+
+// DefaultSyntheticConfig is the dataset the evaluation harness uses by default
+var DefaultSyntheticConfig = SyntheticConfig{
+	Seed:           42,
+	Users:          500,
+	Restaurants:    60,
+	NextOrders:     3,
+	ColdStartShare: 0.2,
+	Now:            time.Date(2026, time.January, 15, 18, 0, 0, 0, time.UTC),
+}
+
+// SyntheticUser is a user as the ranker sees them, with the orders they went on to make
+type SyntheticUser struct {
+	Profile *UserProfile
+	// NextOrders are indexes into SyntheticDataset.Candidates
+	NextOrders []int
+	ColdStart  bool
+}
+
+// SyntheticDataset is a synthetic city of candidates and users
+type SyntheticDataset struct {
+	Now        time.Time
+	Candidates []Candidate
+	Users      []SyntheticUser
+}
+
+// syntheticTaste is a synthetic user's hidden preferences
+type syntheticTaste struct {
+	lat, lon    float64
+	cuisine     []float64 // by index in syntheticCuisines
+	sensitivity float64
+	budget      float64
+	toleranceKm float64
+}
+
+// Ranker ranks candidates for a user profile
+type Ranker func(profile *UserProfile, candidates []Candidate, now time.Time) []Recommendation
+
+// WeightedRanker ranks with Rank and the given weights
+func WeightedRanker(weights Weights) Ranker {
+	return func(profile *UserProfile, candidates []Candidate, now time.Time) []Recommendation {
+		return Rank(profile, candidates, weights, now, 0)
+	}
+}
+
+// RandomRanker ranks candidates in a random order, as a floor for the other rankers
+func RandomRanker(seed int64) Ranker {
+	rng := rand.New(rand.NewSource(seed))
+	return func(profile *UserProfile, candidates []Candidate, now time.Time) []Recommendation {
+		recommendations := make([]Recommendation, len(candidates))
+		for i, candidate := range candidates {
+			recommendations[i] = Recommendation{Candidate: candidate}
+		}
+		rng.Shuffle(len(recommendations), func(i, j int) {
+			recommendations[i], recommendations[j] = recommendations[j], recommendations[i]
+		})
+		return recommendations
+	}
+}
+
+// EvaluationResult is how well a ranker placed users' held-out orders
+type EvaluationResult struct {
+	Name    string  `json:"name"`
+	Segment string  `json:"segment"`
+	K       int     `json:"k"`
+	Users   int     `json:"users"`
+	Queries int     `json:"queries"`
+	HitRate float64 `json:"hit_rate"` // share of orders ranked in the top K
+	NDCG    float64 `json:"ndcg"`     // mean NDCG@K with the order as the only relevant item
+	MRR     float64 `json:"mrr"`      // mean reciprocal rank
+}
+
+func (r EvaluationResult) String() string {
+	return fmt.Sprintf("%-16s %-10s users=%-4d queries=%-5d hit@%d=%.3f ndcg@%d=%.3f mrr=%.3f",
+		r.Name, r.Segment, r.Users, r.Queries, r.K, r.HitRate, r.K, r.NDCG, r.MRR)
+}
+
+// GenerateSyntheticDataset builds a synthetic city from config
+func GenerateSyntheticDataset(config SyntheticConfig) *SyntheticDataset {
+	rng := rand.New(rand.NewSource(config.Seed))
+	dataset := &SyntheticDataset{Now: config.Now}
+
+	itemID, offerID := 0, 0
+	for r := 1; r <= config.Restaurants; r++ {
+		lat, lon := syntheticLocation(rng)
+		cuisine := syntheticCuisines[rng.Intn(len(syntheticCuisines))]
+		restaurant := Candidate{
+			RestaurantID:   r,
+			RestaurantName: fmt.Sprintf("%s Kitchen %d", cuisine, r),
+			CuisineType:    cuisine,
+			Latitude:       lat,
+			Longitude:      lon,
+		}
+
+		for i := 0; i < 1+rng.Intn(4); i++ {
+			itemID++
+			candidate := restaurant
+			candidate.Kind = KindInventoryItem
+			candidate.ID = itemID
+			candidate.Name = fmt.Sprintf("%s item %d", cuisine, itemID)
+			syntheticPrices(rng, &candidate)
+			candidate.ListedAt = config.Now.Add(-time.Duration(rng.Float64() * 12 * float64(time.Hour)))
+			expiry := config.Now.Add(30*time.Minute + time.Duration(rng.Float64()*8*float64(time.Hour)))
+			candidate.ExpiryTime = &expiry
+			dataset.Candidates = append(dataset.Candidates, candidate)
+		}
+		if rng.Float64() < 0.5 {
+			offerID++
+			candidate := restaurant
+			candidate.Kind = KindOffer
+			candidate.ID = offerID
+			candidate.Name = fmt.Sprintf("%s surprise bag %d", cuisine, offerID)
+			syntheticPrices(rng, &candidate)
+			candidate.ListedAt = config.Now.Add(-time.Duration(rng.Float64() * 48 * float64(time.Hour)))
+			dataset.Candidates = append(dataset.Candidates, candidate)
+		}
+	}
+
+	for u := 0; u < config.Users; u++ {
+		taste := syntheticUserTaste(rng)
+		user := SyntheticUser{ColdStart: rng.Float64() < config.ColdStartShare}
+
+		// Past orders are made from a random part of the city's surplus, as on an
+		// earlier day when different things were available
+		var history []PastOrder
+		if !user.ColdStart {
+			for i := 0; i < 2+rng.Intn(11); i++ {
+				subset := rng.Perm(len(dataset.Candidates))[:minInt(30, len(dataset.Candidates))]
+				chosen := dataset.Candidates[syntheticChoice(rng, taste, dataset.Candidates, subset, config.Now)]
+				history = append(history, PastOrder{
+					RestaurantID:  chosen.RestaurantID,
+					CuisineType:   chosen.CuisineType,
+					OriginalPrice: chosen.OriginalPrice,
+					PricePaid:     chosen.SurplusPrice,
+				})
+			}
+		}
+
+		lat, lon := taste.lat, taste.lon
+		user.Profile = BuildUserProfile(&lat, &lon, history)
+
+		all := make([]int, len(dataset.Candidates))
+		for i := range all {
+			all[i] = i
+		}
+		for i := 0; i < config.NextOrders; i++ {
+			user.NextOrders = append(user.NextOrders, syntheticChoice(rng, taste, dataset.Candidates, all, config.Now))
+		}
+		dataset.Users = append(dataset.Users, user)
+	}
+
+	return dataset
+}
+
+// Evaluate scores a ranker on a dataset's held-out orders, for all users and for
+// users with and without order history
+func Evaluate(name string, dataset *SyntheticDataset, ranker Ranker, k int) []EvaluationResult {
+	results := map[string]*EvaluationResult{}
+	segments := []string{"all", "warm", "cold-start"}
+	for _, segment := range segments {
+		results[segment] = &EvaluationResult{Name: name, Segment: segment, K: k}
+	}
+
+	for _, user := range dataset.Users {
+		ranked := ranker(user.Profile, dataset.Candidates, dataset.Now)
+		positions := map[string]int{}
+		for i, rec := range ranked {
+			positions[fmt.Sprintf("%s/%d", rec.Kind, rec.ID)] = i + 1
+		}
+
+		segment := "warm"
+		if user.ColdStart {
+			segment = "cold-start"
+		}
+		for _, result := range []*EvaluationResult{results["all"], results[segment]} {
+			result.Users++
+			for _, index := range user.NextOrders {
+				candidate := dataset.Candidates[index]
+				result.Queries++
+				position, ok := positions[fmt.Sprintf("%s/%d", candidate.Kind, candidate.ID)]
+				if !ok {
+					continue
+				}
+				result.MRR += 1 / float64(position)
+				if position <= k {
+					result.HitRate++
+					result.NDCG += 1 / math.Log2(float64(position)+1)
+				}
+			}
+		}
+	}
+
+	out := []EvaluationResult{}
+	for _, segment := range segments {
+		result := results[segment]
+		if result.Queries > 0 {
+			result.HitRate = math.Round(result.HitRate/float64(result.Queries)*1000) / 1000
+			result.NDCG = math.Round(result.NDCG/float64(result.Queries)*1000) / 1000
+			result.MRR = math.Round(result.MRR/float64(result.Queries)*1000) / 1000
+		}
+		out = append(out, *result)
+	}
+	return out
+}
+
+// syntheticLocation returns a point within about 8 km of the city centre
+func syntheticLocation(rng *rand.Rand) (float64, float64) {
+	return syntheticCenter.lat + (rng.Float64()-0.5)*0.15, syntheticCenter.lon + (rng.Float64()-0.5)*0.2
+}
+
+// syntheticPrices sets an original price of $6-30 and a 30-70% discount
+func syntheticPrices(rng *rand.Rand, candidate *Candidate) {
+	candidate.OriginalPrice = math.Round((6+rng.Float64()*24)*100) / 100
+	candidate.SurplusPrice = math.Round(candidate.OriginalPrice*(0.3+rng.Float64()*0.4)*100) / 100
+}
+
+// syntheticUserTaste draws hidden preferences, with one or two favourite cuisines
+func syntheticUserTaste(rng *rand.Rand) syntheticTaste {
+	lat, lon := syntheticLocation(rng)
+	taste := syntheticTaste{
+		lat:         lat,
+		lon:         lon,
+		cuisine:     make([]float64, len(syntheticCuisines)),
+		sensitivity: rng.Float64(),
+		budget:      5 + rng.Float64()*12,
+		toleranceKm: 1.5 + rng.Float64()*3.5,
+	}
+	for i := range taste.cuisine {
+		taste.cuisine[i] = rng.Float64() * 0.5
+	}
+	for i := 0; i < 1+rng.Intn(2); i++ {
+		taste.cuisine[rng.Intn(len(taste.cuisine))] += 1.5
+	}
+	return taste
+}
+
+// syntheticChoice returns the index of the candidate among options a user with the
+// given taste picks: the highest utility after Gumbel noise, i.e. a logit choice
+func syntheticChoice(rng *rand.Rand, taste syntheticTaste, candidates []Candidate, options []int, now time.Time) int {
+	best, bestUtility := options[0], math.Inf(-1)
+	for _, index := range options {
+		candidate := candidates[index]
+		distance := haversineKm(taste.lat, taste.lon, candidate.Latitude, candidate.Longitude)
+
+		cuisine := 0.0
+		for i, name := range syntheticCuisines {
+			if name == candidate.CuisineType {
+				cuisine = taste.cuisine[i]
+			}
+		}
+
+		utility := 1.2*cuisine -
+			distance/taste.toleranceKm +
+			2*taste.sensitivity*discount(candidate.OriginalPrice, candidate.SurplusPrice) -
+			(1-taste.sensitivity)*math.Abs(math.Log(candidate.SurplusPrice/taste.budget)) -
+			0.05*now.Sub(candidate.ListedAt).Hours()
+		utility += -math.Log(-math.Log(rng.Float64()*0.999999 + 0.0000005))
+
+		if utility > bestUtility {
+			best, bestUtility = index, utility
+		}
+	}
+	return best
+}
+
+// haversineKm is the great-circle distance, kept separate from the ranker's so the
+// synthetic world doesn't share code with what it evaluates
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
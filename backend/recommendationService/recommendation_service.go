@@ -0,0 +1,207 @@
+package recommendationService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"surplus-supper/backend/geo"
+)
+
+const (
+	// DefaultLimit is how many recommendations are returned when no limit is given
+	DefaultLimit = 20
+	// MaxLimit is the most recommendations returned at once
+	MaxLimit = 100
+	// defaultRadiusKm is how far away candidates are considered when the user has a location
+	defaultRadiusKm = 25.0
+	// MaxRadiusKm is the widest radius candidates are considered within
+	MaxRadiusKm = 200
+	// historyLimit is how many of the user's most recent order items shape their profile
+	historyLimit = 200
+)
+
+// ErrInvalidInput is returned when a recommendation request's location or radius is invalid
+var ErrInvalidInput = errors.New("invalid recommendation input")
+
+// RecommendInput narrows a user's recommendations. Latitude and Longitude override
+// the location in the user's profile, e.g. with the browser's current position.
+type RecommendInput struct {
+	Limit     int      `json:"limit"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	RadiusKm  float64  `json:"radius_km"`
+}
+
+// RecommendationService ranks available surplus for users
+type RecommendationService struct {
+	db *sql.DB
+}
+
+// NewRecommendationService creates a new recommendation service
+func NewRecommendationService(db *sql.DB) *RecommendationService {
+	return &RecommendationService{db: db}
+}
+
+// Recommend ranks available inventory items and offers for a user by distance,
+// the cuisines they order, their price sensitivity and freshness
+func (s *RecommendationService) Recommend(userID int, input RecommendInput) ([]Recommendation, error) {
+	if input.Limit <= 0 {
+		input.Limit = DefaultLimit
+	}
+	if input.Limit > MaxLimit {
+		input.Limit = MaxLimit
+	}
+	if input.RadiusKm == 0 {
+		input.RadiusKm = defaultRadiusKm
+	}
+	if input.RadiusKm < 0 || input.RadiusKm > MaxRadiusKm {
+		return nil, fmt.Errorf("%w: radius must be between 0 and %d km", ErrInvalidInput, MaxRadiusKm)
+	}
+	if (input.Latitude == nil) != (input.Longitude == nil) {
+		return nil, fmt.Errorf("%w: latitude and longitude must be given together", ErrInvalidInput)
+	}
+	if input.Latitude != nil && !geo.ValidCoordinates(*input.Latitude, *input.Longitude) {
+		return nil, fmt.Errorf("%w: invalid coordinates", ErrInvalidInput)
+	}
+
+	profile, err := s.GetUserProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Latitude != nil {
+		profile.Latitude, profile.Longitude = input.Latitude, input.Longitude
+	}
+
+	now := time.Now()
+	candidates, err := s.getCandidates(now, profile.Latitude, profile.Longitude, input.RadiusKm)
+	if err != nil {
+		return nil, err
+	}
+
+	return Rank(profile, candidates, DefaultWeights, now, input.Limit), nil
+}
+
+// GetUserProfile builds a user's profile from their location and order history
+func (s *RecommendationService) GetUserProfile(userID int) (*UserProfile, error) {
+	var latitude, longitude sql.NullFloat64
+	err := s.db.QueryRow("SELECT latitude, longitude FROM users WHERE id = $1", userID).Scan(&latitude, &longitude)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT o.restaurant_id, COALESCE(r.cuisine_type, ''),
+			COALESCE(ii.original_price, ofr.original_price, 0), oi.unit_price
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN restaurants r ON r.id = o.restaurant_id
+		LEFT JOIN inventory_items ii ON ii.id = oi.inventory_item_id
+		LEFT JOIN offers ofr ON ofr.id = oi.offer_id
+		WHERE o.user_id = $1 AND o.status NOT IN ('cancelled', 'refunded')
+		ORDER BY o.created_at DESC
+		LIMIT $2
+	`, userID, historyLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []PastOrder
+	for rows.Next() {
+		var order PastOrder
+		if err := rows.Scan(&order.RestaurantID, &order.CuisineType, &order.OriginalPrice, &order.PricePaid); err != nil {
+			return nil, fmt.Errorf("failed to scan order history: %w", err)
+		}
+		history = append(history, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+
+	var lat, lon *float64
+	if latitude.Valid && longitude.Valid {
+		lat, lon = &latitude.Float64, &longitude.Float64
+	}
+	return BuildUserProfile(lat, lon, history), nil
+}
+
+// radiusCondition returns a condition matching restaurants within radiusKm of a
+// location and its arguments, numbered from firstArg. Rows are prefiltered with a
+// bounding box on the location index. Without a location everything matches.
+func radiusCondition(lat, lon *float64, radiusKm float64, firstArg int) (string, []interface{}) {
+	if lat == nil || lon == nil {
+		return "true", nil
+	}
+
+	box, args := geo.BoundingBoxAround(*lat, *lon, radiusKm).SQL("r.latitude", "r.longitude", firstArg)
+	next := firstArg + len(args)
+	distance := geo.DistanceSQL("r.latitude", "r.longitude", fmt.Sprintf("$%d", next), fmt.Sprintf("$%d", next+1))
+	return fmt.Sprintf("%s AND %s <= $%d", box, distance, next+2), append(args, *lat, *lon, radiusKm)
+}
+
+// getCandidates loads the available inventory items and offers of active restaurants,
+// within radiusKm of the location when there is one
+func (s *RecommendationService) getCandidates(now time.Time, lat, lon *float64, radiusKm float64) ([]Candidate, error) {
+	candidates := []Candidate{}
+
+	nearby, nearbyArgs := radiusCondition(lat, lon, radiusKm, 2)
+	rows, err := s.db.Query(`
+		SELECT ii.id, ii.restaurant_id, r.name, COALESCE(r.cuisine_type, ''), ii.name,
+			ii.original_price, ii.surplus_price, r.latitude, r.longitude, ii.updated_at, ii.expiry_time, ii.at_risk
+		FROM inventory_items ii
+		JOIN restaurants r ON r.id = ii.restaurant_id
+		WHERE r.is_active = true AND ii.is_available = true AND ii.quantity > 0 AND ii.expiry_time > $1
+		AND `+nearby, append([]interface{}{now.Add(pickupBuffer)}, nearbyArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		candidate := Candidate{Kind: KindInventoryItem}
+		var expiry time.Time
+		err := rows.Scan(&candidate.ID, &candidate.RestaurantID, &candidate.RestaurantName, &candidate.CuisineType, &candidate.Name,
+			&candidate.OriginalPrice, &candidate.SurplusPrice, &candidate.Latitude, &candidate.Longitude, &candidate.ListedAt, &expiry, &candidate.AtRisk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
+		}
+		candidate.ExpiryTime = &expiry
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get inventory items: %w", err)
+	}
+
+	nearby, nearbyArgs = radiusCondition(lat, lon, radiusKm, 1)
+	offerRows, err := s.db.Query(`
+		SELECT o.id, o.restaurant_id, r.name, COALESCE(r.cuisine_type, ''), o.name,
+			o.original_price, o.surplus_price, r.latitude, r.longitude, o.updated_at
+		FROM offers o
+		JOIN restaurants r ON r.id = o.restaurant_id
+		WHERE r.is_active = true AND o.is_available = true AND (o.quantity IS NULL OR o.quantity > 0)
+		AND `+nearby, nearbyArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offers: %w", err)
+	}
+	defer offerRows.Close()
+
+	for offerRows.Next() {
+		candidate := Candidate{Kind: KindOffer}
+		err := offerRows.Scan(&candidate.ID, &candidate.RestaurantID, &candidate.RestaurantName, &candidate.CuisineType, &candidate.Name,
+			&candidate.OriginalPrice, &candidate.SurplusPrice, &candidate.Latitude, &candidate.Longitude, &candidate.ListedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan offer: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := offerRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get offers: %w", err)
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,289 @@
+package recommendationService
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"surplus-supper/backend/restaurantService"
+)
+
+// Kinds of recommended items
+const (
+	KindInventoryItem = "inventory_item"
+	KindOffer         = "offer"
+)
+
+// Weights blends the per-signal scores into one; they sum to 1
+type Weights struct {
+	Distance  float64 `json:"distance"`
+	Cuisine   float64 `json:"cuisine"`
+	Price     float64 `json:"price"`
+	Freshness float64 `json:"freshness"`
+}
+
+// DefaultWeights are the weights the service ranks with
+var DefaultWeights = Weights{Distance: 0.35, Cuisine: 0.25, Price: 0.2, Freshness: 0.2}
+
+const (
+	// distanceScaleKm is the distance at which the distance score falls to 1/e
+	distanceScaleKm = 3.0
+	// cuisineSmoothing is how many orders' worth of weight the uniform prior gets
+	cuisineSmoothing = 2.0
+	// freshnessHalfLife is how long after listing an item's freshness halves
+	freshnessHalfLife = 6 * time.Hour
+	// pickupBuffer is the least time before expiry an item is still worth recommending
+	pickupBuffer = 15 * time.Minute
+	// atRiskBonus lifts items the waste predictor flagged, see restaurantService.FlagWasteRisks
+	atRiskBonus = 0.05
+	// neutralScore is used for a signal with nothing to go on
+	neutralScore = 0.5
+)
+
+// Candidate is an available inventory item or offer that can be recommended
+type Candidate struct {
+	Kind           string     `json:"kind"`
+	ID             int        `json:"id"`
+	RestaurantID   int        `json:"restaurant_id"`
+	RestaurantName string     `json:"restaurant_name"`
+	CuisineType    string     `json:"cuisine_type"`
+	Name           string     `json:"name"`
+	OriginalPrice  float64    `json:"original_price"`
+	SurplusPrice   float64    `json:"surplus_price"`
+	Latitude       float64    `json:"-"`
+	Longitude      float64    `json:"-"`
+	ListedAt       time.Time  `json:"listed_at"`
+	ExpiryTime     *time.Time `json:"expiry_time,omitempty"`
+	AtRisk         bool       `json:"at_risk"`
+}
+
+// PastOrder is one item a user bought, as used to build their profile
+type PastOrder struct {
+	RestaurantID  int
+	CuisineType   string
+	OriginalPrice float64
+	PricePaid     float64
+}
+
+// UserProfile is what ranking knows about a user
+type UserProfile struct {
+	Latitude  *float64
+	Longitude *float64
+	// CuisineShare is the smoothed share of past orders per lower-case cuisine
+	CuisineShare map[string]float64
+	// DefaultCuisineShare is the share of a cuisine the user never ordered
+	DefaultCuisineShare float64
+	// Restaurants the user has ordered from
+	Restaurants map[int]bool
+	// TypicalPrice is the median price the user paid, 0 without history
+	TypicalPrice float64
+	// PriceSensitivity in [0, 1] is how much the user goes for deep discounts
+	PriceSensitivity float64
+	Orders           int
+}
+
+// ScoreBreakdown is the per-signal score of a recommendation, each in [0, 1]
+type ScoreBreakdown struct {
+	Distance  float64 `json:"distance"`
+	Cuisine   float64 `json:"cuisine"`
+	Price     float64 `json:"price"`
+	Freshness float64 `json:"freshness"`
+}
+
+// Recommendation is a ranked candidate with why it was recommended
+type Recommendation struct {
+	Candidate
+	DistanceKm *float64       `json:"distance_km,omitempty"`
+	Score      float64        `json:"score"`
+	Breakdown  ScoreBreakdown `json:"breakdown"`
+	Reasons    []string       `json:"reasons"`
+}
+
+// BuildUserProfile summarises a user's location and order history
+func BuildUserProfile(latitude, longitude *float64, history []PastOrder) *UserProfile {
+	profile := &UserProfile{
+		Latitude:         latitude,
+		Longitude:        longitude,
+		CuisineShare:     map[string]float64{},
+		Restaurants:      map[int]bool{},
+		PriceSensitivity: neutralScore,
+		Orders:           len(history),
+	}
+
+	counts := map[string]float64{}
+	prices := []float64{}
+	discountTotal, discounted := 0.0, 0
+	for _, order := range history {
+		profile.Restaurants[order.RestaurantID] = true
+		if cuisine := normalizeCuisine(order.CuisineType); cuisine != "" {
+			counts[cuisine]++
+		}
+		if order.PricePaid > 0 {
+			prices = append(prices, order.PricePaid)
+		}
+		if order.OriginalPrice > 0 {
+			discountTotal += discount(order.OriginalPrice, order.PricePaid)
+			discounted++
+		}
+	}
+
+	// Smooth towards a uniform prior over the cuisines seen plus one unseen one, so a
+	// single order doesn't rule everything else out
+	if len(counts) > 0 {
+		total := 0.0
+		for _, count := range counts {
+			total += count
+		}
+		prior := cuisineSmoothing / float64(len(counts)+1)
+		for cuisine, count := range counts {
+			profile.CuisineShare[cuisine] = (count + prior) / (total + cuisineSmoothing)
+		}
+		profile.DefaultCuisineShare = prior / (total + cuisineSmoothing)
+	}
+
+	if len(prices) > 0 {
+		sort.Float64s(prices)
+		profile.TypicalPrice = prices[len(prices)/2]
+		if len(prices)%2 == 0 {
+			profile.TypicalPrice = (prices[len(prices)/2-1] + prices[len(prices)/2]) / 2
+		}
+	}
+
+	// Surplus is usually 30-70% off; a user averaging 70% off is as price sensitive
+	// as it gets, one averaging 30% off barely cares
+	if discounted > 0 {
+		profile.PriceSensitivity = clamp((discountTotal/float64(discounted)-0.3)/0.4, 0, 1)
+	}
+
+	return profile
+}
+
+// Rank scores candidates for a user and returns the best limit of them, highest
+// score first. Candidates too close to expiry to pick up are left out. Ties are
+// broken by kind and id, so the same input always gives the same ranking.
+func Rank(profile *UserProfile, candidates []Candidate, weights Weights, now time.Time, limit int) []Recommendation {
+	recommendations := []Recommendation{}
+	for _, candidate := range candidates {
+		if candidate.ExpiryTime != nil && candidate.ExpiryTime.Sub(now) < pickupBuffer {
+			continue
+		}
+		recommendations = append(recommendations, score(profile, candidate, weights, now))
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations
+}
+
+// score computes a candidate's blended score and the reasons behind it
+func score(profile *UserProfile, candidate Candidate, weights Weights, now time.Time) Recommendation {
+	rec := Recommendation{Candidate: candidate, Reasons: []string{}}
+
+	// Distance decays exponentially; without a location it says nothing
+	rec.Breakdown.Distance = neutralScore
+	if profile.Latitude != nil && profile.Longitude != nil {
+		distance := restaurantService.CalculateDistance(*profile.Latitude, *profile.Longitude, candidate.Latitude, candidate.Longitude)
+		distance = math.Round(distance*100) / 100
+		rec.DistanceKm = &distance
+		rec.Breakdown.Distance = math.Exp(-distance / distanceScaleKm)
+		if distance < 1 {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("%.0f m away", distance*1000))
+		} else {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("%.1f km away", distance))
+		}
+	}
+
+	// Cuisine affinity is the user's smoothed share of orders for it, scaled so
+	// their favourite scores 1
+	rec.Breakdown.Cuisine = neutralScore
+	if len(profile.CuisineShare) > 0 {
+		best := 0.0
+		for _, share := range profile.CuisineShare {
+			best = math.Max(best, share)
+		}
+		share, ordered := profile.CuisineShare[normalizeCuisine(candidate.CuisineType)]
+		if !ordered {
+			share = profile.DefaultCuisineShare
+		}
+		rec.Breakdown.Cuisine = share / best
+		if ordered && share/best >= 0.5 && candidate.CuisineType != "" {
+			rec.Reasons = append(rec.Reasons, "You often order "+candidate.CuisineType)
+		}
+	}
+	if profile.Restaurants[candidate.RestaurantID] {
+		rec.Breakdown.Cuisine = math.Min(1, rec.Breakdown.Cuisine+0.1)
+		rec.Reasons = append(rec.Reasons, "You've ordered from "+candidate.RestaurantName+" before")
+	}
+
+	// Price blends the discount, which sensitive users care about, with how close
+	// the price is to what the user usually pays
+	off := discount(candidate.OriginalPrice, candidate.SurplusPrice)
+	fit := neutralScore
+	if profile.TypicalPrice > 0 && candidate.SurplusPrice > 0 {
+		fit = math.Exp(-math.Abs(math.Log(candidate.SurplusPrice / profile.TypicalPrice)))
+	}
+	rec.Breakdown.Price = profile.PriceSensitivity*off + (1-profile.PriceSensitivity)*fit
+	if off >= 0.5 {
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("%.0f%% off", off*100))
+	}
+
+	// Freshness halves every freshnessHalfLife since listing, and falls further in
+	// the last hour before expiry
+	age := now.Sub(candidate.ListedAt)
+	if age < 0 {
+		age = 0
+	}
+	rec.Breakdown.Freshness = math.Pow(0.5, age.Hours()/freshnessHalfLife.Hours())
+	if candidate.ExpiryTime != nil {
+		if remaining := candidate.ExpiryTime.Sub(now); remaining < time.Hour {
+			rec.Breakdown.Freshness *= remaining.Hours()
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Pick up within %d min", int(remaining.Minutes())))
+		}
+	}
+	if age < time.Hour {
+		rec.Reasons = append(rec.Reasons, "Just listed")
+	}
+
+	rec.Score = weights.Distance*rec.Breakdown.Distance +
+		weights.Cuisine*rec.Breakdown.Cuisine +
+		weights.Price*rec.Breakdown.Price +
+		weights.Freshness*rec.Breakdown.Freshness
+	if candidate.AtRisk {
+		rec.Score += atRiskBonus
+		rec.Reasons = append(rec.Reasons, "Last chance to save it from waste")
+	}
+	rec.Score = math.Round(rec.Score*10000) / 10000
+
+	return rec
+}
+
+// discount is the fraction taken off the original price
+func discount(originalPrice, price float64) float64 {
+	if originalPrice <= 0 {
+		return 0
+	}
+	return clamp(1-price/originalPrice, 0, 1)
+}
+
+// normalizeCuisine is the key cuisines are compared by
+func normalizeCuisine(cuisine string) string {
+	return strings.ToLower(strings.TrimSpace(cuisine))
+}
+
+func clamp(value, min, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
@@ -0,0 +1,235 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"surplus-supper/backend/geo"
+)
+
+// ErrOutsideDeliveryArea is returned when no active delivery zone covers an address
+var ErrOutsideDeliveryArea = errors.New("address is outside the restaurant's delivery area")
+
+// MaxDeliveryRadiusKm bounds the radius of a delivery zone
+const MaxDeliveryRadiusKm = 50
+
+// DeliveryZone is an area a restaurant delivers to, either within RadiusKm of the
+// restaurant or inside Polygon
+type DeliveryZone struct {
+	ID             int         `json:"id"`
+	RestaurantID   int         `json:"restaurant_id"`
+	Name           string      `json:"name"`
+	RadiusKm       *float64    `json:"radius_km,omitempty"`
+	Polygon        []geo.Point `json:"polygon,omitempty"`
+	Fee            float64     `json:"fee"`
+	MinOrderAmount float64     `json:"min_order_amount"`
+	IsActive       bool        `json:"is_active"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// CreateDeliveryZoneInput represents the input for creating a delivery zone.
+// Set either RadiusKm or Polygon.
+type CreateDeliveryZoneInput struct {
+	RestaurantID   int         `json:"restaurant_id"`
+	Name           string      `json:"name"`
+	RadiusKm       *float64    `json:"radius_km"`
+	Polygon        []geo.Point `json:"polygon"`
+	Fee            float64     `json:"fee"`
+	MinOrderAmount float64     `json:"min_order_amount"`
+}
+
+// DeliveryQuote is the zone an address falls in and what delivery there costs
+type DeliveryQuote struct {
+	ZoneID         int     `json:"zone_id"`
+	ZoneName       string  `json:"zone_name"`
+	Fee            float64 `json:"fee"`
+	MinOrderAmount float64 `json:"min_order_amount"`
+	DistanceKm     float64 `json:"distance_km"`
+}
+
+// deliveryZoneColumns are the delivery_zones columns read by scanDeliveryZone
+const deliveryZoneColumns = `id, restaurant_id, name, radius_km, polygon, fee, min_order_amount, is_active, created_at, updated_at`
+
+// scanDeliveryZone scans a row of deliveryZoneColumns
+func scanDeliveryZone(row interface{ Scan(...interface{}) error }) (*DeliveryZone, error) {
+	var zone DeliveryZone
+	var radius sql.NullFloat64
+	var polygon []byte
+	err := row.Scan(
+		&zone.ID, &zone.RestaurantID, &zone.Name, &radius, &polygon, &zone.Fee, &zone.MinOrderAmount, &zone.IsActive, &zone.CreatedAt, &zone.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if radius.Valid {
+		zone.RadiusKm = &radius.Float64
+	}
+	if polygon != nil {
+		if err := json.Unmarshal(polygon, &zone.Polygon); err != nil {
+			return nil, fmt.Errorf("failed to decode delivery zone polygon: %w", err)
+		}
+	}
+	return &zone, nil
+}
+
+// Covers reports whether the zone covers a point, given the restaurant's location
+// for radius zones
+func (z *DeliveryZone) Covers(restaurantLat, restaurantLon, lat, lon float64) bool {
+	if z.RadiusKm != nil {
+		return geo.Distance(restaurantLat, restaurantLon, lat, lon) <= *z.RadiusKm
+	}
+	return geo.PolygonContains(z.Polygon, lat, lon)
+}
+
+// CreateDeliveryZone creates a delivery zone for a restaurant
+func (s *RestaurantService) CreateDeliveryZone(input CreateDeliveryZoneInput) (*DeliveryZone, error) {
+	if input.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if (input.RadiusKm == nil) == (len(input.Polygon) == 0) {
+		return nil, errors.New("either radius_km or polygon is required")
+	}
+	if input.RadiusKm != nil && (*input.RadiusKm <= 0 || *input.RadiusKm > MaxDeliveryRadiusKm) {
+		return nil, fmt.Errorf("radius_km must be between 0 and %d", MaxDeliveryRadiusKm)
+	}
+	if input.Fee < 0 || input.MinOrderAmount < 0 {
+		return nil, errors.New("fee and min_order_amount can't be negative")
+	}
+
+	var polygon interface{}
+	if len(input.Polygon) > 0 {
+		if !geo.ValidPolygon(input.Polygon) {
+			return nil, errors.New("polygon needs at least three valid points and can't cross the antimeridian")
+		}
+		encoded, err := json.Marshal(input.Polygon)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode delivery zone polygon: %w", err)
+		}
+		polygon = string(encoded)
+	}
+
+	zone, err := scanDeliveryZone(s.db.QueryRow(`
+		INSERT INTO delivery_zones (restaurant_id, name, radius_km, polygon, fee, min_order_amount)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6)
+		RETURNING `+deliveryZoneColumns,
+		input.RestaurantID, input.Name, input.RadiusKm, polygon, input.Fee, input.MinOrderAmount,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery zone: %w", err)
+	}
+
+	return zone, nil
+}
+
+// GetDeliveryZones retrieves a restaurant's delivery zones, cheapest first
+func (s *RestaurantService) GetDeliveryZones(restaurantID int, activeOnly bool) ([]*DeliveryZone, error) {
+	query := `SELECT ` + deliveryZoneColumns + ` FROM delivery_zones WHERE restaurant_id = $1`
+	if activeOnly {
+		query += ` AND is_active = true`
+	}
+	query += ` ORDER BY fee, min_order_amount, id`
+
+	rows, err := s.db.Query(query, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery zones: %w", err)
+	}
+	defer rows.Close()
+
+	var zones []*DeliveryZone
+	for rows.Next() {
+		zone, err := scanDeliveryZone(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery zone: %w", err)
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// SetDeliveryZoneActive turns one of a restaurant's delivery zones on or off
+func (s *RestaurantService) SetDeliveryZoneActive(restaurantID, id int, active bool) (*DeliveryZone, error) {
+	zone, err := scanDeliveryZone(s.db.QueryRow(`
+		UPDATE delivery_zones SET is_active = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND restaurant_id = $2
+		RETURNING `+deliveryZoneColumns,
+		id, restaurantID, active,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("delivery zone not found")
+		}
+		return nil, fmt.Errorf("failed to update delivery zone: %w", err)
+	}
+
+	return zone, nil
+}
+
+// DeleteDeliveryZone deletes one of a restaurant's delivery zones
+func (s *RestaurantService) DeleteDeliveryZone(restaurantID, id int) error {
+	result, err := s.db.Exec("DELETE FROM delivery_zones WHERE id = $1 AND restaurant_id = $2", id, restaurantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete delivery zone: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("delivery zone not found")
+	}
+
+	return nil
+}
+
+// QuoteDelivery finds the cheapest active delivery zone covering an address.
+// It returns ErrOutsideDeliveryArea when there's none.
+func (s *RestaurantService) QuoteDelivery(restaurantID int, latitude, longitude float64) (*DeliveryQuote, error) {
+	if !geo.ValidCoordinates(latitude, longitude) {
+		return nil, ErrInvalidLocation
+	}
+
+	var restaurantLat, restaurantLon float64
+	err := s.db.QueryRow("SELECT latitude, longitude FROM restaurants WHERE id = $1 AND is_active = true", restaurantID).Scan(&restaurantLat, &restaurantLon)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRestaurantNotFound
+		}
+		return nil, fmt.Errorf("failed to get restaurant: %w", err)
+	}
+
+	zones, err := s.GetDeliveryZones(restaurantID, true)
+	if err != nil {
+		return nil, err
+	}
+	// Zones come cheapest first, so the first that covers the address wins
+	for _, zone := range zones {
+		if zone.Covers(restaurantLat, restaurantLon, latitude, longitude) {
+			return &DeliveryQuote{
+				ZoneID:         zone.ID,
+				ZoneName:       zone.Name,
+				Fee:            zone.Fee,
+				MinOrderAmount: zone.MinOrderAmount,
+				DistanceKm:     geo.Distance(restaurantLat, restaurantLon, latitude, longitude),
+			}, nil
+		}
+	}
+
+	return nil, ErrOutsideDeliveryArea
+}
+
+// DeliveryFee returns the zone, fee and minimum order for delivering to an
+// address, for orderService.DeliveryQuoter
+func (s *RestaurantService) DeliveryFee(restaurantID int, latitude, longitude float64) (int, float64, float64, error) {
+	quote, err := s.QuoteDelivery(restaurantID, latitude, longitude)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return quote.ZoneID, quote.Fee, quote.MinOrderAmount, nil
+}
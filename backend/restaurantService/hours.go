@@ -0,0 +1,441 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Opening hours errors
+var (
+	ErrInvalidHours    = errors.New("invalid opening hours")
+	ErrClosedForPickup = errors.New("restaurant is closed at the pickup time")
+	ErrPickupInPast    = errors.New("pickup time is in the past")
+)
+
+// nextOpenDays is how far ahead NextOpen looks, long enough to see past a closure
+const nextOpenDays = 366
+
+// pickupGrace lets a pickup time fall slightly in the past, e.g. "now" sent from a
+// slow client
+const pickupGrace = 5 * time.Minute
+
+// dateLayout is the format of exception dates
+const dateLayout = "2006-01-02"
+
+// OpeningPeriod is a weekly opening period in the restaurant's timezone
+type OpeningPeriod struct {
+	Weekday int    `json:"weekday"` // 0 is Sunday
+	Opens   string `json:"opens"`   // HH:MM
+	Closes  string `json:"closes"`  // HH:MM, at or before Opens for periods past midnight
+}
+
+// HoursException replaces the weekly hours from StartsOn to EndsOn, for holidays,
+// temporary closures and special hours
+type HoursException struct {
+	StartsOn string `json:"starts_on"` // YYYY-MM-DD
+	EndsOn   string `json:"ends_on"`   // YYYY-MM-DD, inclusive; defaults to StartsOn
+	Opens    string `json:"opens,omitempty"`
+	Closes   string `json:"closes,omitempty"` // both empty when closed all day
+	Reason   string `json:"reason"`
+}
+
+// OpeningHours are a restaurant's weekly hours and exceptions. A restaurant without
+// weekly hours is open around the clock, apart from its exceptions.
+type OpeningHours struct {
+	Timezone   string           `json:"timezone"`
+	Weekly     []OpeningPeriod  `json:"weekly"`
+	Exceptions []HoursException `json:"exceptions"`
+}
+
+// openingInterval is an opening on a particular day, in wall-clock time
+type openingInterval struct {
+	opens  time.Time
+	closes time.Time
+}
+
+// IsOpen reports whether the restaurant is open at t. It matches the
+// restaurant_is_open SQL function used to filter searches; the cases in
+// hours_test.go hold for both.
+func (h *OpeningHours) IsOpen(t time.Time) bool {
+	now := wallClock(t, h.location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// Yesterday's periods can run past midnight into today
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		for _, interval := range h.intervalsOn(day) {
+			if !now.Before(interval.opens) && now.Before(interval.closes) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextOpen returns when the restaurant next opens after t, or nil if it has no
+// opening within a year
+func (h *OpeningHours) NextOpen(t time.Time) *time.Time {
+	location := h.location()
+	now := wallClock(t, location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= nextOpenDays; i++ {
+		var next *time.Time
+		for _, interval := range h.intervalsOn(today.AddDate(0, 0, i)) {
+			if interval.opens.After(now) && (next == nil || interval.opens.Before(*next)) {
+				opens := interval.opens
+				next = &opens
+			}
+		}
+		if next != nil {
+			opens := time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), next.Minute(), 0, 0, location)
+			// An opening time skipped by a DST change happens just after the gap, as
+			// Postgres reads it, rather than before the restaurant opens
+			if skipped := next.Sub(wallClock(opens, location)); skipped > 0 {
+				opens = opens.Add(skipped)
+			}
+			return &opens
+		}
+	}
+	return nil
+}
+
+// intervalsOn returns the openings starting on a day, given as midnight UTC
+func (h *OpeningHours) intervalsOn(day time.Time) []openingInterval {
+	date := day.Format(dateLayout)
+	var exception *HoursException
+	for i := range h.Exceptions {
+		candidate := &h.Exceptions[i]
+		// The latest starting exception wins, as in restaurant_is_open
+		if date >= candidate.StartsOn && date <= candidate.EndsOn && (exception == nil || candidate.StartsOn >= exception.StartsOn) {
+			exception = candidate
+		}
+	}
+
+	switch {
+	case exception != nil && exception.Opens == "":
+		return nil
+	case exception != nil:
+		return []openingInterval{newOpeningInterval(day, exception.Opens, exception.Closes)}
+	case len(h.Weekly) == 0:
+		return []openingInterval{{opens: day, closes: day.AddDate(0, 0, 1)}}
+	}
+
+	var intervals []openingInterval
+	for _, period := range h.Weekly {
+		if period.Weekday == int(day.Weekday()) {
+			intervals = append(intervals, newOpeningInterval(day, period.Opens, period.Closes))
+		}
+	}
+	return intervals
+}
+
+func newOpeningInterval(day time.Time, opens, closes string) openingInterval {
+	opensAt, _ := parseClock(opens)
+	closesAt, _ := parseClock(closes)
+	interval := openingInterval{
+		opens:  day.Add(time.Duration(opensAt) * time.Minute),
+		closes: day.Add(time.Duration(closesAt) * time.Minute),
+	}
+	if closesAt <= opensAt {
+		interval.closes = interval.closes.AddDate(0, 0, 1)
+	}
+	return interval
+}
+
+func (h *OpeningHours) location() *time.Location {
+	location, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// wallClock returns t's wall-clock time in location as a UTC time, so local times
+// compare the way Postgres compares TIMESTAMP values
+func wallClock(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+}
+
+// normalizeOpeningHours checks opening hours and fills in defaults
+func normalizeOpeningHours(hours *OpeningHours) error {
+	if hours.Timezone == "" {
+		hours.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(hours.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidHours, hours.Timezone)
+	}
+
+	for i := range hours.Weekly {
+		period := &hours.Weekly[i]
+		if period.Weekday < 0 || period.Weekday > 6 {
+			return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6", ErrInvalidHours)
+		}
+		if err := normalizePeriod(&period.Opens, &period.Closes); err != nil {
+			return err
+		}
+	}
+
+	for i := range hours.Exceptions {
+		exception := &hours.Exceptions[i]
+		if exception.EndsOn == "" {
+			exception.EndsOn = exception.StartsOn
+		}
+		startsOn, startErr := time.Parse(dateLayout, exception.StartsOn)
+		endsOn, endErr := time.Parse(dateLayout, exception.EndsOn)
+		if startErr != nil || endErr != nil {
+			return fmt.Errorf("%w: exception dates must be YYYY-MM-DD", ErrInvalidHours)
+		}
+		if endsOn.Before(startsOn) {
+			return fmt.Errorf("%w: exception ends before it starts", ErrInvalidHours)
+		}
+		if (exception.Opens == "") != (exception.Closes == "") {
+			return fmt.Errorf("%w: exception opens and closes must be set together", ErrInvalidHours)
+		}
+		if exception.Opens != "" {
+			if err := normalizePeriod(&exception.Opens, &exception.Closes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizePeriod checks an opening period's times and rewrites them as HH:MM
+func normalizePeriod(opens, closes *string) error {
+	opensAt, err := parseClock(*opens)
+	if err != nil || opensAt == 24*60 {
+		return fmt.Errorf("%w: invalid opening time %q, expected HH:MM", ErrInvalidHours, *opens)
+	}
+	closesAt, err := parseClock(*closes)
+	if err != nil {
+		return fmt.Errorf("%w: invalid closing time %q, expected HH:MM", ErrInvalidHours, *closes)
+	}
+	if opensAt == closesAt {
+		return fmt.Errorf("%w: a period can't open and close at the same time", ErrInvalidHours)
+	}
+	*opens = formatClock(opensAt)
+	*closes = formatClock(closesAt)
+	return nil
+}
+
+// parseClock parses "HH:MM" (or "HH:MM:SS") into minutes after midnight, allowing
+// "24:00" for the end of the day
+func parseClock(value string) (int, error) {
+	value = trimSeconds(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// trimSeconds turns Postgres TIME output like "22:00:00" into "22:00"
+func trimSeconds(value string) string {
+	if len(value) > 5 && strings.Count(value, ":") == 2 {
+		return value[:5]
+	}
+	return value
+}
+
+// GetOpeningHours retrieves a restaurant's opening hours, with exceptions that
+// haven't ended yet
+func (s *RestaurantService) GetOpeningHours(restaurantID int) (*OpeningHours, error) {
+	hours, err := s.loadOpeningHours([]int{restaurantID})
+	if err != nil {
+		return nil, err
+	}
+	if hours[restaurantID] == nil {
+		return nil, ErrRestaurantNotFound
+	}
+	return hours[restaurantID], nil
+}
+
+// SetOpeningHours replaces a restaurant's timezone, weekly hours and exceptions
+func (s *RestaurantService) SetOpeningHours(restaurantID int, hours OpeningHours) (*OpeningHours, error) {
+	if err := normalizeOpeningHours(&hours); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE restaurants SET timezone = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", restaurantID, hours.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update restaurant timezone: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return nil, ErrRestaurantNotFound
+	}
+
+	if _, err = tx.Exec("DELETE FROM restaurant_hours WHERE restaurant_id = $1", restaurantID); err != nil {
+		return nil, fmt.Errorf("failed to clear opening hours: %w", err)
+	}
+	if _, err = tx.Exec("DELETE FROM restaurant_hours_exceptions WHERE restaurant_id = $1", restaurantID); err != nil {
+		return nil, fmt.Errorf("failed to clear opening hours exceptions: %w", err)
+	}
+	for _, period := range hours.Weekly {
+		_, err = tx.Exec(`
+			INSERT INTO restaurant_hours (restaurant_id, day_of_week, opens_at, closes_at)
+			VALUES ($1, $2, $3, $4)
+		`, restaurantID, period.Weekday, period.Opens, period.Closes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save opening hours: %w", err)
+		}
+	}
+	for _, exception := range hours.Exceptions {
+		_, err = tx.Exec(`
+			INSERT INTO restaurant_hours_exceptions (restaurant_id, starts_on, ends_on, opens_at, closes_at, reason)
+			VALUES ($1, $2, $3, NULLIF($4, '')::TIME, NULLIF($5, '')::TIME, $6)
+		`, restaurantID, exception.StartsOn, exception.EndsOn, exception.Opens, exception.Closes, exception.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save opening hours exception: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetOpeningHours(restaurantID)
+}
+
+// CheckPickup returns an error unless the restaurant is open at the pickup time.
+// Closed errors say when it next opens.
+func (s *RestaurantService) CheckPickup(restaurantID int, pickup time.Time) error {
+	now := time.Now()
+	if pickup.Before(now.Add(-pickupGrace)) {
+		return ErrPickupInPast
+	}
+
+	hours, err := s.GetOpeningHours(restaurantID)
+	if err != nil {
+		return err
+	}
+	if hours.IsOpen(pickup) {
+		return nil
+	}
+	if next := hours.NextOpen(pickup); next != nil {
+		return fmt.Errorf("%w, it next opens at %s", ErrClosedForPickup, next.Format(time.RFC3339))
+	}
+	return ErrClosedForPickup
+}
+
+// attachOpeningStatus sets whether each restaurant is open now, and when it next
+// opens if not
+func (s *RestaurantService) attachOpeningStatus(restaurants []*Restaurant) error {
+	if len(restaurants) == 0 {
+		return nil
+	}
+	ids := make([]int, len(restaurants))
+	for i, restaurant := range restaurants {
+		ids[i] = restaurant.ID
+	}
+	hours, err := s.loadOpeningHours(ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, restaurant := range restaurants {
+		schedule := hours[restaurant.ID]
+		if schedule == nil {
+			continue
+		}
+		isOpen := schedule.IsOpen(now)
+		restaurant.IsOpenNow = &isOpen
+		if !isOpen {
+			restaurant.NextOpen = schedule.NextOpen(now)
+		}
+	}
+	return nil
+}
+
+// loadOpeningHours loads the opening hours of restaurants by ID. Exceptions that
+// ended a couple of days ago are left out, they can't affect today in any timezone.
+func (s *RestaurantService) loadOpeningHours(ids []int) (map[int]*OpeningHours, error) {
+	hours := make(map[int]*OpeningHours, len(ids))
+	rows, err := s.db.Query("SELECT id, timezone FROM restaurants WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get restaurant timezones: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		schedule := &OpeningHours{Weekly: []OpeningPeriod{}, Exceptions: []HoursException{}}
+		if err := rows.Scan(&id, &schedule.Timezone); err != nil {
+			return nil, fmt.Errorf("failed to scan restaurant timezone: %w", err)
+		}
+		hours[id] = schedule
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get restaurant timezones: %w", err)
+	}
+
+	periodRows, err := s.db.Query(`
+		SELECT restaurant_id, day_of_week, opens_at, closes_at
+		FROM restaurant_hours WHERE restaurant_id = ANY($1)
+		ORDER BY restaurant_id, day_of_week, opens_at
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get opening hours: %w", err)
+	}
+	defer periodRows.Close()
+	for periodRows.Next() {
+		var restaurantID int
+		var period OpeningPeriod
+		if err := periodRows.Scan(&restaurantID, &period.Weekday, &period.Opens, &period.Closes); err != nil {
+			return nil, fmt.Errorf("failed to scan opening hours: %w", err)
+		}
+		period.Opens, period.Closes = trimSeconds(period.Opens), trimSeconds(period.Closes)
+		if schedule := hours[restaurantID]; schedule != nil {
+			schedule.Weekly = append(schedule.Weekly, period)
+		}
+	}
+	if err := periodRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get opening hours: %w", err)
+	}
+
+	exceptionRows, err := s.db.Query(`
+		SELECT restaurant_id, starts_on, ends_on, opens_at, closes_at, COALESCE(reason, '')
+		FROM restaurant_hours_exceptions
+		WHERE restaurant_id = ANY($1) AND ends_on >= CURRENT_DATE - 2
+		ORDER BY restaurant_id, starts_on, id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get opening hours exceptions: %w", err)
+	}
+	defer exceptionRows.Close()
+	for exceptionRows.Next() {
+		var restaurantID int
+		var startsOn, endsOn time.Time
+		var opens, closes sql.NullString
+		var exception HoursException
+		if err := exceptionRows.Scan(&restaurantID, &startsOn, &endsOn, &opens, &closes, &exception.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan opening hours exception: %w", err)
+		}
+		exception.StartsOn, exception.EndsOn = startsOn.Format(dateLayout), endsOn.Format(dateLayout)
+		exception.Opens, exception.Closes = trimSeconds(opens.String), trimSeconds(closes.String)
+		if schedule := hours[restaurantID]; schedule != nil {
+			schedule.Exceptions = append(schedule.Exceptions, exception)
+		}
+	}
+	if err := exceptionRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get opening hours exceptions: %w", err)
+	}
+
+	return hours, nil
+}
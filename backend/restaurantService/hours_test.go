@@ -0,0 +1,141 @@
+package restaurantService
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests' timezones, whatever the machine has installed
+)
+
+// These cases describe the schedule semantics shared by OpeningHours.IsOpen and the
+// restaurant_is_open SQL function; a change to either must keep them passing.
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestOpeningHoursIsOpen(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, newYork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	// Mondays 09:00-17:00 and Fridays 22:00-02:00, in New York
+	weekly := []OpeningPeriod{
+		{Weekday: 1, Opens: "09:00", Closes: "17:00"},
+		{Weekday: 5, Opens: "22:00", Closes: "02:00"},
+	}
+
+	tests := []struct {
+		name  string
+		hours OpeningHours
+		at    time.Time
+		want  bool
+	}{
+		{"inside a period", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-01 12:00"), true},
+		{"at opening time", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-01 09:00"), true},
+		{"at closing time", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-01 17:00"), false},
+		{"other weekday", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-02 12:00"), false},
+		{"before midnight", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-05 23:30"), true},
+		{"past midnight into the next day", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-06 01:59"), true},
+		{"after a period past midnight", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, at("2026-06-06 02:00"), false},
+		{"restaurant's timezone, not UTC", OpeningHours{Timezone: "America/New_York", Weekly: weekly}, time.Date(2026, 6, 1, 14, 0, 0, 0, time.UTC), true},
+		{"UTC timezone", OpeningHours{Timezone: "UTC", Weekly: weekly}, time.Date(2026, 6, 1, 14, 0, 0, 0, time.UTC), true},
+		{"UTC timezone after closing", OpeningHours{Timezone: "UTC", Weekly: weekly}, time.Date(2026, 6, 1, 17, 30, 0, 0, time.UTC), false},
+		{"no weekly hours", OpeningHours{Timezone: "America/New_York"}, at("2026-06-02 03:00"), true},
+		{"closed-day exception", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-01", EndsOn: "2026-06-01"},
+		}}, at("2026-06-01 12:00"), false},
+		{"closed-day exception on the day before", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-05", EndsOn: "2026-06-05"},
+		}}, at("2026-06-06 01:00"), false},
+		{"closed exception on an open-all-day restaurant", OpeningHours{Timezone: "America/New_York", Exceptions: []HoursException{
+			{StartsOn: "2026-12-24", EndsOn: "2026-12-26"},
+		}}, at("2026-12-25 12:00"), false},
+		{"special hours", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-02", EndsOn: "2026-06-02", Opens: "10:00", Closes: "11:00"},
+		}}, at("2026-06-02 10:30"), true},
+		{"latest starting exception wins", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-01", EndsOn: "2026-06-07"},
+			{StartsOn: "2026-06-03", EndsOn: "2026-06-03", Opens: "18:00", Closes: "20:00"},
+		}}, at("2026-06-03 19:00"), true},
+		// Spring forward: 02:00 EST jumps to 03:00 EDT on 8 March 2026
+		{"period spanning the spring gap", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "01:00", Closes: "04:00"},
+		}}, time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), true},
+		{"after a period ending in the spring gap", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "00:00", Closes: "02:30"},
+		}}, time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC), false},
+		// Fall back: 01:00-02:00 happens twice on 1 November 2026, both times open
+		{"first 01:30 on the fall-back day", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "01:00", Closes: "02:00"},
+		}}, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), true},
+		{"repeated 01:30 on the fall-back day", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "01:00", Closes: "02:00"},
+		}}, time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), true},
+	}
+
+	for _, test := range tests {
+		if got := test.hours.IsOpen(test.at); got != test.want {
+			t.Errorf("%s: IsOpen(%s) = %v, want %v", test.name, test.at.Format(time.RFC3339), got, test.want)
+		}
+	}
+}
+
+func TestOpeningHoursNextOpen(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+	weekly := []OpeningPeriod{
+		{Weekday: 1, Opens: "09:00", Closes: "17:00"},
+		{Weekday: 5, Opens: "22:00", Closes: "02:00"},
+	}
+
+	tests := []struct {
+		name  string
+		hours OpeningHours
+		at    time.Time
+		want  time.Time // zero for nil
+	}{
+		{"later the same day", OpeningHours{Timezone: "America/New_York", Weekly: weekly},
+			time.Date(2026, 6, 1, 8, 0, 0, 0, newYork), time.Date(2026, 6, 1, 9, 0, 0, 0, newYork)},
+		{"later in the week", OpeningHours{Timezone: "America/New_York", Weekly: weekly},
+			time.Date(2026, 6, 1, 17, 0, 0, 0, newYork), time.Date(2026, 6, 5, 22, 0, 0, 0, newYork)},
+		{"next week once open", OpeningHours{Timezone: "America/New_York", Weekly: weekly},
+			time.Date(2026, 6, 5, 23, 0, 0, 0, newYork), time.Date(2026, 6, 8, 9, 0, 0, 0, newYork)},
+		{"restaurant's timezone", OpeningHours{Timezone: "Asia/Tokyo", Weekly: weekly},
+			time.Date(2026, 6, 1, 0, 30, 0, 0, time.UTC), time.Date(2026, 6, 5, 22, 0, 0, 0, tokyo)},
+		{"skips a closed-day exception", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-05", EndsOn: "2026-06-08"},
+		}}, time.Date(2026, 6, 1, 18, 0, 0, 0, newYork), time.Date(2026, 6, 12, 22, 0, 0, 0, newYork)},
+		{"special hours", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-02", EndsOn: "2026-06-02", Opens: "10:00", Closes: "11:00"},
+		}}, time.Date(2026, 6, 1, 18, 0, 0, 0, newYork), time.Date(2026, 6, 2, 10, 0, 0, 0, newYork)},
+		{"opening in the spring gap moves to after it", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "02:30", Closes: "05:00"},
+		}}, time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)},
+		{"across the fall-back change", OpeningHours{Timezone: "America/New_York", Weekly: []OpeningPeriod{
+			{Weekday: 0, Opens: "09:00", Closes: "17:00"},
+		}}, time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), time.Date(2026, 11, 1, 14, 0, 0, 0, time.UTC)},
+		{"closed for over a year", OpeningHours{Timezone: "America/New_York", Weekly: weekly, Exceptions: []HoursException{
+			{StartsOn: "2026-06-01", EndsOn: "2027-12-31"},
+		}}, time.Date(2026, 6, 1, 8, 0, 0, 0, newYork), time.Time{}},
+	}
+
+	for _, test := range tests {
+		got := test.hours.NextOpen(test.at)
+		switch {
+		case test.want.IsZero() && got != nil:
+			t.Errorf("%s: NextOpen = %s, want nil", test.name, got.Format(time.RFC3339))
+		case !test.want.IsZero() && (got == nil || !got.Equal(test.want)):
+			t.Errorf("%s: NextOpen = %v, want %s", test.name, got, test.want.Format(time.RFC3339))
+		}
+	}
+}
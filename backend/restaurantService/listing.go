@@ -0,0 +1,444 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"surplus-supper/backend/geo"
+
+	"github.com/lib/pq"
+)
+
+// Listing sort orders
+const (
+	SortDistance = "distance" // nearest first, needs a location
+	SortRating   = "rating"   // best rated first
+	SortDiscount = "discount" // biggest discount on any listing first
+	SortExpiry   = "expiry"   // soonest expiring inventory first
+	SortPrice    = "price"    // cheapest listing first
+)
+
+// Listing page size and radius defaults
+const (
+	DefaultListingPageSize = 20
+	MaxListingPageSize     = 100
+	DefaultListingRadiusKm = 10
+)
+
+// ErrInvalidSort is returned for an unknown sort order, or distance without a location
+var ErrInvalidSort = errors.New("invalid sort")
+
+// PriceBucket is a price range restaurants are faceted by, on their cheapest listing
+type PriceBucket struct {
+	Key   string
+	Label string
+	Min   float64
+	Max   float64 // exclusive, 0 for no upper bound
+}
+
+// PriceBuckets are the price facets, cheapest first
+var PriceBuckets = []PriceBucket{
+	{Key: "under_5", Label: "Under $5", Max: 5},
+	{Key: "5_to_10", Label: "$5 - $10", Min: 5, Max: 10},
+	{Key: "10_to_15", Label: "$10 - $15", Min: 10, Max: 15},
+	{Key: "15_plus", Label: "$15+", Min: 15},
+}
+
+// ListingQuery lists active restaurants. With a location, only restaurants within
+// RadiusKm are listed and facets count the restaurants in that area.
+type ListingQuery struct {
+	Latitude  *float64
+	Longitude *float64
+	RadiusKm  float64
+	Sort      string // one of the Sort constants; distance with a location, rating without
+	// Cuisines, PriceBuckets and OfferTypes filter the list; each facet is counted
+	// with the other two filters applied but not its own
+	Cuisines     []string
+	PriceBuckets []string
+	OfferTypes   []string
+	Cursor       string // NextCursor from the previous page, empty for the first page
+	Limit        int
+}
+
+// RestaurantListing is a restaurant with a summary of what it has on offer now
+type RestaurantListing struct {
+	Restaurant
+	BestDiscount  *float64   `json:"best_discount_percent,omitempty"`
+	SoonestExpiry *time.Time `json:"soonest_expiry,omitempty"`
+	CheapestPrice *float64   `json:"cheapest_price,omitempty"`
+	Listings      int        `json:"listings"`
+	OfferTypes    []string   `json:"offer_types"`
+}
+
+// Facet is a filter value and how many restaurants match it
+type Facet struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// ListingFacets count restaurants by cuisine, price bucket and offer type
+type ListingFacets struct {
+	Cuisines     []Facet `json:"cuisines"`
+	PriceBuckets []Facet `json:"price_buckets"`
+	OfferTypes   []Facet `json:"offer_types"`
+}
+
+// ListingPage is one page of restaurants and the facets for the whole list
+type ListingPage struct {
+	Restaurants []*RestaurantListing `json:"restaurants"`
+	Facets      ListingFacets        `json:"facets"`
+	Sort        string               `json:"sort"`
+	NextCursor  string               `json:"next_cursor,omitempty"`
+	HasMore     bool                 `json:"has_more"`
+}
+
+// listingSortKeys are the SQL for each sort's key. Every sort is ascending on
+// (key, id), so descending sorts negate their key, and restaurants without listings
+// get a key that puts them last.
+var listingSortKeys = map[string]string{
+	SortDistance: "distance",
+	SortRating:   "-COALESCE(rating, 0)::float8",
+	SortDiscount: "COALESCE(-best_discount, 2)",
+	SortExpiry:   "COALESCE(EXTRACT(EPOCH FROM soonest_expiry)::float8, 1e15)",
+	SortPrice:    "COALESCE(cheapest_price, 1e15)",
+}
+
+// ListRestaurants returns a page of active restaurants in the query's sort order,
+// with what each has on offer and facet counts for the area
+func (s *RestaurantService) ListRestaurants(query ListingQuery) (*ListingPage, error) {
+	if err := normalizeListingQuery(&query); err != nil {
+		return nil, err
+	}
+
+	var after listingCursor
+	if query.Cursor != "" {
+		var err error
+		after, err = decodeListingCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	area, args := listingAreaSQL(query, time.Now())
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	filters := map[string]string{
+		"cuisine":    "true",
+		"price":      "true",
+		"offer_type": "true",
+	}
+	if len(query.Cuisines) > 0 {
+		filters["cuisine"] = "LOWER(cuisine_type) = ANY(" + arg(pq.Array(query.Cuisines)) + ")"
+	}
+	if len(query.PriceBuckets) > 0 {
+		filters["price"] = "price_bucket = ANY(" + arg(pq.Array(query.PriceBuckets)) + ")"
+	}
+	if len(query.OfferTypes) > 0 {
+		filters["offer_type"] = "offer_types && " + arg(pq.Array(query.OfferTypes)) + "::varchar[]"
+	}
+	facetArgs := append([]interface{}{}, args...)
+
+	listArgs := append([]interface{}{}, args...)
+	listArg := func(value interface{}) string {
+		listArgs = append(listArgs, value)
+		return "$" + strconv.Itoa(len(listArgs))
+	}
+	keyset := "true"
+	if query.Cursor != "" {
+		keyset = fmt.Sprintf("(sort_key, id) > (%s::float8, %s)", listArg(after.Key), listArg(after.ID))
+	}
+	rows, err := s.db.Query(area+`
+		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating, is_active, created_at, updated_at,
+		       distance, best_discount, soonest_expiry, cheapest_price, listings, offer_types, sort_key
+		FROM area
+		WHERE `+filters["cuisine"]+` AND `+filters["price"]+` AND `+filters["offer_type"]+` AND `+keyset+`
+		ORDER BY sort_key, id
+		LIMIT `+listArg(query.Limit+1), listArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restaurants: %w", err)
+	}
+	defer rows.Close()
+
+	page := &ListingPage{Restaurants: []*RestaurantListing{}, Sort: query.Sort}
+	var keys []float64
+	for rows.Next() {
+		listing, key, err := scanRestaurantListing(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Restaurants = append(page.Restaurants, listing)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list restaurants: %w", err)
+	}
+	if len(page.Restaurants) > query.Limit {
+		page.Restaurants = page.Restaurants[:query.Limit]
+		page.HasMore = true
+		last := page.Restaurants[query.Limit-1]
+		page.NextCursor = listingCursor{Sort: query.Sort, Key: keys[query.Limit-1], ID: last.ID}.encode()
+	}
+
+	restaurants := make([]*Restaurant, len(page.Restaurants))
+	for i, listing := range page.Restaurants {
+		restaurants[i] = &listing.Restaurant
+	}
+	if err := s.attachOpeningStatus(restaurants); err != nil {
+		return nil, err
+	}
+
+	page.Facets, err = s.listingFacets(area, facetArgs, filters)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// normalizeListingQuery checks a listing query and fills in defaults
+func normalizeListingQuery(query *ListingQuery) error {
+	if query.Limit <= 0 {
+		query.Limit = DefaultListingPageSize
+	}
+	if query.Limit > MaxListingPageSize {
+		query.Limit = MaxListingPageSize
+	}
+
+	if (query.Latitude == nil) != (query.Longitude == nil) {
+		return ErrInvalidLocation
+	}
+	if query.Latitude != nil {
+		if query.RadiusKm == 0 {
+			query.RadiusKm = DefaultListingRadiusKm
+		}
+		if !geo.ValidCoordinates(*query.Latitude, *query.Longitude) || query.RadiusKm < 0 || query.RadiusKm > MaxNearbyRadiusKm {
+			return ErrInvalidLocation
+		}
+	}
+
+	if query.Sort == "" {
+		query.Sort = SortRating
+		if query.Latitude != nil {
+			query.Sort = SortDistance
+		}
+	}
+	if _, ok := listingSortKeys[query.Sort]; !ok || (query.Sort == SortDistance && query.Latitude == nil) {
+		return ErrInvalidSort
+	}
+
+	query.Cuisines = lowerAll(query.Cuisines)
+	query.OfferTypes = lowerAll(query.OfferTypes)
+	query.PriceBuckets = lowerAll(query.PriceBuckets)
+	return nil
+}
+
+// listingAreaSQL is a WITH clause defining "area": the active restaurants in the
+// query's area with a summary of their available listings, price bucket and sort key
+func listingAreaSQL(query ListingQuery, now time.Time) (string, []interface{}) {
+	args := []interface{}{now}
+	distance, location := "NULL::float8", "true"
+	if query.Latitude != nil {
+		box, boxArgs := geo.BoundingBoxAround(*query.Latitude, *query.Longitude, query.RadiusKm).SQL("r.latitude", "r.longitude", len(args)+1)
+		args = append(args, boxArgs...)
+		args = append(args, *query.Latitude, *query.Longitude, query.RadiusKm)
+		n := len(args)
+		distance = geo.DistanceSQL("r.latitude", "r.longitude", "$"+strconv.Itoa(n-2), "$"+strconv.Itoa(n-1))
+		location = box + " AND " + distance + " <= $" + strconv.Itoa(n)
+	}
+
+	bucket := "CASE WHEN cheapest_price IS NULL THEN NULL"
+	for _, b := range PriceBuckets {
+		if b.Max > 0 {
+			bucket += fmt.Sprintf(" WHEN cheapest_price < %g THEN '%s'", b.Max, b.Key)
+		} else {
+			bucket += fmt.Sprintf(" ELSE '%s'", b.Key)
+		}
+	}
+	bucket += " END"
+
+	return `
+		WITH summary AS (
+			SELECT r.id, r.name, COALESCE(r.description, '') AS description, r.address, r.latitude, r.longitude,
+			       COALESCE(r.phone, '') AS phone, COALESCE(r.email, '') AS email, COALESCE(r.cuisine_type, '') AS cuisine_type,
+			       COALESCE(r.rating, 0) AS rating, r.is_active, r.created_at, r.updated_at,
+			       ` + distance + ` AS distance,
+			       l.best_discount, l.soonest_expiry, l.cheapest_price, l.listings, COALESCE(l.offer_types, '{}') AS offer_types
+			FROM restaurants r
+			CROSS JOIN LATERAL (
+				SELECT MAX(discount)::float8 AS best_discount, MIN(expiry_time) AS soonest_expiry,
+				       MIN(price)::float8 AS cheapest_price, COUNT(*) AS listings,
+				       array_agg(DISTINCT offer_type) FILTER (WHERE offer_type IS NOT NULL) AS offer_types
+				FROM (
+					SELECT CASE WHEN original_price > 0 THEN 1 - surplus_price / original_price ELSE 0 END AS discount,
+					       expiry_time, surplus_price AS price, NULL::varchar AS offer_type
+					FROM inventory_items
+					WHERE restaurant_id = r.id AND is_available = true AND quantity > 0 AND (expiry_time IS NULL OR expiry_time > $1)
+					UNION ALL
+					SELECT CASE WHEN original_price > 0 THEN 1 - surplus_price / original_price ELSE 0 END,
+					       NULL, surplus_price, LOWER(offer_type)::varchar
+					FROM offers
+					WHERE restaurant_id = r.id AND is_available = true AND (quantity IS NULL OR quantity > 0)
+				) listing
+			) l
+			WHERE r.is_active = true AND ` + location + `
+		), area AS (
+			SELECT *, ` + bucket + ` AS price_bucket, ` + listingSortKeys[query.Sort] + ` AS sort_key
+			FROM summary
+		)`, args
+}
+
+// listingFacets counts the area's restaurants by cuisine, price bucket and offer
+// type, each with the other facets' filters applied
+func (s *RestaurantService) listingFacets(area string, args []interface{}, filters map[string]string) (ListingFacets, error) {
+	facets := ListingFacets{Cuisines: []Facet{}, PriceBuckets: []Facet{}, OfferTypes: []Facet{}}
+	rows, err := s.db.Query(area+`
+		SELECT 'cuisine', LOWER(cuisine_type), MIN(cuisine_type), COUNT(*)
+		FROM area WHERE cuisine_type <> '' AND `+filters["price"]+` AND `+filters["offer_type"]+`
+		GROUP BY LOWER(cuisine_type)
+		UNION ALL
+		SELECT 'price', price_bucket, price_bucket, COUNT(*)
+		FROM area WHERE price_bucket IS NOT NULL AND `+filters["cuisine"]+` AND `+filters["offer_type"]+`
+		GROUP BY price_bucket
+		UNION ALL
+		SELECT 'offer_type', offer_type, offer_type, COUNT(*)
+		FROM area, unnest(offer_types) AS offer_type WHERE `+filters["cuisine"]+` AND `+filters["price"]+`
+		GROUP BY offer_type
+	`, args...)
+	if err != nil {
+		return facets, fmt.Errorf("failed to count listing facets: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := map[string]int{}
+	for rows.Next() {
+		var kind string
+		var facet Facet
+		if err := rows.Scan(&kind, &facet.Value, &facet.Label, &facet.Count); err != nil {
+			return facets, fmt.Errorf("failed to scan listing facet: %w", err)
+		}
+		switch kind {
+		case "cuisine":
+			facets.Cuisines = append(facets.Cuisines, facet)
+		case "price":
+			buckets[facet.Value] = facet.Count
+		case "offer_type":
+			facet.Label = offerTypeLabel(facet.Value)
+			facets.OfferTypes = append(facets.OfferTypes, facet)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return facets, fmt.Errorf("failed to count listing facets: %w", err)
+	}
+
+	for _, bucket := range PriceBuckets {
+		facets.PriceBuckets = append(facets.PriceBuckets, Facet{Value: bucket.Key, Label: bucket.Label, Count: buckets[bucket.Key]})
+	}
+	for _, list := range [][]Facet{facets.Cuisines, facets.OfferTypes} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Value < list[j].Value
+		})
+	}
+	return facets, nil
+}
+
+// scanRestaurantListing scans a listing row and its sort key
+func scanRestaurantListing(rows *sql.Rows) (*RestaurantListing, float64, error) {
+	var listing RestaurantListing
+	var distance, discount, price sql.NullFloat64
+	var expiry sql.NullTime
+	var offerTypes pq.StringArray
+	var key float64
+	r := &listing.Restaurant
+	err := rows.Scan(
+		&r.ID, &r.Name, &r.Description, &r.Address, &r.Latitude, &r.Longitude, &r.Phone, &r.Email, &r.CuisineType, &r.Rating, &r.IsActive, &r.CreatedAt, &r.UpdatedAt,
+		&distance, &discount, &expiry, &price, &listing.Listings, &offerTypes, &key,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan restaurant listing: %w", err)
+	}
+
+	if distance.Valid {
+		r.DistanceKm = &distance.Float64
+	}
+	if discount.Valid {
+		percent := math.Round(discount.Float64*1000) / 10
+		listing.BestDiscount = &percent
+	}
+	if expiry.Valid {
+		listing.SoonestExpiry = &expiry.Time
+	}
+	if price.Valid {
+		listing.CheapestPrice = &price.Float64
+	}
+	listing.OfferTypes = []string(offerTypes)
+	if listing.OfferTypes == nil {
+		listing.OfferTypes = []string{}
+	}
+	return &listing, key, nil
+}
+
+// listingCursor is a position in a sorted listing. It records the sort so a cursor
+// from one order isn't used with another.
+type listingCursor struct {
+	Sort string
+	Key  float64
+	ID   int
+}
+
+func (c listingCursor) encode() string {
+	raw := c.Sort + ":" + strconv.FormatFloat(c.Key, 'g', -1, 64) + ":" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListingCursor(value, sortOrder string) (listingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return listingCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != sortOrder {
+		return listingCursor{}, ErrInvalidCursor
+	}
+	key, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || math.IsNaN(key) || math.IsInf(key, 0) {
+		return listingCursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id <= 0 {
+		return listingCursor{}, ErrInvalidCursor
+	}
+	return listingCursor{Sort: sortOrder, Key: key, ID: id}, nil
+}
+
+// offerTypeLabel turns an offer type like "surprise_bag" into "Surprise Bag"
+func offerTypeLabel(offerType string) string {
+	words := strings.Fields(strings.ReplaceAll(offerType, "_", " "))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// lowerAll trims and lower-cases values, dropping empty ones
+func lowerAll(values []string) []string {
+	var out []string
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,276 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"surplus-supper/backend/geo"
+)
+
+// Map zoom levels, as used by web map tiles
+const (
+	MaxMapZoom = 22
+	// ClusterMaxZoom is the zoom from which every restaurant is its own point
+	ClusterMaxZoom = 15
+)
+
+// ErrInvalidMapArea is returned for a map bounding box off the Earth or a zoom out of range
+var ErrInvalidMapArea = errors.New("invalid map area or zoom")
+
+// clusterCellPixels is the size of the screen grid restaurants are clustered on
+const clusterCellPixels = 64
+
+// maxMapFeatures caps the restaurants or clusters returned for one map. Only a
+// map far larger than a screen for its zoom reaches it; the rest are cut off.
+const maxMapFeatures = 2000
+
+// MapQuery is the visible area of a map and its zoom level
+type MapQuery struct {
+	Box           geo.BoundingBox
+	Zoom          int
+	AvailableOnly bool // only restaurants with surplus available now
+}
+
+// MapRestaurant is a restaurant on the map with a summary of its surplus
+type MapRestaurant struct {
+	ID          int
+	Name        string
+	CuisineType string
+	Latitude    float64
+	Longitude   float64
+	// AvailableItems counts inventory item units plus available offers
+	AvailableItems int
+	BestDiscount   *float64 // percent
+}
+
+// GetMapFeatures returns the active restaurants in a map's area as GeoJSON points,
+// clustered on a screen grid below ClusterMaxZoom. Restaurant features have the
+// restaurant's id, name, cuisine_type, available_items and best_discount_percent;
+// cluster features have point_count, the members' total available_items, their
+// best_discount_percent and expansion_zoom, the zoom at which they split up.
+// Clustering happens in the database, so a zoomed out map costs one row per cell,
+// and at most maxMapFeatures features come back.
+func (s *RestaurantService) GetMapFeatures(query MapQuery) (*geo.FeatureCollection, error) {
+	box := query.Box
+	if box.MinLat > box.MaxLat || !geo.ValidCoordinates(box.MinLat, box.MinLon) || !geo.ValidCoordinates(box.MaxLat, box.MaxLon) {
+		return nil, ErrInvalidMapArea
+	}
+	if query.Zoom < 0 || query.Zoom > MaxMapZoom {
+		return nil, fmt.Errorf("%w: zoom must be between 0 and %d", ErrInvalidMapArea, MaxMapZoom)
+	}
+
+	if query.Zoom >= ClusterMaxZoom {
+		restaurants, err := s.getMapRestaurants(query, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		collection := geo.NewFeatureCollection()
+		for _, restaurant := range restaurants {
+			collection.Features = append(collection.Features, restaurantFeature(restaurant))
+		}
+		return collection, nil
+	}
+
+	clusters, err := s.getMapClusters(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	collection := geo.NewFeatureCollection()
+	for _, cluster := range clusters {
+		if cluster.count == 1 {
+			collection.Features = append(collection.Features, restaurantFeature(&cluster.restaurant))
+			continue
+		}
+		collection.Features = append(collection.Features, clusterFeature(cluster, query.Zoom))
+	}
+	return collection, nil
+}
+
+// mapListingsSQL is a WITH clause defining listed, the active restaurants in the
+// map's area with their surplus and position in world pixels at zoom 0. Surplus
+// is summed once per restaurant rather than looked up row by row. The arguments
+// start with now.
+func mapListingsSQL(query MapQuery, now time.Time) (string, []interface{}) {
+	condition, args := query.Box.SQL("r.latitude", "r.longitude", 2)
+	available := ""
+	if query.AvailableOnly {
+		available = "WHERE s.available_items > 0"
+	}
+	x, y := geo.WorldPixelSQL("a.latitude", "a.longitude")
+
+	return `
+		WITH area AS (
+			SELECT r.id, r.name, COALESCE(r.cuisine_type, '') AS cuisine_type, r.latitude, r.longitude
+			FROM restaurants r
+			WHERE r.is_active = true AND ` + condition + `
+		), surplus AS (
+			SELECT restaurant_id, SUM(units)::int AS available_items, (MAX(discount) * 100)::float8 AS best_discount
+			FROM (
+				SELECT restaurant_id, quantity AS units, CASE WHEN original_price > 0 THEN 1 - surplus_price / original_price ELSE 0 END AS discount
+				FROM inventory_items
+				WHERE restaurant_id IN (SELECT id FROM area) AND is_available = true AND quantity > 0 AND (expiry_time IS NULL OR expiry_time > $1)
+				UNION ALL
+				-- Offers whose units aren't counted count as one
+				SELECT restaurant_id, COALESCE(quantity, 1), CASE WHEN original_price > 0 THEN 1 - surplus_price / original_price ELSE 0 END
+				FROM offers
+				WHERE restaurant_id IN (SELECT id FROM area) AND is_available = true AND (quantity IS NULL OR quantity > 0)
+			) listing
+			GROUP BY restaurant_id
+		), listed AS (
+			SELECT a.id, a.name, a.cuisine_type, a.latitude::float8 AS latitude, a.longitude::float8 AS longitude,
+				COALESCE(s.available_items, 0) AS available_items, s.best_discount,
+				` + x + ` AS x, ` + y + ` AS y
+			FROM area a
+			LEFT JOIN surplus s ON s.restaurant_id = a.id
+			` + available + `
+		)`, append([]interface{}{now}, args...)
+}
+
+// getMapRestaurants returns the restaurants in the map's area, at most
+// maxMapFeatures of them
+func (s *RestaurantService) getMapRestaurants(query MapQuery, now time.Time) ([]*MapRestaurant, error) {
+	listings, args := mapListingsSQL(query, now)
+	rows, err := s.db.Query(listings+`
+		SELECT id, name, cuisine_type, latitude, longitude, available_items, best_discount
+		FROM listed
+		ORDER BY id
+		LIMIT `+strconv.Itoa(maxMapFeatures), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get map restaurants: %w", err)
+	}
+	defer rows.Close()
+
+	var restaurants []*MapRestaurant
+	for rows.Next() {
+		var restaurant MapRestaurant
+		var discount sql.NullFloat64
+		err := rows.Scan(&restaurant.ID, &restaurant.Name, &restaurant.CuisineType, &restaurant.Latitude, &restaurant.Longitude, &restaurant.AvailableItems, &discount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan map restaurant: %w", err)
+		}
+		if discount.Valid {
+			restaurant.BestDiscount = &discount.Float64
+		}
+		restaurants = append(restaurants, &restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get map restaurants: %w", err)
+	}
+
+	return restaurants, nil
+}
+
+// mapCell is a square of the clustering grid at a zoom level
+type mapCell struct {
+	x, y int
+}
+
+// mapCluster is the restaurants sharing a grid cell. restaurant is the only member
+// of a cell of one; otherwise it has the members' centre and totals.
+type mapCluster struct {
+	cell       mapCell
+	count      int
+	restaurant MapRestaurant
+	minX, maxX float64 // members' world pixels at zoom 0
+	minY, maxY float64
+}
+
+// getMapClusters groups the restaurants in the map's area by grid cell at the
+// query's zoom, top left first. At most maxMapFeatures cells are returned.
+func (s *RestaurantService) getMapClusters(query MapQuery, now time.Time) ([]*mapCluster, error) {
+	listings, args := mapListingsSQL(query, now)
+	scale := "$" + strconv.Itoa(len(args)+1)
+	rows, err := s.db.Query(listings+`
+		SELECT cell_x, cell_y, COUNT(*), MIN(id), MIN(name), MIN(cuisine_type), AVG(latitude), AVG(longitude),
+			SUM(available_items)::int, MAX(best_discount), MIN(x), MAX(x), MIN(y), MAX(y)
+		FROM (
+			SELECT listed.*,
+				floor(x * `+scale+` / `+strconv.Itoa(clusterCellPixels)+`)::int AS cell_x,
+				floor(y * `+scale+` / `+strconv.Itoa(clusterCellPixels)+`)::int AS cell_y
+			FROM listed
+		) cells
+		GROUP BY cell_x, cell_y
+		ORDER BY cell_y, cell_x
+		LIMIT `+strconv.Itoa(maxMapFeatures), append(args, math.Exp2(float64(query.Zoom)))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get map clusters: %w", err)
+	}
+	defer rows.Close()
+
+	var clusters []*mapCluster
+	for rows.Next() {
+		var cluster mapCluster
+		var discount sql.NullFloat64
+		err := rows.Scan(
+			&cluster.cell.x, &cluster.cell.y, &cluster.count,
+			&cluster.restaurant.ID, &cluster.restaurant.Name, &cluster.restaurant.CuisineType,
+			&cluster.restaurant.Latitude, &cluster.restaurant.Longitude, &cluster.restaurant.AvailableItems, &discount,
+			&cluster.minX, &cluster.maxX, &cluster.minY, &cluster.maxY,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan map cluster: %w", err)
+		}
+		if discount.Valid {
+			cluster.restaurant.BestDiscount = &discount.Float64
+		}
+		clusters = append(clusters, &cluster)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get map clusters: %w", err)
+	}
+
+	return clusters, nil
+}
+
+// cellAt returns the grid cell at a zoom of a world pixel at zoom 0
+func cellAt(x, y float64, zoom int) mapCell {
+	scale := math.Exp2(float64(zoom)) / clusterCellPixels
+	return mapCell{x: int(math.Floor(x * scale)), y: int(math.Floor(y * scale))}
+}
+
+// expansionZoom returns the first zoom after zoom at which a cluster's members no
+// longer share a cell. The members' extremes split first, so they are enough.
+func expansionZoom(cluster *mapCluster, zoom int) int {
+	expansion := zoom + 1
+	for ; expansion < ClusterMaxZoom; expansion++ {
+		if cellAt(cluster.minX, cluster.minY, expansion) != cellAt(cluster.maxX, cluster.maxY, expansion) {
+			break
+		}
+	}
+	return expansion
+}
+
+func restaurantFeature(restaurant *MapRestaurant) *geo.Feature {
+	var discount interface{}
+	if restaurant.BestDiscount != nil {
+		discount = math.Round(*restaurant.BestDiscount)
+	}
+	return geo.NewPointFeature(restaurant.ID, restaurant.Latitude, restaurant.Longitude, map[string]interface{}{
+		"cluster":               false,
+		"restaurant_id":         restaurant.ID,
+		"name":                  restaurant.Name,
+		"cuisine_type":          restaurant.CuisineType,
+		"available_items":       restaurant.AvailableItems,
+		"best_discount_percent": discount,
+	})
+}
+
+func clusterFeature(cluster *mapCluster, zoom int) *geo.Feature {
+	var discount interface{}
+	if cluster.restaurant.BestDiscount != nil {
+		discount = math.Round(*cluster.restaurant.BestDiscount)
+	}
+
+	id := fmt.Sprintf("cluster-%d-%d-%d", zoom, cluster.cell.x, cluster.cell.y)
+	return geo.NewPointFeature(id, cluster.restaurant.Latitude, cluster.restaurant.Longitude, map[string]interface{}{
+		"cluster":               true,
+		"point_count":           cluster.count,
+		"available_items":       cluster.restaurant.AvailableItems,
+		"best_discount_percent": discount,
+		"expansion_zoom":        expansionZoom(cluster, zoom),
+	})
+}
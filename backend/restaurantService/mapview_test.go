@@ -0,0 +1,49 @@
+package restaurantService
+
+import (
+	"math"
+	"testing"
+
+	"surplus-supper/backend/geo"
+)
+
+func TestExpansionZoom(t *testing.T) {
+	tests := []struct {
+		name    string
+		members [][2]float64 // latitude, longitude
+		zoom    int
+	}{
+		{"same building", [][2]float64{{40.7128, -74.0060}, {40.71281, -74.00601}}, 3},
+		{"across a city", [][2]float64{{40.7128, -74.0060}, {40.7306, -73.9352}, {40.6782, -73.9442}}, 5},
+		{"neighbouring towns", [][2]float64{{51.5074, -0.1278}, {51.7520, -1.2577}}, 2},
+		{"split east to west only", [][2]float64{{0, 10}, {0, 10.5}}, 0},
+		{"split north to south only", [][2]float64{{10, 0}, {10.5, 0}}, 0},
+		{"at the last clustered zoom", [][2]float64{{40.7128, -74.0060}, {40.7306, -73.9352}}, ClusterMaxZoom - 1},
+	}
+
+	for _, test := range tests {
+		cluster := &mapCluster{count: len(test.members), minX: math.Inf(1), maxX: math.Inf(-1), minY: math.Inf(1), maxY: math.Inf(-1)}
+		for _, member := range test.members {
+			x, y := geo.WorldPixel(member[0], member[1], 0)
+			cluster.minX, cluster.maxX = math.Min(cluster.minX, x), math.Max(cluster.maxX, x)
+			cluster.minY, cluster.maxY = math.Min(cluster.minY, y), math.Max(cluster.maxY, y)
+		}
+
+		// The first zoom at which any two members are in different cells
+		want := test.zoom + 1
+		for ; want < ClusterMaxZoom; want++ {
+			cells := map[mapCell]bool{}
+			for _, member := range test.members {
+				x, y := geo.WorldPixel(member[0], member[1], want)
+				cells[mapCell{x: int(math.Floor(x / clusterCellPixels)), y: int(math.Floor(y / clusterCellPixels))}] = true
+			}
+			if len(cells) > 1 {
+				break
+			}
+		}
+
+		if got := expansionZoom(cluster, test.zoom); got != want {
+			t.Errorf("%s: expansion zoom %d, want %d", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// bigPriceDrop is how far below its pre-markdown price an item must fall
+// before followers are told about it
+const bigPriceDrop = 0.25
+
+// Price change reasons recorded in price_history
+const (
+	PriceChangeManual   = "manual"
+	PriceChangeMarkdown = "markdown"
+)
+
+// MarkdownSchedule lowers an item's surplus price in steps as it nears expiry
+type MarkdownSchedule struct {
+	ID                       int       `json:"id"`
+	RestaurantID             int       `json:"restaurant_id"`
+	InventoryItemID          *int      `json:"inventory_item_id"`
+	Category                 string    `json:"category"`
+	StartMinutesBeforeExpiry int       `json:"start_minutes_before_expiry"`
+	StepMinutes              int       `json:"step_minutes"`
+	StepPercent              float64   `json:"step_percent"`
+	FloorRatio               *float64  `json:"floor_ratio"`
+	IsActive                 bool      `json:"is_active"`
+	CreatedAt                time.Time `json:"created_at"`
+}
+
+// CreateMarkdownScheduleInput represents the input for creating a markdown schedule.
+// Set either InventoryItemID or Category.
+type CreateMarkdownScheduleInput struct {
+	RestaurantID             int      `json:"restaurant_id"`
+	InventoryItemID          *int     `json:"inventory_item_id"`
+	Category                 string   `json:"category"`
+	StartMinutesBeforeExpiry int      `json:"start_minutes_before_expiry"`
+	StepMinutes              int      `json:"step_minutes"`
+	StepPercent              float64  `json:"step_percent"`
+	FloorRatio               *float64 `json:"floor_ratio"`
+}
+
+// PriceChange is an entry in an item's price history
+type PriceChange struct {
+	ID                 int       `json:"id"`
+	InventoryItemID    int       `json:"inventory_item_id"`
+	OldPrice           float64   `json:"old_price"`
+	NewPrice           float64   `json:"new_price"`
+	Reason             string    `json:"reason"`
+	MarkdownScheduleID *int      `json:"markdown_schedule_id"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// PriceDropNotifier is told when a markdown makes an item much cheaper
+type PriceDropNotifier interface {
+	SendPriceDropNotification(restaurantID int, itemName string, oldPrice, newPrice float64) error
+}
+
+// SetPriceDropNotifier sets the notifier used when markdowns cause a big price drop
+func (s *RestaurantService) SetPriceDropNotifier(notifier PriceDropNotifier) {
+	s.priceDropNotifier = notifier
+}
+
+// CreateMarkdownSchedule creates a markdown schedule for an item or category
+func (s *RestaurantService) CreateMarkdownSchedule(input CreateMarkdownScheduleInput) (*MarkdownSchedule, error) {
+	if input.InventoryItemID == nil && input.Category == "" {
+		return nil, errors.New("inventory_item_id or category is required")
+	}
+	if input.StartMinutesBeforeExpiry == 0 {
+		input.StartMinutesBeforeExpiry = 120
+	}
+	if input.StepMinutes == 0 {
+		input.StepMinutes = 30
+	}
+	if input.StepPercent == 0 {
+		input.StepPercent = 10
+	}
+	if input.StartMinutesBeforeExpiry < 0 || input.StepMinutes < 0 {
+		return nil, errors.New("start_minutes_before_expiry and step_minutes must be positive")
+	}
+	if input.StepPercent < 0 || input.StepPercent >= 100 {
+		return nil, errors.New("step_percent must be between 0 and 100")
+	}
+	if input.FloorRatio != nil && (*input.FloorRatio <= 0 || *input.FloorRatio > 1) {
+		return nil, errors.New("floor_ratio must be between 0 and 1")
+	}
+
+	// An item schedule must belong to the same restaurant as the item
+	if input.InventoryItemID != nil {
+		var exists bool
+		err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE id = $1 AND restaurant_id = $2)", *input.InventoryItemID, input.RestaurantID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check inventory item: %w", err)
+		}
+		if !exists {
+			return nil, errors.New("inventory item not found")
+		}
+	}
+
+	row := s.db.QueryRow(`
+		INSERT INTO markdown_schedules (restaurant_id, inventory_item_id, category, start_minutes_before_expiry, step_minutes, step_percent, floor_ratio)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+		RETURNING id, restaurant_id, inventory_item_id, category, start_minutes_before_expiry, step_minutes, step_percent, floor_ratio, is_active, created_at
+	`, input.RestaurantID, input.InventoryItemID, input.Category, input.StartMinutesBeforeExpiry, input.StepMinutes, input.StepPercent, input.FloorRatio)
+
+	schedule, err := scanMarkdownSchedule(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create markdown schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetMarkdownSchedules retrieves a restaurant's markdown schedules
+func (s *RestaurantService) GetMarkdownSchedules(restaurantID int) ([]*MarkdownSchedule, error) {
+	rows, err := s.db.Query(`
+		SELECT id, restaurant_id, inventory_item_id, category, start_minutes_before_expiry, step_minutes, step_percent, floor_ratio, is_active, created_at
+		FROM markdown_schedules WHERE restaurant_id = $1 ORDER BY created_at DESC
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get markdown schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*MarkdownSchedule
+	for rows.Next() {
+		schedule, err := scanMarkdownSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan markdown schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+// DeleteMarkdownSchedule deletes one of a restaurant's markdown schedules
+func (s *RestaurantService) DeleteMarkdownSchedule(restaurantID, id int) error {
+	result, err := s.db.Exec("DELETE FROM markdown_schedules WHERE id = $1 AND restaurant_id = $2", id, restaurantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete markdown schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("markdown schedule not found")
+	}
+
+	return nil
+}
+
+// GetPriceHistory retrieves an item's price changes, oldest first
+func (s *RestaurantService) GetPriceHistory(inventoryItemID int) ([]*PriceChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, inventory_item_id, old_price, new_price, reason, markdown_schedule_id, created_at
+		FROM price_history WHERE inventory_item_id = $1 ORDER BY created_at, id
+	`, inventoryItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []*PriceChange
+	for rows.Next() {
+		var change PriceChange
+		var scheduleID sql.NullInt64
+		err := rows.Scan(&change.ID, &change.InventoryItemID, &change.OldPrice, &change.NewPrice, &change.Reason, &scheduleID, &change.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan price change: %w", err)
+		}
+		if scheduleID.Valid {
+			id := int(scheduleID.Int64)
+			change.MarkdownScheduleID = &id
+		}
+		changes = append(changes, &change)
+	}
+
+	return changes, nil
+}
+
+// MarkdownPrice returns the price a schedule sets for an item at a given time, or
+// basePrice when the markdown window hasn't started. Steps are a percentage of
+// basePrice (the price before the first markdown) and never go below the floor.
+func MarkdownPrice(basePrice, originalPrice float64, expiry, now time.Time, startMinutes, stepMinutes int, stepPercent, floorRatio float64) float64 {
+	start := expiry.Add(-time.Duration(startMinutes) * time.Minute)
+	if now.Before(start) || !now.Before(expiry) {
+		return basePrice
+	}
+
+	// The first step applies as soon as the window opens
+	steps := 1
+	if stepMinutes > 0 {
+		steps += int(now.Sub(start) / (time.Duration(stepMinutes) * time.Minute))
+	}
+
+	price := basePrice * (1 - float64(steps)*stepPercent/100)
+	if floor := originalPrice * floorRatio; price < floor {
+		price = floor
+	}
+
+	return math.Round(price*100) / 100
+}
+
+// ApplyMarkdowns lowers the price of every item inside an active markdown window
+// and returns how many prices changed. Prices are only ever lowered, so a manual
+// price below the schedule is left alone.
+func (s *RestaurantService) ApplyMarkdowns(now time.Time) (int, error) {
+	rows, err := s.db.Query(`
+		SELECT i.id, i.restaurant_id, i.name, i.original_price, i.surplus_price,
+		       COALESCE(i.markdown_base_price, i.surplus_price), i.expiry_time,
+		       m.id, m.start_minutes_before_expiry, m.step_minutes, m.step_percent,
+		       COALESCE(m.floor_ratio, r.min_price_ratio)
+		FROM inventory_items i
+		JOIN restaurants r ON r.id = i.restaurant_id
+		CROSS JOIN LATERAL (
+			SELECT * FROM markdown_schedules ms
+			WHERE ms.restaurant_id = i.restaurant_id AND ms.is_active
+			AND (ms.inventory_item_id = i.id OR (ms.inventory_item_id IS NULL AND LOWER(ms.category) = LOWER(i.category)))
+			ORDER BY ms.inventory_item_id IS NULL, ms.id
+			LIMIT 1
+		) m
+		WHERE i.is_available = true AND i.quantity > 0
+		AND i.expiry_time > $1
+		AND i.expiry_time <= $1 + make_interval(mins => m.start_minutes_before_expiry)
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get items to mark down: %w", err)
+	}
+
+	type markdown struct {
+		itemID, restaurantID, scheduleID int
+		name                             string
+		oldPrice, basePrice, newPrice    float64
+	}
+
+	var markdowns []markdown
+	for rows.Next() {
+		var m markdown
+		var originalPrice, stepPercent, floorRatio float64
+		var expiry time.Time
+		var startMinutes, stepMinutes int
+		err := rows.Scan(&m.itemID, &m.restaurantID, &m.name, &originalPrice, &m.oldPrice, &m.basePrice, &expiry,
+			&m.scheduleID, &startMinutes, &stepMinutes, &stepPercent, &floorRatio)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan item to mark down: %w", err)
+		}
+
+		m.newPrice = MarkdownPrice(m.basePrice, originalPrice, expiry, now, startMinutes, stepMinutes, stepPercent, floorRatio)
+		if m.newPrice < m.oldPrice-0.005 {
+			markdowns = append(markdowns, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get items to mark down: %w", err)
+	}
+
+	changed := 0
+	for _, m := range markdowns {
+		ok, err := s.applyMarkdown(m.itemID, m.scheduleID, m.oldPrice, m.basePrice, m.newPrice)
+		if err != nil {
+			log.Printf("Failed to mark down inventory item %d: %v", m.itemID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		changed++
+
+		// Tell followers once, when the item first crosses the big-drop threshold
+		threshold := m.basePrice * (1 - bigPriceDrop)
+		if m.newPrice <= threshold && m.oldPrice > threshold {
+			s.publishPriceDrop(m.restaurantID, m.name, m.basePrice, m.newPrice)
+		}
+	}
+
+	return changed, nil
+}
+
+// applyMarkdown sets a marked-down price and records it. It returns false when the
+// price changed since it was read, leaving the item for the next run.
+func (s *RestaurantService) applyMarkdown(itemID, scheduleID int, oldPrice, basePrice, newPrice float64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE inventory_items
+		SET surplus_price = $2, markdown_base_price = COALESCE(markdown_base_price, $3), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND surplus_price = $4
+	`, itemID, newPrice, basePrice, oldPrice)
+	if err != nil {
+		return false, fmt.Errorf("failed to update price: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO price_history (inventory_item_id, old_price, new_price, reason, markdown_schedule_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, itemID, oldPrice, newPrice, PriceChangeMarkdown, scheduleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record price change: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// publishPriceDrop notifies followers about a big price drop without blocking the scheduler
+func (s *RestaurantService) publishPriceDrop(restaurantID int, name string, oldPrice, newPrice float64) {
+	if s.priceDropNotifier == nil {
+		return
+	}
+
+	go func() {
+		if err := s.priceDropNotifier.SendPriceDropNotification(restaurantID, name, oldPrice, newPrice); err != nil {
+			log.Printf("Failed to send price drop notification for restaurant %d: %v", restaurantID, err)
+		}
+	}()
+}
+
+// StartMarkdownScheduler applies markdowns every interval until the returned stop function is called
+func (s *RestaurantService) StartMarkdownScheduler(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				changed, err := s.ApplyMarkdowns(now)
+				if err != nil {
+					log.Printf("Failed to apply markdowns: %v", err)
+				} else if changed > 0 {
+					log.Printf("Applied %d markdowns", changed)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// scanMarkdownSchedule scans a markdown_schedules row
+func scanMarkdownSchedule(row interface{ Scan(...interface{}) error }) (*MarkdownSchedule, error) {
+	var schedule MarkdownSchedule
+	var itemID sql.NullInt64
+	var category sql.NullString
+	var floorRatio sql.NullFloat64
+
+	err := row.Scan(&schedule.ID, &schedule.RestaurantID, &itemID, &category, &schedule.StartMinutesBeforeExpiry,
+		&schedule.StepMinutes, &schedule.StepPercent, &floorRatio, &schedule.IsActive, &schedule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if itemID.Valid {
+		id := int(itemID.Int64)
+		schedule.InventoryItemID = &id
+	}
+	schedule.Category = category.String
+	if floorRatio.Valid {
+		schedule.FloorRatio = &floorRatio.Float64
+	}
+
+	return &schedule, nil
+}
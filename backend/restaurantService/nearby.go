@@ -0,0 +1,112 @@
+package restaurantService
+
+import (
+	"errors"
+	"fmt"
+
+	"surplus-supper/backend/geo"
+)
+
+// Page size and radius limits for nearby search
+const (
+	DefaultNearbyPageSize = 20
+	MaxNearbyPageSize     = 100
+	MaxNearbyRadiusKm     = 200
+)
+
+// ErrInvalidCursor is returned when a nearby search cursor can't be decoded
+var ErrInvalidCursor = geo.ErrInvalidCursor
+
+// ErrInvalidLocation is returned for coordinates off the Earth or a radius out of range
+var ErrInvalidLocation = errors.New("invalid location or radius")
+
+// NearbyQuery is a nearby restaurant search
+type NearbyQuery struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	Cursor    string // NextCursor from the previous page, empty for the first page
+	Limit     int
+}
+
+// NearbyPage is one page of restaurants, nearest first
+type NearbyPage struct {
+	Restaurants []*Restaurant `json:"restaurants"`
+	NextCursor  string        `json:"next_cursor,omitempty"`
+	HasMore     bool          `json:"has_more"`
+}
+
+// GetNearbyRestaurantsPage returns a page of active restaurants within the radius,
+// ordered by distance then id. Rows are prefiltered with a bounding box on the
+// location index and only those inside it get an exact distance; pages are keyed
+// on the last (distance, id) so they stay stable while restaurants are added.
+func (s *RestaurantService) GetNearbyRestaurantsPage(query NearbyQuery) (*NearbyPage, error) {
+	if !geo.ValidCoordinates(query.Latitude, query.Longitude) || query.RadiusKm <= 0 || query.RadiusKm > MaxNearbyRadiusKm {
+		return nil, ErrInvalidLocation
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultNearbyPageSize
+	}
+	if limit > MaxNearbyPageSize {
+		limit = MaxNearbyPageSize
+	}
+
+	after := geo.Cursor{Distance: -1}
+	if query.Cursor != "" {
+		var err error
+		after, err = geo.DecodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	box, boxArgs := geo.BoundingBoxAround(query.Latitude, query.Longitude, query.RadiusKm).SQL("latitude", "longitude", 7)
+	args := append([]interface{}{query.Latitude, query.Longitude, query.RadiusKm, after.Distance, after.ID, limit + 1}, boxArgs...)
+
+	rows, err := s.db.Query(`
+		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating, is_active, created_at, updated_at, distance
+		FROM (
+			SELECT *, `+geo.DistanceSQL("latitude", "longitude", "$1", "$2")+` AS distance
+			FROM restaurants
+			WHERE is_active = true AND `+box+`
+		) nearby
+		WHERE distance <= $3 AND (distance, id) > ($4, $5)
+		ORDER BY distance, id
+		LIMIT $6
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nearby restaurants: %w", err)
+	}
+	defer rows.Close()
+
+	page := &NearbyPage{Restaurants: []*Restaurant{}}
+	for rows.Next() {
+		var restaurant Restaurant
+		var distance float64
+		err := rows.Scan(
+			&restaurant.ID, &restaurant.Name, &restaurant.Description, &restaurant.Address, &restaurant.Latitude, &restaurant.Longitude, &restaurant.Phone, &restaurant.Email, &restaurant.CuisineType, &restaurant.Rating, &restaurant.IsActive, &restaurant.CreatedAt, &restaurant.UpdatedAt, &distance,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan restaurant: %w", err)
+		}
+		restaurant.DistanceKm = &distance
+		page.Restaurants = append(page.Restaurants, &restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get nearby restaurants: %w", err)
+	}
+
+	if len(page.Restaurants) > limit {
+		page.Restaurants = page.Restaurants[:limit]
+		page.HasMore = true
+		last := page.Restaurants[limit-1]
+		page.NextCursor = geo.Cursor{Distance: *last.DistanceKm, ID: last.ID}.Encode()
+	}
+	if err := s.attachOpeningStatus(page.Restaurants); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
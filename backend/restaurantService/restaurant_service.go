@@ -4,10 +4,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"math"
+	"log"
 	"time"
+
+	"surplus-supper/backend/geo"
 )
 
+// ErrRestaurantNotFound is returned when a restaurant id matches no restaurant
+var ErrRestaurantNotFound = errors.New("restaurant not found")
+
 // Restaurant represents a restaurant in the system
 type Restaurant struct {
 	ID          int       `json:"id"`
@@ -23,6 +28,9 @@ type Restaurant struct {
 	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	DistanceKm  *float64  `json:"distance_km,omitempty"` // set by nearby search
+	IsOpenNow   *bool      `json:"is_open_now,omitempty"` // set with opening hours, see attachOpeningStatus
+	NextOpen    *time.Time `json:"next_open,omitempty"`   // when a closed restaurant next opens
 }
 
 // InventoryItem represents an inventory item in a restaurant
@@ -37,10 +45,35 @@ type InventoryItem struct {
 	Category     string    `json:"category"`
 	ExpiryTime   time.Time `json:"expiry_time"`
 	IsAvailable  bool      `json:"is_available"`
+	WeightKg     *float64  `json:"weight_kg"`
+	WasteRisk    *float64  `json:"waste_risk"`
+	AtRisk       bool      `json:"at_risk"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// inventoryItemColumns are the inventory_items columns read by scanInventoryItem
+const inventoryItemColumns = `id, restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, is_available, weight_kg, waste_risk, at_risk, created_at, updated_at`
+
+// scanInventoryItem scans a row of inventoryItemColumns
+func scanInventoryItem(row interface{ Scan(...interface{}) error }) (*InventoryItem, error) {
+	var item InventoryItem
+	var weight, risk sql.NullFloat64
+	err := row.Scan(
+		&item.ID, &item.RestaurantID, &item.Name, &item.Description, &item.OriginalPrice, &item.SurplusPrice, &item.Quantity, &item.Category, &item.ExpiryTime, &item.IsAvailable, &weight, &risk, &item.AtRisk, &item.CreatedAt, &item.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if weight.Valid {
+		item.WeightKg = &weight.Float64
+	}
+	if risk.Valid {
+		item.WasteRisk = &risk.Float64
+	}
+	return &item, nil
+}
+
 // Offer represents a special offer (Surprise Bag or Chef's Surprise)
 type Offer struct {
 	ID           int       `json:"id"`
@@ -51,11 +84,34 @@ type Offer struct {
 	SurplusPrice float64   `json:"surplus_price"`
 	OfferType    string    `json:"offer_type"`
 	Ingredients  string    `json:"ingredients"`
+	Quantity     *int      `json:"quantity"` // units left, nil when they aren't counted
 	IsAvailable  bool      `json:"is_available"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// offerColumns are the offers columns read by scanOffer
+const offerColumns = `id, restaurant_id, name, description, original_price, surplus_price, offer_type, ingredients, quantity, is_available, created_at, updated_at`
+
+// scanOffer scans a row of offerColumns
+func scanOffer(row interface{ Scan(...interface{}) error }) (*Offer, error) {
+	var offer Offer
+	var ingredients sql.NullString
+	var quantity sql.NullInt64
+	err := row.Scan(
+		&offer.ID, &offer.RestaurantID, &offer.Name, &offer.Description, &offer.OriginalPrice, &offer.SurplusPrice, &offer.OfferType, &ingredients, &quantity, &offer.IsAvailable, &offer.CreatedAt, &offer.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	offer.Ingredients = ingredients.String
+	if quantity.Valid {
+		units := int(quantity.Int64)
+		offer.Quantity = &units
+	}
+	return &offer, nil
+}
+
 // CreateRestaurantInput represents the input for creating a new restaurant
 type CreateRestaurantInput struct {
 	Name        string  `json:"name"`
@@ -91,11 +147,33 @@ type CreateInventoryItemInput struct {
 	Quantity      int       `json:"quantity"`
 	Category      string    `json:"category"`
 	ExpiryTime    time.Time `json:"expiry_time"`
+	WeightKg      *float64  `json:"weight_kg"` // per unit, optional
+}
+
+// CreateOfferInput represents the input for creating a new offer
+type CreateOfferInput struct {
+	RestaurantID  int     `json:"restaurant_id"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	OriginalPrice float64 `json:"original_price"`
+	SurplusPrice  float64 `json:"surplus_price"`
+	OfferType     string  `json:"offer_type"`
+	Ingredients   string  `json:"ingredients"`
+	Quantity      *int    `json:"quantity"` // optional, leave out to not count units
+}
+
+// OfferNotifier is told about newly published offers and inventory items
+type OfferNotifier interface {
+	SendOfferNotification(restaurantID int, offerName string, price float64) error
 }
 
 // RestaurantService handles restaurant-related operations
 type RestaurantService struct {
-	db *sql.DB
+	db                *sql.DB
+	notifier          OfferNotifier
+	priceDropNotifier PriceDropNotifier
+	wastePredictor    WastePredictor
+	waitlistNotifier  WaitlistNotifier
 }
 
 // NewRestaurantService creates a new restaurant service
@@ -103,6 +181,24 @@ func NewRestaurantService(db *sql.DB) *RestaurantService {
 	return &RestaurantService{db: db}
 }
 
+// SetOfferNotifier sets the notifier used when new surplus is published
+func (s *RestaurantService) SetOfferNotifier(notifier OfferNotifier) {
+	s.notifier = notifier
+}
+
+// publishSurplus notifies subscribers about new surplus without blocking the caller
+func (s *RestaurantService) publishSurplus(restaurantID int, name string, price float64) {
+	if s.notifier == nil {
+		return
+	}
+
+	go func() {
+		if err := s.notifier.SendOfferNotification(restaurantID, name, price); err != nil {
+			log.Printf("Failed to send offer notification for restaurant %d: %v", restaurantID, err)
+		}
+	}()
+}
+
 // CreateRestaurant creates a new restaurant
 func (s *RestaurantService) CreateRestaurant(input CreateRestaurantInput) (*Restaurant, error) {
 	var restaurant Restaurant
@@ -131,53 +227,33 @@ func (s *RestaurantService) GetRestaurantByID(id int) (*Restaurant, error) {
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("restaurant not found")
+			return nil, ErrRestaurantNotFound
 		}
 		return nil, fmt.Errorf("failed to get restaurant: %w", err)
 	}
+	if err := s.attachOpeningStatus([]*Restaurant{&restaurant}); err != nil {
+		return nil, err
+	}
 
 	return &restaurant, nil
 }
 
-// GetNearbyRestaurants retrieves restaurants within a specified radius
+// GetNearbyRestaurants retrieves all restaurants within a specified radius, nearest first
 func (s *RestaurantService) GetNearbyRestaurants(latitude, longitude, radius float64) ([]*Restaurant, error) {
-	// Using Haversine formula to calculate distance
-	query := `
-		SELECT id, name, description, address, latitude, longitude, phone, email, cuisine_type, rating, is_active, created_at, updated_at
-		FROM restaurants 
-		WHERE is_active = true 
-		AND (
-			6371 * acos(
-				cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) + 
-				sin(radians($1)) * sin(radians(latitude))
-			) <= $3
-		ORDER BY (
-			6371 * acos(
-				cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) + 
-				sin(radians($1)) * sin(radians(latitude))
-			)
-		)
-	`
-
-	rows, err := s.db.Query(query, latitude, longitude, radius)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get nearby restaurants: %w", err)
-	}
-	defer rows.Close()
+	query := NearbyQuery{Latitude: latitude, Longitude: longitude, RadiusKm: radius, Limit: MaxNearbyPageSize}
 
 	var restaurants []*Restaurant
-	for rows.Next() {
-		var restaurant Restaurant
-		err := rows.Scan(
-			&restaurant.ID, &restaurant.Name, &restaurant.Description, &restaurant.Address, &restaurant.Latitude, &restaurant.Longitude, &restaurant.Phone, &restaurant.Email, &restaurant.CuisineType, &restaurant.Rating, &restaurant.IsActive, &restaurant.CreatedAt, &restaurant.UpdatedAt,
-		)
+	for {
+		page, err := s.GetNearbyRestaurantsPage(query)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan restaurant: %w", err)
+			return nil, err
 		}
-		restaurants = append(restaurants, &restaurant)
+		restaurants = append(restaurants, page.Restaurants...)
+		if !page.HasMore {
+			return restaurants, nil
+		}
+		query.Cursor = page.NextCursor
 	}
-
-	return restaurants, nil
 }
 
 // UpdateRestaurant updates a restaurant's information
@@ -204,7 +280,7 @@ func (s *RestaurantService) UpdateRestaurant(id int, input UpdateRestaurantInput
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("restaurant not found")
+			return nil, ErrRestaurantNotFound
 		}
 		return nil, fmt.Errorf("failed to update restaurant: %w", err)
 	}
@@ -214,19 +290,19 @@ func (s *RestaurantService) UpdateRestaurant(id int, input UpdateRestaurantInput
 
 // CreateInventoryItem creates a new inventory item
 func (s *RestaurantService) CreateInventoryItem(input CreateInventoryItemInput) (*InventoryItem, error) {
-	var item InventoryItem
-	err := s.db.QueryRow(`
-		INSERT INTO inventory_items (restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, is_available, created_at, updated_at
-	`, input.RestaurantID, input.Name, input.Description, input.OriginalPrice, input.SurplusPrice, input.Quantity, input.Category, input.ExpiryTime).Scan(
-		&item.ID, &item.RestaurantID, &item.Name, &item.Description, &item.OriginalPrice, &item.SurplusPrice, &item.Quantity, &item.Category, &item.ExpiryTime, &item.IsAvailable, &item.CreatedAt, &item.UpdatedAt,
-	)
+	item, err := scanInventoryItem(s.db.QueryRow(`
+		INSERT INTO inventory_items (restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, weight_kg)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+inventoryItemColumns,
+		input.RestaurantID, input.Name, input.Description, input.OriginalPrice, input.SurplusPrice, input.Quantity, input.Category, input.ExpiryTime, input.WeightKg,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inventory item: %w", err)
 	}
 
-	return &item, nil
+	s.publishSurplus(item.RestaurantID, item.Name, item.SurplusPrice)
+
+	return item, nil
 }
 
 // GetInventoryItems retrieves inventory items for a restaurant
@@ -235,16 +311,17 @@ func (s *RestaurantService) GetInventoryItems(restaurantID int, availableOnly bo
 	var args []interface{}
 
 	if availableOnly {
+		// Items likely to go to waste are promoted to the top
 		query = `
-			SELECT id, restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, is_available, created_at, updated_at
+			SELECT ` + inventoryItemColumns + `
 			FROM inventory_items 
 			WHERE restaurant_id = $1 AND is_available = true AND expiry_time > NOW()
-			ORDER BY created_at DESC
+			ORDER BY at_risk DESC, created_at DESC
 		`
 		args = []interface{}{restaurantID}
 	} else {
 		query = `
-			SELECT id, restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, is_available, created_at, updated_at
+			SELECT ` + inventoryItemColumns + `
 			FROM inventory_items 
 			WHERE restaurant_id = $1
 			ORDER BY created_at DESC
@@ -260,14 +337,11 @@ func (s *RestaurantService) GetInventoryItems(restaurantID int, availableOnly bo
 
 	var items []*InventoryItem
 	for rows.Next() {
-		var item InventoryItem
-		err := rows.Scan(
-			&item.ID, &item.RestaurantID, &item.Name, &item.Description, &item.OriginalPrice, &item.SurplusPrice, &item.Quantity, &item.Category, &item.ExpiryTime, &item.IsAvailable, &item.CreatedAt, &item.UpdatedAt,
-		)
+		item, err := scanInventoryItem(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
 		}
-		items = append(items, &item)
+		items = append(items, item)
 	}
 
 	return items, nil
@@ -286,15 +360,30 @@ func (s *RestaurantService) UpdateInventoryItem(id int, updates map[string]inter
 		category = COALESCE($7, category),
 		expiry_time = COALESCE($8, expiry_time),
 		is_available = COALESCE($9, is_available),
+		weight_kg = COALESCE($10, weight_kg),
+		-- A manual price or expiry starts any markdown afresh from the new price
+		markdown_base_price = CASE WHEN $5::DECIMAL IS NULL AND $8::TIMESTAMP IS NULL THEN markdown_base_price END,
 		updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
-		RETURNING id, restaurant_id, name, description, original_price, surplus_price, quantity, category, expiry_time, is_available, created_at, updated_at
-	`
+		RETURNING ` + inventoryItemColumns
 
-	var item InventoryItem
-	err := s.db.QueryRow(query, id, updates["name"], updates["description"], updates["original_price"], updates["surplus_price"], updates["quantity"], updates["category"], updates["expiry_time"], updates["is_available"]).Scan(
-		&item.ID, &item.RestaurantID, &item.Name, &item.Description, &item.OriginalPrice, &item.SurplusPrice, &item.Quantity, &item.Category, &item.ExpiryTime, &item.IsAvailable, &item.CreatedAt, &item.UpdatedAt,
-	)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so the price history sees the price this update replaces
+	var oldPrice float64
+	err = tx.QueryRow("SELECT surplus_price FROM inventory_items WHERE id = $1 FOR UPDATE", id).Scan(&oldPrice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("inventory item not found")
+		}
+		return nil, fmt.Errorf("failed to get inventory item: %w", err)
+	}
+
+	item, err := scanInventoryItem(tx.QueryRow(query, id, updates["name"], updates["description"], updates["original_price"], updates["surplus_price"], updates["quantity"], updates["category"], updates["expiry_time"], updates["is_available"], updates["weight_kg"]))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("inventory item not found")
@@ -302,7 +391,112 @@ func (s *RestaurantService) UpdateInventoryItem(id int, updates map[string]inter
 		return nil, fmt.Errorf("failed to update inventory item: %w", err)
 	}
 
-	return &item, nil
+	if item.SurplusPrice != oldPrice {
+		_, err = tx.Exec(`
+			INSERT INTO price_history (inventory_item_id, old_price, new_price, reason)
+			VALUES ($1, $2, $3, $4)
+		`, id, oldPrice, item.SurplusPrice, PriceChangeManual)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record price change: %w", err)
+		}
+	}
+
+	// Restocking or putting the item back on sale goes to its waitlist first
+	var holds []*WaitlistEntry
+	if updates["quantity"] != nil || updates["is_available"] != nil {
+		holds, err = holdForWaitlist(tx, waitlistTarget{inventoryItemID: id})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, hold := range holds {
+		s.publishWaitlistHold(hold)
+	}
+
+	return item, nil
+}
+
+// CreateOffer creates a new offer
+func (s *RestaurantService) CreateOffer(input CreateOfferInput) (*Offer, error) {
+	if input.OfferType != "surprise_bag" && input.OfferType != "chef_surprise" {
+		return nil, errors.New("offer_type must be surprise_bag or chef_surprise")
+	}
+	if input.Quantity != nil && *input.Quantity < 0 {
+		return nil, errors.New("quantity can't be negative")
+	}
+
+	offer, err := scanOffer(s.db.QueryRow(`
+		INSERT INTO offers (restaurant_id, name, description, original_price, surplus_price, offer_type, ingredients, quantity)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+		RETURNING `+offerColumns,
+		input.RestaurantID, input.Name, input.Description, input.OriginalPrice, input.SurplusPrice, input.OfferType, input.Ingredients, input.Quantity,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	s.publishSurplus(offer.RestaurantID, offer.Name, offer.SurplusPrice)
+
+	return offer, nil
+}
+
+// UpdateOffer updates an offer. Restocking it or putting it back on sale goes to
+// its waitlist first, see ReleaseStock.
+func (s *RestaurantService) UpdateOffer(id int, updates map[string]interface{}) (*Offer, error) {
+	if offerType, ok := updates["offer_type"].(string); ok && offerType != "surprise_bag" && offerType != "chef_surprise" {
+		return nil, errors.New("offer_type must be surprise_bag or chef_surprise")
+	}
+
+	query := `
+		UPDATE offers SET
+		name = COALESCE($2, name),
+		description = COALESCE($3, description),
+		original_price = COALESCE($4, original_price),
+		surplus_price = COALESCE($5, surplus_price),
+		offer_type = COALESCE($6, offer_type),
+		ingredients = COALESCE($7, ingredients),
+		quantity = COALESCE($8, quantity),
+		is_available = COALESCE($9, is_available),
+		updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + offerColumns
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	offer, err := scanOffer(tx.QueryRow(query, id, updates["name"], updates["description"], updates["original_price"], updates["surplus_price"], updates["offer_type"], updates["ingredients"], updates["quantity"], updates["is_available"]))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("offer not found")
+		}
+		return nil, fmt.Errorf("failed to update offer: %w", err)
+	}
+
+	var holds []*WaitlistEntry
+	if updates["quantity"] != nil || updates["is_available"] != nil {
+		holds, err = holdForWaitlist(tx, waitlistTarget{offerID: id})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, hold := range holds {
+		s.publishWaitlistHold(hold)
+	}
+
+	return offer, nil
 }
 
 // GetOffers retrieves offers for a restaurant
@@ -312,15 +506,15 @@ func (s *RestaurantService) GetOffers(restaurantID int, availableOnly bool) ([]*
 
 	if availableOnly {
 		query = `
-			SELECT id, restaurant_id, name, description, original_price, surplus_price, offer_type, ingredients, is_available, created_at, updated_at
+			SELECT ` + offerColumns + `
 			FROM offers 
-			WHERE restaurant_id = $1 AND is_available = true
+			WHERE restaurant_id = $1 AND is_available = true AND (quantity IS NULL OR quantity > 0)
 			ORDER BY created_at DESC
 		`
 		args = []interface{}{restaurantID}
 	} else {
 		query = `
-			SELECT id, restaurant_id, name, description, original_price, surplus_price, offer_type, ingredients, is_available, created_at, updated_at
+			SELECT ` + offerColumns + `
 			FROM offers 
 			WHERE restaurant_id = $1
 			ORDER BY created_at DESC
@@ -336,14 +530,11 @@ func (s *RestaurantService) GetOffers(restaurantID int, availableOnly bool) ([]*
 
 	var offers []*Offer
 	for rows.Next() {
-		var offer Offer
-		err := rows.Scan(
-			&offer.ID, &offer.RestaurantID, &offer.Name, &offer.Description, &offer.OriginalPrice, &offer.SurplusPrice, &offer.OfferType, &offer.Ingredients, &offer.IsAvailable, &offer.CreatedAt, &offer.UpdatedAt,
-		)
+		offer, err := scanOffer(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan offer: %w", err)
 		}
-		offers = append(offers, &offer)
+		offers = append(offers, offer)
 	}
 
 	return offers, nil
@@ -351,18 +542,5 @@ func (s *RestaurantService) GetOffers(restaurantID int, availableOnly bool) ([]*
 
 // CalculateDistance calculates the distance between two points using Haversine formula
 func CalculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
-
-	lat1Rad := lat1 * math.Pi / 180
-	lon1Rad := lon1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	lon2Rad := lon2 * math.Pi / 180
-
-	dlat := lat2Rad - lat1Rad
-	dlon := lon2Rad - lon1Rad
-
-	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dlon/2)*math.Sin(dlon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return R * c
-} 
\ No newline at end of file
+	return geo.Distance(lat1, lon1, lat2, lon2)
+}
@@ -0,0 +1,412 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Review errors
+var (
+	ErrInvalidRating      = errors.New("rating must be between 1 and 5")
+	ErrOrderNotReviewable = errors.New("only collected orders can be reviewed")
+	ErrAlreadyReviewed    = errors.New("order has already been reviewed")
+	ErrOwnReview          = errors.New("you can't report your own review")
+	ErrNotRestaurantOwner = errors.New("only the restaurant's owner can reply to its reviews")
+)
+
+// MaxReviewLength bounds the text of reviews and owner replies, in characters
+const MaxReviewLength = 2000
+
+// ReviewReportThreshold is the number of reports that hides a review until a
+// moderator looks at it
+const ReviewReportThreshold = 3
+
+// reviewableStatus is the status of collected orders, the only ones that can be
+// reviewed. Pickup orders are marked delivered once collected.
+const reviewableStatus = "delivered"
+
+// Restaurant ratings are a Bayesian average of their reviews: ratingPriorWeight
+// reviews of ratingPriorMean stars, plus the real ones. A few early reviews then
+// can't take a restaurant to the top or bottom of the rating sort.
+const (
+	ratingPriorMean   = 3.5
+	ratingPriorWeight = 5
+)
+
+// Review is a customer's review of a collected order
+type Review struct {
+	ID           int        `json:"id"`
+	OrderID      int        `json:"-"`
+	UserID       int        `json:"-"`
+	RestaurantID int        `json:"restaurant_id"`
+	AuthorName   string     `json:"author_name"` // first name and last initial
+	Rating       int        `json:"rating"`
+	Text         string     `json:"text"`
+	IsHidden     bool       `json:"is_hidden"`
+	HiddenReason string     `json:"hidden_reason,omitempty"`
+	ReportCount  int        `json:"report_count"`
+	OwnerReply   *string    `json:"owner_reply,omitempty"`
+	RepliedAt    *time.Time `json:"replied_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CreateReviewInput represents the input for reviewing an order
+type CreateReviewInput struct {
+	OrderID int    `json:"order_id"`
+	Rating  int    `json:"rating"`
+	Text    string `json:"text"`
+}
+
+// ReviewSummary is a restaurant's rating and how its visible reviews are spread
+type ReviewSummary struct {
+	Rating       float64     `json:"rating"`
+	ReviewCount  int         `json:"review_count"`
+	Distribution map[int]int `json:"distribution"` // reviews by stars, 1 to 5
+}
+
+// reviewColumns are the reviews and users columns read by scanReview
+const reviewColumns = `rv.id, rv.order_id, rv.user_id, rv.restaurant_id, u.first_name, u.last_name, rv.rating, rv.text, rv.is_hidden,
+	COALESCE(rv.hidden_reason, ''), rv.report_count, rv.owner_reply, rv.replied_at, rv.created_at, rv.updated_at`
+
+// scanReview scans a row of reviewColumns
+func scanReview(row interface{ Scan(...interface{}) error }) (*Review, error) {
+	var review Review
+	var firstName, lastName string
+	var reply sql.NullString
+	var repliedAt sql.NullTime
+	err := row.Scan(
+		&review.ID, &review.OrderID, &review.UserID, &review.RestaurantID, &firstName, &lastName, &review.Rating, &review.Text, &review.IsHidden,
+		&review.HiddenReason, &review.ReportCount, &reply, &repliedAt, &review.CreatedAt, &review.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	review.AuthorName = firstName
+	if initial, _ := utf8.DecodeRuneInString(lastName); initial != utf8.RuneError {
+		review.AuthorName += " " + string(initial) + "."
+	}
+	if reply.Valid {
+		review.OwnerReply = &reply.String
+	}
+	if repliedAt.Valid {
+		review.RepliedAt = &repliedAt.Time
+	}
+	return &review, nil
+}
+
+// bayesianRating is the rating of a restaurant with count visible reviews adding
+// up to sum stars, rounded to the two decimals restaurants.rating keeps
+func bayesianRating(sum, count int) float64 {
+	rating := (ratingPriorMean*ratingPriorWeight + float64(sum)) / float64(ratingPriorWeight+count)
+	return math.Round(rating*100) / 100
+}
+
+// refreshRating recomputes a restaurant's rating and review count from its visible
+// reviews. Callers run it in the transaction that changed them.
+func refreshRating(tx *sql.Tx, restaurantID int) error {
+	// Lock the restaurant so concurrent reviews don't overwrite each other's count
+	if _, err := tx.Exec("SELECT id FROM restaurants WHERE id = $1 FOR UPDATE", restaurantID); err != nil {
+		return fmt.Errorf("failed to lock restaurant: %w", err)
+	}
+
+	var sum, count int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(rating), 0), COUNT(*)
+		FROM reviews WHERE restaurant_id = $1 AND is_hidden = false
+	`, restaurantID).Scan(&sum, &count)
+	if err != nil {
+		return fmt.Errorf("failed to count reviews: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE restaurants SET rating = $2, review_count = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, restaurantID, bayesianRating(sum, count), count)
+	if err != nil {
+		return fmt.Errorf("failed to update restaurant rating: %w", err)
+	}
+	return nil
+}
+
+// normalizeReviewText trims text and checks its length
+func normalizeReviewText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > MaxReviewLength {
+		return "", fmt.Errorf("text can't be longer than %d characters", MaxReviewLength)
+	}
+	return text, nil
+}
+
+// CreateReview reviews one of a user's collected orders and updates the
+// restaurant's rating. Each order can be reviewed once.
+func (s *RestaurantService) CreateReview(userID int, input CreateReviewInput) (*Review, error) {
+	if input.Rating < 1 || input.Rating > 5 {
+		return nil, ErrInvalidRating
+	}
+	text, err := normalizeReviewText(input.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var restaurantID int
+	var status string
+	err = tx.QueryRow(`
+		SELECT restaurant_id, status FROM orders WHERE id = $1 AND user_id = $2
+	`, input.OrderID, userID).Scan(&restaurantID, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("order not found")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if status != reviewableStatus {
+		return nil, ErrOrderNotReviewable
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO reviews (order_id, user_id, restaurant_id, rating, text)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING id
+	`, input.OrderID, userID, restaurantID, input.Rating, text).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAlreadyReviewed
+		}
+		return nil, fmt.Errorf("failed to create review: %w", err)
+	}
+
+	if err = refreshRating(tx, restaurantID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetReview(id)
+}
+
+// GetReview retrieves a review, hidden or not
+func (s *RestaurantService) GetReview(id int) (*Review, error) {
+	review, err := scanReview(s.db.QueryRow(`
+		SELECT `+reviewColumns+`
+		FROM reviews rv JOIN users u ON u.id = rv.user_id
+		WHERE rv.id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("review not found")
+		}
+		return nil, fmt.Errorf("failed to get review: %w", err)
+	}
+	return review, nil
+}
+
+// GetRestaurantReviews retrieves a restaurant's visible reviews, newest first
+func (s *RestaurantService) GetRestaurantReviews(restaurantID, limit, offset int) ([]*Review, error) {
+	rows, err := s.db.Query(`
+		SELECT `+reviewColumns+`
+		FROM reviews rv JOIN users u ON u.id = rv.user_id
+		WHERE rv.restaurant_id = $1 AND rv.is_hidden = false
+		ORDER BY rv.created_at DESC, rv.id DESC
+		LIMIT $2 OFFSET $3
+	`, restaurantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []*Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
+
+// GetReviewSummary retrieves a restaurant's rating, review count and the spread of
+// its visible reviews
+func (s *RestaurantService) GetReviewSummary(restaurantID int) (*ReviewSummary, error) {
+	summary := ReviewSummary{Distribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	err := s.db.QueryRow(`
+		SELECT COALESCE(rating, 0), review_count FROM restaurants WHERE id = $1
+	`, restaurantID).Scan(&summary.Rating, &summary.ReviewCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRestaurantNotFound
+		}
+		return nil, fmt.Errorf("failed to get restaurant rating: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT rating, COUNT(*) FROM reviews
+		WHERE restaurant_id = $1 AND is_hidden = false
+		GROUP BY rating
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get review distribution: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stars, count int
+		if err := rows.Scan(&stars, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan review distribution: %w", err)
+		}
+		summary.Distribution[stars] = count
+	}
+
+	return &summary, nil
+}
+
+// ReportReview records a user's report of a review. A review reaching
+// ReviewReportThreshold reports is hidden until a moderator restores it; after
+// that, further reports don't hide it again.
+func (s *RestaurantService) ReportReview(userID, reviewID int, reason string) error {
+	reason, err := normalizeReviewText(reason)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var authorID, restaurantID int
+	err = tx.QueryRow("SELECT user_id, restaurant_id FROM reviews WHERE id = $1 FOR UPDATE", reviewID).Scan(&authorID, &restaurantID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("review not found")
+		}
+		return fmt.Errorf("failed to get review: %w", err)
+	}
+	if authorID == userID {
+		return ErrOwnReview
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO review_reports (review_id, user_id, reason) VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, user_id) DO NOTHING
+	`, reviewID, userID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to report review: %w", err)
+	}
+	if reported, err := result.RowsAffected(); err == nil && reported == 0 {
+		// Already reported by this user
+		return nil
+	}
+
+	var hidden bool
+	err = tx.QueryRow(`
+		UPDATE reviews SET report_count = report_count + 1,
+			is_hidden = is_hidden OR report_count + 1 = $2,
+			hidden_reason = CASE WHEN NOT is_hidden AND report_count + 1 = $2 THEN 'reported' ELSE hidden_reason END
+		WHERE id = $1
+		RETURNING is_hidden
+	`, reviewID, ReviewReportThreshold).Scan(&hidden)
+	if err != nil {
+		return fmt.Errorf("failed to update review reports: %w", err)
+	}
+	if hidden {
+		if err = refreshRating(tx, restaurantID); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetReviewHidden hides or restores a review for moderation and updates the
+// restaurant's rating
+func (s *RestaurantService) SetReviewHidden(reviewID int, hidden bool, reason string) (*Review, error) {
+	reason, err := normalizeReviewText(reason)
+	if err != nil {
+		return nil, err
+	}
+	if !hidden {
+		reason = ""
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var restaurantID int
+	err = tx.QueryRow(`
+		UPDATE reviews SET is_hidden = $2, hidden_reason = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING restaurant_id
+	`, reviewID, hidden, reason).Scan(&restaurantID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("review not found")
+		}
+		return nil, fmt.Errorf("failed to update review: %w", err)
+	}
+
+	if err = refreshRating(tx, restaurantID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetReview(reviewID)
+}
+
+// ReplyToReview sets the restaurant owner's public reply to a review, replacing
+// any earlier one. An empty reply removes it. ownerUserID must be linked to an
+// owner of the reviewed restaurant, see LinkStaffAccount.
+func (s *RestaurantService) ReplyToReview(reviewID, ownerUserID int, reply string) (*Review, error) {
+	reply, err := normalizeReviewText(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := s.GetReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := s.IsRestaurantOwner(review.RestaurantID, ownerUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !owner {
+		return nil, ErrNotRestaurantOwner
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE reviews SET owner_reply = NULLIF($2, ''),
+			replied_at = CASE WHEN $2 = '' THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE id = $1
+	`, reviewID, reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply to review: %w", err)
+	}
+
+	return s.GetReview(reviewID)
+}
@@ -0,0 +1,76 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidStaffCredentials is returned when a staff email and password don't match
+	ErrInvalidStaffCredentials = errors.New("invalid staff credentials")
+	// ErrStaffAccountLinked is returned when a staff login is already linked to someone else
+	ErrStaffAccountLinked = errors.New("staff account is already linked to another user")
+)
+
+// StaffAccount is a restaurant staff login linked to a customer account
+type StaffAccount struct {
+	ID           int    `json:"id"`
+	RestaurantID int    `json:"restaurant_id"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+}
+
+// LinkStaffAccount links a restaurant staff login to a user, who proves it's
+// theirs with the staff password. Linking it again to the same user is a no-op.
+func (s *RestaurantService) LinkStaffAccount(userID int, email, password string) (*StaffAccount, error) {
+	var account StaffAccount
+	var passwordHash string
+	var linkedUserID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT id, restaurant_id, email, COALESCE(role, 'staff'), password_hash, user_id
+		FROM restaurant_staff WHERE email = $1
+	`, email).Scan(&account.ID, &account.RestaurantID, &account.Email, &account.Role, &passwordHash, &linkedUserID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidStaffCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staff account: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidStaffCredentials
+	}
+	if linkedUserID.Valid && int(linkedUserID.Int64) != userID {
+		return nil, ErrStaffAccountLinked
+	}
+
+	// Only claim the login if nobody linked it in the meantime
+	result, err := s.db.Exec("UPDATE restaurant_staff SET user_id = $2 WHERE id = $1 AND (user_id IS NULL OR user_id = $2)", account.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link staff account: %w", err)
+	}
+	if linked, _ := result.RowsAffected(); linked == 0 {
+		return nil, ErrStaffAccountLinked
+	}
+
+	return &account, nil
+}
+
+// IsRestaurantOwner reports whether the user is linked to an owner's staff login
+// of the restaurant
+func (s *RestaurantService) IsRestaurantOwner(restaurantID, userID int) (bool, error) {
+	var owner bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM restaurant_staff
+			WHERE restaurant_id = $1 AND user_id = $2 AND role = 'owner'
+		)
+	`, restaurantID, userID).Scan(&owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to check restaurant owner: %w", err)
+	}
+	return owner, nil
+}
@@ -0,0 +1,505 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrNotSoldOut is returned when joining the waitlist for something that can still be ordered
+	ErrNotSoldOut = errors.New("still available, order it instead of joining the waitlist")
+	// ErrAlreadyWaitlisted is returned when the user is already waiting for the item or offer
+	ErrAlreadyWaitlisted = errors.New("already on the waitlist")
+)
+
+// WaitlistHoldDuration is how long stock handed to the next person in line is held
+// for them before it passes on
+const WaitlistHoldDuration = 15 * time.Minute
+
+// MaxWaitlistQuantity bounds the units one waitlist entry can ask for
+const MaxWaitlistQuantity = 10
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistHeld      = "held"
+	WaitlistFulfilled = "fulfilled"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+// WaitlistEntry is a user's place in line for a sold-out inventory item or offer
+type WaitlistEntry struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	RestaurantID    int        `json:"restaurant_id"`
+	InventoryItemID int        `json:"inventory_item_id,omitempty"`
+	OfferID         int        `json:"offer_id,omitempty"`
+	ItemName        string     `json:"item_name"`
+	Quantity        int        `json:"quantity"`
+	Status          string     `json:"status"`
+	Position        int        `json:"position,omitempty"` // place in line while waiting, 1 is next
+	HoldExpiresAt   *time.Time `json:"hold_expires_at"`    // set while held
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// JoinWaitlistInput represents the input for joining a waitlist. Exactly one of
+// InventoryItemID and OfferID is set.
+type JoinWaitlistInput struct {
+	InventoryItemID int `json:"inventory_item_id"`
+	OfferID         int `json:"offer_id"`
+	Quantity        int `json:"quantity"` // 1 when left out
+}
+
+// WaitlistNotifier tells the next person in line that stock is held for them
+type WaitlistNotifier interface {
+	SendWaitlistHoldNotification(userID, restaurantID int, itemName string, quantity int, holdFor time.Duration) error
+}
+
+// SetWaitlistNotifier sets the notifier used when waitlist holds are handed out
+func (s *RestaurantService) SetWaitlistNotifier(notifier WaitlistNotifier) {
+	s.waitlistNotifier = notifier
+}
+
+// waitlistTarget is the inventory item or offer a waitlist is for
+type waitlistTarget struct {
+	inventoryItemID int
+	offerID         int
+}
+
+// newWaitlistTarget checks that exactly one of the IDs is set
+func newWaitlistTarget(inventoryItemID, offerID int) (waitlistTarget, error) {
+	if (inventoryItemID > 0) == (offerID > 0) {
+		return waitlistTarget{}, errors.New("exactly one of inventory_item_id and offer_id is required")
+	}
+	return waitlistTarget{inventoryItemID: inventoryItemID, offerID: offerID}, nil
+}
+
+// column is the waitlist_entries column referencing the target
+func (t waitlistTarget) column() string {
+	if t.offerID > 0 {
+		return "offer_id"
+	}
+	return "inventory_item_id"
+}
+
+// id is the ID of the inventory item or offer
+func (t waitlistTarget) id() int {
+	if t.offerID > 0 {
+		return t.offerID
+	}
+	return t.inventoryItemID
+}
+
+// waitlistStock is an inventory item or offer and how much of it is on general sale
+type waitlistStock struct {
+	restaurantID int
+	name         string
+	onSale       bool // available and not expired
+	expired      bool
+	unlimited    bool // an offer whose units aren't counted
+	free         int  // units neither ordered nor held, unless unlimited
+}
+
+// lockWaitlistStock locks an inventory item or offer for the rest of tx and works
+// out how much of it is free. Holds that ran out are expired first.
+func lockWaitlistStock(tx *sql.Tx, target waitlistTarget) (*waitlistStock, error) {
+	var stock waitlistStock
+	var quantity sql.NullInt64
+	var err error
+	if target.offerID > 0 {
+		err = tx.QueryRow("SELECT restaurant_id, name, quantity, is_available FROM offers WHERE id = $1 FOR UPDATE", target.offerID).Scan(
+			&stock.restaurantID, &stock.name, &quantity, &stock.onSale,
+		)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("offer not found")
+		}
+	} else {
+		err = tx.QueryRow("SELECT restaurant_id, name, quantity, is_available, expiry_time <= NOW() FROM inventory_items WHERE id = $1 FOR UPDATE", target.inventoryItemID).Scan(
+			&stock.restaurantID, &stock.name, &quantity, &stock.onSale, &stock.expired,
+		)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("inventory item not found")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlist stock: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'expired', updated_at = CURRENT_TIMESTAMP
+		WHERE `+target.column()+` = $1 AND status = 'held' AND hold_expires_at <= NOW()
+	`, target.id())
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire waitlist holds: %w", err)
+	}
+
+	var held int
+	err = tx.QueryRow("SELECT COALESCE(SUM(quantity), 0) FROM waitlist_entries WHERE "+target.column()+" = $1 AND status = 'held'", target.id()).Scan(&held)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlist holds: %w", err)
+	}
+
+	stock.onSale = stock.onSale && !stock.expired
+	stock.unlimited = !quantity.Valid
+	stock.free = int(quantity.Int64) - held
+	return &stock, nil
+}
+
+// holdForWaitlist hands the free units of an inventory item or offer to the people
+// waiting for it. In the order they joined, each gets what they asked for held until
+// someone's request doesn't fit; whatever is left stays on general sale.
+func holdForWaitlist(tx *sql.Tx, target waitlistTarget) ([]*WaitlistEntry, error) {
+	stock, err := lockWaitlistStock(tx, target)
+	if err != nil {
+		return nil, err
+	}
+	if !stock.onSale || (!stock.unlimited && stock.free <= 0) {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, user_id, quantity FROM waitlist_entries
+		WHERE `+target.column()+` = $1 AND status = 'waiting'
+		ORDER BY created_at, id
+	`, target.id())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlist: %w", err)
+	}
+
+	var waiting []*WaitlistEntry
+	for rows.Next() {
+		entry := &WaitlistEntry{RestaurantID: stock.restaurantID, InventoryItemID: target.inventoryItemID, OfferID: target.offerID, ItemName: stock.name}
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan waitlist entry: %w", err)
+		}
+		waiting = append(waiting, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read waitlist: %w", err)
+	}
+
+	var holds []*WaitlistEntry
+	free := stock.free
+	for _, entry := range waiting {
+		if !stock.unlimited && entry.Quantity > free {
+			break
+		}
+
+		var expiresAt time.Time
+		err := tx.QueryRow(`
+			UPDATE waitlist_entries SET status = 'held', hold_expires_at = NOW() + make_interval(secs => $2), updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING hold_expires_at
+		`, entry.ID, int(WaitlistHoldDuration.Seconds())).Scan(&expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hold stock for waitlist entry %d: %w", entry.ID, err)
+		}
+
+		entry.Status = WaitlistHeld
+		entry.HoldExpiresAt = &expiresAt
+		holds = append(holds, entry)
+		free -= entry.Quantity
+	}
+
+	return holds, nil
+}
+
+// publishWaitlistHold tells a user their hold started without blocking the caller
+func (s *RestaurantService) publishWaitlistHold(hold *WaitlistEntry) {
+	if s.waitlistNotifier == nil {
+		return
+	}
+
+	go func() {
+		err := s.waitlistNotifier.SendWaitlistHoldNotification(hold.UserID, hold.RestaurantID, hold.ItemName, hold.Quantity, WaitlistHoldDuration)
+		if err != nil {
+			log.Printf("Failed to send waitlist hold notification for entry %d: %v", hold.ID, err)
+		}
+	}()
+}
+
+// ReleaseStock hands stock that came back, e.g. from a cancelled order, to the
+// waitlist of an inventory item or offer before it goes back on general sale
+func (s *RestaurantService) ReleaseStock(inventoryItemID, offerID int) error {
+	target, err := newWaitlistTarget(inventoryItemID, offerID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	holds, err := holdForWaitlist(tx, target)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, hold := range holds {
+		s.publishWaitlistHold(hold)
+	}
+
+	return nil
+}
+
+// waitlistEntryColumns are the columns read by scanWaitlistEntry, from waitlistEntryTables
+const waitlistEntryColumns = `w.id, w.user_id, w.restaurant_id, COALESCE(w.inventory_item_id, 0), COALESCE(w.offer_id, 0),
+	COALESCE(i.name, o.name), w.quantity, w.status, w.hold_expires_at, w.created_at, w.updated_at,
+	CASE WHEN w.status = 'waiting' THEN (
+		SELECT COUNT(*) + 1 FROM waitlist_entries ahead
+		WHERE ahead.status = 'waiting'
+		AND ahead.inventory_item_id IS NOT DISTINCT FROM w.inventory_item_id
+		AND ahead.offer_id IS NOT DISTINCT FROM w.offer_id
+		AND (ahead.created_at, ahead.id) < (w.created_at, w.id)
+	) ELSE 0 END`
+
+// waitlistEntryTables are the tables behind waitlistEntryColumns
+const waitlistEntryTables = `waitlist_entries w
+	LEFT JOIN inventory_items i ON i.id = w.inventory_item_id
+	LEFT JOIN offers o ON o.id = w.offer_id`
+
+// scanWaitlistEntry scans a row of waitlistEntryColumns
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var holdExpiresAt sql.NullTime
+	err := row.Scan(
+		&entry.ID, &entry.UserID, &entry.RestaurantID, &entry.InventoryItemID, &entry.OfferID,
+		&entry.ItemName, &entry.Quantity, &entry.Status, &holdExpiresAt, &entry.CreatedAt, &entry.UpdatedAt, &entry.Position,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if holdExpiresAt.Valid {
+		entry.HoldExpiresAt = &holdExpiresAt.Time
+	}
+	return &entry, nil
+}
+
+// JoinWaitlist puts a user in line for an inventory item or offer that is sold out
+// or not enough of it is left
+func (s *RestaurantService) JoinWaitlist(userID int, input JoinWaitlistInput) (*WaitlistEntry, error) {
+	target, err := newWaitlistTarget(input.InventoryItemID, input.OfferID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+	if input.Quantity < 0 || input.Quantity > MaxWaitlistQuantity {
+		return nil, fmt.Errorf("quantity must be between 1 and %d", MaxWaitlistQuantity)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stock, err := lockWaitlistStock(tx, target)
+	if err != nil {
+		return nil, err
+	}
+	if stock.expired {
+		return nil, errors.New("inventory item has expired")
+	}
+	if stock.onSale && (stock.unlimited || stock.free >= input.Quantity) {
+		return nil, ErrNotSoldOut
+	}
+
+	var waiting bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM waitlist_entries
+			WHERE `+target.column()+` = $1 AND user_id = $2 AND status IN ('waiting', 'held')
+		)
+	`, target.id(), userID).Scan(&waiting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlist entry: %w", err)
+	}
+	if waiting {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO waitlist_entries (user_id, restaurant_id, inventory_item_id, offer_id, quantity)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5)
+		RETURNING id
+	`, userID, stock.restaurantID, target.inventoryItemID, target.offerID, input.Quantity).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join waitlist: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetWaitlistEntry(userID, id)
+}
+
+// GetWaitlistEntry retrieves one of a user's waitlist entries
+func (s *RestaurantService) GetWaitlistEntry(userID, id int) (*WaitlistEntry, error) {
+	entry, err := scanWaitlistEntry(s.db.QueryRow(`
+		SELECT `+waitlistEntryColumns+`
+		FROM `+waitlistEntryTables+`
+		WHERE w.id = $1 AND w.user_id = $2
+	`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("waitlist entry not found")
+		}
+		return nil, fmt.Errorf("failed to get waitlist entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// GetUserWaitlists retrieves the waitlists a user is waiting in or holding stock
+// from, oldest first
+func (s *RestaurantService) GetUserWaitlists(userID int) ([]*WaitlistEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT `+waitlistEntryColumns+`
+		FROM `+waitlistEntryTables+`
+		WHERE w.user_id = $1
+		AND (w.status = 'waiting' OR (w.status = 'held' AND w.hold_expires_at > NOW()))
+		ORDER BY w.created_at, w.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waitlists: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*WaitlistEntry{}
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan waitlist entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// LeaveWaitlist takes a user out of a waitlist. Stock they were holding passes on
+// to the next in line.
+func (s *RestaurantService) LeaveWaitlist(userID, id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var target waitlistTarget
+	err = tx.QueryRow(`
+		SELECT status, COALESCE(inventory_item_id, 0), COALESCE(offer_id, 0) FROM waitlist_entries
+		WHERE id = $1 AND user_id = $2 AND status IN ('waiting', 'held')
+		FOR UPDATE
+	`, id, userID).Scan(&status, &target.inventoryItemID, &target.offerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("waitlist entry not found")
+		}
+		return fmt.Errorf("failed to get waitlist entry: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE waitlist_entries SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to leave waitlist: %w", err)
+	}
+
+	var holds []*WaitlistEntry
+	if status == WaitlistHeld {
+		holds, err = holdForWaitlist(tx, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, hold := range holds {
+		s.publishWaitlistHold(hold)
+	}
+
+	return nil
+}
+
+// ExpireWaitlistHolds passes on the stock of holds that weren't ordered in time.
+// It returns the number of inventory items and offers that had holds run out.
+func (s *RestaurantService) ExpireWaitlistHolds() (int, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT COALESCE(inventory_item_id, 0), COALESCE(offer_id, 0) FROM waitlist_entries
+		WHERE status = 'held' AND hold_expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired waitlist holds: %w", err)
+	}
+
+	var targets []waitlistTarget
+	for rows.Next() {
+		var target waitlistTarget
+		if err := rows.Scan(&target.inventoryItemID, &target.offerID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired waitlist hold: %w", err)
+		}
+		targets = append(targets, target)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read expired waitlist holds: %w", err)
+	}
+
+	expired := 0
+	for _, target := range targets {
+		if err := s.ReleaseStock(target.inventoryItemID, target.offerID); err != nil {
+			log.Printf("Failed to pass on expired waitlist holds for %s %d: %v", target.column(), target.id(), err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// StartWaitlistScheduler passes on expired waitlist holds every interval until the
+// returned stop function is called
+func (s *RestaurantService) StartWaitlistScheduler(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				expired, err := s.ExpireWaitlistHolds()
+				if err != nil {
+					log.Printf("Failed to expire waitlist holds: %v", err)
+				} else if expired > 0 {
+					log.Printf("Passed on expired waitlist holds for %d items", expired)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,468 @@
+package restaurantService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Waste report periods
+const (
+	WastePeriodDaily   = "daily"
+	WastePeriodWeekly  = "weekly"
+	WastePeriodMonthly = "monthly"
+)
+
+const (
+	// wasteRiskThreshold is the predicted unsold fraction at which an item is promoted
+	wasteRiskThreshold = 0.5
+	// wasteRiskHorizon is how close to expiry items are checked for waste risk
+	wasteRiskHorizon = 6 * time.Hour
+	// wasteRiskInterval is how often the scheduler re-predicts waste risk
+	wasteRiskInterval = 15 * time.Minute
+	// defaultUnitWeightKg is the weight of a unit whose category has no estimate
+	defaultUnitWeightKg = 0.35
+	// topWasteItems is how many items a waste report lists
+	topWasteItems = 5
+)
+
+// categoryUnitWeightsKg are typical weights of one unit, by lower-case category
+var categoryUnitWeightsKg = map[string]float64{
+	"bakery":     0.15,
+	"bread":      0.4,
+	"pastry":     0.1,
+	"pastries":   0.1,
+	"dessert":    0.15,
+	"desserts":   0.15,
+	"sandwich":   0.25,
+	"sandwiches": 0.25,
+	"salad":      0.3,
+	"salads":     0.3,
+	"soup":       0.4,
+	"main":       0.45,
+	"mains":      0.45,
+	"meal":       0.45,
+	"meals":      0.45,
+	"pizza":      0.5,
+	"side":       0.2,
+	"sides":      0.2,
+	"produce":    0.5,
+	"dairy":      0.5,
+	"drink":      0.35,
+	"drinks":     0.35,
+	"beverage":   0.35,
+	"beverages":  0.35,
+}
+
+// wastePeriodDefaults is how far back a report goes when no range is given
+var wastePeriodDefaults = map[string]func(until time.Time) time.Time{
+	WastePeriodDaily:   func(until time.Time) time.Time { return until.AddDate(0, 0, -14) },
+	WastePeriodWeekly:  func(until time.Time) time.Time { return until.AddDate(0, 0, -8*7) },
+	WastePeriodMonthly: func(until time.Time) time.Time { return until.AddDate(0, -6, 0) },
+}
+
+// WastePredictor estimates how much of an item's remaining quantity will go unsold.
+// known is false when there is not enough history to say.
+type WastePredictor interface {
+	PredictWaste(itemID int) (risk float64, known bool, err error)
+}
+
+// WasteEntry is what was left of an inventory item when it expired
+type WasteEntry struct {
+	ID              int       `json:"id"`
+	InventoryItemID *int      `json:"inventory_item_id"`
+	RestaurantID    int       `json:"restaurant_id"`
+	ItemName        string    `json:"item_name"`
+	Category        string    `json:"category"`
+	Quantity        int       `json:"quantity"`
+	WeightKg        float64   `json:"weight_kg"`
+	WeightEstimated bool      `json:"weight_estimated"`
+	ValueLost       float64   `json:"value_lost"`
+	RevenueLost     float64   `json:"revenue_lost"`
+	PredictedRisk   *float64  `json:"predicted_risk"`
+	ExpiredAt       time.Time `json:"expired_at"`
+	RecordedAt      time.Time `json:"recorded_at"`
+}
+
+// WasteTotals sums waste ledger entries
+type WasteTotals struct {
+	Items       int     `json:"items"`
+	Quantity    int     `json:"quantity"`
+	WeightKg    float64 `json:"weight_kg"`
+	ValueLost   float64 `json:"value_lost"`
+	RevenueLost float64 `json:"revenue_lost"`
+}
+
+// WasteBucket is the waste of one day, week or month
+type WasteBucket struct {
+	Start time.Time `json:"start"`
+	WasteTotals
+}
+
+// WasteItemTotal is the waste of one item name over a report
+type WasteItemTotal struct {
+	ItemName string `json:"item_name"`
+	Category string `json:"category"`
+	WasteTotals
+}
+
+// WasteReport summarises a restaurant's waste ledger by day, week or month
+type WasteReport struct {
+	RestaurantID int              `json:"restaurant_id"`
+	Period       string           `json:"period"`
+	From         time.Time        `json:"from"`
+	Until        time.Time        `json:"until"`
+	Totals       WasteTotals      `json:"totals"`
+	Buckets      []WasteBucket    `json:"buckets"`
+	TopItems     []WasteItemTotal `json:"top_items"`
+	AtRisk       []*InventoryItem `json:"at_risk"` // unexpired items predicted to go to waste
+}
+
+// SetWastePredictor sets the predictor used to flag items likely to go to waste
+func (s *RestaurantService) SetWastePredictor(predictor WastePredictor) {
+	s.wastePredictor = predictor
+}
+
+// EstimateUnitWeightKg returns the typical weight of one unit of a category
+func EstimateUnitWeightKg(category string) float64 {
+	if weight, ok := categoryUnitWeightsKg[strings.ToLower(strings.TrimSpace(category))]; ok {
+		return weight
+	}
+	return defaultUnitWeightKg
+}
+
+// RecordExpiredWaste snapshots the remaining quantity of every available item that
+// has expired by now into the waste ledger. Items already recorded for their current
+// expiry are skipped, so it is safe to run repeatedly. It returns the entries added.
+func (s *RestaurantService) RecordExpiredWaste(now time.Time) (int, error) {
+	rows, err := s.db.Query(`
+		SELECT ii.id, ii.restaurant_id, ii.name, COALESCE(ii.category, ''), ii.quantity,
+			ii.original_price, ii.surplus_price, ii.weight_kg, ii.waste_risk, ii.expiry_time
+		FROM inventory_items ii
+		WHERE ii.is_available = true AND ii.quantity > 0 AND ii.expiry_time <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM waste_ledger wl
+				WHERE wl.inventory_item_id = ii.id AND wl.expired_at = ii.expiry_time
+			)
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired items: %w", err)
+	}
+
+	var entries []WasteEntry
+	for rows.Next() {
+		var entry WasteEntry
+		var itemID int
+		var originalPrice, surplusPrice float64
+		var unitWeight, risk sql.NullFloat64
+		err := rows.Scan(&itemID, &entry.RestaurantID, &entry.ItemName, &entry.Category, &entry.Quantity,
+			&originalPrice, &surplusPrice, &unitWeight, &risk, &entry.ExpiredAt)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired item: %w", err)
+		}
+
+		entry.InventoryItemID = &itemID
+		if unitWeight.Valid && unitWeight.Float64 > 0 {
+			entry.WeightKg = unitWeight.Float64 * float64(entry.Quantity)
+		} else {
+			entry.WeightKg = EstimateUnitWeightKg(entry.Category) * float64(entry.Quantity)
+			entry.WeightEstimated = true
+		}
+		entry.ValueLost = originalPrice * float64(entry.Quantity)
+		entry.RevenueLost = surplusPrice * float64(entry.Quantity)
+		if risk.Valid {
+			entry.PredictedRisk = &risk.Float64
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get expired items: %w", err)
+	}
+
+	recorded := 0
+	for _, entry := range entries {
+		result, err := s.db.Exec(`
+			INSERT INTO waste_ledger (inventory_item_id, restaurant_id, item_name, category, quantity,
+				weight_kg, weight_estimated, value_lost, revenue_lost, predicted_risk, expired_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (inventory_item_id, expired_at) DO NOTHING
+		`, *entry.InventoryItemID, entry.RestaurantID, entry.ItemName, entry.Category, entry.Quantity,
+			entry.WeightKg, entry.WeightEstimated, entry.ValueLost, entry.RevenueLost, entry.PredictedRisk, entry.ExpiredAt)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to record waste for item %d: %w", *entry.InventoryItemID, err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+			recorded++
+		}
+	}
+
+	return recorded, nil
+}
+
+// FlagWasteRisks predicts waste for available items expiring within the next few
+// hours and flags those likely to go mostly unsold, which listings show first.
+// It returns the number of items flagged.
+func (s *RestaurantService) FlagWasteRisks(now time.Time) (int, error) {
+	if s.wastePredictor == nil {
+		return 0, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id FROM inventory_items
+		WHERE is_available = true AND quantity > 0 AND expiry_time > $1 AND expiry_time <= $2
+	`, now, now.Add(wasteRiskHorizon))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expiring items: %w", err)
+	}
+
+	var itemIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expiring item: %w", err)
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get expiring items: %w", err)
+	}
+
+	flagged := 0
+	for _, id := range itemIDs {
+		var risk *float64
+		atRisk := false
+
+		predicted, known, err := s.wastePredictor.PredictWaste(id)
+		if err != nil {
+			log.Printf("Failed to predict waste for item %d: %v", id, err)
+			continue
+		}
+		if known {
+			risk = &predicted
+			atRisk = predicted >= wasteRiskThreshold
+		}
+
+		_, err = s.db.Exec("UPDATE inventory_items SET waste_risk = $2, at_risk = $3 WHERE id = $1", id, risk, atRisk)
+		if err != nil {
+			return flagged, fmt.Errorf("failed to flag item %d: %w", id, err)
+		}
+		if atRisk {
+			flagged++
+		}
+	}
+
+	return flagged, nil
+}
+
+// StartWasteScheduler records expired items every interval, and re-predicts waste
+// risk every wasteRiskInterval, until the returned stop function is called
+func (s *RestaurantService) StartWasteScheduler(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		var lastFlagged time.Time
+		for {
+			select {
+			case now := <-ticker.C:
+				recorded, err := s.RecordExpiredWaste(now)
+				if err != nil {
+					log.Printf("Failed to record expired waste: %v", err)
+				} else if recorded > 0 {
+					log.Printf("Recorded %d expired items in the waste ledger", recorded)
+				}
+
+				if now.Sub(lastFlagged) >= wasteRiskInterval {
+					lastFlagged = now
+					if _, err := s.FlagWasteRisks(now); err != nil {
+						log.Printf("Failed to flag waste risks: %v", err)
+					}
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// GetWasteReport summarises a restaurant's waste between from and until by day,
+// week or month. Zero times default to the last 14 days, 8 weeks or 6 months.
+// Periods are UTC days, weeks and months.
+func (s *RestaurantService) GetWasteReport(restaurantID int, period string, from, until time.Time) (*WasteReport, error) {
+	defaultFrom, ok := wastePeriodDefaults[period]
+	if !ok {
+		return nil, errors.New("period must be daily, weekly or monthly")
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	if from.IsZero() {
+		from = defaultFrom(until)
+	}
+	if !until.After(from) {
+		return nil, errors.New("until must be after from")
+	}
+	from, until = from.UTC(), until.UTC()
+
+	report := &WasteReport{
+		RestaurantID: restaurantID,
+		Period:       period,
+		From:         from,
+		Until:        until,
+		Buckets:      []WasteBucket{},
+		TopItems:     []WasteItemTotal{},
+	}
+
+	// Every bucket in the range, so days without waste still show
+	buckets := map[string]*WasteBucket{}
+	for start := WastePeriodStart(period, from); start.Before(until); start = nextWastePeriod(period, start) {
+		report.Buckets = append(report.Buckets, WasteBucket{Start: start})
+	}
+	for i := range report.Buckets {
+		buckets[report.Buckets[i].Start.Format(dateLayout)] = &report.Buckets[i]
+	}
+
+	// expired_at holds UTC times; truncate them in UTC whatever the session time
+	// zone, so the buckets line up with WastePeriodStart's
+	rows, err := s.db.Query(`
+		SELECT date_trunc($2, expired_at AT TIME ZONE 'UTC', 'UTC'), COUNT(*), SUM(quantity), SUM(weight_kg), SUM(value_lost), SUM(revenue_lost)
+		FROM waste_ledger
+		WHERE restaurant_id = $1 AND expired_at >= $3 AND expired_at < $4
+		GROUP BY 1
+	`, restaurantID, wasteTruncUnit(period), from, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waste report: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var totals WasteTotals
+		if err := rows.Scan(&start, &totals.Items, &totals.Quantity, &totals.WeightKg, &totals.ValueLost, &totals.RevenueLost); err != nil {
+			return nil, fmt.Errorf("failed to scan waste report: %w", err)
+		}
+		if bucket, ok := buckets[start.UTC().Format(dateLayout)]; ok {
+			bucket.WasteTotals = totals
+		}
+		report.Totals.add(totals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get waste report: %w", err)
+	}
+
+	itemRows, err := s.db.Query(`
+		SELECT item_name, category, COUNT(*), SUM(quantity), SUM(weight_kg), SUM(value_lost), SUM(revenue_lost)
+		FROM waste_ledger
+		WHERE restaurant_id = $1 AND expired_at >= $2 AND expired_at < $3
+		GROUP BY item_name, category
+		ORDER BY SUM(value_lost) DESC, item_name
+		LIMIT $4
+	`, restaurantID, from, until, topWasteItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get most wasted items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item WasteItemTotal
+		err := itemRows.Scan(&item.ItemName, &item.Category, &item.Items, &item.Quantity, &item.WeightKg, &item.ValueLost, &item.RevenueLost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan most wasted item: %w", err)
+		}
+		report.TopItems = append(report.TopItems, item)
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get most wasted items: %w", err)
+	}
+
+	report.AtRisk, err = s.GetAtRiskItems(restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// GetAtRiskItems returns a restaurant's unexpired items flagged as likely waste,
+// the soonest to expire first
+func (s *RestaurantService) GetAtRiskItems(restaurantID int) ([]*InventoryItem, error) {
+	rows, err := s.db.Query(`
+		SELECT `+inventoryItemColumns+`
+		FROM inventory_items
+		WHERE restaurant_id = $1 AND at_risk = true AND is_available = true AND quantity > 0 AND expiry_time > NOW()
+		ORDER BY expiry_time
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get at-risk items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []*InventoryItem{}
+	for rows.Next() {
+		item, err := scanInventoryItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// add adds other to t
+func (t *WasteTotals) add(other WasteTotals) {
+	t.Items += other.Items
+	t.Quantity += other.Quantity
+	t.WeightKg += other.WeightKg
+	t.ValueLost += other.ValueLost
+	t.RevenueLost += other.RevenueLost
+}
+
+// WastePeriodStart returns the start of the UTC day, week (Monday) or month
+// containing t, matching Postgres date_trunc in UTC
+func WastePeriodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case WastePeriodWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case WastePeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextWastePeriod returns the start of the period after the one starting at start
+func nextWastePeriod(period string, start time.Time) time.Time {
+	switch period {
+	case WastePeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case WastePeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// wasteTruncUnit is the date_trunc unit for a report period
+func wasteTruncUnit(period string) string {
+	switch period {
+	case WastePeriodWeekly:
+		return "week"
+	case WastePeriodMonthly:
+		return "month"
+	default:
+		return "day"
+	}
+}
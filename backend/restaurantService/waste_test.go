@@ -0,0 +1,57 @@
+package restaurantService
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWastePeriodStart(t *testing.T) {
+	newYork := time.FixedZone("EDT", -4*60*60)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	tests := []struct {
+		name   string
+		period string
+		t      time.Time
+		want   time.Time
+	}{
+		{"daily", WastePeriodDaily, time.Date(2026, 6, 3, 15, 4, 5, 0, time.UTC), time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{"daily at midnight", WastePeriodDaily, time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC)},
+		// 22:00 in New York is already the next UTC day, 08:00 in Tokyo still the previous one
+		{"daily from a zone behind UTC", WastePeriodDaily, time.Date(2026, 6, 3, 22, 0, 0, 0, newYork), time.Date(2026, 6, 4, 0, 0, 0, 0, time.UTC)},
+		{"daily from a zone ahead of UTC", WastePeriodDaily, time.Date(2026, 6, 3, 8, 0, 0, 0, tokyo), time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"weekly midweek", WastePeriodWeekly, time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly on Monday", WastePeriodWeekly, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly on Sunday", WastePeriodWeekly, time.Date(2026, 6, 7, 23, 59, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly across a month", WastePeriodWeekly, time.Date(2026, 7, 2, 12, 0, 0, 0, time.UTC), time.Date(2026, 6, 29, 0, 0, 0, 0, time.UTC)},
+		{"weekly across a year", WastePeriodWeekly, time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC)},
+		{"weekly from a zone behind UTC", WastePeriodWeekly, time.Date(2026, 6, 7, 22, 0, 0, 0, newYork), time.Date(2026, 6, 8, 0, 0, 0, 0, time.UTC)},
+		{"monthly", WastePeriodMonthly, time.Date(2026, 6, 30, 23, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly from a zone behind UTC", WastePeriodMonthly, time.Date(2026, 6, 30, 23, 0, 0, 0, newYork), time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got := WastePeriodStart(test.period, test.t)
+		if !got.Equal(test.want) || got.Location() != time.UTC {
+			t.Errorf("%s: WastePeriodStart(%s) = %s, want %s", test.name, test.t.Format(time.RFC3339), got.Format(time.RFC3339), test.want.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestNextWastePeriod(t *testing.T) {
+	tests := []struct {
+		period string
+		start  time.Time
+		want   time.Time
+	}{
+		{WastePeriodDaily, time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC), time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{WastePeriodWeekly, time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{WastePeriodMonthly, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if got := nextWastePeriod(test.period, test.start); !got.Equal(test.want) {
+			t.Errorf("nextWastePeriod(%s, %s) = %s, want %s", test.period, test.start.Format(time.RFC3339), got.Format(time.RFC3339), test.want.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package searchService
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Phrases pulled out of free text, e.g. "sushi under $8 within 2km open now"
+var (
+	maxPricePattern    = regexp.MustCompile(`(?i)\b(?:under|below|less than|max|up to)\s*\$?\s*(\d+(?:\.\d+)?)\s*(?:dollars?|usd)?`)
+	radiusPattern      = regexp.MustCompile(`(?i)\b(?:within|in)\s+(\d+(?:\.\d+)?)\s*(km|kms|kilometers?|kilometres?|mi|miles?|m|meters?|metres?)\b`)
+	minDiscountPattern = regexp.MustCompile(`(?i)\b(?:at least\s+)?(\d{1,2})\s*%\s*off\b`)
+	openNowPattern     = regexp.MustCompile(`(?i)\b(?:open now|available now)\b`)
+	spacePattern       = regexp.MustCompile(`\s+`)
+)
+
+// ParseText splits free text into the words to search for and the filters it
+// spells out. Filters found in the text only fill in fields the query leaves unset.
+func ParseText(query SearchQuery) SearchQuery {
+	text := query.Text
+
+	if match := maxPricePattern.FindStringSubmatch(text); match != nil {
+		if price, err := strconv.ParseFloat(match[1], 64); err == nil && query.MaxPrice == nil {
+			query.MaxPrice = &price
+		}
+		text = strings.Replace(text, match[0], " ", 1)
+	}
+
+	if match := radiusPattern.FindStringSubmatch(text); match != nil {
+		if radius, err := strconv.ParseFloat(match[1], 64); err == nil && query.RadiusKm == 0 {
+			query.RadiusKm = radius * kmPerUnit(match[2])
+		}
+		text = strings.Replace(text, match[0], " ", 1)
+	}
+
+	if match := minDiscountPattern.FindStringSubmatch(text); match != nil {
+		if discount, err := strconv.ParseFloat(match[1], 64); err == nil && query.MinDiscount == nil {
+			query.MinDiscount = &discount
+		}
+		text = strings.Replace(text, match[0], " ", 1)
+	}
+
+	if openNowPattern.MatchString(text) {
+		query.OpenNow = true
+		text = openNowPattern.ReplaceAllString(text, " ")
+	}
+
+	query.Text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+	return query
+}
+
+// kmPerUnit converts a distance unit written in a query to kilometres
+func kmPerUnit(unit string) float64 {
+	switch strings.ToLower(unit) {
+	case "mi", "mile", "miles":
+		return 1.609344
+	case "m", "meter", "meters", "metre", "metres":
+		return 0.001
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,489 @@
+package searchService
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"surplus-supper/backend/geo"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of search result
+const (
+	KindRestaurant    = "restaurant"
+	KindInventoryItem = "inventory_item"
+	KindOffer         = "offer"
+)
+
+const (
+	// DefaultLimit is how many results are returned when no limit is given
+	DefaultLimit = 20
+	// MaxLimit is the most results returned at once
+	MaxLimit = 100
+	// MaxRadiusKm is the widest distance filter
+	MaxRadiusKm = 200
+	// defaultRadiusKm is how far away results are considered when a location is given
+	defaultRadiusKm = 10.0
+	// proximityScaleKm is the distance at which the proximity score falls to 1/e
+	proximityScaleKm = 2.0
+	// relevanceWeight is the share of relevance in the score when there's both
+	// text and a location; proximity makes up the rest
+	relevanceWeight = 0.6
+)
+
+// ErrInvalidQuery is returned for a search with contradictory or out-of-range filters
+var ErrInvalidQuery = errors.New("invalid search")
+
+// SearchQuery is a search across restaurants, inventory items and offers. Price and
+// discount filters only apply to items and offers, and expiry only to items, so
+// kinds a filter can't apply to are left out when it's set.
+type SearchQuery struct {
+	Text      string   `json:"text"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	RadiusKm  float64  `json:"radius_km"`
+	MinPrice  *float64 `json:"min_price"`
+	MaxPrice  *float64 `json:"max_price"`
+	// MinDiscount is the smallest discount off the original price, in percent
+	MinDiscount *float64 `json:"min_discount"`
+	// Cuisines match restaurants' cuisine_type, case-insensitively
+	Cuisines []string `json:"cuisines"`
+	// ExpiresWithin keeps inventory items expiring within this long
+	ExpiresWithin time.Duration `json:"-"`
+	// OpenNow keeps results from restaurants open now, by their opening hours
+	OpenNow bool `json:"open_now"`
+	// Kinds limits the kinds of result, all kinds when empty
+	Kinds []string `json:"kinds"`
+	Limit int      `json:"limit"`
+}
+
+// SearchResult is a restaurant, inventory item or offer matching a search
+type SearchResult struct {
+	Kind            string     `json:"kind"`
+	ID              int        `json:"id"`
+	RestaurantID    int        `json:"restaurant_id"`
+	RestaurantName  string     `json:"restaurant_name"`
+	CuisineType     string     `json:"cuisine_type,omitempty"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	OriginalPrice   *float64   `json:"original_price,omitempty"`
+	SurplusPrice    *float64   `json:"surplus_price,omitempty"`
+	DiscountPercent *float64   `json:"discount_percent,omitempty"`
+	ExpiryTime      *time.Time `json:"expiry_time,omitempty"`
+	Latitude        float64    `json:"latitude"`
+	Longitude       float64    `json:"longitude"`
+	DistanceKm      *float64   `json:"distance_km,omitempty"`
+	Relevance       float64    `json:"relevance"`
+	Score           float64    `json:"score"`
+}
+
+// SearchResponse is the results of a search and the query they were found with,
+// after filters were read from the text
+type SearchResponse struct {
+	Query   SearchQuery     `json:"query"`
+	Results []*SearchResult `json:"results"`
+}
+
+// SearchService searches restaurants, inventory items and offers
+type SearchService struct {
+	db *sql.DB
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(db *sql.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+// Search finds restaurants, inventory items and offers matching the text with
+// Postgres full-text search and the query's filters. Results are ranked by text
+// relevance and closeness: each kind is ranked and cut off in SQL, then merged.
+// Without text or a location, items and offers are ranked by discount.
+func (s *SearchService) Search(query SearchQuery) (*SearchResponse, error) {
+	query = ParseText(query)
+	if err := normalize(&query); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := []*SearchResult{}
+	for _, kind := range query.Kinds {
+		var found []*SearchResult
+		var err error
+		switch kind {
+		case KindRestaurant:
+			found, err = s.searchRestaurants(query, now)
+		case KindInventoryItem:
+			found, err = s.searchInventoryItems(query, now)
+		case KindOffer:
+			found, err = s.searchOffers(query, now)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return &SearchResponse{Query: query, Results: results}, nil
+}
+
+// normalize checks a query's filters and fills in defaults
+func normalize(query *SearchQuery) error {
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit > MaxLimit {
+		query.Limit = MaxLimit
+	}
+
+	if (query.Latitude == nil) != (query.Longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be given together", ErrInvalidQuery)
+	}
+	if query.Latitude != nil {
+		if !geo.ValidCoordinates(*query.Latitude, *query.Longitude) {
+			return fmt.Errorf("%w: invalid coordinates", ErrInvalidQuery)
+		}
+		if query.RadiusKm == 0 {
+			query.RadiusKm = defaultRadiusKm
+		}
+	}
+	if query.RadiusKm < 0 || query.RadiusKm > MaxRadiusKm {
+		return fmt.Errorf("%w: radius must be between 0 and %d km", ErrInvalidQuery, MaxRadiusKm)
+	}
+
+	if (query.MinPrice != nil && *query.MinPrice < 0) || (query.MaxPrice != nil && *query.MaxPrice < 0) {
+		return fmt.Errorf("%w: prices can't be negative", ErrInvalidQuery)
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return fmt.Errorf("%w: min price is above max price", ErrInvalidQuery)
+	}
+	if query.MinDiscount != nil && (*query.MinDiscount < 0 || *query.MinDiscount > 100) {
+		return fmt.Errorf("%w: discount must be between 0 and 100", ErrInvalidQuery)
+	}
+	if query.ExpiresWithin < 0 {
+		return fmt.Errorf("%w: expiry window can't be negative", ErrInvalidQuery)
+	}
+
+	cuisines := query.Cuisines[:0]
+	for _, cuisine := range query.Cuisines {
+		if cuisine = strings.ToLower(strings.TrimSpace(cuisine)); cuisine != "" {
+			cuisines = append(cuisines, cuisine)
+		}
+	}
+	query.Cuisines = cuisines
+
+	if len(query.Kinds) == 0 {
+		query.Kinds = []string{KindRestaurant, KindInventoryItem, KindOffer}
+	}
+	listingFilters := query.MinPrice != nil || query.MaxPrice != nil || query.MinDiscount != nil || query.ExpiresWithin > 0
+	kinds := []string{}
+	for _, kind := range query.Kinds {
+		switch kind {
+		case KindRestaurant:
+			if listingFilters {
+				continue
+			}
+		case KindOffer:
+			if query.ExpiresWithin > 0 {
+				continue
+			}
+		case KindInventoryItem:
+		default:
+			return fmt.Errorf("%w: unknown kind %q", ErrInvalidQuery, kind)
+		}
+		kinds = append(kinds, kind)
+	}
+	query.Kinds = kinds
+
+	return nil
+}
+
+// searchSQL builds one kind's search. Conditions and ranking are added as the
+// query is built, with arguments numbered in the order they're added.
+type searchSQL struct {
+	query      SearchQuery
+	args       []interface{}
+	conditions []string
+	// textQuery is the tsquery parameter, empty when there's no text
+	textQuery string
+	relevance string
+	distance  string
+}
+
+func newSearchSQL(query SearchQuery) *searchSQL {
+	b := &searchSQL{query: query, relevance: "0", distance: "NULL::float8"}
+	if query.Text != "" {
+		b.textQuery = fmt.Sprintf("websearch_to_tsquery('english', %s)", b.arg(query.Text))
+	}
+	return b
+}
+
+// arg adds an argument and returns its placeholder
+func (b *searchSQL) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *searchSQL) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// matchText keeps rows where any of the vectors matches the text and ranks them.
+// Each vector has a weight, e.g. a restaurant's cuisine counts for less on its items.
+func (b *searchSQL) matchText(vectors map[string]float64) {
+	if b.textQuery == "" {
+		return
+	}
+	columns := make([]string, 0, len(vectors))
+	for column := range vectors {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var matches, ranks []string
+	for _, column := range columns {
+		matches = append(matches, fmt.Sprintf("%s @@ %s", column, b.textQuery))
+		// Normalization 32 scales the rank into [0, 1)
+		ranks = append(ranks, fmt.Sprintf("%g * ts_rank_cd(%s, %s, 32)", vectors[column], column, b.textQuery))
+	}
+	b.where("(" + strings.Join(matches, " OR ") + ")")
+	if len(ranks) == 1 {
+		b.relevance = ranks[0]
+	} else {
+		b.relevance = "GREATEST(" + strings.Join(ranks, ", ") + ")"
+	}
+}
+
+// near keeps rows within the radius, using the bounding box on the restaurant's
+// location before computing distances
+func (b *searchSQL) near(latColumn, lonColumn string) {
+	if b.query.Latitude == nil {
+		return
+	}
+	lat, lon := *b.query.Latitude, *b.query.Longitude
+	box, boxArgs := geo.BoundingBoxAround(lat, lon, b.query.RadiusKm).SQL(latColumn, lonColumn, len(b.args)+1)
+	b.args = append(b.args, boxArgs...)
+	b.where(box)
+	b.distance = geo.DistanceSQL(latColumn, lonColumn, b.arg(lat), b.arg(lon))
+}
+
+// cuisines keeps rows whose restaurant serves one of the query's cuisines
+func (b *searchSQL) cuisines(column string) {
+	if len(b.query.Cuisines) > 0 {
+		b.where(fmt.Sprintf("LOWER(%s) = ANY(%s)", column, b.arg(pq.Array(b.query.Cuisines))))
+	}
+}
+
+// openAt keeps rows whose restaurant is open at now when the query asks for it
+func (b *searchSQL) openAt(now time.Time) {
+	if b.query.OpenNow {
+		b.where(fmt.Sprintf("restaurant_is_open(r.id, %s)", b.arg(now)))
+	}
+}
+
+// prices keeps rows within the query's price and discount filters
+func (b *searchSQL) prices(table string) {
+	if b.query.MinPrice != nil {
+		b.where(fmt.Sprintf("%s.surplus_price >= %s", table, b.arg(*b.query.MinPrice)))
+	}
+	if b.query.MaxPrice != nil {
+		b.where(fmt.Sprintf("%s.surplus_price <= %s", table, b.arg(*b.query.MaxPrice)))
+	}
+	if b.query.MinDiscount != nil {
+		b.where(fmt.Sprintf("%[1]s.original_price > 0 AND (1 - %[1]s.surplus_price / %[1]s.original_price) * 100 >= %[2]s",
+			table, b.arg(*b.query.MinDiscount)))
+	}
+}
+
+// build wraps the selected columns so relevance and distance are computed once,
+// then filters on the radius and orders by score. fallback is the SQL for the
+// score used without text or a location.
+func (b *searchSQL) build(columns, from, fallback string) string {
+	limit := b.arg(b.query.Limit)
+	radius := "true"
+	if b.query.Latitude != nil {
+		radius = "distance <= " + b.arg(b.query.RadiusKm)
+	}
+
+	return fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT %s, %s AS relevance, %s AS distance, %s AS fallback
+			FROM %s
+			WHERE %s
+		) found
+		WHERE %s
+		ORDER BY %s DESC, id
+		LIMIT %s
+	`, columns, b.relevance, b.distance, fallback, from, strings.Join(b.conditions, " AND "), radius, scoreSQL(b.query), limit)
+}
+
+// scoreSQL is score in SQL, over the columns build selects
+func scoreSQL(query SearchQuery) string {
+	proximity := fmt.Sprintf("exp(-distance / %g)", proximityScaleKm)
+	switch {
+	case query.Text != "" && query.Latitude != nil:
+		return fmt.Sprintf("(%g * relevance + %g * %s)", relevanceWeight, 1-relevanceWeight, proximity)
+	case query.Text != "":
+		return "relevance"
+	case query.Latitude != nil:
+		return proximity
+	default:
+		return "fallback"
+	}
+}
+
+// score combines a result's relevance and distance the way scoreSQL does
+func score(query SearchQuery, relevance float64, distance *float64, fallback float64) float64 {
+	proximity := 0.0
+	if distance != nil {
+		proximity = math.Exp(-*distance / proximityScaleKm)
+	}
+	switch {
+	case query.Text != "" && query.Latitude != nil:
+		return relevanceWeight*relevance + (1-relevanceWeight)*proximity
+	case query.Text != "":
+		return relevance
+	case query.Latitude != nil:
+		return proximity
+	default:
+		return fallback
+	}
+}
+
+// discountSQL is an item or offer's discount as a fraction of its original price
+func discountSQL(table string) string {
+	return fmt.Sprintf("CASE WHEN %[1]s.original_price > 0 THEN 1 - %[1]s.surplus_price / %[1]s.original_price ELSE 0 END", table)
+}
+
+func (s *SearchService) searchRestaurants(query SearchQuery, now time.Time) ([]*SearchResult, error) {
+	b := newSearchSQL(query)
+	b.where("r.is_active = true")
+	b.openAt(now)
+	b.matchText(map[string]float64{"r.search_vector": 1})
+	b.near("r.latitude", "r.longitude")
+	b.cuisines("r.cuisine_type")
+
+	rows, err := s.db.Query(b.build(
+		`r.id, r.id AS restaurant_id, r.name AS restaurant_name, COALESCE(r.cuisine_type, '') AS cuisine_type,
+		 r.name, COALESCE(r.description, '') AS description, '' AS category,
+		 NULL::float8 AS original_price, NULL::float8 AS surplus_price, NULL::timestamp AS expiry_time,
+		 r.latitude, r.longitude`,
+		"restaurants r", "COALESCE(r.rating, 0) / 5",
+	), b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search restaurants: %w", err)
+	}
+	defer rows.Close()
+	return scanResults(rows, KindRestaurant, query)
+}
+
+func (s *SearchService) searchInventoryItems(query SearchQuery, now time.Time) ([]*SearchResult, error) {
+	b := newSearchSQL(query)
+	b.where("r.is_active = true AND i.is_available = true AND i.quantity > 0")
+	b.where(fmt.Sprintf("(i.expiry_time IS NULL OR i.expiry_time > %s)", b.arg(now)))
+	if query.ExpiresWithin > 0 {
+		b.where(fmt.Sprintf("i.expiry_time <= %s", b.arg(now.Add(query.ExpiresWithin))))
+	}
+	b.openAt(now)
+	// A match on the restaurant, e.g. its cuisine, counts for half a match on the item
+	b.matchText(map[string]float64{"i.search_vector": 1, "r.search_vector": 0.5})
+	b.near("r.latitude", "r.longitude")
+	b.cuisines("r.cuisine_type")
+	b.prices("i")
+
+	rows, err := s.db.Query(b.build(
+		`i.id, i.restaurant_id, r.name AS restaurant_name, COALESCE(r.cuisine_type, '') AS cuisine_type,
+		 i.name, COALESCE(i.description, '') AS description, COALESCE(i.category, '') AS category,
+		 i.original_price::float8, i.surplus_price::float8, i.expiry_time,
+		 r.latitude, r.longitude`,
+		"inventory_items i JOIN restaurants r ON r.id = i.restaurant_id", discountSQL("i"),
+	), b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search inventory items: %w", err)
+	}
+	defer rows.Close()
+	return scanResults(rows, KindInventoryItem, query)
+}
+
+func (s *SearchService) searchOffers(query SearchQuery, now time.Time) ([]*SearchResult, error) {
+	b := newSearchSQL(query)
+	b.where("r.is_active = true AND o.is_available = true AND (o.quantity IS NULL OR o.quantity > 0)")
+	b.openAt(now)
+	b.matchText(map[string]float64{"o.search_vector": 1, "r.search_vector": 0.5})
+	b.near("r.latitude", "r.longitude")
+	b.cuisines("r.cuisine_type")
+	b.prices("o")
+
+	rows, err := s.db.Query(b.build(
+		`o.id, o.restaurant_id, r.name AS restaurant_name, COALESCE(r.cuisine_type, '') AS cuisine_type,
+		 o.name, COALESCE(o.description, '') AS description, o.offer_type AS category,
+		 o.original_price::float8, o.surplus_price::float8, NULL::timestamp AS expiry_time,
+		 r.latitude, r.longitude`,
+		"offers o JOIN restaurants r ON r.id = o.restaurant_id", discountSQL("o"),
+	), b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search offers: %w", err)
+	}
+	defer rows.Close()
+	return scanResults(rows, KindOffer, query)
+}
+
+// scanResults scans rows selected by searchSQL.build
+func scanResults(rows *sql.Rows, kind string, query SearchQuery) ([]*SearchResult, error) {
+	var results []*SearchResult
+	for rows.Next() {
+		result := SearchResult{Kind: kind}
+		var originalPrice, surplusPrice, distance sql.NullFloat64
+		var expiry sql.NullTime
+		var fallback float64
+		err := rows.Scan(
+			&result.ID, &result.RestaurantID, &result.RestaurantName, &result.CuisineType,
+			&result.Name, &result.Description, &result.Category,
+			&originalPrice, &surplusPrice, &expiry,
+			&result.Latitude, &result.Longitude, &result.Relevance, &distance, &fallback,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		if originalPrice.Valid && surplusPrice.Valid {
+			result.OriginalPrice, result.SurplusPrice = &originalPrice.Float64, &surplusPrice.Float64
+			if originalPrice.Float64 > 0 {
+				discount := math.Round((1-surplusPrice.Float64/originalPrice.Float64)*1000) / 10
+				result.DiscountPercent = &discount
+			}
+		}
+		if expiry.Valid {
+			result.ExpiryTime = &expiry.Time
+		}
+		if distance.Valid {
+			result.DistanceKm = &distance.Float64
+		}
+		result.Score = score(query, result.Relevance, result.DistanceKm, fallback)
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search %ss: %w", kind, err)
+	}
+	return results, nil
+}
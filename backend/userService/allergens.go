@@ -0,0 +1,84 @@
+package userService
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Allergens are the allergens a user can list in their profile. Creative Kitchen
+// keeps recipes for the user free of them.
+var Allergens = []string{"milk", "eggs", "fish", "shellfish", "tree_nuts", "peanuts", "gluten", "soy", "sesame"}
+
+// NormalizeAllergens lower-cases, de-duplicates and sorts allergens, rejecting unknown ones
+func NormalizeAllergens(allergens []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, allergen := range allergens {
+		allergen = strings.ToLower(strings.TrimSpace(allergen))
+		known := false
+		for _, candidate := range Allergens {
+			if allergen == candidate {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown allergen %q, expected one of %s", allergen, strings.Join(Allergens, ", "))
+		}
+		if !seen[allergen] {
+			seen[allergen] = true
+			normalized = append(normalized, allergen)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// GetAllergens retrieves a user's allergen profile
+func (s *UserService) GetAllergens(userID int) ([]string, error) {
+	rows, err := s.db.Query("SELECT allergen FROM user_allergens WHERE user_id = $1 ORDER BY allergen", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allergens: %w", err)
+	}
+	defer rows.Close()
+
+	allergens := []string{}
+	for rows.Next() {
+		var allergen string
+		if err := rows.Scan(&allergen); err != nil {
+			return nil, fmt.Errorf("failed to scan allergen: %w", err)
+		}
+		allergens = append(allergens, allergen)
+	}
+
+	return allergens, nil
+}
+
+// UpdateAllergens replaces a user's allergen profile
+func (s *UserService) UpdateAllergens(userID int, allergens []string) ([]string, error) {
+	allergens, err := NormalizeAllergens(allergens)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_allergens WHERE user_id = $1", userID); err != nil {
+		return nil, fmt.Errorf("failed to clear allergens: %w", err)
+	}
+	for _, allergen := range allergens {
+		if _, err := tx.Exec("INSERT INTO user_allergens (user_id, allergen) VALUES ($1, $2)", userID, allergen); err != nil {
+			return nil, fmt.Errorf("failed to save allergen: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return allergens, nil
+}
@@ -0,0 +1,165 @@
+package userService
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCategoryLength matches favorite_categories.category
+const maxCategoryLength = 100
+
+// FavoriteRestaurant is a restaurant a user follows
+type FavoriteRestaurant struct {
+	RestaurantID int       `json:"restaurant_id"`
+	Name         string    `json:"name"`
+	Address      string    `json:"address"`
+	CuisineType  string    `json:"cuisine_type"`
+	Rating       float64   `json:"rating"`
+	IsActive     bool      `json:"is_active"`
+	FavoritedAt  time.Time `json:"favorited_at"`
+}
+
+// NormalizeCategory trims and lower-cases an item category
+func NormalizeCategory(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return "", errors.New("category is required")
+	}
+	if utf8.RuneCountInString(category) > maxCategoryLength {
+		return "", fmt.Errorf("category can't be longer than %d characters", maxCategoryLength)
+	}
+	return category, nil
+}
+
+// GetFavoriteRestaurants retrieves the restaurants a user follows, most recent first
+func (s *UserService) GetFavoriteRestaurants(userID int) ([]*FavoriteRestaurant, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id, r.name, r.address, COALESCE(r.cuisine_type, ''), COALESCE(r.rating, 0), r.is_active, f.created_at
+		FROM favorite_restaurants f
+		JOIN restaurants r ON r.id = f.restaurant_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at DESC, r.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorite restaurants: %w", err)
+	}
+	defer rows.Close()
+
+	favorites := []*FavoriteRestaurant{}
+	for rows.Next() {
+		var favorite FavoriteRestaurant
+		err := rows.Scan(&favorite.RestaurantID, &favorite.Name, &favorite.Address, &favorite.CuisineType, &favorite.Rating, &favorite.IsActive, &favorite.FavoritedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan favorite restaurant: %w", err)
+		}
+		favorites = append(favorites, &favorite)
+	}
+
+	return favorites, nil
+}
+
+// AddFavoriteRestaurant makes a user follow a restaurant. Following it again is a no-op.
+func (s *UserService) AddFavoriteRestaurant(userID, restaurantID int) error {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM restaurants WHERE id = $1 AND is_active = true)", restaurantID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get restaurant: %w", err)
+	}
+	if !exists {
+		return errors.New("restaurant not found")
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO favorite_restaurants (user_id, restaurant_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, restaurant_id) DO NOTHING
+	`, userID, restaurantID)
+	if err != nil {
+		return fmt.Errorf("failed to add favorite restaurant: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFavoriteRestaurant makes a user stop following a restaurant
+func (s *UserService) RemoveFavoriteRestaurant(userID, restaurantID int) error {
+	result, err := s.db.Exec("DELETE FROM favorite_restaurants WHERE user_id = $1 AND restaurant_id = $2", userID, restaurantID)
+	if err != nil {
+		return fmt.Errorf("failed to remove favorite restaurant: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("favorite restaurant not found")
+	}
+
+	return nil
+}
+
+// GetFavoriteCategories retrieves a user's favorite item categories
+func (s *UserService) GetFavoriteCategories(userID int) ([]string, error) {
+	rows, err := s.db.Query("SELECT category FROM favorite_categories WHERE user_id = $1 ORDER BY category", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorite categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, fmt.Errorf("failed to scan favorite category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+// AddFavoriteCategory adds an item category to a user's favorites. Adding it again is a no-op.
+func (s *UserService) AddFavoriteCategory(userID int, category string) error {
+	category, err := NormalizeCategory(category)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO favorite_categories (user_id, category) VALUES ($1, $2)
+		ON CONFLICT (user_id, category) DO NOTHING
+	`, userID, category)
+	if err != nil {
+		return fmt.Errorf("failed to add favorite category: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFavoriteCategory removes an item category from a user's favorites
+func (s *UserService) RemoveFavoriteCategory(userID int, category string) error {
+	category, err := NormalizeCategory(category)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("DELETE FROM favorite_categories WHERE user_id = $1 AND category = $2", userID, category)
+	if err != nil {
+		return fmt.Errorf("failed to remove favorite category: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("favorite category not found")
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ type User struct {
 	Address   string    `json:"address"`
 	Latitude  float64   `json:"latitude"`
 	Longitude float64   `json:"longitude"`
+	Locale    string    `json:"locale"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -33,6 +34,7 @@ type CreateUserInput struct {
 	Address   string  `json:"address"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	Locale    string  `json:"locale"`
 }
 
 // UpdateUserInput represents the input for updating a user
@@ -43,6 +45,7 @@ type UpdateUserInput struct {
 	Address   string  `json:"address"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	Locale    string  `json:"locale"`
 }
 
 // LoginInput represents the input for user login
@@ -82,11 +85,11 @@ func (s *UserService) CreateUser(input CreateUserInput) (*User, error) {
 	// Insert user
 	var user User
 	err = s.db.QueryRow(`
-		INSERT INTO users (email, password_hash, first_name, last_name, phone, address, latitude, longitude)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, email, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
-	`, input.Email, string(hashedPassword), input.FirstName, input.LastName, input.Phone, input.Address, input.Latitude, input.Longitude).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+		INSERT INTO users (email, password_hash, first_name, last_name, phone, address, latitude, longitude, locale)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'en'))
+		RETURNING id, email, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
+	`, input.Email, string(hashedPassword), input.FirstName, input.LastName, input.Phone, input.Address, input.Latitude, input.Longitude, input.Locale).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -99,10 +102,10 @@ func (s *UserService) CreateUser(input CreateUserInput) (*User, error) {
 func (s *UserService) GetUserByID(id int) (*User, error) {
 	var user User
 	err := s.db.QueryRow(`
-		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
+		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
 		FROM users WHERE id = $1
 	`, id).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -118,10 +121,10 @@ func (s *UserService) GetUserByID(id int) (*User, error) {
 func (s *UserService) GetUserByEmail(email string) (*User, error) {
 	var user User
 	err := s.db.QueryRow(`
-		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
+		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
 		FROM users WHERE email = $1
 	`, email).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -144,14 +147,15 @@ func (s *UserService) UpdateUser(id int, input UpdateUserInput) (*User, error) {
 		address = COALESCE($5, address),
 		latitude = COALESCE($6, latitude),
 		longitude = COALESCE($7, longitude),
+		locale = COALESCE(NULLIF($8, ''), locale),
 		updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
-		RETURNING id, email, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
+		RETURNING id, email, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
 	`
 
 	var user User
-	err := s.db.QueryRow(query, id, input.FirstName, input.LastName, input.Phone, input.Address, input.Latitude, input.Longitude).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+	err := s.db.QueryRow(query, id, input.FirstName, input.LastName, input.Phone, input.Address, input.Latitude, input.Longitude, input.Locale).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -188,10 +192,10 @@ func (s *UserService) AuthenticateUser(input LoginInput) (*User, error) {
 	var passwordHash string
 
 	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
+		SELECT id, email, password_hash, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
 		FROM users WHERE email = $1
 	`, input.Email).Scan(
-		&user.ID, &user.Email, &passwordHash, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &passwordHash, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -212,7 +216,7 @@ func (s *UserService) AuthenticateUser(input LoginInput) (*User, error) {
 // GetAllUsers retrieves all users (for admin purposes)
 func (s *UserService) GetAllUsers() ([]*User, error) {
 	rows, err := s.db.Query(`
-		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, created_at, updated_at
+		SELECT id, email, first_name, last_name, phone, address, latitude, longitude, locale, created_at, updated_at
 		FROM users ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -224,7 +228,7 @@ func (s *UserService) GetAllUsers() ([]*User, error) {
 	for rows.Next() {
 		var user User
 		err := rows.Scan(
-			&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.CreatedAt, &user.UpdatedAt,
+			&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Phone, &user.Address, &user.Latitude, &user.Longitude, &user.Locale, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
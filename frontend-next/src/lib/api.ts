@@ -13,8 +13,86 @@ export interface Restaurant {
   email: string
   cuisine_type: string
   rating: number
+  review_count?: number
   distance: number
   surplus_items?: string[]
+  is_open_now?: boolean
+  next_open?: string
+}
+
+export interface Review {
+  id: number
+  restaurant_id: number
+  author_name: string
+  rating: number
+  text: string
+  is_hidden: boolean
+  report_count: number
+  owner_reply?: string
+  replied_at?: string
+  created_at: string
+  updated_at: string
+}
+
+export interface RestaurantReviews {
+  summary: {
+    rating: number
+    review_count: number
+    distribution: Record<string, number>
+  }
+  reviews: Review[]
+}
+
+export type RestaurantSort = 'distance' | 'rating' | 'discount' | 'expiry' | 'price'
+
+export interface Facet {
+  value: string
+  label: string
+  count: number
+}
+
+export interface RestaurantListingPage {
+  restaurants: (Omit<Restaurant, 'distance'> & {
+    distance_km?: number
+    best_discount_percent?: number
+    soonest_expiry?: string
+    cheapest_price?: number
+    listings: number
+    offer_types: string[]
+  })[]
+  facets: {
+    cuisines: Facet[]
+    price_buckets: Facet[]
+    offer_types: Facet[]
+  }
+  sort: RestaurantSort
+  next_cursor?: string
+  has_more: boolean
+}
+
+export interface MapFeatureProperties {
+  cluster: boolean
+  available_items: number
+  best_discount_percent: number | null
+  // restaurants
+  restaurant_id?: number
+  name?: string
+  cuisine_type?: string
+  // clusters
+  point_count?: number
+  expansion_zoom?: number
+}
+
+export interface RestaurantMapFeature {
+  type: 'Feature'
+  id: number | string
+  geometry: { type: 'Point'; coordinates: [number, number] }
+  properties: MapFeatureProperties
+}
+
+export interface RestaurantMap {
+  type: 'FeatureCollection'
+  features: RestaurantMapFeature[]
 }
 
 export interface InventoryItem {
@@ -30,7 +108,7 @@ export interface InventoryItem {
 }
 
 export const api = {
-  async getRestaurants(lat?: number, lng?: number, location?: string): Promise<Restaurant[]> {
+  async getRestaurants(lat?: number, lng?: number, location?: string, sort?: RestaurantSort): Promise<Restaurant[]> {
     try {
       const params = new URLSearchParams()
       if (lat && lng) {
@@ -40,6 +118,9 @@ export const api = {
       if (location) {
         params.append('location', location)
       }
+      if (sort) {
+        params.append('sort', sort)
+      }
 
       const url = `${API_BASE}/api/restaurants?${params}`
       console.log('Making request to:', url)
@@ -55,7 +136,11 @@ export const api = {
       }
 
       try {
-        return JSON.parse(text)
+        const page: RestaurantListingPage = JSON.parse(text)
+        return page.restaurants.map((restaurant) => ({
+          ...restaurant,
+          distance: restaurant.distance_km ?? 0,
+        }))
       } catch (e) {
         console.error('Failed to parse JSON:', e)
         throw new Error('Invalid JSON response from server')
@@ -66,6 +151,25 @@ export const api = {
     }
   },
 
+  async getRestaurantMap(
+    bounds: { west: number; south: number; east: number; north: number },
+    zoom: number,
+    availableOnly = false,
+  ): Promise<RestaurantMap> {
+    const params = new URLSearchParams({
+      bbox: [bounds.west, bounds.south, bounds.east, bounds.north].join(','),
+      zoom: Math.round(zoom).toString(),
+    })
+    if (availableOnly) {
+      params.append('available_only', 'true')
+    }
+    const response = await fetch(`${API_BASE}/api/restaurants/map?${params.toString()}`)
+    if (!response.ok) {
+      throw new Error('Failed to fetch restaurant map')
+    }
+    return response.json()
+  },
+
   async getRestaurant(id: number): Promise<{ restaurant: Restaurant; inventory: InventoryItem[] }> {
     const response = await fetch(`${API_BASE}/api/restaurant/${id}`)
     if (!response.ok) {
@@ -74,6 +178,15 @@ export const api = {
     return response.json()
   },
 
+  async getRestaurantReviews(id: number, limit = 20, offset = 0): Promise<RestaurantReviews> {
+    const params = new URLSearchParams({ limit: limit.toString(), offset: offset.toString() })
+    const response = await fetch(`${API_BASE}/api/restaurant/${id}/reviews?${params.toString()}`)
+    if (!response.ok) {
+      throw new Error('Failed to fetch reviews')
+    }
+    return response.json()
+  },
+
   async createOrder(orderData: Record<string, unknown>): Promise<Record<string, unknown>> {
     const response = await fetch(`${API_BASE}/api/order/confirm`, {
       method: 'POST',